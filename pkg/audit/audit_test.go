@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const auditLog = `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"a1","stage":"RequestReceived","requestURI":"/api/v1/namespaces/shop/pods/web-1/exec?command=sh&command=-c&command=id&container=web&stdin=true","verb":"create","user":{"username":"alice"},"sourceIPs":["10.0.0.5"],"objectRef":{"resource":"pods","namespace":"shop","name":"web-1","apiVersion":"v1","subresource":"exec"},"requestReceivedTimestamp":"2026-10-01T10:00:00.000000Z","stageTimestamp":"2026-10-01T10:00:00.000000Z"}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"a1","stage":"ResponseStarted","requestURI":"/api/v1/namespaces/shop/pods/web-1/exec?command=sh&command=-c&command=id&container=web&stdin=true","verb":"create","user":{"username":"alice"},"sourceIPs":["10.0.0.5"],"objectRef":{"resource":"pods","namespace":"shop","name":"web-1","apiVersion":"v1","subresource":"exec"},"responseStatus":{"code":101},"requestReceivedTimestamp":"2026-10-01T10:00:00.000000Z","stageTimestamp":"2026-10-01T10:00:00.100000Z"}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"b2","stage":"ResponseComplete","requestURI":"/api/v1/secrets","verb":"list","user":{"username":"system:serviceaccount:ci:runner"},"sourceIPs":["192.168.1.20"],"objectRef":{"resource":"secrets","apiVersion":"v1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2026-10-01T09:00:00.000000Z","stageTimestamp":"2026-10-01T09:00:00.200000Z"}
+{"truncated
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Request","auditID":"c3","stage":"ResponseComplete","requestURI":"/apis/rbac.authorization.k8s.io/v1/clusterrolebindings","verb":"create","user":{"username":"alice"},"impersonatedUser":{"username":"bob"},"sourceIPs":["10.0.0.5"],"objectRef":{"resource":"clusterrolebindings","name":"pwn","apiGroup":"rbac.authorization.k8s.io","apiVersion":"v1"},"responseStatus":{"code":201},"requestObject":{"kind":"ClusterRoleBinding","roleRef":{"kind":"ClusterRole","name":"cluster-admin"},"subjects":[{"kind":"ServiceAccount","namespace":"ci","name":"runner"}]},"requestReceivedTimestamp":"2026-10-01T11:00:00.000000Z","stageTimestamp":"2026-10-01T11:00:00.010000Z"}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Request","auditID":"d4","stage":"ResponseComplete","requestURI":"/apis/apps/v1/namespaces/kube-system/daemonsets","verb":"create","user":{"username":"alice"},"sourceIPs":["10.0.0.5"],"objectRef":{"resource":"daemonsets","namespace":"kube-system","name":"node-agent","apiGroup":"apps","apiVersion":"v1"},"responseStatus":{"code":201},"requestObject":{"kind":"DaemonSet","spec":{"template":{"spec":{"hostPID":true,"containers":[{"name":"agent","securityContext":{"privileged":true}}]}}}},"requestReceivedTimestamp":"2026-10-01T12:00:00.000000Z","stageTimestamp":"2026-10-01T12:00:00.010000Z"}
+{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"e5","stage":"ResponseComplete","requestURI":"/api/v1/namespaces/shop/configmaps","verb":"list","user":{"username":"alice"},"sourceIPs":["10.0.0.5"],"objectRef":{"resource":"configmaps","namespace":"shop","apiVersion":"v1"},"responseStatus":{"code":200},"requestReceivedTimestamp":"2026-10-01T13:00:00.000000Z","stageTimestamp":"2026-10-01T13:00:00.010000Z"}
+`
+
+func readTimeline(t *testing.T, filter Filter, queries []Query) []Entry {
+	t.Helper()
+	tl := NewTimeline(filter, queries)
+	skipped, err := Read(strings.NewReader(auditLog), func(e *Event) error {
+		tl.Add(e)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, skipped)
+	return tl.Entries()
+}
+
+func TestTimelineQueries(t *testing.T) {
+	entries := readTimeline(t, Filter{}, Queries)
+	require.Len(t, entries, 4)
+
+	assert.Equal(t, "b2", entries[0].AuditID)
+	assert.Equal(t, []string{"secrets"}, entries[0].Queries)
+	assert.Equal(t, "all secrets of the cluster", entries[0].Detail)
+
+	exec := entries[1]
+	assert.Equal(t, "a1", exec.AuditID)
+	assert.Equal(t, StageResponseStarted, exec.Stage)
+	assert.Equal(t, int32(101), exec.Code)
+	assert.Equal(t, "pods/exec shop/web-1", exec.Object)
+	assert.Equal(t, "container web, command sh -c id", exec.Detail)
+
+	rbac := entries[2]
+	assert.Equal(t, "bob", rbac.Impersonated)
+	assert.Equal(t, "clusterrolebindings.rbac.authorization.k8s.io pwn", rbac.Object)
+	assert.Equal(t, "binds ClusterRole/cluster-admin to ServiceAccount/ci/runner", rbac.Detail)
+
+	assert.Equal(t, []string{"privileged-pods"}, entries[3].Queries)
+	assert.Equal(t, "host-pid; agent: privileged", entries[3].Detail)
+}
+
+func TestTimelineRequestReceived(t *testing.T) {
+	const watch = `{"kind":"Event","apiVersion":"audit.k8s.io/v1","level":"Metadata","auditID":"f6","stage":"RequestReceived","requestURI":"/api/v1/secrets?watch=true","verb":"watch","user":{"username":"mallory"},"sourceIPs":["10.0.0.9"],"objectRef":{"resource":"secrets","apiVersion":"v1"},"requestReceivedTimestamp":"2026-10-01T14:00:00.000000Z","stageTimestamp":"2026-10-01T14:00:00.000000Z"}`
+	tl := NewTimeline(Filter{}, nil)
+	_, err := Read(strings.NewReader(auditLog+watch+"\n"), func(e *Event) error {
+		tl.Add(e)
+		return nil
+	})
+	require.NoError(t, err)
+
+	entries := tl.Entries()
+	require.Len(t, entries, 6)
+	assert.Equal(t, "a1", entries[1].AuditID)
+	assert.Equal(t, StageResponseStarted, entries[1].Stage)
+	assert.Equal(t, "f6", entries[5].AuditID)
+	assert.Equal(t, StageRequestReceived, entries[5].Stage)
+}
+
+func TestTimelineFilter(t *testing.T) {
+	sa, err := ServiceAccountUser("ci/runner")
+	require.NoError(t, err)
+	entries := readTimeline(t, Filter{Users: []string{sa}}, nil)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "b2", entries[0].AuditID)
+
+	// The impersonated user matches as well.
+	entries = readTimeline(t, Filter{Users: []string{"bob"}}, nil)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "c3", entries[0].AuditID)
+
+	networks, err := ParseNetworks([]string{"10.0.0.0/24"})
+	require.NoError(t, err)
+	entries = readTimeline(t, Filter{
+		SourceIPs: networks,
+		Verbs:     []string{"create", "list"},
+		Resources: []string{"pods/exec", "configmaps"},
+		Since:     time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC),
+		Until:     time.Date(2026, 10, 1, 12, 30, 0, 0, time.UTC),
+	}, nil)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a1", entries[0].AuditID)
+
+	_, err = ServiceAccountUser("runner")
+	assert.Error(t, err)
+	_, err = ParseNetworks([]string{"10.0.0"})
+	assert.Error(t, err)
+}
+
+func TestOpenGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(auditLog))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	name := filepath.Join(t.TempDir(), "audit-2026-10-01T00-00-00.000.log.gz")
+	require.NoError(t, os.WriteFile(name, buf.Bytes(), 0o600))
+
+	f, err := Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+	n := 0
+	_, err = Read(f, func(*Event) error {
+		n++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 6, n)
+}
+
+func TestParseLogFiles(t *testing.T) {
+	files, warnings := ParseLogFiles([]byte("file\t/proc/812/root/var/log/audit.log\t/var/log/audit.log\t2048\tlive\n" +
+		"file\t/proc/812/root/var/log/audit-2026-10-01T10-00-00.000.log\t/var/log/audit-2026-10-01T10-00-00.000.log\t4096\t\nwarning\tsomething\n"))
+	assert.Equal(t, []LogFile{
+		{Path: "/proc/812/root/var/log/audit.log", Source: "/var/log/audit.log", Size: 2048, Live: true},
+		{Path: "/proc/812/root/var/log/audit-2026-10-01T10-00-00.000.log", Source: "/var/log/audit-2026-10-01T10-00-00.000.log", Size: 4096},
+	}, files)
+	assert.Equal(t, []string{"something"}, warnings)
+}
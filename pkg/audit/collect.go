@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// LogFile is an audit log file on a control plane node.
+type LogFile struct {
+	// Path is the file as read from the forensic pod, through the mount
+	// namespace of the API server.
+	Path string `json:"path"`
+	// Source is the file as the API server sees it.
+	Source string `json:"source"`
+	Size   int64  `json:"size"`
+	// Live is set for the file the API server is writing to, as opposed to
+	// its rotated files.
+	Live bool `json:"live,omitempty"`
+}
+
+// logFilesScript takes the audit log from the --audit-log-path of the
+// kube-apiserver process unless $log is set, and lists it with its rotated
+// files, which share the name of the log up to its extension.
+const logFilesScript = `
+root=` + tasks.HostRoot + `
+if [ -z "$log" ]; then
+  for d in /proc/[0-9]*; do
+    [ "$(cat "$d/comm" 2>/dev/null)" = kube-apiserver ] || continue
+    log=$(tr '\0' '\n' < "$d/cmdline" 2>/dev/null | awk 'p { print; exit } /^--audit-log-path=/ { sub(/^--audit-log-path=/, ""); print; exit } $0 == "--audit-log-path" { p = 1 }')
+    if [ -z "$log" ]; then
+      printf 'warning\tkube-apiserver %s does not write an audit log file\n' "${d#/proc/}"
+      exit 0
+    fi
+    root=$d/root
+    break
+  done
+fi
+if [ -z "$log" ]; then
+  printf 'warning\tno kube-apiserver process found, give the path of the audit log\n'
+  exit 0
+fi
+if [ "$log" = - ]; then
+  printf 'warning\tkube-apiserver writes its audit log to standard output, read it from the pod logs instead\n'
+  exit 0
+fi
+dir=${log%/*}
+base=${log##*/}
+prefix=${base%.*}
+found=
+for f in "$root$dir/$prefix"*; do
+  [ -f "$f" ] || continue
+  found=1
+  live=
+  [ "$f" = "$root$log" ] && live=live
+  printf 'file\t%s\t%s\t%s\t%s\n' "$f" "$dir/${f##*/}" "$(stat -c %s "$f")" "$live"
+done
+[ -n "$found" ] || printf 'warning\tno audit log file found at %s\n' "$log"
+`
+
+// LogFilesScript lists the audit log files of the API server running on the
+// node. logPath, the path of the audit log on the host, overrides the one the
+// API server is configured with.
+func LogFilesScript(logPath string) string {
+	return "log=" + shell.Quote(logPath) + "\n" + logFilesScript
+}
+
+// ParseLogFiles parses the output of LogFilesScript.
+func ParseLogFiles(output []byte) ([]LogFile, []string) {
+	var (
+		files    []LogFile
+		warnings []string
+	)
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "\t")
+		switch fields[0] {
+		case "warning":
+			if len(fields) > 1 {
+				warnings = append(warnings, fields[1])
+			}
+		case "file":
+			if len(fields) < 4 {
+				continue
+			}
+			size, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("invalid size of %s: %s", fields[2], fields[3]))
+			}
+			files = append(files, LogFile{Path: fields[1], Source: fields[2], Size: size, Live: len(fields) > 4 && fields[4] == "live"})
+		}
+	}
+	return files, warnings
+}
+
+// SnapshotScript copies a live audit log to a temporary file of the forensic
+// pod and prints the path of the copy. The API server keeps appending to the
+// log, the copy is what gets hashed and streamed so that both see the same
+// bytes.
+func SnapshotScript(f LogFile) string {
+	return `tmp=$(mktemp) || exit 1
+cat ` + shell.Quote(f.Path) + ` > "$tmp" || { rm -f "$tmp"; exit 1; }
+printf '%s' "$tmp"`
+}
+
+// RemoveSnapshotScript removes a copy made by SnapshotScript.
+func RemoveSnapshotScript(snapshot string) string {
+	return "rm -f " + shell.Quote(snapshot)
+}
+
+// CopyScript writes an audit log file to standard output.
+func CopyScript(f LogFile) string {
+	return "cat " + shell.Quote(f.Path)
+}
+
+// HashScript prints the SHA-256 of an audit log file.
+func HashScript(f LogFile) string {
+	return "sha256sum < " + shell.Quote(f.Path) + " | cut -d ' ' -f 1"
+}
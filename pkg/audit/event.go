@@ -0,0 +1,256 @@
+// Package audit reads Kubernetes API server audit logs, filters their events
+// and orders them into a timeline, with built-in queries for the requests
+// that matter most in an investigation.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Stages of an audit event.
+const (
+	StageRequestReceived  = "RequestReceived"
+	StageResponseStarted  = "ResponseStarted"
+	StageResponseComplete = "ResponseComplete"
+	StagePanic            = "Panic"
+)
+
+// UserInfo is the user a request was authenticated as.
+type UserInfo struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// ObjectReference is the object a request is about.
+type ObjectReference struct {
+	Resource    string `json:"resource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+	APIGroup    string `json:"apiGroup,omitempty"`
+	APIVersion  string `json:"apiVersion,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+}
+
+// Event is an event of the audit.k8s.io/v1 API, limited to the fields the
+// analysis uses.
+type Event struct {
+	Level                    string            `json:"level"`
+	AuditID                  string            `json:"auditID"`
+	Stage                    string            `json:"stage"`
+	RequestURI               string            `json:"requestURI"`
+	Verb                     string            `json:"verb"`
+	User                     UserInfo          `json:"user"`
+	ImpersonatedUser         *UserInfo         `json:"impersonatedUser,omitempty"`
+	SourceIPs                []string          `json:"sourceIPs,omitempty"`
+	UserAgent                string            `json:"userAgent,omitempty"`
+	ObjectRef                *ObjectReference  `json:"objectRef,omitempty"`
+	ResponseStatus           *metav1.Status    `json:"responseStatus,omitempty"`
+	RequestObject            json.RawMessage   `json:"requestObject,omitempty"`
+	RequestReceivedTimestamp metav1.MicroTime  `json:"requestReceivedTimestamp"`
+	StageTimestamp           metav1.MicroTime  `json:"stageTimestamp"`
+	Annotations              map[string]string `json:"annotations,omitempty"`
+}
+
+// Resource returns the resource of the request, with its subresource as
+// resource/subresource.
+func (e *Event) Resource() string {
+	if e.ObjectRef == nil {
+		return ""
+	}
+	if e.ObjectRef.Subresource != "" {
+		return e.ObjectRef.Resource + "/" + e.ObjectRef.Subresource
+	}
+	return e.ObjectRef.Resource
+}
+
+// Object describes the object of the request, e.g. pods/exec shop/web-1, or
+// its URI for non resource requests.
+func (e *Event) Object() string {
+	if e.ObjectRef == nil || e.ObjectRef.Resource == "" {
+		return e.RequestURI
+	}
+	resource := e.Resource()
+	if e.ObjectRef.APIGroup != "" {
+		resource = e.ObjectRef.Resource + "." + e.ObjectRef.APIGroup
+		if e.ObjectRef.Subresource != "" {
+			resource += "/" + e.ObjectRef.Subresource
+		}
+	}
+	name := e.ObjectRef.Name
+	if e.ObjectRef.Namespace != "" {
+		name = e.ObjectRef.Namespace + "/" + name
+	}
+	if name == "" {
+		return resource
+	}
+	return resource + " " + name
+}
+
+// SourceIP returns the address the request came from.
+func (e *Event) SourceIP() string {
+	if len(e.SourceIPs) == 0 {
+		return ""
+	}
+	return e.SourceIPs[0]
+}
+
+// Code returns the HTTP status code of the response, 0 if there was none.
+func (e *Event) Code() int32 {
+	if e.ResponseStatus == nil {
+		return 0
+	}
+	return e.ResponseStatus.Code
+}
+
+// Open opens an audit log file, decompressing it when it is gzipped as
+// rotated logs often are.
+func Open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, f}, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decompress audit log %s: %w", name, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// Read decodes the JSON lines of an audit log and hands every event to fn.
+// Lines that are not events, e.g. a line truncated by a rotation, are
+// counted and skipped.
+func Read(r io.Reader, fn func(*Event) error) (int, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	skipped := 0
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			e := &Event{}
+			if jsonErr := json.Unmarshal(line, e); jsonErr != nil || e.Verb == "" {
+				skipped++
+			} else if fnErr := fn(e); fnErr != nil {
+				return skipped, fnErr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, fmt.Errorf("failed to read audit log: %w", err)
+		}
+	}
+}
+
+// Filter selects events. Empty fields match every event.
+type Filter struct {
+	// Users are user names, matched against the authenticated and the
+	// impersonated user. Service accounts are named
+	// system:serviceaccount:<namespace>:<name>.
+	Users []string
+	Verbs []string
+	// Resources are resources, optionally with their subresource as
+	// resource/subresource.
+	Resources []string
+	SourceIPs []*net.IPNet
+	Since     time.Time
+	Until     time.Time
+}
+
+// ServiceAccountUser returns the user name of a service account given as
+// namespace/name.
+func ServiceAccountUser(sa string) (string, error) {
+	ns, name, ok := strings.Cut(sa, "/")
+	if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid service account %q, expected namespace/name", sa)
+	}
+	return "system:serviceaccount:" + ns + ":" + name, nil
+}
+
+// ParseNetworks parses addresses and CIDRs.
+func ParseNetworks(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", v, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e *Event) bool {
+	t := e.RequestReceivedTimestamp.Time
+	if !f.Since.IsZero() && t.Before(f.Since) || !f.Until.IsZero() && t.After(f.Until) {
+		return false
+	}
+	if len(f.Users) > 0 {
+		impersonated := ""
+		if e.ImpersonatedUser != nil {
+			impersonated = e.ImpersonatedUser.Username
+		}
+		if !slices.Contains(f.Users, e.User.Username) && !slices.Contains(f.Users, impersonated) {
+			return false
+		}
+	}
+	if len(f.Verbs) > 0 && !slices.Contains(f.Verbs, e.Verb) {
+		return false
+	}
+	if len(f.Resources) > 0 && (e.ObjectRef == nil || !slices.Contains(f.Resources, e.ObjectRef.Resource) && !slices.Contains(f.Resources, e.Resource())) {
+		return false
+	}
+	if len(f.SourceIPs) > 0 {
+		found := false
+		for _, s := range e.SourceIPs {
+			ip := net.ParseIP(s)
+			for _, n := range f.SourceIPs {
+				if ip != nil && n.Contains(ip) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
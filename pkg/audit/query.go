@@ -0,0 +1,315 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/workload"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Query is a built-in query selecting events of interest. Match returns a
+// short description of what the request did.
+type Query struct {
+	Name        string
+	Description string
+	Match       func(*Event) (bool, string)
+}
+
+// Queries are the built-in queries.
+var Queries = []Query{
+	{
+		Name:        "exec",
+		Description: "exec, attach and port-forward sessions into pods",
+		Match:       matchExec,
+	},
+	{
+		Name:        "secrets",
+		Description: "reads of secrets",
+		Match:       matchSecrets,
+	},
+	{
+		Name:        "rbac",
+		Description: "changes of roles and bindings",
+		Match:       matchRBAC,
+	},
+	{
+		Name:        "privileged-pods",
+		Description: "creations of pods and pod controllers with privileged specs, needs the Request audit level",
+		Match:       matchPrivilegedPods,
+	},
+}
+
+// LookupQuery returns the built-in query called name.
+func LookupQuery(name string) (Query, error) {
+	var names []string
+	for _, q := range Queries {
+		if q.Name == name {
+			return q, nil
+		}
+		names = append(names, q.Name)
+	}
+	return Query{}, fmt.Errorf("unknown query %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+func matchExec(e *Event) (bool, string) {
+	if e.ObjectRef == nil || e.ObjectRef.Resource != "pods" {
+		return false, ""
+	}
+	switch e.ObjectRef.Subresource {
+	case "exec", "attach", "portforward":
+	default:
+		return false, ""
+	}
+
+	u, err := url.Parse(e.RequestURI)
+	if err != nil {
+		return true, e.ObjectRef.Subresource
+	}
+	params := u.Query()
+	var detail []string
+	if c := params.Get("container"); c != "" {
+		detail = append(detail, "container "+c)
+	}
+	if cmd := params["command"]; len(cmd) > 0 {
+		detail = append(detail, "command "+strings.Join(cmd, " "))
+	}
+	if ports := params["ports"]; len(ports) > 0 {
+		detail = append(detail, "ports "+strings.Join(ports, ","))
+	}
+	return true, strings.Join(detail, ", ")
+}
+
+func matchSecrets(e *Event) (bool, string) {
+	if e.ObjectRef == nil || e.ObjectRef.Resource != "secrets" || e.ObjectRef.Subresource != "" {
+		return false, ""
+	}
+	switch e.Verb {
+	case "get", "list", "watch":
+	default:
+		return false, ""
+	}
+	if e.ObjectRef.Name == "" {
+		if e.ObjectRef.Namespace == "" {
+			return true, "all secrets of the cluster"
+		}
+		return true, "all secrets of " + e.ObjectRef.Namespace
+	}
+	return true, ""
+}
+
+func matchRBAC(e *Event) (bool, string) {
+	if e.ObjectRef == nil || e.ObjectRef.APIGroup != rbacv1.GroupName {
+		return false, ""
+	}
+	switch e.Verb {
+	case "create", "update", "patch", "delete", "deletecollection":
+	default:
+		return false, ""
+	}
+	if len(e.RequestObject) == 0 {
+		return true, ""
+	}
+
+	// Bindings are described by the role they bind and to whom.
+	var binding struct {
+		RoleRef  rbacv1.RoleRef   `json:"roleRef"`
+		Subjects []rbacv1.Subject `json:"subjects"`
+	}
+	if err := json.Unmarshal(e.RequestObject, &binding); err != nil || binding.RoleRef.Name == "" {
+		return true, ""
+	}
+	var subjects []string
+	for _, s := range binding.Subjects {
+		name := s.Name
+		if s.Namespace != "" {
+			name = s.Namespace + "/" + name
+		}
+		subjects = append(subjects, s.Kind+"/"+name)
+	}
+	return true, fmt.Sprintf("binds %s/%s to %s", binding.RoleRef.Kind, binding.RoleRef.Name, strings.Join(subjects, ","))
+}
+
+// podControllers are the resources holding a pod template.
+var podControllers = map[string]bool{
+	"pods":                   true,
+	"replicationcontrollers": true,
+	"deployments":            true,
+	"replicasets":            true,
+	"statefulsets":           true,
+	"daemonsets":             true,
+	"jobs":                   true,
+	"cronjobs":               true,
+}
+
+func matchPrivilegedPods(e *Event) (bool, string) {
+	if e.ObjectRef == nil || !podControllers[e.ObjectRef.Resource] || e.ObjectRef.Subresource != "" {
+		return false, ""
+	}
+	if e.Verb != "create" || len(e.RequestObject) == 0 {
+		return false, ""
+	}
+
+	pod := &corev1.Pod{}
+	if e.ObjectRef.Resource == "pods" {
+		if err := json.Unmarshal(e.RequestObject, pod); err != nil {
+			return false, ""
+		}
+	} else {
+		var controller struct {
+			Spec struct {
+				Template    *corev1.PodTemplateSpec `json:"template"`
+				JobTemplate *struct {
+					Spec struct {
+						Template *corev1.PodTemplateSpec `json:"template"`
+					} `json:"spec"`
+				} `json:"jobTemplate"`
+			} `json:"spec"`
+		}
+		if err := json.Unmarshal(e.RequestObject, &controller); err != nil {
+			return false, ""
+		}
+		template := controller.Spec.Template
+		if controller.Spec.JobTemplate != nil {
+			template = controller.Spec.JobTemplate.Spec.Template
+		}
+		if template == nil {
+			return false, ""
+		}
+		pod.Spec = template.Spec
+	}
+
+	var checks []string
+	for _, f := range workload.Inspect(pod) {
+		if f.Severity != severity.High {
+			continue
+		}
+		check := f.Check
+		if f.Detail != "" {
+			check += " " + f.Detail
+		}
+		if f.Container != "" {
+			check = f.Container + ": " + check
+		}
+		checks = append(checks, check)
+	}
+	if len(checks) == 0 {
+		return false, ""
+	}
+	return true, strings.Join(checks, "; ")
+}
+
+// Entry is a request in the timeline.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	AuditID      string    `json:"auditID,omitempty"`
+	Stage        string    `json:"stage"`
+	User         string    `json:"user"`
+	Impersonated string    `json:"impersonatedUser,omitempty"`
+	SourceIP     string    `json:"sourceIP,omitempty"`
+	UserAgent    string    `json:"userAgent,omitempty"`
+	Verb         string    `json:"verb"`
+	Object       string    `json:"object"`
+	Code         int32     `json:"code,omitempty"`
+	Queries      []string  `json:"queries,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+}
+
+// Timeline collects the events passing a filter and, when queries are set,
+// matching one of them. A request logged at several stages is kept once, as
+// of its last stage, at the time it was received. Requests only logged at
+// RequestReceived, such as those still running when the log was read, are
+// kept at that stage.
+type Timeline struct {
+	filter  Filter
+	queries []Query
+	entries []Entry
+	index   map[string]int
+}
+
+// NewTimeline creates an empty timeline.
+func NewTimeline(filter Filter, queries []Query) *Timeline {
+	return &Timeline{filter: filter, queries: queries, index: map[string]int{}}
+}
+
+// Add adds an event to the timeline if it is selected.
+func (t *Timeline) Add(e *Event) {
+	if !t.filter.Match(e) {
+		return
+	}
+
+	var (
+		names   []string
+		details []string
+	)
+	for _, q := range t.queries {
+		if ok, detail := q.Match(e); ok {
+			names = append(names, q.Name)
+			if detail != "" {
+				details = append(details, detail)
+			}
+		}
+	}
+	if len(t.queries) > 0 && len(names) == 0 {
+		return
+	}
+
+	entry := Entry{
+		Time:      e.RequestReceivedTimestamp.UTC(),
+		AuditID:   e.AuditID,
+		Stage:     e.Stage,
+		User:      e.User.Username,
+		SourceIP:  e.SourceIP(),
+		UserAgent: e.UserAgent,
+		Verb:      e.Verb,
+		Object:    e.Object(),
+		Code:      e.Code(),
+		Queries:   names,
+		Detail:    strings.Join(details, "; "),
+	}
+	if e.ImpersonatedUser != nil {
+		entry.Impersonated = e.ImpersonatedUser.Username
+	}
+
+	if e.AuditID != "" {
+		if i, ok := t.index[e.AuditID]; ok {
+			if stageRank(entry.Stage) < stageRank(t.entries[i].Stage) {
+				return
+			}
+			if entry.Detail == "" {
+				entry.Detail = t.entries[i].Detail
+			}
+			t.entries[i] = entry
+			return
+		}
+		t.index[e.AuditID] = len(t.entries)
+	}
+	t.entries = append(t.entries, entry)
+}
+
+// Entries returns the entries in chronological order.
+func (t *Timeline) Entries() []Entry {
+	entries := append([]Entry(nil), t.entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
+
+// stageRank orders the stages of a request, rotated files may be read out of
+// order.
+func stageRank(stage string) int {
+	switch stage {
+	case StageResponseStarted:
+		return 1
+	case StageResponseComplete, StagePanic:
+		return 2
+	}
+	return 0
+}
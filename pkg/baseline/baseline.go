@@ -0,0 +1,114 @@
+// Package baseline checks the configuration of the Kubernetes components
+// running on the nodes against a security baseline.
+package baseline
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// Statuses of a check.
+const (
+	StatusPass = "pass"
+	StatusFail = "fail"
+	// StatusWarn is used when the configuration is not known to be unsafe
+	// but can not be verified, or relies on defaults.
+	StatusWarn = "warn"
+)
+
+// Result is the outcome of a check.
+type Result struct {
+	Node      string `json:"node,omitempty"`
+	Component string `json:"component"`
+	Check     string `json:"check"`
+	Status    string `json:"status"`
+	// Value is the effective value of the checked setting, when it has one.
+	Value    string `json:"value,omitempty"`
+	Expected string `json:"expected"`
+	// Evidence holds the configuration lines the status is based on, as
+	// file:line: text, or what is missing.
+	Evidence []string `json:"evidence"`
+}
+
+// File is a configuration file read from a node.
+type File struct {
+	// Path is the file on the host.
+	Path string `json:"path"`
+	Data []byte `json:"-"`
+}
+
+// filesScript prints the files of $dir on the host matching one of the glob
+// $patterns, base64 encoded so each one fits a line.
+const filesScript = `
+if ! cd "` + tasks.HostRoot + `$dir" 2>/dev/null; then
+  printf 'warning\t%s does not exist\n' "$dir"
+  exit 0
+fi
+found=
+set -f
+for p in $patterns; do
+  set +f
+  for f in $p; do
+    [ -f "$f" ] || continue
+    found=1
+    printf 'file\t%s\t%s\n' "$dir/$f" "$(base64 < "$f" | tr -d '\n')"
+  done
+  set -f
+done
+[ -n "$found" ] || printf 'warning\tno %s file found in %s\n' "$patterns" "$dir"
+`
+
+// FilesScript reads the files of a host directory whose name matches one of
+// the glob patterns.
+func FilesScript(dir string, patterns []string) string {
+	return "dir=" + shell.Quote(strings.TrimSuffix(dir, "/")) + "\n" +
+		"patterns=" + shell.Quote(strings.Join(patterns, " ")) + "\n" +
+		filesScript
+}
+
+// ParseFiles parses the output of FilesScript.
+func ParseFiles(output []byte) ([]File, []string) {
+	var (
+		files    []File
+		warnings []string
+	)
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "\t")
+		switch fields[0] {
+		case "warning":
+			if len(fields) > 1 {
+				warnings = append(warnings, fields[1])
+			}
+		case "file":
+			if len(fields) < 3 {
+				continue
+			}
+			data, err := base64.StdEncoding.DecodeString(fields[2])
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("failed to decode %s: %s", fields[1], err))
+				continue
+			}
+			files = append(files, File{Path: fields[1], Data: data})
+		}
+	}
+	return files, warnings
+}
+
+// evidence locates the line of a file matching re.
+func (f *File) evidence(re *regexp.Regexp) (string, bool) {
+	for i, line := range strings.Split(string(f.Data), "\n") {
+		if re.MatchString(line) {
+			return fmt.Sprintf("%s:%d: %s", f.Path, i+1, strings.TrimSpace(line)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,358 @@
+package baseline
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Control plane components.
+const (
+	APIServer         = "kube-apiserver"
+	ControllerManager = "kube-controller-manager"
+	Scheduler         = "kube-scheduler"
+	Etcd              = "etcd"
+)
+
+// Labels of the control plane nodes, the legacy one is still set by some
+// distributions.
+const (
+	ControlPlaneLabel       = "node-role.kubernetes.io/control-plane"
+	LegacyControlPlaneLabel = "node-role.kubernetes.io/master"
+)
+
+// IsControlPlane reports whether the labels of a node mark it as a control
+// plane node.
+func IsControlPlane(labels map[string]string) bool {
+	_, controlPlane := labels[ControlPlaneLabel]
+	_, legacy := labels[LegacyControlPlaneLabel]
+	return controlPlane || legacy
+}
+
+// ManifestsDir is where kubeadm writes the static pod manifests.
+const ManifestsDir = "/etc/kubernetes/manifests"
+
+// ManifestPatterns are the static pod manifests the kubelet reads.
+var ManifestPatterns = []string{"*.yaml", "*.yml", "*.json"}
+
+// Component is a control plane component configured by a static pod.
+type Component struct {
+	Name     string
+	Manifest *File
+	// Flags maps the flags of the command line, without their dashes, to
+	// their value. Flags given without a value are set to true.
+	Flags map[string]string
+}
+
+// flag returns the value of a flag and the manifest line setting it.
+func (c *Component) flag(name string) (value, evidence string, ok bool) {
+	value, ok = c.Flags[name]
+	if !ok {
+		return "", fmt.Sprintf("%s: --%s not set", c.Manifest.Path, name), false
+	}
+	re := regexp.MustCompile(`--` + regexp.QuoteMeta(name) + `(=|["'\s]|$)`)
+	if line, found := c.Manifest.evidence(re); found {
+		// The value may be the next argument, on its own line.
+		if !strings.Contains(line, value) {
+			line += " " + value
+		}
+		return value, line, true
+	}
+	return value, fmt.Sprintf("%s: --%s=%s", c.Manifest.Path, name, value), true
+}
+
+// ParseComponents finds the control plane components in static pod
+// manifests.
+func ParseComponents(manifests []File) ([]Component, []string) {
+	var (
+		components []Component
+		warnings   []string
+	)
+	for i := range manifests {
+		m := &manifests[i]
+		var pod corev1.Pod
+		if err := yaml.Unmarshal(m.Data, &pod); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to parse %s: %s", m.Path, err))
+			continue
+		}
+		for _, c := range pod.Spec.Containers {
+			argv := append(append([]string{}, c.Command...), c.Args...)
+			if len(argv) == 0 {
+				continue
+			}
+			name := path.Base(argv[0])
+			switch name {
+			case APIServer, ControllerManager, Scheduler, Etcd:
+				components = append(components, Component{Name: name, Manifest: m, Flags: parseFlags(argv[1:])})
+			}
+		}
+	}
+	return components, warnings
+}
+
+// parseFlags parses --flag=value, --flag value and boolean --flag arguments.
+func parseFlags(args []string) map[string]string {
+	flags := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if n, value, ok := strings.Cut(name, "="); ok {
+			flags[n] = value
+			continue
+		}
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			flags[name] = args[i+1]
+			i++
+			continue
+		}
+		flags[name] = "true"
+	}
+	return flags
+}
+
+// check is a baseline check of a component.
+type check struct {
+	name     string
+	expected string
+	run      func(c *Component) (string, []string)
+}
+
+// controlPlaneChecks are the checks of every control plane component.
+var controlPlaneChecks = map[string][]check{
+	APIServer: {
+		{"anonymous-auth", "--anonymous-auth=false", checkAnonymousAuth},
+		{"authorization-mode", "--authorization-mode with Node and RBAC, without AlwaysAllow", checkAuthorizationMode},
+		{"audit-log", "--audit-policy-file with --audit-log-path or --audit-webhook-config-file", checkAuditLog},
+		{"encryption-provider-config", "--encryption-provider-config set", checkEncryption},
+		{"profiling", "--profiling=false", checkProfiling},
+		{"insecure-port", "--insecure-port=0 or unset", checkInsecurePort("insecure-port", "insecure-bind-address")},
+		{"tls-cipher-suites", "--tls-cipher-suites without CBC, RC4, 3DES or RSA key exchange suites, --tls-min-version of at least VersionTLS12", checkCiphers("tls-cipher-suites", "tls-min-version")},
+	},
+	ControllerManager: {
+		{"profiling", "--profiling=false", checkProfiling},
+		{"insecure-port", "--port=0 or unset", checkInsecurePort("port", "address")},
+		{"tls-cipher-suites", "--tls-cipher-suites without CBC, RC4, 3DES or RSA key exchange suites, --tls-min-version of at least VersionTLS12", checkCiphers("tls-cipher-suites", "tls-min-version")},
+	},
+	Scheduler: {
+		{"profiling", "--profiling=false", checkProfiling},
+		{"insecure-port", "--port=0 or unset", checkInsecurePort("port", "address")},
+		{"tls-cipher-suites", "--tls-cipher-suites without CBC, RC4, 3DES or RSA key exchange suites, --tls-min-version of at least VersionTLS12", checkCiphers("tls-cipher-suites", "tls-min-version")},
+	},
+	Etcd: {
+		{"client-cert-auth", "--client-cert-auth=true and --peer-client-cert-auth=true", checkEtcdClientAuth},
+		{"auto-tls", "--auto-tls and --peer-auto-tls unset or false", checkEtcdAutoTLS},
+		{"insecure-port", "https:// in --listen-client-urls and --listen-peer-urls", checkEtcdURLs},
+		{"profiling", "--enable-pprof unset or false", checkEtcdProfiling},
+		{"tls-cipher-suites", "--cipher-suites without CBC, RC4, 3DES or RSA key exchange suites, --tls-min-version of at least TLS1.2", checkCiphers("cipher-suites", "tls-min-version")},
+	},
+}
+
+// AuditControlPlane checks the control plane components of the static pod
+// manifests of a node. Components with no manifest are reported as warnings.
+func AuditControlPlane(manifests []File) ([]Result, []string) {
+	components, warnings := ParseComponents(manifests)
+	var results []Result
+	for _, name := range []string{APIServer, ControllerManager, Scheduler, Etcd} {
+		found := false
+		for i := range components {
+			c := &components[i]
+			if c.Name != name {
+				continue
+			}
+			found = true
+			for _, chk := range controlPlaneChecks[name] {
+				status, evidence := chk.run(c)
+				results = append(results, Result{
+					Component: name,
+					Check:     chk.name,
+					Status:    status,
+					Expected:  chk.expected,
+					Evidence:  evidence,
+				})
+			}
+		}
+		if !found {
+			warnings = append(warnings, fmt.Sprintf("no %s static pod manifest found", name))
+		}
+	}
+	return results, warnings
+}
+
+func checkAnonymousAuth(c *Component) (string, []string) {
+	value, evidence, ok := c.flag("anonymous-auth")
+	if ok {
+		if value == "false" {
+			return StatusPass, []string{evidence}
+		}
+		return StatusFail, []string{evidence}
+	}
+	// Structured authentication configures anonymous requests in its file.
+	if _, config, ok := c.flag("authentication-config"); ok {
+		return StatusWarn, []string{evidence, config + ", anonymous requests are configured by this file"}
+	}
+	return StatusFail, []string{evidence + ", anonymous requests are allowed by default"}
+}
+
+func checkAuthorizationMode(c *Component) (string, []string) {
+	value, evidence, ok := c.flag("authorization-mode")
+	if !ok {
+		if _, config, ok := c.flag("authorization-config"); ok {
+			return StatusWarn, []string{evidence, config + ", authorizers are configured by this file"}
+		}
+		return StatusFail, []string{evidence + ", every request is allowed by default"}
+	}
+	modes := strings.Split(value, ",")
+	switch {
+	case slices.Contains(modes, "AlwaysAllow"), !slices.Contains(modes, "RBAC"):
+		return StatusFail, []string{evidence}
+	case !slices.Contains(modes, "Node"):
+		return StatusWarn, []string{evidence + ", kubelets are not restricted to their own node"}
+	}
+	return StatusPass, []string{evidence}
+}
+
+func checkAuditLog(c *Component) (string, []string) {
+	_, policy, hasPolicy := c.flag("audit-policy-file")
+	_, log, hasLog := c.flag("audit-log-path")
+	_, webhook, hasWebhook := c.flag("audit-webhook-config-file")
+	evidence := []string{policy, log}
+	if hasWebhook {
+		evidence = append(evidence, webhook)
+	}
+	if !hasPolicy || (!hasLog && !hasWebhook) {
+		return StatusFail, evidence
+	}
+	return StatusPass, evidence
+}
+
+func checkEncryption(c *Component) (string, []string) {
+	_, evidence, ok := c.flag("encryption-provider-config")
+	if !ok {
+		return StatusFail, []string{evidence + ", Secrets are stored in plain text in etcd"}
+	}
+	return StatusPass, []string{evidence}
+}
+
+func checkProfiling(c *Component) (string, []string) {
+	value, evidence, ok := c.flag("profiling")
+	if !ok {
+		return StatusFail, []string{evidence + ", profiling is enabled by default"}
+	}
+	if value == "false" {
+		return StatusPass, []string{evidence}
+	}
+	return StatusFail, []string{evidence}
+}
+
+// checkInsecurePort fails when the insecure HTTP port of a component is
+// enabled. The port flags are disabled by default since Kubernetes 1.20 and
+// were removed in 1.24.
+func checkInsecurePort(portFlag, addressFlag string) func(c *Component) (string, []string) {
+	return func(c *Component) (string, []string) {
+		port, portEvidence, ok := c.flag(portFlag)
+		evidence := []string{portEvidence}
+		if _, address, ok := c.flag(addressFlag); ok {
+			evidence = append(evidence, address)
+		}
+		if ok && port != "0" {
+			return StatusFail, evidence
+		}
+		return StatusPass, evidence
+	}
+}
+
+// checkCiphers fails on weak cipher suites or TLS versions and warns when
+// they are left to the defaults of the Go runtime.
+func checkCiphers(suitesFlag, versionFlag string) func(c *Component) (string, []string) {
+	return func(c *Component) (string, []string) {
+		suites, evidence, hasSuites := c.flag(suitesFlag)
+		version, versionEvidence, hasVersion := c.flag(versionFlag)
+		all := []string{evidence, versionEvidence}
+
+		var weak []string
+		for _, s := range strings.Split(suites, ",") {
+			if weakCipher(strings.TrimSpace(s)) {
+				weak = append(weak, strings.TrimSpace(s))
+			}
+		}
+		switch {
+		case len(weak) > 0:
+			sort.Strings(weak)
+			return StatusFail, append(all, "weak cipher suites: "+strings.Join(weak, ","))
+		case hasVersion && weakTLSVersion(version):
+			return StatusFail, all
+		case !hasSuites:
+			return StatusWarn, []string{evidence + ", the Go default cipher suites apply", versionEvidence}
+		}
+		return StatusPass, all
+	}
+}
+
+func weakCipher(suite string) bool {
+	for _, marker := range []string{"CBC", "RC4", "3DES"} {
+		if strings.Contains(suite, marker) {
+			return true
+		}
+	}
+	return strings.HasPrefix(suite, "TLS_RSA_")
+}
+
+func weakTLSVersion(version string) bool {
+	switch version {
+	case "VersionTLS10", "VersionTLS11", "TLS1.0", "TLS1.1":
+		return true
+	}
+	return false
+}
+
+func checkEtcdClientAuth(c *Component) (string, []string) {
+	client, clientEvidence, _ := c.flag("client-cert-auth")
+	peer, peerEvidence, _ := c.flag("peer-client-cert-auth")
+	evidence := []string{clientEvidence, peerEvidence}
+	if client != "true" || peer != "true" {
+		return StatusFail, evidence
+	}
+	return StatusPass, evidence
+}
+
+func checkEtcdAutoTLS(c *Component) (string, []string) {
+	auto, autoEvidence, _ := c.flag("auto-tls")
+	peer, peerEvidence, _ := c.flag("peer-auto-tls")
+	evidence := []string{autoEvidence, peerEvidence}
+	if auto == "true" || peer == "true" {
+		return StatusFail, evidence
+	}
+	return StatusPass, evidence
+}
+
+// checkEtcdURLs fails when etcd serves clients or peers over plain HTTP,
+// which is its default.
+func checkEtcdURLs(c *Component) (string, []string) {
+	status := StatusPass
+	var evidence []string
+	for _, name := range []string{"listen-client-urls", "listen-peer-urls"} {
+		urls, e, ok := c.flag(name)
+		evidence = append(evidence, e)
+		if !ok || strings.Contains(urls, "http://") {
+			status = StatusFail
+		}
+	}
+	return status, evidence
+}
+
+func checkEtcdProfiling(c *Component) (string, []string) {
+	value, evidence, _ := c.flag("enable-pprof")
+	if value == "true" {
+		return StatusFail, []string{evidence}
+	}
+	return StatusPass, []string{evidence}
+}
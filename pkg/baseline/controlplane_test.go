@@ -0,0 +1,134 @@
+package baseline
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const apiServerManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-apiserver
+  namespace: kube-system
+spec:
+  containers:
+  - command:
+    - kube-apiserver
+    - --advertise-address=10.0.0.10
+    - --anonymous-auth=false
+    - --authorization-mode=Node,RBAC
+    - --audit-policy-file=/etc/kubernetes/audit/policy.yaml
+    - --audit-log-path=/var/log/kubernetes/audit/audit.log
+    - --encryption-provider-config=/etc/kubernetes/encryption.yaml
+    - --profiling=false
+    - --tls-cipher-suites=TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+    - --tls-min-version=VersionTLS12
+    image: registry.k8s.io/kube-apiserver:v1.31.2
+    name: kube-apiserver
+`
+
+const etcdManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: etcd
+  namespace: kube-system
+spec:
+  containers:
+  - name: etcd
+    image: registry.k8s.io/etcd:3.5.15-0
+    command:
+    - /usr/local/bin/etcd
+    args:
+    - --client-cert-auth=true
+    - --listen-client-urls
+    - https://127.0.0.1:2379,http://10.0.0.10:2379
+    - --listen-peer-urls=https://10.0.0.10:2380
+    - --enable-pprof
+    - --cipher-suites=TLS_RSA_WITH_AES_128_CBC_SHA,TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+`
+
+const schedulerManifest = `apiVersion: v1
+kind: Pod
+metadata:
+  name: kube-scheduler
+spec:
+  containers:
+  - command:
+    - kube-scheduler
+    - --authorization-kubeconfig=/etc/kubernetes/scheduler.conf
+    - --port=10251
+    name: kube-scheduler
+`
+
+func results(t *testing.T, manifests ...File) (map[string]Result, []string) {
+	t.Helper()
+	list, warnings := AuditControlPlane(manifests)
+	byCheck := map[string]Result{}
+	for _, r := range list {
+		byCheck[r.Component+"/"+r.Check] = r
+	}
+	require.Len(t, byCheck, len(list))
+	return byCheck, warnings
+}
+
+func TestAuditControlPlane(t *testing.T) {
+	r, warnings := results(t,
+		File{Path: "/etc/kubernetes/manifests/kube-apiserver.yaml", Data: []byte(apiServerManifest)},
+		File{Path: "/etc/kubernetes/manifests/etcd.yaml", Data: []byte(etcdManifest)},
+		File{Path: "/etc/kubernetes/manifests/kube-scheduler.yaml", Data: []byte(schedulerManifest)},
+		File{Path: "/etc/kubernetes/manifests/broken.yaml", Data: []byte("spec: [")},
+	)
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "failed to parse /etc/kubernetes/manifests/broken.yaml")
+	assert.Equal(t, "no kube-controller-manager static pod manifest found", warnings[1])
+
+	for _, check := range []string{"anonymous-auth", "authorization-mode", "audit-log", "encryption-provider-config", "profiling", "insecure-port", "tls-cipher-suites"} {
+		assert.Equal(t, StatusPass, r[APIServer+"/"+check].Status, check)
+	}
+	assert.Equal(t, []string{"/etc/kubernetes/manifests/kube-apiserver.yaml:11: - --anonymous-auth=false"}, r[APIServer+"/anonymous-auth"].Evidence)
+	assert.Equal(t, []string{"/etc/kubernetes/manifests/kube-apiserver.yaml: --insecure-port not set"}, r[APIServer+"/insecure-port"].Evidence)
+
+	assert.Equal(t, StatusFail, r[Scheduler+"/profiling"].Status)
+	assert.Equal(t, []string{"/etc/kubernetes/manifests/kube-scheduler.yaml: --profiling not set, profiling is enabled by default"}, r[Scheduler+"/profiling"].Evidence)
+	assert.Equal(t, StatusFail, r[Scheduler+"/insecure-port"].Status)
+	assert.Equal(t, []string{"/etc/kubernetes/manifests/kube-scheduler.yaml:10: - --port=10251"}, r[Scheduler+"/insecure-port"].Evidence)
+	assert.Equal(t, StatusWarn, r[Scheduler+"/tls-cipher-suites"].Status)
+
+	assert.Equal(t, StatusFail, r[Etcd+"/client-cert-auth"].Status)
+	assert.Equal(t, []string{
+		"/etc/kubernetes/manifests/etcd.yaml:13: - --client-cert-auth=true",
+		"/etc/kubernetes/manifests/etcd.yaml: --peer-client-cert-auth not set",
+	}, r[Etcd+"/client-cert-auth"].Evidence)
+	assert.Equal(t, StatusPass, r[Etcd+"/auto-tls"].Status)
+	assert.Equal(t, StatusFail, r[Etcd+"/insecure-port"].Status)
+	assert.Equal(t, "/etc/kubernetes/manifests/etcd.yaml:14: - --listen-client-urls https://127.0.0.1:2379,http://10.0.0.10:2379", r[Etcd+"/insecure-port"].Evidence[0])
+	assert.Equal(t, StatusFail, r[Etcd+"/profiling"].Status)
+	assert.Equal(t, StatusFail, r[Etcd+"/tls-cipher-suites"].Status)
+	assert.Contains(t, r[Etcd+"/tls-cipher-suites"].Evidence, "weak cipher suites: TLS_RSA_WITH_AES_128_CBC_SHA")
+}
+
+func TestAuditControlPlaneDefaults(t *testing.T) {
+	r, _ := results(t, File{Path: "/etc/kubernetes/manifests/kube-apiserver.yaml", Data: []byte(`
+spec:
+  containers:
+  - name: kube-apiserver
+    command: [kube-apiserver, --authorization-mode=AlwaysAllow, --insecure-port=8080, --tls-cipher-suites=TLS_RSA_WITH_RC4_128_SHA]
+`)})
+	for _, check := range []string{"anonymous-auth", "authorization-mode", "audit-log", "encryption-provider-config", "profiling", "insecure-port", "tls-cipher-suites"} {
+		assert.Equal(t, StatusFail, r[APIServer+"/"+check].Status, check)
+	}
+}
+
+func TestParseFiles(t *testing.T) {
+	data := base64.StdEncoding.EncodeToString([]byte(apiServerManifest))
+	files, warnings := ParseFiles([]byte("file\t/etc/kubernetes/manifests/kube-apiserver.yaml\t" + data + "\nfile\t/etc/kubernetes/manifests/bad.yaml\t!!\nwarning\tsomething\n"))
+	require.Len(t, files, 1)
+	assert.Equal(t, "/etc/kubernetes/manifests/kube-apiserver.yaml", files[0].Path)
+	assert.Equal(t, apiServerManifest, string(files[0].Data))
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "failed to decode /etc/kubernetes/manifests/bad.yaml")
+	assert.Equal(t, "something", warnings[1])
+}
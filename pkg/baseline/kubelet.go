@@ -0,0 +1,357 @@
+package baseline
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"sigs.k8s.io/yaml"
+)
+
+// Kubelet is the component name of the kubelet checks.
+const Kubelet = "kubelet"
+
+// KubeletConfigPath is where kubeadm writes the kubelet configuration file.
+const KubeletConfigPath = "/var/lib/kubelet/config.yaml"
+
+// KubeletDropInDirs are the systemd drop-in directories of the kubelet unit.
+var KubeletDropInDirs = []string{
+	"/etc/systemd/system/kubelet.service.d",
+	"/usr/lib/systemd/system/kubelet.service.d",
+	"/lib/systemd/system/kubelet.service.d",
+}
+
+// kubeletScript prints the command line of the kubelet process, then its
+// configuration file, taken from --config unless $config is set, and its
+// systemd drop-ins.
+const kubeletScript = `
+for d in /proc/[0-9]*; do
+  [ "$(cat "$d/comm" 2>/dev/null)" = kubelet ] || continue
+  printf 'cmdline'
+  tr '\0' '\n' < "$d/cmdline" | while IFS= read -r arg; do printf '\t%s' "$arg"; done
+  printf '\n'
+  [ -n "$config" ] || config=$(tr '\0' '\n' < "$d/cmdline" | awk 'p { print; exit } /^--config=/ { sub(/^--config=/, ""); print; exit } $0 == "--config" { p = 1 }')
+  break
+done
+[ -n "$config" ] || config=` + KubeletConfigPath + `
+printf 'config\t%s\n' "$config"
+dir=${config%/*}
+patterns=${config##*/}
+(` + filesScript + `)
+for dir in $dropins; do
+  [ -d "` + tasks.HostRoot + `$dir" ] || continue
+  patterns='*.conf'
+  (` + filesScript + `)
+done
+`
+
+// KubeletScript collects the kubelet configuration of the node. configPath,
+// the configuration file on the host, overrides the --config of the kubelet.
+func KubeletScript(configPath string) string {
+	return "config=" + shell.Quote(configPath) + "\n" +
+		"dropins=" + shell.Quote(strings.Join(KubeletDropInDirs, " ")) + "\n" +
+		kubeletScript
+}
+
+// KubeletConfig is the configuration of a kubelet.
+type KubeletConfig struct {
+	// Args is the command line of the kubelet process, nil when it is not
+	// running.
+	Args  []string
+	Flags map[string]string
+	// ConfigPath is the configuration file, Config its content when it
+	// exists.
+	ConfigPath string
+	Config     *File
+	DropIns    []File
+
+	settings map[string]interface{}
+}
+
+// ParseKubelet parses the output of KubeletScript.
+func ParseKubelet(output []byte) (*KubeletConfig, []string) {
+	k := &KubeletConfig{Flags: map[string]string{}}
+	var (
+		rest     bytes.Buffer
+		warnings []string
+	)
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), "\t")
+		switch fields[0] {
+		case "cmdline":
+			k.Args = fields[1:]
+			if len(k.Args) > 0 {
+				k.Flags = parseFlags(k.Args[1:])
+			}
+		case "config":
+			if len(fields) > 1 {
+				k.ConfigPath = fields[1]
+			}
+		default:
+			rest.WriteString(sc.Text() + "\n")
+		}
+	}
+
+	files, fileWarnings := ParseFiles(rest.Bytes())
+	warnings = append(warnings, fileWarnings...)
+	if k.Args == nil {
+		warnings = append(warnings, "no kubelet process found, its flags are unknown")
+	}
+	for i := range files {
+		if files[i].Path == k.ConfigPath {
+			k.Config = &files[i]
+			continue
+		}
+		k.DropIns = append(k.DropIns, files[i])
+	}
+	if k.Config != nil {
+		if err := yaml.Unmarshal(k.Config.Data, &k.settings); err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to parse %s: %s", k.ConfigPath, err))
+		}
+	}
+	return k, warnings
+}
+
+// setting returns a field of the configuration file, given by its path.
+func (k *KubeletConfig) setting(field string) (string, bool) {
+	var v interface{} = k.settings
+	for _, key := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[key]; !ok {
+			return "", false
+		}
+	}
+	if v == nil {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// settingEvidence locates a field of the configuration file, each key of its
+// path being searched below the previous one.
+func (k *KubeletConfig) settingEvidence(field string) string {
+	lines := strings.Split(string(k.Config.Data), "\n")
+	keys := strings.Split(field, ".")
+	from := 0
+	for i, key := range keys {
+		re := regexp.MustCompile(`^\s*"?` + regexp.QuoteMeta(key) + `"?\s*:`)
+		found := false
+		for n := from; n < len(lines); n++ {
+			if re.MatchString(lines[n]) {
+				from, found = n, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		if i == len(keys)-1 {
+			return fmt.Sprintf("%s:%d: %s", k.Config.Path, from+1, strings.TrimSpace(lines[from]))
+		}
+		from++
+	}
+	value, _ := k.setting(field)
+	return fmt.Sprintf("%s: %s: %s", k.Config.Path, field, value)
+}
+
+// kubeletSetting is a checked kubelet setting, read from its flag, then
+// from its configuration file field, then from the defaults, which differ
+// when the kubelet runs without a configuration file.
+type kubeletSetting struct {
+	check         string
+	field         string
+	flag          string
+	configDefault string
+	flagDefault   string
+	expected      string
+	evaluate      func(value string) string
+}
+
+// minEventRecordQPS is the default event rate limit of the kubelet before
+// Kubernetes 1.27, lower limits drop events an investigation relies on.
+const minEventRecordQPS = 5
+
+var kubeletSettings = []kubeletSetting{
+	{"anonymous-auth", "authentication.anonymous.enabled", "anonymous-auth", "false", "true", "false", equals("false")},
+	{"authorization-mode", "authorization.mode", "authorization-mode", "Webhook", "AlwaysAllow", "Webhook", equals("Webhook")},
+	{"read-only-port", "readOnlyPort", "read-only-port", "0", "10255", "0", equals("0")},
+	{"protect-kernel-defaults", "protectKernelDefaults", "protect-kernel-defaults", "false", "false", "true", equals("true")},
+	{"rotate-certificates", "rotateCertificates", "rotate-certificates", "false", "false", "true", equals("true")},
+	{"event-record-qps", "eventRecordQPS", "event-qps", "50", "50", fmt.Sprintf("at least %d, 0 is unlimited", minEventRecordQPS), evaluateEventQPS},
+	{"streaming-connection-idle-timeout", "streamingConnectionIdleTimeout", "streaming-connection-idle-timeout", "4h0m0s", "4h0m0s", "not 0", evaluateIdleTimeout},
+}
+
+func equals(expected string) func(string) string {
+	return func(value string) string {
+		if value == expected {
+			return StatusPass
+		}
+		return StatusFail
+	}
+}
+
+func evaluateEventQPS(value string) string {
+	qps, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return StatusWarn
+	case qps == 0:
+		// Unlimited events keep every event but let a noisy pod flood the
+		// API server.
+		return StatusWarn
+	case qps < minEventRecordQPS:
+		return StatusFail
+	}
+	return StatusPass
+}
+
+func evaluateIdleTimeout(value string) string {
+	d, err := time.ParseDuration(value)
+	switch {
+	case err != nil:
+		return StatusWarn
+	case d == 0:
+		return StatusFail
+	}
+	return StatusPass
+}
+
+// AuditKubelet checks the effective kubelet settings. Flags take precedence
+// over the configuration file.
+func AuditKubelet(k *KubeletConfig) []Result {
+	var results []Result
+	for _, s := range kubeletSettings {
+		r := Result{Component: Kubelet, Check: s.check, Expected: s.expected}
+		if value, ok := k.Flags[s.flag]; ok {
+			r.Value = value
+			r.Evidence = append(r.Evidence, fmt.Sprintf("kubelet command line: --%s=%s", s.flag, value))
+		} else if value, ok := k.setting(s.field); ok {
+			r.Value = value
+			r.Evidence = append(r.Evidence, k.settingEvidence(s.field))
+		} else if k.Config != nil {
+			r.Value = s.configDefault
+			r.Evidence = append(r.Evidence, fmt.Sprintf("%s: %s not set, defaults to %s", k.Config.Path, s.field, s.configDefault))
+		} else {
+			r.Value = s.flagDefault
+			r.Evidence = append(r.Evidence, fmt.Sprintf("--%s not set and no configuration file, defaults to %s", s.flag, s.flagDefault))
+		}
+		// Drop-ins may set the flag through an environment variable the
+		// command line does not tell apart.
+		re := regexp.MustCompile(`--` + regexp.QuoteMeta(s.flag) + `(=|["'\s]|$)`)
+		for i := range k.DropIns {
+			if line, ok := k.DropIns[i].evidence(re); ok {
+				r.Evidence = append(r.Evidence, line)
+			}
+		}
+		r.Status = s.evaluate(r.Value)
+		results = append(results, r)
+	}
+	return results
+}
+
+// PoolLabels are the node labels naming the node pool of a node, in the
+// order they are looked up.
+var PoolLabels = []string{
+	"cloud.google.com/gke-nodepool",
+	"eks.amazonaws.com/nodegroup",
+	"kubernetes.azure.com/agentpool",
+	"karpenter.sh/nodepool",
+	"node.kubernetes.io/pool",
+}
+
+// NodePool returns the pool of a node from label when set, else from the
+// labels of the managed node pools, else from its role.
+func NodePool(labels map[string]string, label string) string {
+	if label != "" {
+		return labels[label]
+	}
+	for _, l := range PoolLabels {
+		if pool, ok := labels[l]; ok {
+			return pool
+		}
+	}
+	if IsControlPlane(labels) {
+		return "control-plane"
+	}
+	return "worker"
+}
+
+// DriftValue is a value of a drifting setting and the nodes using it.
+type DriftValue struct {
+	Value string   `json:"value"`
+	Nodes []string `json:"nodes"`
+}
+
+// Drift is a setting whose value differs between the nodes of a pool.
+type Drift struct {
+	Pool   string       `json:"pool"`
+	Check  string       `json:"check"`
+	Values []DriftValue `json:"values"`
+}
+
+// String describes which nodes use which value.
+func (d Drift) String() string {
+	var parts []string
+	for _, v := range d.Values {
+		parts = append(parts, fmt.Sprintf("%s on %s", v.Value, strings.Join(v.Nodes, ",")))
+	}
+	return fmt.Sprintf("%s differs in pool %s: %s", d.Check, d.Pool, strings.Join(parts, "; "))
+}
+
+// DetectDrift compares the values of the checks between the nodes of each
+// pool. pools maps the nodes to their pool.
+func DetectDrift(results []Result, pools map[string]string) []Drift {
+	// values maps pool, then check, then value to the nodes.
+	values := map[string]map[string]map[string][]string{}
+	for _, r := range results {
+		pool := pools[r.Node]
+		if values[pool] == nil {
+			values[pool] = map[string]map[string][]string{}
+		}
+		if values[pool][r.Check] == nil {
+			values[pool][r.Check] = map[string][]string{}
+		}
+		values[pool][r.Check][r.Value] = append(values[pool][r.Check][r.Value], r.Node)
+	}
+
+	var drifts []Drift
+	for pool, checks := range values {
+		for check, byValue := range checks {
+			if len(byValue) < 2 {
+				continue
+			}
+			d := Drift{Pool: pool, Check: check}
+			for value, nodes := range byValue {
+				sort.Strings(nodes)
+				d.Values = append(d.Values, DriftValue{Value: value, Nodes: nodes})
+			}
+			// The value of the fewest nodes is the likely odd one out.
+			sort.Slice(d.Values, func(i, j int) bool {
+				if len(d.Values[i].Nodes) != len(d.Values[j].Nodes) {
+					return len(d.Values[i].Nodes) < len(d.Values[j].Nodes)
+				}
+				return d.Values[i].Value < d.Values[j].Value
+			})
+			drifts = append(drifts, d)
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Pool != drifts[j].Pool {
+			return drifts[i].Pool < drifts[j].Pool
+		}
+		return drifts[i].Check < drifts[j].Check
+	})
+	return drifts
+}
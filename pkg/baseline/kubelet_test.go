@@ -0,0 +1,109 @@
+package baseline
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kubeletConfig = `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    enabled: true
+authorization:
+  mode: Webhook
+protectKernelDefaults: true
+eventRecordQPS: 2
+streamingConnectionIdleTimeout: 0s
+`
+
+const kubeletDropIn = `[Service]
+Environment="KUBELET_EXTRA_ARGS=--read-only-port=10255"
+ExecStart=
+ExecStart=/usr/bin/kubelet $KUBELET_CONFIG_ARGS $KUBELET_EXTRA_ARGS
+`
+
+func kubeletOutput(files ...File) []byte {
+	out := "cmdline\t/usr/bin/kubelet\t--config=/var/lib/kubelet/config.yaml\t--read-only-port=10255\t--node-ip=10.0.0.21\n" +
+		"config\t/var/lib/kubelet/config.yaml\n"
+	for _, f := range files {
+		out += "file\t" + f.Path + "\t" + base64.StdEncoding.EncodeToString(f.Data) + "\n"
+	}
+	return []byte(out)
+}
+
+func TestAuditKubelet(t *testing.T) {
+	k, warnings := ParseKubelet(kubeletOutput(
+		File{Path: "/var/lib/kubelet/config.yaml", Data: []byte(kubeletConfig)},
+		File{Path: "/etc/systemd/system/kubelet.service.d/20-extra.conf", Data: []byte(kubeletDropIn)},
+	))
+	assert.Empty(t, warnings)
+	require.NotNil(t, k.Config)
+	require.Len(t, k.DropIns, 1)
+	assert.Equal(t, "10.0.0.21", k.Flags["node-ip"])
+
+	r := map[string]Result{}
+	for _, res := range AuditKubelet(k) {
+		r[res.Check] = res
+	}
+	assert.Equal(t, Result{
+		Component: Kubelet, Check: "anonymous-auth", Status: StatusPass, Value: "false", Expected: "false",
+		Evidence: []string{"/var/lib/kubelet/config.yaml:5: enabled: false"},
+	}, r["anonymous-auth"])
+	assert.Equal(t, StatusPass, r["authorization-mode"].Status)
+	assert.Equal(t, Result{
+		Component: Kubelet, Check: "read-only-port", Status: StatusFail, Value: "10255", Expected: "0",
+		Evidence: []string{
+			"kubelet command line: --read-only-port=10255",
+			`/etc/systemd/system/kubelet.service.d/20-extra.conf:2: Environment="KUBELET_EXTRA_ARGS=--read-only-port=10255"`,
+		},
+	}, r["read-only-port"])
+	assert.Equal(t, StatusPass, r["protect-kernel-defaults"].Status)
+	assert.Equal(t, StatusFail, r["rotate-certificates"].Status)
+	assert.Equal(t, []string{"/var/lib/kubelet/config.yaml: rotateCertificates not set, defaults to false"}, r["rotate-certificates"].Evidence)
+	assert.Equal(t, StatusFail, r["event-record-qps"].Status)
+	assert.Equal(t, StatusFail, r["streaming-connection-idle-timeout"].Status)
+	assert.Equal(t, "0s", r["streaming-connection-idle-timeout"].Value)
+}
+
+func TestAuditKubeletWithoutConfig(t *testing.T) {
+	k, warnings := ParseKubelet([]byte("config\t/var/lib/kubelet/config.yaml\nwarning\tno config.yaml file found in /var/lib/kubelet\n"))
+	assert.Equal(t, []string{"no config.yaml file found in /var/lib/kubelet", "no kubelet process found, its flags are unknown"}, warnings)
+	for _, r := range AuditKubelet(k) {
+		switch r.Check {
+		case "anonymous-auth", "authorization-mode", "read-only-port", "protect-kernel-defaults", "rotate-certificates":
+			assert.Equal(t, StatusFail, r.Status, r.Check)
+		default:
+			assert.Equal(t, StatusPass, r.Status, r.Check)
+		}
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	pools := map[string]string{
+		"worker-1": NodePool(map[string]string{"eks.amazonaws.com/nodegroup": "apps"}, ""),
+		"worker-2": NodePool(map[string]string{"eks.amazonaws.com/nodegroup": "apps"}, ""),
+		"worker-3": NodePool(map[string]string{"eks.amazonaws.com/nodegroup": "apps"}, ""),
+		"batch-1":  NodePool(map[string]string{"pool": "batch"}, "pool"),
+	}
+	results := []Result{
+		{Node: "worker-1", Check: "read-only-port", Value: "0"},
+		{Node: "worker-2", Check: "read-only-port", Value: "10255"},
+		{Node: "worker-3", Check: "read-only-port", Value: "0"},
+		{Node: "worker-1", Check: "anonymous-auth", Value: "false"},
+		{Node: "worker-2", Check: "anonymous-auth", Value: "false"},
+		{Node: "batch-1", Check: "read-only-port", Value: "10255"},
+	}
+	drifts := DetectDrift(results, pools)
+	require.Len(t, drifts, 1)
+	assert.Equal(t, Drift{Pool: "apps", Check: "read-only-port", Values: []DriftValue{
+		{Value: "10255", Nodes: []string{"worker-2"}},
+		{Value: "0", Nodes: []string{"worker-1", "worker-3"}},
+	}}, drifts[0])
+	assert.Equal(t, "read-only-port differs in pool apps: 10255 on worker-2; 0 on worker-1,worker-3", drifts[0].String())
+}
@@ -0,0 +1,143 @@
+// Package checkpoint requests container checkpoints from the kubelet and
+// inspects the resulting archives. The kubelet checkpoint API, behind the
+// ContainerCheckpoint feature gate, asks the container runtime to dump the
+// container with CRIU without stopping it and writes a tar archive with the
+// process images and the filesystem changes below /var/lib/kubelet/checkpoints.
+package checkpoint
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/rest"
+)
+
+// Dir is the directory the kubelet writes checkpoint archives to.
+const Dir = "/var/lib/kubelet/checkpoints"
+
+// response is the body returned by the kubelet checkpoint endpoint.
+type response struct {
+	Items []string `json:"items"`
+}
+
+// Request checkpoints a container through the node proxy of the API server
+// and returns the paths of the archives written on the node. A zero timeout
+// keeps the kubelet default.
+func Request(ctx context.Context, c rest.Interface, ref kube.ContainerRef, nodeName string, timeout time.Duration) ([]string, error) {
+	req := c.Post().
+		Resource("nodes").
+		Name(nodeName).
+		SubResource("proxy").
+		Suffix("checkpoint", ref.Namespace, ref.Pod, ref.Container)
+	if timeout > 0 {
+		req = req.Param("timeout", strconv.Itoa(int(timeout.Seconds())))
+	}
+
+	body, err := req.DoRaw(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("the kubelet of %s does not serve the checkpoint API, is the ContainerCheckpoint feature gate enabled? %w", nodeName, err)
+		}
+		return nil, fmt.Errorf("failed to checkpoint container %s: %w", ref, err)
+	}
+
+	return ParseResponse(body)
+}
+
+// ParseResponse returns the archive paths of a checkpoint response.
+func ParseResponse(body []byte) ([]string, error) {
+	var r response
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint response: %w", err)
+	}
+	if len(r.Items) == 0 {
+		return nil, fmt.Errorf("the checkpoint response lists no archive")
+	}
+	for _, item := range r.Items {
+		if !strings.HasPrefix(path.Clean(item), Dir+"/") {
+			return nil, fmt.Errorf("checkpoint archive %s is outside of %s", item, Dir)
+		}
+	}
+	return r.Items, nil
+}
+
+// Info summarizes the content of a checkpoint archive.
+type Info struct {
+	Entries        int   `json:"entries"`
+	Images         int   `json:"images"`
+	PagesSize      int64 `json:"pagesSize"`
+	RootfsDiffSize int64 `json:"rootfsDiffSize"`
+	HasSpec        bool  `json:"hasSpec"`
+	HasConfig      bool  `json:"hasConfig"`
+	DeletedFiles   bool  `json:"deletedFiles"`
+}
+
+// Inspect reads a checkpoint archive and fails if it is not a readable tar
+// archive holding CRIU images.
+func Inspect(r io.Reader) (Info, error) {
+	var info Info
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return info, fmt.Errorf("failed to read checkpoint archive: %w", err)
+		}
+		// Reading the entry checks the archive is complete.
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return info, fmt.Errorf("failed to read %s of checkpoint archive: %w", hdr.Name, err)
+		}
+		info.Entries++
+
+		name := strings.TrimPrefix(path.Clean(hdr.Name), "./")
+		switch {
+		case strings.HasPrefix(name, "checkpoint/") && strings.HasSuffix(name, ".img"):
+			info.Images++
+			if strings.HasPrefix(path.Base(name), "pages-") {
+				info.PagesSize += hdr.Size
+			}
+		case name == "rootfs-diff.tar":
+			info.RootfsDiffSize = hdr.Size
+		case name == "spec.dump":
+			info.HasSpec = true
+		case name == "config.dump":
+			info.HasConfig = true
+		case name == "deleted.files":
+			info.DeletedFiles = true
+		}
+	}
+
+	if info.Images == 0 {
+		return info, fmt.Errorf("checkpoint archive holds no CRIU image")
+	}
+	return info, nil
+}
+
+// CopyScript writes the checkpoint archive at source on the node to standard
+// output.
+func CopyScript(source string) string {
+	return "cat " + shell.Quote(tasks.HostRoot+path.Clean(source))
+}
+
+// HashScript prints the SHA-256 of the checkpoint archive at source.
+func HashScript(source string) string {
+	return "sha256sum < " + shell.Quote(tasks.HostRoot+path.Clean(source)) + " | cut -d ' ' -f 1"
+}
+
+// RemoveScript removes the checkpoint archive at source from the node.
+func RemoveScript(source string) string {
+	return "rm -f " + shell.Quote(tasks.HostRoot+path.Clean(source))
+}
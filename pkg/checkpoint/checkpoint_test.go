@@ -0,0 +1,99 @@
+package checkpoint
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+func testClient(t *testing.T, handler http.HandlerFunc) rest.Interface {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := rest.RESTClientFor(&rest.Config{
+		Host:    srv.URL,
+		APIPath: "/api",
+		ContentConfig: rest.ContentConfig{
+			GroupVersion:         &corev1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		},
+	})
+	require.NoError(t, err)
+	return c
+}
+
+func TestRequest(t *testing.T) {
+	ref := kube.ContainerRef{Namespace: "shop", Pod: "web-1", Container: "nginx"}
+
+	c := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/v1/nodes/worker-1/proxy/checkpoint/shop/web-1/nginx", r.URL.Path)
+		assert.Equal(t, "120", r.URL.Query().Get("timeout"))
+		w.Write([]byte(`{"items":["/var/lib/kubelet/checkpoints/checkpoint-web-1_shop-nginx-2026-10-18T16:00:00Z.tar"]}`))
+	})
+	items, err := Request(context.Background(), c, ref, "worker-1", 2*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/var/lib/kubelet/checkpoints/checkpoint-web-1_shop-nginx-2026-10-18T16:00:00Z.tar"}, items)
+
+	c = testClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.NotFound(w, nil)
+	})
+	_, err = Request(context.Background(), c, ref, "worker-1", 0)
+	assert.ErrorContains(t, err, "ContainerCheckpoint feature gate")
+}
+
+func TestParseResponse(t *testing.T) {
+	_, err := ParseResponse([]byte(`{"items":[]}`))
+	assert.Error(t, err)
+	_, err = ParseResponse([]byte(`{"items":["/var/lib/kubelet/checkpoints/../../../etc/shadow"]}`))
+	assert.Error(t, err)
+	_, err = ParseResponse([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestInspect(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, size := range map[string]int{
+		"config.dump":               10,
+		"spec.dump":                 10,
+		"rootfs-diff.tar":           2048,
+		"checkpoint/inventory.img":  4,
+		"checkpoint/pages-1.img":    4096,
+		"checkpoint/pagemap-1.img":  8,
+		"checkpoint/pstree.img":     4,
+		"./checkpoint/pages-2.img":  4096,
+		"checkpoint/stats-dump.log": 1,
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(size)}))
+		_, err := tw.Write(make([]byte, size))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	info, err := Inspect(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 9, info.Entries)
+	assert.Equal(t, 5, info.Images)
+	assert.Equal(t, int64(8192), info.PagesSize)
+	assert.Equal(t, int64(2048), info.RootfsDiffSize)
+	assert.True(t, info.HasSpec)
+	assert.True(t, info.HasConfig)
+	assert.False(t, info.DeletedFiles)
+
+	_, err = Inspect(bytes.NewReader(buf.Bytes()[:1000]))
+	assert.Error(t, err)
+	_, err = Inspect(bytes.NewReader([]byte("not a tar archive")))
+	assert.Error(t, err)
+}
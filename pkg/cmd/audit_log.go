@@ -0,0 +1,331 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/audit"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type auditLogOpts struct {
+	globalOptions
+	Output          string   `longflag:"output" shortflag:"o"`
+	Nodes           []string `longflag:"node"`
+	LogPath         string   `longflag:"log-path"`
+	DumpDir         string   `longflag:"dump-dir"`
+	Users           []string `longflag:"user"`
+	ServiceAccounts []string `longflag:"service-account"`
+	Verbs           []string `longflag:"verb"`
+	Resources       []string `longflag:"resource"`
+	SourceIPs       []string `longflag:"source-ip"`
+	Since           string   `longflag:"since"`
+	Until           string   `longflag:"until"`
+	Queries         []string `longflag:"query" shortflag:"q"`
+}
+
+func (opts *auditLogOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func auditLogCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &auditLogOpts{}
+
+	var queries []string
+	for _, q := range audit.Queries {
+		queries = append(queries, fmt.Sprintf("  %-16s%s", q.Name, q.Description))
+	}
+
+	cmd := &cobra.Command{
+		Use:   "audit-log [file...]",
+		Short: "Build a timeline from API server audit logs, filtered or with built-in queries",
+		Long: `Build a timeline from API server audit logs, filtered or with built-in queries.
+
+Audit logs are JSON lines files, gzipped rotated files are read as well. They
+are given as local files or pulled from control plane nodes with --node: the
+forensic pod finds the log from the --audit-log-path of kube-apiserver, or
+from --log-path, and copies it with its rotated files into --dump-dir, where
+they are recorded as evidence before being analyzed. The current log keeps
+growing, it is copied to a temporary file of the forensic pod first and that
+snapshot is hashed and pulled.
+
+Events are kept when they match every filter given and, with --query, one of
+the built-in queries:
+
+` + strings.Join(queries, "\n") + `
+
+A request logged at several stages appears once, at the time it was received.`,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			logger := newLogger(opts.Verbose, opts.LogFormat)
+			if len(opts.Nodes) == 0 {
+				return runAuditLogCmd(nil, logger, opts, args)
+			}
+
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runAuditLogCmd(st, st.Logger, opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringSliceVar(&opts.Nodes,
+		longFlagName(opts, "Nodes"),
+		nil,
+		"control plane nodes to pull the audit logs from")
+
+	cmd.Flags().StringVar(&opts.LogPath,
+		longFlagName(opts, "LogPath"),
+		"",
+		"path of the audit log on the nodes, instead of the one kube-apiserver is configured with")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"evidence",
+		"evidence directory the pulled audit logs are written to")
+
+	cmd.Flags().StringSliceVar(&opts.Users,
+		longFlagName(opts, "Users"),
+		nil,
+		"only keep requests of these users, authenticated or impersonated")
+
+	cmd.Flags().StringSliceVar(&opts.ServiceAccounts,
+		longFlagName(opts, "ServiceAccounts"),
+		nil,
+		"only keep requests of these service accounts, given as namespace/name")
+
+	cmd.Flags().StringSliceVar(&opts.Verbs,
+		longFlagName(opts, "Verbs"),
+		nil,
+		"only keep requests with these verbs")
+
+	cmd.Flags().StringSliceVar(&opts.Resources,
+		longFlagName(opts, "Resources"),
+		nil,
+		"only keep requests on these resources, e.g. secrets or pods/exec")
+
+	cmd.Flags().StringSliceVar(&opts.SourceIPs,
+		longFlagName(opts, "SourceIPs"),
+		nil,
+		"only keep requests from these addresses or networks")
+
+	cmd.Flags().StringVar(&opts.Since,
+		longFlagName(opts, "Since"),
+		"",
+		"only keep requests received at or after this time (RFC3339 or YYYY-MM-DD)")
+
+	cmd.Flags().StringVar(&opts.Until,
+		longFlagName(opts, "Until"),
+		"",
+		"only keep requests received at or before this time (RFC3339 or YYYY-MM-DD)")
+
+	cmd.Flags().StringSliceVarP(&opts.Queries,
+		longFlagName(opts, "Queries"),
+		shortFlagName(opts, "Queries"),
+		nil,
+		"only keep requests matching one of these built-in queries")
+
+	return cmd
+}
+
+// runAuditLogCmd analyzes local audit logs and the ones pulled from the
+// nodes. st is only set when logs are pulled.
+func runAuditLogCmd(st *state.State, logger logrus.FieldLogger, opts *auditLogOpts, files []string) error {
+	if len(files) == 0 && len(opts.Nodes) == 0 {
+		return fmt.Errorf("give audit log files or the nodes to pull them from with --node")
+	}
+
+	filter, queries, err := auditLogFilter(opts)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range opts.Nodes {
+		pulled, err := pullAuditLogs(st, opts, node)
+		if err != nil {
+			return err
+		}
+		files = append(files, pulled...)
+	}
+
+	timeline := audit.NewTimeline(filter, queries)
+	for _, name := range files {
+		f, err := audit.Open(name)
+		if err != nil {
+			return err
+		}
+		skipped, err := audit.Read(f, func(e *audit.Event) error {
+			timeline.Add(e)
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if skipped > 0 {
+			logger.Warn(fmt.Sprintf("Skipped %d lines of %s that are not audit events", skipped, name))
+		}
+	}
+	entries := timeline.Entries()
+
+	return printReport(opts.Output, entries, func(w io.Writer) {
+		fmt.Fprintln(w, "TIME\tUSER\tSOURCE\tVERB\tOBJECT\tCODE\tQUERY\tDETAIL")
+		for _, e := range entries {
+			user := e.User
+			if e.Impersonated != "" {
+				user += " as " + e.Impersonated
+			}
+			code := ""
+			if e.Code != 0 {
+				code = strconv.Itoa(int(e.Code))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Time.Format("2006-01-02 15:04:05.000"), user, e.SourceIP, e.Verb, e.Object, code,
+				strings.Join(e.Queries, ","), e.Detail)
+		}
+	})
+}
+
+func auditLogFilter(opts *auditLogOpts) (audit.Filter, []audit.Query, error) {
+	filter := audit.Filter{
+		Users:     opts.Users,
+		Verbs:     opts.Verbs,
+		Resources: opts.Resources,
+	}
+	for _, sa := range opts.ServiceAccounts {
+		user, err := audit.ServiceAccountUser(sa)
+		if err != nil {
+			return filter, nil, err
+		}
+		filter.Users = append(filter.Users, user)
+	}
+
+	var err error
+	if filter.SourceIPs, err = audit.ParseNetworks(opts.SourceIPs); err != nil {
+		return filter, nil, err
+	}
+	if filter.Since, err = parseTime(opts.Since); err != nil {
+		return filter, nil, err
+	}
+	if filter.Until, err = parseTime(opts.Until); err != nil {
+		return filter, nil, err
+	}
+
+	var queries []audit.Query
+	for _, name := range opts.Queries {
+		q, err := audit.LookupQuery(name)
+		if err != nil {
+			return filter, nil, err
+		}
+		queries = append(queries, q)
+	}
+	return filter, queries, nil
+}
+
+// pullAuditLogs acquires the audit logs of a node into the evidence directory
+// and returns the local copies.
+func pullAuditLogs(st *state.State, opts *auditLogOpts, nodeName string) ([]string, error) {
+	manifest, err := evidence.Open(opts.DumpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Pulling the audit logs of %s", nodeName))
+
+	var (
+		logs  []audit.LogFile
+		files []string
+	)
+	dir := path.Join(nodeName, "audit", time.Now().UTC().Format("20060102T150405Z"))
+	err = runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "find the audit logs", audit.LogFilesScript(opts.LogPath), func(output []byte) error {
+			var warnings []string
+			logs, warnings = audit.ParseLogFiles(output)
+			for _, w := range warnings {
+				st.Logger.Warn(fmt.Sprintf("%s: %s", nodeName, w))
+			}
+			return nil
+		}),
+		tasks.Task{
+			Description: "copy the audit logs",
+			Predicate: func(_ *state.State) bool {
+				return len(logs) > 0
+			},
+			Fn: func(s *state.State) error {
+				for _, l := range logs {
+					item := evidence.Item{
+						Name:        path.Join(dir, path.Base(l.Source)),
+						Source:      l.Source,
+						Description: fmt.Sprintf("API server audit log %s of %s", l.Source, nodeName),
+					}
+					if err := acquireAuditLog(s, nodeName, manifest, item, l); err != nil {
+						// The current log may be rotated while it is copied,
+						// the other files are still useful.
+						s.Logger.Warnf("Failed to copy %s: %s", l.Source, err)
+						continue
+					}
+					files = append(files, filepath.Join(manifest.Dir, item.Name))
+				}
+				return nil
+			},
+		},
+	)
+	return files, err
+}
+
+// acquireAuditLog copies an audit log file into the evidence directory. The
+// live log is copied to a temporary file of the forensic pod first, the API
+// server keeps appending to it and the hash taken in the pod would never match
+// the streamed copy otherwise.
+func acquireAuditLog(s *state.State, nodeName string, manifest *evidence.Manifest, item evidence.Item, l audit.LogFile) error {
+	if l.Live {
+		err := tasks.ExecuteCollect(s, nodeName, "snapshot "+l.Source, audit.SnapshotScript(l), func(output []byte) error {
+			l.Path = strings.TrimSpace(string(output))
+			if l.Path == "" {
+				return fmt.Errorf("no snapshot of %s was made", l.Source)
+			}
+			return nil
+		}).Fn(s)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			remove := tasks.ExecuteStream(s, nodeName, "remove the snapshot of "+l.Source, audit.RemoveSnapshotScript(l.Path), io.Discard)
+			if err := remove.Fn(s); err != nil {
+				s.Logger.Warnf("Failed to remove the snapshot %s of %s: %s", l.Path, l.Source, err)
+			}
+		}()
+		item.Description += ", snapshot taken in the forensic pod"
+	}
+
+	return tasks.AcquireEvidence(s, nodeName, manifest, item, audit.CopyScript(l), audit.HashScript(l)).Fn(s)
+}
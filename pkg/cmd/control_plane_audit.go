@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/baseline"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type controlPlaneAuditOpts struct {
+	globalOptions
+	Output       string `longflag:"output" shortflag:"o"`
+	ManifestsDir string `longflag:"manifests-dir"`
+	FailedOnly   bool   `longflag:"failed-only"`
+}
+
+func (opts *controlPlaneAuditOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func controlPlaneAuditCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &controlPlaneAuditOpts{}
+	cmd := &cobra.Command{
+		Use:   "control-plane-audit [node-name...]",
+		Short: "Check the control plane static pod manifests against a security baseline",
+		Long: `Check the control plane static pod manifests against a security baseline.
+
+The static pod manifests of the control plane nodes are read through the
+forensic pod and the flags of kube-apiserver, kube-controller-manager,
+kube-scheduler and etcd are checked for:
+
+  anonymous-auth               anonymous requests are rejected
+  authorization-mode           RBAC and Node authorizers, never AlwaysAllow
+  audit-log                    an audit policy and a log file or webhook
+  encryption-provider-config   Secrets are encrypted at rest
+  profiling                    profiling endpoints are disabled
+  insecure-port                no plain HTTP port is served
+  tls-cipher-suites            no weak cipher suite or TLS version
+  client-cert-auth, auto-tls   etcd only accepts clients with a trusted certificate
+
+Every check passes, fails or warns when it relies on defaults or a
+configuration file, with the manifest lines it is based on as evidence.
+
+Nodes labeled as control plane are audited unless nodes are given.`,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runControlPlaneAuditCmd(st, opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.ManifestsDir,
+		longFlagName(opts, "ManifestsDir"),
+		baseline.ManifestsDir,
+		"host directory of the static pod manifests")
+
+	cmd.Flags().BoolVar(&opts.FailedOnly,
+		longFlagName(opts, "FailedOnly"),
+		false,
+		"only report the failed and warning checks")
+
+	return cmd
+}
+
+// runControlPlaneAuditCmd audits the nodes one after the other. A node that
+// can not be audited is logged and does not stop the audit.
+func runControlPlaneAuditCmd(st *state.State, opts *controlPlaneAuditOpts, nodeNames []string) error {
+	if len(nodeNames) == 0 {
+		var err error
+		if nodeNames, err = controlPlaneNodes(st); err != nil {
+			return err
+		}
+		if len(nodeNames) == 0 {
+			return fmt.Errorf("no control plane node found, pass node names")
+		}
+	}
+
+	results := []baseline.Result{}
+	failed := 0
+	for _, nodeName := range nodeNames {
+		st.Logger.Info(fmt.Sprintf("Auditing the static pod manifests of %s", nodeName))
+
+		var manifests []baseline.File
+		err := runOnNode(st, nodeName,
+			tasks.ExecuteCollect(st, nodeName, "read the static pod manifests", baseline.FilesScript(opts.ManifestsDir, baseline.ManifestPatterns), func(output []byte) error {
+				var warnings []string
+				manifests, warnings = baseline.ParseFiles(output)
+				for _, w := range warnings {
+					st.Logger.Warn(fmt.Sprintf("%s: %s", nodeName, w))
+				}
+				return nil
+			}),
+		)
+		if err != nil {
+			st.Logger.Errorf("Audit of %s failed: %v", nodeName, err)
+			failed++
+			continue
+		}
+
+		nodeResults, warnings := baseline.AuditControlPlane(manifests)
+		for _, w := range warnings {
+			st.Logger.Warn(fmt.Sprintf("%s: %s", nodeName, w))
+		}
+		for _, r := range nodeResults {
+			r.Node = nodeName
+			if opts.FailedOnly && r.Status == baseline.StatusPass {
+				continue
+			}
+			results = append(results, r)
+		}
+	}
+	if failed == len(nodeNames) {
+		return fmt.Errorf("no node could be audited")
+	}
+
+	return printReport(opts.Output, results, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tCOMPONENT\tCHECK\tSTATUS\tEVIDENCE")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Node, r.Component, r.Check, r.Status, strings.Join(r.Evidence, "; "))
+		}
+	})
+}
+
+// controlPlaneNodes returns the names of the nodes labeled as control plane.
+func controlPlaneNodes(st *state.State) ([]string, error) {
+	var nodes corev1.NodeList
+	if err := st.K8sClient.List(st.Context, &nodes); err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	var names []string
+	for _, n := range nodes.Items {
+		if baseline.IsControlPlane(n.Labels) {
+			names = append(names, n.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
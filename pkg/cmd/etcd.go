@@ -0,0 +1,439 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/etcd"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type etcdSnapshotOpts struct {
+	globalOptions
+	Output   string `longflag:"output" shortflag:"o"`
+	DumpDir  string `longflag:"dump-dir"`
+	Endpoint string `longflag:"endpoint"`
+	CACert   string `longflag:"cacert"`
+	Cert     string `longflag:"cert"`
+	Key      string `longflag:"key"`
+}
+
+// etcdSnapshot is an acquired etcd snapshot.
+type etcdSnapshot struct {
+	Node     string              `json:"node"`
+	Path     string              `json:"path"`
+	SHA256   string              `json:"sha256"`
+	Size     int64               `json:"size"`
+	Verified bool                `json:"verified"`
+	Taken    time.Time           `json:"taken"`
+	Member   etcd.MemberStatus   `json:"member"`
+	Content  etcd.SnapshotStatus `json:"content"`
+}
+
+type etcdInspectOpts struct {
+	globalOptions
+	Output         string   `longflag:"output" shortflag:"o"`
+	Resources      []string `longflag:"resource"`
+	Namespace      string   `longflag:"namespace" shortflag:"n"`
+	Summary        bool     `longflag:"summary"`
+	IncludeDeleted bool     `longflag:"include-deleted"`
+	DumpDir        string   `longflag:"dump-dir"`
+	Diff           string   `longflag:"diff"`
+}
+
+// etcdResourceCount is the number of keys of a resource in a namespace.
+type etcdResourceCount struct {
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Keys      int    `json:"keys"`
+	Deleted   int    `json:"deleted,omitempty"`
+}
+
+func (opts *etcdSnapshotOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func etcdCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "etcd",
+		Short: "Acquire and read etcd snapshots of the cluster state",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(etcdSnapshotCmd(rootFlags))
+	cmd.AddCommand(etcdInspectCmd(rootFlags))
+
+	return cmd
+}
+
+func etcdSnapshotCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &etcdSnapshotOpts{}
+	cmd := &cobra.Command{
+		Use:   "snapshot [node-name]",
+		Short: "Take a consistent etcd snapshot on a control plane node and acquire it",
+		Long: `Take a consistent etcd snapshot on a control plane node and acquire it.
+
+The snapshot is taken through the forensic pod with the etcdctl of the etcd
+container, or the one of an --image built from build/forensic-pod, and the
+etcd client certificates of the node, by default the health check client
+kubeadm issues in ` + etcd.PKIDir + `. It is saved inside the forensic pod,
+never on the host, streamed into the evidence directory, checked against its
+hash on the node and removed.
+
+The status of the member, its cluster and member IDs, etcd version, raft term
+and revision, and the revision, hash and key count of the snapshot are
+recorded in the evidence manifest. The snapshot is a point-in-time copy of
+the cluster state that can be read with etcd inspect.
+
+The first control plane node is used unless a node is given.`,
+		Args:          cobra.MaximumNArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			nodeName := ""
+			if len(args) > 0 {
+				nodeName = args[0]
+			}
+			return runEtcdSnapshotCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"evidence",
+		"evidence directory the snapshot is written to")
+
+	cmd.Flags().StringVar(&opts.Endpoint,
+		longFlagName(opts, "Endpoint"),
+		"",
+		"etcd client URL, the first one etcd listens on by default")
+
+	cmd.Flags().StringVar(&opts.CACert,
+		longFlagName(opts, "CACert"),
+		etcd.DefaultCredentials.CACert,
+		"host path of the etcd CA certificate")
+
+	cmd.Flags().StringVar(&opts.Cert,
+		longFlagName(opts, "Cert"),
+		etcd.DefaultCredentials.Cert,
+		"host path of the etcd client certificate")
+
+	cmd.Flags().StringVar(&opts.Key,
+		longFlagName(opts, "Key"),
+		etcd.DefaultCredentials.Key,
+		"host path of the etcd client key")
+
+	return cmd
+}
+
+func runEtcdSnapshotCmd(st *state.State, opts *etcdSnapshotOpts, nodeName string) error {
+	if nodeName == "" {
+		nodes, err := controlPlaneNodes(st)
+		if err != nil {
+			return err
+		}
+		if len(nodes) == 0 {
+			return fmt.Errorf("no control plane node found, give the node etcd runs on")
+		}
+		nodeName = nodes[0]
+	}
+
+	manifest, err := evidence.Open(opts.DumpDir)
+	if err != nil {
+		return err
+	}
+
+	taken := time.Now().UTC()
+	out := "/tmp/etcd-snapshot-" + taken.Format("20060102T150405Z") + ".db"
+	item := evidence.Item{
+		Name:        path.Join(nodeName, "etcd", path.Base(out)),
+		Source:      out,
+		Description: "etcd snapshot of " + nodeName,
+	}
+	snapshot := etcdSnapshot{Node: nodeName, Taken: taken}
+	creds := etcd.Credentials{CACert: opts.CACert, Cert: opts.Cert, Key: opts.Key}
+
+	st.Logger.Info(fmt.Sprintf("Taking an etcd snapshot on %s", nodeName))
+	err = runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "take the etcd snapshot", etcd.SnapshotScript(creds, opts.Endpoint, out), func(output []byte) error {
+			var err error
+			snapshot.Member, snapshot.Content, err = etcd.ParseSnapshot(output)
+			return err
+		}),
+		tasks.Task{
+			Description: "acquire the etcd snapshot",
+			Fn: func(s *state.State) error {
+				item.Source = "etcd " + snapshot.Member.Endpoint + " at revision " + strconv.FormatInt(snapshot.Member.Revision, 10)
+				item.Metadata = map[string]string{
+					"endpoint":  snapshot.Member.Endpoint,
+					"clusterID": fmt.Sprintf("%x", snapshot.Member.ClusterID),
+					"memberID":  fmt.Sprintf("%x", snapshot.Member.MemberID),
+					"version":   snapshot.Member.Version,
+					"raftTerm":  strconv.FormatUint(snapshot.Member.RaftTerm, 10),
+					"revision":  strconv.FormatInt(snapshot.Member.Revision, 10),
+					"taken":     taken.Format(time.RFC3339),
+				}
+				if snapshot.Content.Revision != 0 {
+					item.Metadata["snapshotRevision"] = strconv.FormatInt(snapshot.Content.Revision, 10)
+					item.Metadata["snapshotHash"] = fmt.Sprintf("%x", snapshot.Content.Hash)
+					item.Metadata["totalKey"] = strconv.Itoa(snapshot.Content.TotalKey)
+				}
+				return tasks.AcquireEvidence(s, nodeName, manifest, item, etcd.CopyScript(out), etcd.HashScript(out)).Fn(s)
+			},
+		},
+		tasks.Task{
+			Description: "remove the etcd snapshot from the forensic pod",
+			Fn: func(s *state.State) error {
+				return tasks.ExecuteCollect(s, nodeName, "remove "+out, etcd.RemoveScript(out), func([]byte) error {
+					return nil
+				}).Fn(s)
+			},
+			Retries: 1,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, i := range manifest.Items {
+		if i.Name == item.Name {
+			snapshot.Path, snapshot.SHA256, snapshot.Size, snapshot.Verified = i.Path, i.SHA256, i.Size, i.Verified
+		}
+	}
+
+	return printReport(opts.Output, snapshot, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tENDPOINT\tVERSION\tREVISION\tKEYS\tPATH\tSIZE\tVERIFIED\tSHA256")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%d\t%t\t%s\n", snapshot.Node, snapshot.Member.Endpoint,
+			snapshot.Member.Version, snapshot.Member.Revision, snapshot.Content.TotalKey,
+			snapshot.Path, snapshot.Size, snapshot.Verified, snapshot.SHA256)
+	})
+}
+
+func etcdInspectCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &etcdInspectOpts{}
+	cmd := &cobra.Command{
+		Use:   "inspect SNAPSHOT",
+		Short: "Read the Kubernetes objects of an etcd snapshot offline",
+		Long: `Read the Kubernetes objects of an etcd snapshot offline.
+
+The snapshot, taken with etcd snapshot or copied from the member/snap/db file
+of an etcd data directory, is opened read-only without a cluster. The objects
+the API server stored in it, in protobuf or JSON, are decoded and listed by
+resource and namespace, or counted with --summary. Encrypted values are listed
+but can not be decoded.
+
+Keys deleted before the snapshot was taken stay in it until etcd compacts its
+history, --include-deleted lists them with the revision they were deleted at
+and the last value they had.
+
+With --diff, the snapshot is compared with a newer one: objects that existed
+in the first one and are gone from the second, like the ones an attacker
+deleted to cover their tracks, are listed with the added and modified ones.
+
+With --dump-dir, the objects listed, or the deleted and modified ones of a
+diff as they were in the first snapshot, are written there as YAML in a
+directory per resource and namespace.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			return runEtcdInspectCmd(newLogger(opts.Verbose, opts.LogFormat), opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringSliceVar(&opts.Resources,
+		longFlagName(opts, "Resources"),
+		nil,
+		"only keep these resources, e.g. secrets or example.com/widgets for custom resources")
+
+	cmd.Flags().StringVarP(&opts.Namespace,
+		longFlagName(opts, "Namespace"),
+		shortFlagName(opts, "Namespace"),
+		"",
+		"only keep objects of this namespace")
+
+	cmd.Flags().BoolVar(&opts.Summary,
+		longFlagName(opts, "Summary"),
+		false,
+		"count the keys per resource and namespace instead of listing them")
+
+	cmd.Flags().BoolVar(&opts.IncludeDeleted,
+		longFlagName(opts, "IncludeDeleted"),
+		false,
+		"list the keys deleted before the snapshot whose history was not compacted yet")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"",
+		"directory the objects are written to as YAML")
+
+	cmd.Flags().StringVar(&opts.Diff,
+		longFlagName(opts, "Diff"),
+		"",
+		"newer snapshot to compare the snapshot with")
+
+	return cmd
+}
+
+func runEtcdInspectCmd(logger logrus.FieldLogger, opts *etcdInspectOpts, name string) error {
+	snapshot, err := openEtcdSnapshot(logger, name)
+	if err != nil {
+		return err
+	}
+	filter := etcd.Filter{
+		Resources: opts.Resources,
+		Namespace: opts.Namespace,
+		Deleted:   opts.IncludeDeleted,
+	}
+
+	if opts.Diff != "" {
+		newer, err := openEtcdSnapshot(logger, opts.Diff)
+		if err != nil {
+			return err
+		}
+		if newer.Revision < snapshot.Revision {
+			logger.Warn(fmt.Sprintf("%s is older than %s, deleted and added objects are swapped", opts.Diff, name))
+		}
+		changes := etcd.Diff(snapshot, newer, filter)
+		if opts.DumpDir != "" {
+			var objects []*etcd.Object
+			for _, c := range changes {
+				if c.Old != nil {
+					objects = append(objects, c.Old)
+				}
+			}
+			if err := dumpEtcdObjects(logger, opts.DumpDir, objects); err != nil {
+				return err
+			}
+		}
+		return printReport(opts.Output, changes, func(w io.Writer) {
+			fmt.Fprintln(w, "CHANGE\tRESOURCE\tNAMESPACE\tNAME\tKIND\tOLD REVISION\tNEW REVISION\tDELETED AT")
+			for _, c := range changes {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Type, c.Resource, c.Namespace, c.Name, c.Kind,
+					formatRevision(c.OldRevision), formatRevision(c.NewRevision), formatRevision(c.DeleteRevision))
+			}
+		})
+	}
+
+	objects := snapshot.Select(filter)
+	if opts.DumpDir != "" {
+		if err := dumpEtcdObjects(logger, opts.DumpDir, objects); err != nil {
+			return err
+		}
+	}
+
+	if opts.Summary {
+		counts := countEtcdObjects(objects)
+		return printReport(opts.Output, counts, func(w io.Writer) {
+			fmt.Fprintln(w, "RESOURCE\tNAMESPACE\tKEYS\tDELETED")
+			for _, c := range counts {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", c.Resource, c.Namespace, c.Keys, c.Deleted)
+			}
+		})
+	}
+
+	return printReport(opts.Output, objects, func(w io.Writer) {
+		fmt.Fprintln(w, "RESOURCE\tNAMESPACE\tNAME\tKIND\tENCODING\tCREATED\tMODIFIED\tVERSION\tDELETED AT")
+		for _, o := range objects {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", o.Resource, o.Namespace, o.Name, o.Kind, o.Encoding,
+				o.CreateRevision, o.ModRevision, o.Version, formatRevision(o.DeleteRevision))
+		}
+	})
+}
+
+func openEtcdSnapshot(logger logrus.FieldLogger, name string) (*etcd.Snapshot, error) {
+	snapshot, err := etcd.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info(fmt.Sprintf("Read %d keys of %s at revision %d, compacted at revision %d",
+		len(snapshot.Objects), name, snapshot.Revision, snapshot.CompactRevision))
+	return snapshot, nil
+}
+
+func dumpEtcdObjects(logger logrus.FieldLogger, dir string, objects []*etcd.Object) error {
+	skipped, err := etcd.WriteYAML(dir, objects)
+	if err != nil {
+		return fmt.Errorf("failed to write the objects to %s: %w", dir, err)
+	}
+	for _, o := range skipped {
+		logger.Warn(fmt.Sprintf("Skipped %s, its %s value can not be written as YAML", o.Key, o.Encoding))
+	}
+	logger.Info(fmt.Sprintf("Wrote %d objects to %s", len(objects)-len(skipped), dir))
+	return nil
+}
+
+func countEtcdObjects(objects []*etcd.Object) []etcdResourceCount {
+	index := map[[2]string]int{}
+	var counts []etcdResourceCount
+	for _, o := range objects {
+		k := [2]string{o.Resource, o.Namespace}
+		i, ok := index[k]
+		if !ok {
+			i = len(counts)
+			index[k] = i
+			counts = append(counts, etcdResourceCount{Resource: o.Resource, Namespace: o.Namespace})
+		}
+		counts[i].Keys++
+		if o.Deleted() {
+			counts[i].Deleted++
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Resource != counts[j].Resource {
+			return counts[i].Resource < counts[j].Resource
+		}
+		return counts[i].Namespace < counts[j].Namespace
+	})
+	return counts
+}
+
+func formatRevision(rev int64) string {
+	if rev == 0 {
+		return ""
+	}
+	return strconv.FormatInt(rev, 10)
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/images"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type imageInventoryOpts struct {
+	globalOptions
+	Output    string `longflag:"output" shortflag:"o"`
+	Namespace string `longflag:"namespace" shortflag:"n"`
+	DriftOnly bool   `longflag:"drift-only"`
+}
+
+func (opts *imageInventoryOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func imageInventoryCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &imageInventoryOpts{}
+	cmd := &cobra.Command{
+		Use:   "image-inventory",
+		Short: "List the images of the running containers and flag tags resolving to different digests",
+		Long: `List the images of the running containers and flag tags resolving to different digests.
+
+Every container of the running pods is listed with the image of its spec and
+the digest the runtime resolved it to, read from the imageID of the pod
+status. Containers are flagged when their image is:
+
+  unpinned          referenced by tag only
+  latest            using the latest tag, explicitly or not
+  no-repo-digest    reported by its local image ID only, e.g. loaded on the node
+  drift             a tag running with different digests in the cluster
+  digest-mismatch   pinned to a digest but running another one
+
+A tag resolving to different digests on different nodes is a sign of a
+compromised registry or of an image tampered with on a node, unless the tag
+was legitimately moved between pulls.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runImageInventoryCmd(st, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVarP(&opts.Namespace,
+		longFlagName(opts, "Namespace"),
+		shortFlagName(opts, "Namespace"),
+		"",
+		"only list the containers of this namespace, drift is then only detected within it")
+
+	cmd.Flags().BoolVar(&opts.DriftOnly,
+		longFlagName(opts, "DriftOnly"),
+		false,
+		"only list the containers running a drifting tag or another digest than pinned")
+
+	return cmd
+}
+
+func runImageInventoryCmd(st *state.State, opts *imageInventoryOpts) error {
+	var pods corev1.PodList
+	if err := st.K8sClient.List(st.Context, &pods, client.InNamespace(opts.Namespace)); err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	report := images.Inventory(pods.Items)
+	for _, d := range report.Drifts {
+		st.Logger.Warn(d.String())
+	}
+	if opts.DriftOnly {
+		var drifting []images.Container
+		for _, c := range report.Containers {
+			if slices.Contains(c.Flags, images.FlagDrift) || slices.Contains(c.Flags, images.FlagDigestMismatch) {
+				drifting = append(drifting, c)
+			}
+		}
+		report.Containers = drifting
+	}
+
+	return printReport(opts.Output, report, func(w io.Writer) {
+		fmt.Fprintln(w, "POD\tCONTAINER\tNODE\tIMAGE\tDIGEST\tFLAGS")
+		for _, c := range report.Containers {
+			fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s\t%s\t%s\n", c.Namespace, c.Pod, c.Container, c.Node,
+				c.Image, images.ShortDigest(c.Digest), strings.Join(c.Flags, ","))
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/ioc"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type iocSweepOpts struct {
+	globalOptions
+	Output     string   `longflag:"output" shortflag:"o"`
+	Indicators string   `longflag:"indicators" shortflag:"i"`
+	AllNodes   bool     `longflag:"all-nodes"`
+	Paths      []string `longflag:"path"`
+	MaxSize    int64    `longflag:"max-size"`
+}
+
+// iocSweepReport is the consolidated result of a sweep.
+type iocSweepReport struct {
+	Nodes      []ioc.NodeResult `json:"nodes"`
+	Indicators []ioc.Summary    `json:"indicators"`
+}
+
+func (opts *iocSweepOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func iocSweepCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &iocSweepOpts{}
+	cmd := &cobra.Command{
+		Use:   "ioc-sweep [node-name...]",
+		Short: "Sweep one or many nodes for indicators of compromise",
+		Long: `Sweep one or many nodes for indicators of compromise.
+
+Indicators are read from a file with one indicator per line, either as
+type:value or as a bare value whose type is guessed. Supported types are
+sha256, ip, cidr, domain, path and process. Lines starting with # are comments
+and text after " #" describes the indicator.
+
+Indicators are matched against running processes, the SHA-256 of their
+executables, their command lines and connections, the hosts and resolver
+files of the node and of every container, and the files below --path.`,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runIOCSweepCmd(st, opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVarP(&opts.Indicators,
+		longFlagName(opts, "Indicators"),
+		shortFlagName(opts, "Indicators"),
+		"",
+		"indicator file")
+
+	cmd.Flags().BoolVar(&opts.AllNodes,
+		longFlagName(opts, "AllNodes"),
+		false,
+		"sweep every node of the cluster")
+
+	cmd.Flags().StringSliceVar(&opts.Paths,
+		longFlagName(opts, "Paths"),
+		nil,
+		"host directories whose files are hashed and matched against the SHA-256 indicators")
+
+	cmd.Flags().Int64Var(&opts.MaxSize,
+		longFlagName(opts, "MaxSize"),
+		64,
+		"skip files larger than this many MiB when hashing --path")
+
+	return cmd
+}
+
+// runIOCSweepCmd sweeps the nodes one after the other. A node that can not be
+// swept is reported with its error and does not stop the sweep.
+func runIOCSweepCmd(st *state.State, opts *iocSweepOpts, nodeNames []string) error {
+	if opts.Indicators == "" {
+		return fmt.Errorf("an indicator file is required, see --indicators")
+	}
+	set, err := ioc.Load(opts.Indicators)
+	if err != nil {
+		return err
+	}
+
+	if opts.AllNodes {
+		var nodes corev1.NodeList
+		if err := st.K8sClient.List(st.Context, &nodes); err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		nodeNames = nodeNames[:0]
+		for _, n := range nodes.Items {
+			nodeNames = append(nodeNames, n.Name)
+		}
+		sort.Strings(nodeNames)
+	}
+	if len(nodeNames) == 0 {
+		return fmt.Errorf("no node given, pass node names or --all-nodes")
+	}
+
+	var counts []string
+	for t, n := range set.Count() {
+		counts = append(counts, fmt.Sprintf("%d %s", n, t))
+	}
+	sort.Strings(counts)
+	st.Logger.Info(fmt.Sprintf("Sweeping %d nodes for %d indicators (%s)", len(nodeNames), len(set.Indicators), strings.Join(counts, ", ")))
+
+	script := ioc.SweepScript(set.Paths(), opts.Paths, opts.MaxSize*1024*1024)
+	report := iocSweepReport{}
+	for _, nodeName := range nodeNames {
+		result := ioc.NodeResult{Node: nodeName, Hits: []ioc.Hit{}}
+		if err := sweepNode(st, set, script, &result); err != nil {
+			st.Logger.Errorf("Sweep of %s failed: %v", nodeName, err)
+			result.Error = err.Error()
+		} else {
+			st.Logger.Info(fmt.Sprintf("Found %d hits on %s", len(result.Hits), nodeName))
+		}
+		report.Nodes = append(report.Nodes, result)
+	}
+	report.Indicators = ioc.Summarize(report.Nodes)
+
+	return printReport(opts.Output, report, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tINDICATOR\tSOURCE\tPOD\tPID\tPROCESS\tDETAIL")
+		for _, r := range report.Nodes {
+			if r.Error != "" {
+				fmt.Fprintf(w, "%s\t-\terror\t-\t-\t-\t%s\n", r.Node, r.Error)
+			}
+			for _, h := range r.Hits {
+				pod, pid, process := h.Pod, "-", h.Process
+				if pod == "" {
+					pod = "<host>"
+				}
+				if h.PID != 0 {
+					pid = fmt.Sprint(h.PID)
+				}
+				if process == "" {
+					process = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Node, h.Indicator, h.Source, pod, pid, process, h.Detail)
+			}
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "INDICATOR\tDESCRIPTION\tHITS\tNODES")
+		for _, s := range report.Indicators {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Indicator, s.Indicator.Description, s.Hits, strings.Join(s.Nodes, ","))
+		}
+	})
+}
+
+// sweepNode runs the sweep script on a node and matches its output.
+func sweepNode(st *state.State, set *ioc.Set, script string, result *ioc.NodeResult) error {
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, result.Node)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+	resolve := func(cgroup string) string {
+		if ref, ok := index.LookupCgroup(cgroup); ok {
+			return ref.String()
+		}
+		return ""
+	}
+
+	return runOnNode(st, result.Node,
+		tasks.ExecuteCollect(st, result.Node, "collect processes, connections and files", script, func(output []byte) error {
+			result.Hits = append(result.Hits, set.Match(output, resolve)...)
+			return nil
+		}),
+	)
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/baseline"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type kubeletAuditOpts struct {
+	globalOptions
+	Output     string `longflag:"output" shortflag:"o"`
+	ConfigPath string `longflag:"config"`
+	PoolLabel  string `longflag:"pool-label"`
+	FailedOnly bool   `longflag:"failed-only"`
+}
+
+// kubeletAuditReport is the result of the audit of the kubelets.
+type kubeletAuditReport struct {
+	Results []baseline.Result `json:"results"`
+	Drifts  []baseline.Drift  `json:"drifts,omitempty"`
+}
+
+func (opts *kubeletAuditOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func kubeletAuditCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &kubeletAuditOpts{}
+	cmd := &cobra.Command{
+		Use:   "kubelet-audit [node-name...]",
+		Short: "Check the kubelet configuration of the nodes and report drift within node pools",
+		Long: `Check the kubelet configuration of the nodes and report drift within node pools.
+
+The command line of the kubelet process, its configuration file and its
+systemd drop-ins are read through the forensic pod. The effective settings,
+flags taking precedence over the configuration file, are checked for:
+
+  anonymous-auth                      anonymous requests are rejected
+  authorization-mode                  requests are authorized by the API server
+  read-only-port                      the unauthenticated read-only port is disabled
+  protect-kernel-defaults             kernel tunables are not changed by the kubelet
+  rotate-certificates                 client certificates are rotated
+  event-record-qps                    events are not dropped by a low rate limit
+  streaming-connection-idle-timeout   exec and port-forward sessions time out
+
+Settings whose value differs between the nodes of a pool are reported as
+drift, a node configured apart from its siblings may have been tampered
+with. Pools are read from the node pool labels of the managed offerings,
+from --pool-label when set, and default to the role of the node.
+
+Every node is audited unless nodes are given.`,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runKubeletAuditCmd(st, opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.ConfigPath,
+		longFlagName(opts, "ConfigPath"),
+		"",
+		"host path of the kubelet configuration file, taken from the kubelet --config by default")
+
+	cmd.Flags().StringVar(&opts.PoolLabel,
+		longFlagName(opts, "PoolLabel"),
+		"",
+		"node label naming the node pool drift is detected within")
+
+	cmd.Flags().BoolVar(&opts.FailedOnly,
+		longFlagName(opts, "FailedOnly"),
+		false,
+		"only report the failed and warning checks")
+
+	return cmd
+}
+
+// runKubeletAuditCmd audits the kubelets one after the other. A node that can
+// not be audited is logged and does not stop the audit.
+func runKubeletAuditCmd(st *state.State, opts *kubeletAuditOpts, nodeNames []string) error {
+	var nodes corev1.NodeList
+	if err := st.K8sClient.List(st.Context, &nodes); err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+	pools := map[string]string{}
+	for _, n := range nodes.Items {
+		pools[n.Name] = baseline.NodePool(n.Labels, opts.PoolLabel)
+	}
+	if len(nodeNames) == 0 {
+		for _, n := range nodes.Items {
+			nodeNames = append(nodeNames, n.Name)
+		}
+		sort.Strings(nodeNames)
+	}
+
+	var (
+		results []baseline.Result
+		failed  int
+	)
+	script := baseline.KubeletScript(opts.ConfigPath)
+	for _, nodeName := range nodeNames {
+		st.Logger.Info(fmt.Sprintf("Auditing the kubelet of %s", nodeName))
+
+		var kubelet *baseline.KubeletConfig
+		err := runOnNode(st, nodeName,
+			tasks.ExecuteCollect(st, nodeName, "read the kubelet configuration", script, func(output []byte) error {
+				var warnings []string
+				kubelet, warnings = baseline.ParseKubelet(output)
+				for _, w := range warnings {
+					st.Logger.Warn(fmt.Sprintf("%s: %s", nodeName, w))
+				}
+				return nil
+			}),
+		)
+		if err != nil {
+			st.Logger.Errorf("Audit of %s failed: %v", nodeName, err)
+			failed++
+			continue
+		}
+		for _, r := range baseline.AuditKubelet(kubelet) {
+			r.Node = nodeName
+			results = append(results, r)
+		}
+	}
+	if failed == len(nodeNames) {
+		return fmt.Errorf("no node could be audited")
+	}
+
+	report := kubeletAuditReport{Results: []baseline.Result{}, Drifts: baseline.DetectDrift(results, pools)}
+	for _, d := range report.Drifts {
+		st.Logger.Warn(d.String())
+	}
+	for _, r := range results {
+		if opts.FailedOnly && r.Status == baseline.StatusPass {
+			continue
+		}
+		report.Results = append(report.Results, r)
+	}
+
+	return printReport(opts.Output, report, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tCHECK\tSTATUS\tVALUE\tEVIDENCE")
+		for _, r := range report.Results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Node, r.Check, r.Status, r.Value, strings.Join(r.Evidence, "; "))
+		}
+
+		if len(report.Drifts) > 0 {
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "POOL\tCHECK\tVALUE\tNODES")
+			for _, d := range report.Drifts {
+				for _, v := range d.Values {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Pool, d.Check, v.Value, strings.Join(v.Nodes, ","))
+				}
+			}
+		}
+	})
+}
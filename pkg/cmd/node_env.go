@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeEnvOpts struct {
+	globalOptions
+	Output      string `longflag:"output" shortflag:"o"`
+	ShowSecrets bool   `longflag:"show-secrets"`
+}
+
+func (opts *nodeEnvOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeEnvCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeEnvOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-env [node-name]",
+		Short:         "Scan process environments and libraries on a node for LD_PRELOAD injection and secrets",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeEnvCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().BoolVar(&opts.ShowSecrets,
+		longFlagName(opts, "ShowSecrets"),
+		false,
+		"print credential values instead of redacting them")
+
+	return cmd
+}
+
+// runNodeEnvCmd scans the environment and the loaded libraries of every process
+// on a node and attributes the findings to the pods they belong to.
+func runNodeEnvCmd(st *state.State, opts *nodeEnvOpts, nodeName string) error {
+	st.Logger.Info(fmt.Sprintf("Scanning process environments on %s", nodeName))
+
+	var findings []procfs.EnvFinding
+	err := runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "read process environments and libraries", procfs.EnvironScript, func(output []byte) error {
+			findings = procfs.ScanEnviron(output, opts.ShowSecrets)
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+	for i := range findings {
+		if ref, ok := index.LookupCgroup(findings[i].Cgroup); ok {
+			findings[i].Pod = ref.String()
+		}
+	}
+
+	return printReport(opts.Output, findings, func(w io.Writer) {
+		fmt.Fprintln(w, "SEVERITY\tCATEGORY\tVARIABLE\tVALUE\tPOD\tPROCESSES\tPIDS")
+		for _, f := range findings {
+			pod := f.Pod
+			if pod == "" {
+				pod = "<host>"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				f.Severity, f.Category, f.Variable, f.Value, pod,
+				strings.Join(f.Names, ","), joinInts(f.PIDs))
+		}
+	})
+}
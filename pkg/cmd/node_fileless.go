@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeFilelessOpts struct {
+	globalOptions
+	Output  string `longflag:"output" shortflag:"o"`
+	DumpDir string `longflag:"dump-dir"`
+}
+
+func (opts *nodeFilelessOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeFilelessCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeFilelessOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-fileless [node-name]",
+		Short:         "Detect processes running from deleted, memfd or tmpfs executables on a node",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeFilelessCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"",
+		"copy the executable of every finding through /proc/PID/exe into this evidence directory")
+
+	return cmd
+}
+
+// runNodeFilelessCmd reports processes executing code that has no regular file
+// behind it and optionally copies their executables out of the node.
+func runNodeFilelessCmd(st *state.State, opts *nodeFilelessOpts, nodeName string) error {
+	st.Logger.Info(fmt.Sprintf("Looking for fileless executables on %s", nodeName))
+
+	var manifest *evidence.Manifest
+	if opts.DumpDir != "" {
+		var err error
+		manifest, err = evidence.Open(opts.DumpDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	var found []procfs.FilelessProcess
+	err := runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "read executables and mappings", procfs.FilelessScript, func(output []byte) error {
+			found = procfs.FindFilelessProcesses(output)
+			return nil
+		}),
+		tasks.Task{
+			Description: "copy fileless executables",
+			Predicate: func(_ *state.State) bool {
+				return manifest != nil
+			},
+			Fn: func(s *state.State) error {
+				for _, p := range found {
+					item := evidence.Item{
+						Name:        path.Join(nodeName, fmt.Sprintf("exe-%d-%s.bin", p.PID, strings.ReplaceAll(p.Name, "/", "_"))),
+						Source:      fmt.Sprintf("/proc/%d/exe", p.PID),
+						Description: fmt.Sprintf("executable of %s (%s)", p.Name, strings.Join(p.Reasons, ",")),
+						Metadata: map[string]string{
+							"exe":     p.Exe,
+							"cmdline": p.Cmdline,
+						},
+					}
+					acquire := tasks.AcquireEvidence(s, nodeName, manifest, item,
+						procfs.ExeCopyScript(p.PID), procfs.ExeHashScript(p.PID))
+					if err := acquire.Fn(s); err != nil {
+						// The process may have exited since the scan, keep going
+						// with the remaining ones.
+						s.Logger.Warnf("Failed to copy executable of PID %d: %s", p.PID, err)
+					}
+				}
+				return nil
+			},
+			Retries: 1,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(found) == 0 {
+		st.Logger.Info(fmt.Sprintf("No fileless executables found on %s", nodeName))
+	}
+
+	return printReport(opts.Output, found, func(w io.Writer) {
+		fmt.Fprintln(w, "PID\tNAME\tREASONS\tEXE\tMAPPINGS\tANON EXEC\tCMDLINE")
+		for _, p := range found {
+			var mappings []string
+			for _, m := range p.Mappings {
+				mappings = append(mappings, m.Path)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				p.PID, p.Name, strings.Join(p.Reasons, ","), p.Exe,
+				strings.Join(mappings, ","), p.AnonExecRegions, p.Cmdline)
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeHiddenOpts struct {
+	globalOptions
+	Output string `longflag:"output" shortflag:"o"`
+}
+
+func (opts *nodeHiddenOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeHiddenCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeHiddenOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-hidden [node-name]",
+		Short:         "Detect processes hidden from /proc on a node",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeHiddenCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	return cmd
+}
+
+// runNodeHiddenCmd compares the /proc listing of a node with direct PID probing,
+// thread groups and cgroup membership and reports the processes missing from one of them.
+func runNodeHiddenCmd(st *state.State, opts *nodeHiddenOpts, nodeName string) error {
+	st.Logger.Info(fmt.Sprintf("Looking for hidden processes on %s", nodeName))
+
+	var hidden []procfs.HiddenProcess
+	err := runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "probe every PID up to pid_max", procfs.HiddenScript, func(output []byte) error {
+			hidden = procfs.FindHiddenProcesses(output)
+			return nil
+		}),
+		tasks.Task{
+			Description: "verify hidden process candidates",
+			Fn: func(s *state.State) error {
+				if len(hidden) == 0 {
+					return nil
+				}
+				return tasks.ExecuteCollect(s, nodeName, "verify hidden process candidates", procfs.VerifyHiddenScript(hidden), func(output []byte) error {
+					hidden = procfs.ApplyVerification(hidden, output)
+					return nil
+				}).Fn(s)
+			},
+			Retries: 1,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(hidden) == 0 {
+		st.Logger.Info(fmt.Sprintf("No hidden processes found on %s", nodeName))
+	}
+
+	return printReport(opts.Output, hidden, func(w io.Writer) {
+		fmt.Fprintln(w, "PID\tTGID\tPPID\tUID\tNAME\tSEEN IN\tMISSING FROM\tVERIFIED\tEXE\tCMDLINE")
+		for _, h := range hidden {
+			fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+				h.PID, h.TGID, h.PPID, h.UID, h.Name,
+				strings.Join(h.SeenIn, ","), strings.Join(h.MissingFrom, ","),
+				h.Verified, h.Exe, h.Cmdline)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/memdump"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/stream"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeMemdumpOpts struct {
+	globalOptions
+	Output     string `longflag:"output" shortflag:"o"`
+	PID        int    `longflag:"pid"`
+	Pod        string `longflag:"pod"`
+	DumpDir    string `longflag:"dump-dir"`
+	AllRegions bool   `longflag:"all-regions"`
+	MaxRegion  int64  `longflag:"max-region"`
+	MaxSize    int64  `longflag:"max-size"`
+}
+
+func (opts *nodeMemdumpOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeMemdumpCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeMemdumpOpts{}
+	cmd := &cobra.Command{
+		Use:   "node-memdump [node-name]",
+		Short: "Dump the memory of a host process or of all processes of a pod container",
+		Long: `Dump the memory of a host process or of all processes of a pod container.
+
+The readable regions listed in /proc/PID/maps are read through /proc/PID/mem
+and written to a tar archive in the evidence directory. The archive holds one
+PID/START-END.bin file per region, or per 16 MiB piece of the larger ones, and
+an index.json with the address range, permissions, backing file and hashes of
+every region. A region that could only be read partially is cut where the
+read failed and marked truncated in the index, with the size it should have.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeMemdumpCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format of the region index, one of text, json or yaml")
+
+	cmd.Flags().IntVar(&opts.PID,
+		longFlagName(opts, "PID"),
+		0,
+		"host PID to dump")
+
+	cmd.Flags().StringVar(&opts.Pod,
+		longFlagName(opts, "Pod"),
+		"",
+		"dump all processes of this container, as namespace/pod[/container]")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"evidence",
+		"evidence directory the archive is written to")
+
+	cmd.Flags().BoolVar(&opts.AllRegions,
+		longFlagName(opts, "AllRegions"),
+		false,
+		"also dump read-only file backed regions, which are skipped since their content is on disk")
+
+	cmd.Flags().Int64Var(&opts.MaxRegion,
+		longFlagName(opts, "MaxRegion"),
+		1024,
+		"skip regions larger than this many MiB, 0 for no limit")
+
+	cmd.Flags().Int64Var(&opts.MaxSize,
+		longFlagName(opts, "MaxSize"),
+		4096,
+		"stop dumping once this many MiB were written, 0 for no limit")
+
+	return cmd
+}
+
+// runNodeMemdumpCmd streams the memory regions of the selected processes into
+// a tar archive recorded in the evidence manifest.
+func runNodeMemdumpCmd(st *state.State, opts *nodeMemdumpOpts, nodeName string) error {
+	if (opts.PID == 0) == (opts.Pod == "") {
+		return fmt.Errorf("exactly one of --pid or --pod is required")
+	}
+
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+
+	memOpts := stream.MemoryOptions{
+		AllRegions: opts.AllRegions,
+		MaxRegion:  opts.MaxRegion * 1024 * 1024,
+		MaxTotal:   opts.MaxSize * 1024 * 1024,
+	}
+	var target, label, source string
+	if opts.PID != 0 {
+		memOpts.PIDs = []int{opts.PID}
+		target = "pid " + strconv.Itoa(opts.PID)
+		label = "pid" + strconv.Itoa(opts.PID)
+		source = fmt.Sprintf("/proc/%d/mem", opts.PID)
+	} else {
+		ref, id, err := resolveContainer(pods, index, opts.Pod, nodeName)
+		if err != nil {
+			return err
+		}
+		memOpts.ContainerID = id
+		target = ref.String()
+		label = strings.ReplaceAll(ref.String(), "/", "_")
+		source = "/proc/PID/mem of container " + id
+	}
+
+	manifest, err := evidence.Open(opts.DumpDir)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("memdump/%s-%s-%s.tar", nodeName, label, time.Now().UTC().Format("20060102T150405Z"))
+	w, err := manifest.Create(name, nodeName, source)
+	if err != nil {
+		return err
+	}
+	archive := memdump.NewArchive(w, nodeName, target)
+
+	st.Logger.Info(fmt.Sprintf("Dumping memory of %s on %s", target, nodeName))
+	runErr := runOnNode(st, nodeName,
+		streamTargets(st, nodeName, "dump process memory", stream.MemoryScript(memOpts),
+			func(t stream.Target, data io.Reader) error {
+				pod := ""
+				if ref, ok := index.LookupCgroup(t.Cgroup); ok {
+					pod = ref.String()
+				}
+				if t.Truncated {
+					st.Logger.Warn(fmt.Sprintf("Only %d of %d bytes of %s at %#x could be read, the region is truncated", t.Size, t.Requested, t, t.Address))
+				}
+				return archive.Add(t, pod, data)
+			},
+			archive.Skip),
+	)
+
+	// The archive is kept and recorded even when the dump failed halfway, the
+	// regions written so far are listed in its index.
+	if err := archive.Close(); err != nil && runErr == nil {
+		runErr = err
+	}
+	item, err := w.Close()
+	if err != nil && runErr == nil {
+		runErr = err
+	}
+	item.Description = "memory dump of " + target
+	if runErr != nil {
+		item.Description += " (incomplete)"
+	}
+	item.Metadata = map[string]string{
+		"target":  target,
+		"regions": strconv.Itoa(len(archive.Index.Regions)),
+		"skipped": strconv.Itoa(len(archive.Index.Skipped)),
+	}
+	if n := archive.Truncated(); n > 0 {
+		item.Metadata["truncated"] = strconv.Itoa(n)
+	}
+	if err := manifest.Record(item); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	st.Logger.Info(fmt.Sprintf("Dumped %d regions, %d MiB, to %s (sha256 %s)",
+		len(archive.Index.Regions), archive.Size()/1024/1024, item.Path, item.SHA256))
+	if len(archive.Index.Regions) == 0 {
+		st.Logger.Warn("No memory region was dumped, check that the process exists and is not a kernel thread")
+	}
+
+	return printReport(opts.Output, archive.Index, func(w io.Writer) {
+		fmt.Fprintln(w, "PID\tPROCESS\tSTART\tEND\tPERMS\tSIZE\tPATH\tSHA256")
+		for _, r := range archive.Index.Regions {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", r.PID, r.Process, r.Start, r.End, r.Perms, r.Size, r.Path, r.SHA256)
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeMinerOpts struct {
+	globalOptions
+	Output       string        `longflag:"output" shortflag:"o"`
+	Window       time.Duration `longflag:"window"`
+	Samples      int           `longflag:"samples"`
+	CPUThreshold float64       `longflag:"cpu-threshold"`
+	MinScore     int           `longflag:"min-score"`
+}
+
+func (opts *nodeMinerOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeMinerCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeMinerOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-miner [node-name]",
+		Short:         "Rank the processes of a node by cryptominer traits",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeMinerCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().DurationVar(&opts.Window,
+		longFlagName(opts, "Window"),
+		30*time.Second,
+		"time window over which CPU usage is sampled")
+
+	cmd.Flags().IntVar(&opts.Samples,
+		longFlagName(opts, "Samples"),
+		6,
+		"number of CPU samples taken over the window")
+
+	cmd.Flags().Float64Var(&opts.CPUThreshold,
+		longFlagName(opts, "CPUThreshold"),
+		50,
+		"CPU usage, in percent of one core, a process must sustain to count as busy")
+
+	cmd.Flags().IntVar(&opts.MinScore,
+		longFlagName(opts, "MinScore"),
+		30,
+		"minimum score for a process to be reported")
+
+	return cmd
+}
+
+// runNodeMinerCmd samples the processes of a node and ranks them by combined
+// cryptominer signals.
+func runNodeMinerCmd(st *state.State, opts *nodeMinerOpts, nodeName string) error {
+	if opts.Samples < 2 {
+		return fmt.Errorf("at least 2 samples are required, got %d", opts.Samples)
+	}
+	interval := int(opts.Window.Seconds()) / (opts.Samples - 1)
+	if interval < 1 {
+		interval = 1
+	}
+
+	st.Logger.Info(fmt.Sprintf("Looking for cryptominers on %s, sampling CPU usage for %s", nodeName, opts.Window))
+
+	var report procfs.MinerReport
+	err := runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "sample processes for miner traits", procfs.MinerScript(opts.Samples, interval), func(output []byte) error {
+			report = procfs.FindMiners(output, opts.CPUThreshold, opts.MinScore)
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+	for i := range report.Suspects {
+		if ref, ok := index.LookupCgroup(report.Suspects[i].Cgroup); ok {
+			report.Suspects[i].Pod = ref.String()
+		}
+	}
+
+	return printReport(opts.Output, report, func(w io.Writer) {
+		for _, e := range report.HostEvidence {
+			fmt.Fprintf(w, "host: %s\n", e)
+		}
+		fmt.Fprintln(w, "SCORE\tPID\tNAME\tPOD\tAVG CPU\tEVIDENCE\tCMDLINE")
+		for _, s := range report.Suspects {
+			pod := s.Pod
+			if pod == "" {
+				pod = "<host>"
+			}
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%.0f%%\t%s\t%s\n",
+				s.Score, s.PID, s.Name, pod, s.AvgCPU, strings.Join(s.Evidence, "; "), s.Cmdline)
+		}
+	})
+}
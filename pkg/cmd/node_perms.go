@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/fsscan"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodePermsOpts struct {
+	globalOptions
+	Output   string   `longflag:"output" shortflag:"o"`
+	Roots    []string `longflag:"root"`
+	Excludes []string `longflag:"exclude"`
+}
+
+func (opts *nodePermsOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodePermsCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodePermsOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-perms [node-name]",
+		Short:         "Scan the host filesystem of a node for SUID/SGID, capability, world writable and unowned files",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodePermsCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringSliceVar(&opts.Roots,
+		longFlagName(opts, "Roots"),
+		[]string{"/"},
+		"host directories to scan")
+
+	cmd.Flags().StringSliceVar(&opts.Excludes,
+		longFlagName(opts, "Excludes"),
+		fsscan.DefaultExcludes,
+		"host directories to skip")
+
+	return cmd
+}
+
+// runNodePermsCmd lists the files of a node that grant privileges or can be
+// tampered with, together with their hash and package ownership.
+func runNodePermsCmd(st *state.State, opts *nodePermsOpts, nodeName string) error {
+	st.Logger.Info(fmt.Sprintf("Scanning file permissions of %s on %s", strings.Join(opts.Roots, ","), nodeName))
+
+	var result fsscan.Result
+	err := runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "walk the host filesystem", fsscan.ScanScript(opts.Roots, opts.Excludes), func(output []byte) error {
+			result = fsscan.ParseScan(output)
+			return nil
+		}),
+		tasks.Task{
+			Description: "hash findings and check package ownership",
+			Fn: func(s *state.State) error {
+				if len(result.Entries) == 0 {
+					return nil
+				}
+				var paths []string
+				for _, e := range result.Entries {
+					paths = append(paths, e.Path)
+				}
+				return tasks.ExecuteCollect(s, nodeName, "hash findings and check package ownership", fsscan.PackageScript(paths), func(output []byte) error {
+					result.ApplyPackages(output)
+					return nil
+				}).Fn(s)
+			},
+			Retries: 1,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, w := range result.Warnings {
+		st.Logger.Warn(w)
+	}
+
+	noCaps := slices.Contains(result.Unavailable, fsscan.FieldCapabilities)
+	return printReport(opts.Output, result, func(w io.Writer) {
+		fmt.Fprintln(w, "SUSPICIOUS\tKINDS\tMODE\tUID\tGID\tSIZE\tCAPABILITIES\tPACKAGE\tSHA256\tPATH")
+		for _, e := range result.Entries {
+			pkg := e.PackageStatus
+			if e.Package != "" {
+				pkg += ":" + e.Package
+			}
+			caps := e.Capabilities
+			if noCaps {
+				caps = "unavailable"
+			}
+			fmt.Fprintf(w, "%t\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+				e.Suspicious, strings.Join(e.Kinds, ","), e.Mode, e.UID, e.GID, e.Size,
+				caps, pkg, e.SHA256, e.Path)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeShellsOpts struct {
+	globalOptions
+	Output string `longflag:"output" shortflag:"o"`
+}
+
+func (opts *nodeShellsOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeShellsCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeShellsOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-shells [node-name]",
+		Short:         "Detect reverse shells and unexpected interactive shells on a node",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeShellsCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	return cmd
+}
+
+// runNodeShellsCmd looks for shells wired to network connections and for
+// container processes holding a terminal their pod did not request.
+func runNodeShellsCmd(st *state.State, opts *nodeShellsOpts, nodeName string) error {
+	st.Logger.Info(fmt.Sprintf("Looking for reverse and interactive shells on %s", nodeName))
+
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+	resolve := func(cgroup string) (string, bool, bool) {
+		ref, ok := index.LookupCgroup(cgroup)
+		if !ok || ref.Container == "" {
+			return "", false, false
+		}
+		spec, ok := index.ContainerSpec(ref)
+		return ref.String(), ok && spec.TTY, true
+	}
+
+	var hits []procfs.ShellHit
+	err = runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "read process descriptors and sockets", procfs.ShellsScript, func(output []byte) error {
+			hits = procfs.FindShells(output, resolve)
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(hits) == 0 {
+		st.Logger.Info(fmt.Sprintf("No suspicious shells found on %s", nodeName))
+	}
+
+	return printReport(opts.Output, hits, func(w io.Writer) {
+		fmt.Fprintln(w, "SEVERITY\tKIND\tPID\tNAME\tPOD\tREMOTE\tDETAIL\tANCESTRY")
+		for _, h := range hits {
+			pod := h.Pod
+			if pod == "" {
+				pod = "<host>"
+			}
+			var ancestry []string
+			for _, a := range h.Ancestry {
+				ancestry = append(ancestry, fmt.Sprintf("%s[%d]", a.Name, a.PID))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				h.Severity, h.Kind, h.PID, h.Name, pod, strings.Join(h.Remote, ","),
+				h.Detail, strings.Join(ancestry, " < "))
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/timeline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeTimelineOpts struct {
+	globalOptions
+	Paths    []string `longflag:"path"`
+	Bodyfile string   `longflag:"bodyfile"`
+	MD5      bool     `longflag:"md5"`
+	XDev     bool     `longflag:"xdev"`
+}
+
+func (opts *nodeTimelineOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeTimelineCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeTimelineOpts{}
+	cmd := &cobra.Command{
+		Use:           "node-timeline [node-name]",
+		Short:         "Collect a bodyfile of host paths on a node for timeline analysis",
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeTimelineCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&opts.Paths,
+		longFlagName(opts, "Paths"),
+		[]string{"/etc", "/usr/bin", "/usr/sbin", "/usr/local", "/root", "/home", "/tmp", "/var/tmp", "/dev/shm"},
+		"host paths to walk")
+
+	cmd.Flags().StringVar(&opts.Bodyfile,
+		longFlagName(opts, "Bodyfile"),
+		"",
+		"write the bodyfile to this file instead of stdout")
+
+	cmd.Flags().BoolVar(&opts.MD5,
+		longFlagName(opts, "MD5"),
+		false,
+		"compute the MD5 of every regular file")
+
+	cmd.Flags().BoolVar(&opts.XDev,
+		longFlagName(opts, "XDev"),
+		true,
+		"do not descend into other filesystems")
+
+	return cmd
+}
+
+// runNodeTimelineCmd walks host paths of a node and writes their MAC times in
+// the TSK bodyfile format.
+func runNodeTimelineCmd(st *state.State, opts *nodeTimelineOpts, nodeName string) error {
+	st.Logger.Info(fmt.Sprintf("Collecting timeline of %s on %s", strings.Join(opts.Paths, ","), nodeName))
+
+	var records []timeline.Record
+	err := runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "stat host paths", timeline.CollectScript(opts.Paths, opts.XDev, opts.MD5), func(output []byte) error {
+			var warnings []string
+			records, warnings = timeline.ParseCollect(output)
+			for _, w := range warnings {
+				st.Logger.Warn(w)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.Bodyfile != "" {
+		f, err := os.Create(opts.Bodyfile)
+		if err != nil {
+			return fmt.Errorf("failed to create bodyfile: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	for _, r := range records {
+		fmt.Fprintln(w, r.String())
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write bodyfile: %w", err)
+	}
+
+	st.Logger.Info(fmt.Sprintf("Collected %d entries from %s", len(records), nodeName))
+	return nil
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/stream"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/yara"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type nodeYaraOpts struct {
+	globalOptions
+	Output       string   `longflag:"output" shortflag:"o"`
+	Rules        []string `longflag:"rules" shortflag:"r"`
+	Paths        []string `longflag:"path"`
+	Pods         []string `longflag:"pod"`
+	PodPaths     []string `longflag:"pod-path"`
+	PIDs         []int    `longflag:"pid"`
+	AllProcesses bool     `longflag:"all-processes"`
+	AllRegions   bool     `longflag:"all-regions"`
+	MaxSize      int64    `longflag:"max-size"`
+	XDev         bool     `longflag:"xdev"`
+}
+
+func (opts *nodeYaraOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func nodeYaraCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &nodeYaraOpts{}
+	cmd := &cobra.Command{
+		Use:   "node-yara [node-name]",
+		Short: "Scan host files, container filesystems and process memory of a node with YARA rules",
+		Long: `Scan host files, container filesystems and process memory of a node with YARA rules.
+
+The data is streamed out of the forensic pod and matched locally, no YARA binary
+is needed on the node. A subset of the YARA language is supported: text, hex and
+regular expression strings and conditions without modules or for loops.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			nodeName := args[0]
+
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runNodeYaraCmd(st, opts, nodeName)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringSliceVarP(&opts.Rules,
+		longFlagName(opts, "Rules"),
+		shortFlagName(opts, "Rules"),
+		nil,
+		"YARA rule files")
+
+	cmd.Flags().StringSliceVar(&opts.Paths,
+		longFlagName(opts, "Paths"),
+		nil,
+		"host paths to scan")
+
+	cmd.Flags().StringSliceVar(&opts.Pods,
+		longFlagName(opts, "Pods"),
+		nil,
+		"containers to scan the root filesystem of, as namespace/pod[/container]")
+
+	cmd.Flags().StringSliceVar(&opts.PodPaths,
+		longFlagName(opts, "PodPaths"),
+		[]string{"/"},
+		"paths inside the container root filesystems to scan")
+
+	cmd.Flags().IntSliceVar(&opts.PIDs,
+		longFlagName(opts, "PIDs"),
+		nil,
+		"host PIDs to scan the memory of")
+
+	cmd.Flags().BoolVar(&opts.AllProcesses,
+		longFlagName(opts, "AllProcesses"),
+		false,
+		"scan the memory of every process of the node")
+
+	cmd.Flags().BoolVar(&opts.AllRegions,
+		longFlagName(opts, "AllRegions"),
+		false,
+		"also scan read-only file backed memory regions, which are skipped since their content is on disk")
+
+	cmd.Flags().Int64Var(&opts.MaxSize,
+		longFlagName(opts, "MaxSize"),
+		64,
+		"skip files and memory regions larger than this many MiB")
+
+	cmd.Flags().BoolVar(&opts.XDev,
+		longFlagName(opts, "XDev"),
+		true,
+		"do not descend into other filesystems")
+
+	return cmd
+}
+
+// runNodeYaraCmd streams the selected targets out of a node and matches the
+// rules against them locally.
+func runNodeYaraCmd(st *state.State, opts *nodeYaraOpts, nodeName string) error {
+	if len(opts.Rules) == 0 {
+		return fmt.Errorf("at least one rule file is required, see --rules")
+	}
+	if len(opts.Paths) == 0 && len(opts.Pods) == 0 && len(opts.PIDs) == 0 && !opts.AllProcesses {
+		return fmt.Errorf("nothing to scan, use --path, --pod, --pid or --all-processes")
+	}
+
+	rules, err := yara.Load(opts.Rules...)
+	if err != nil {
+		return err
+	}
+	st.Logger.Info(fmt.Sprintf("Loaded %d rules", rules.Len()))
+
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+	maxSize := opts.MaxSize * 1024 * 1024
+
+	var (
+		hits    []yara.Hit
+		windows []*stream.Window
+	)
+	scanned := 0
+	// Targets are scanned whole, memory regions being streamed in pieces,
+	// within a window of the maximum size.
+	scanner := func(pod string) func(stream.Target, io.Reader) error {
+		window := stream.NewWindow(maxSize, func(t stream.Target, data []byte) error {
+			scanned++
+			p := pod
+			if t.Kind == stream.TargetMemory {
+				if ref, ok := index.LookupCgroup(t.Cgroup); ok {
+					p = ref.String()
+				}
+			}
+			if t.Truncated {
+				st.Logger.Warn(fmt.Sprintf("Only %d of %d bytes of %s could be read and scanned", t.Size, t.Requested, t))
+			}
+			hits = append(hits, yara.NewHits(t, p, rules.Scan(data))...)
+			return nil
+		})
+		windows = append(windows, window)
+		return window.Add
+	}
+
+	var steps []tasks.Task
+	if len(opts.Paths) > 0 {
+		steps = append(steps, streamTargets(st, nodeName, "scan host files",
+			stream.FilesScript(opts.Paths, opts.XDev, maxSize), scanner(""), nil))
+	}
+	for _, name := range opts.Pods {
+		ref, id, err := resolveContainer(pods, index, name, nodeName)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, streamTargets(st, nodeName, "scan files of "+ref.String(),
+			stream.ContainerFilesScript(id, opts.PodPaths, opts.XDev, maxSize), scanner(ref.String()), nil))
+	}
+	if len(opts.PIDs) > 0 || opts.AllProcesses {
+		var pids []int
+		if !opts.AllProcesses {
+			pids = opts.PIDs
+		}
+		steps = append(steps, streamTargets(st, nodeName, "scan process memory",
+			stream.MemoryScript(stream.MemoryOptions{PIDs: pids, AllRegions: opts.AllRegions, MaxRegion: maxSize}), scanner(""), nil))
+	}
+
+	st.Logger.Info(fmt.Sprintf("Scanning %s", nodeName))
+	if err := runOnNode(st, nodeName, steps...); err != nil {
+		return err
+	}
+	for _, w := range windows {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	st.Logger.Info(fmt.Sprintf("Scanned %d targets, %d matches", scanned, len(hits)))
+
+	return printReport(opts.Output, hits, func(w io.Writer) {
+		fmt.Fprintln(w, "RULE\tTARGET\tPOD\tOFFSET\tSTRINGS")
+		for _, h := range hits {
+			pod := h.Pod
+			if pod == "" {
+				pod = "<host>"
+			}
+			offset := "-"
+			var strs []string
+			for _, s := range h.Strings {
+				if offset == "-" {
+					offset = fmt.Sprintf("%#x", s.Offset)
+				}
+				strs = append(strs, fmt.Sprintf("%s=%s", s.ID, s.Data))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", h.Rule, h.Target, pod, offset, strings.Join(strs, " "))
+		}
+	})
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/baseline"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/pki"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// expiringWithin is how soon a certificate is reported as expiring.
+const expiringWithin = 30 * 24 * time.Hour
+
+type pkiInventoryOpts struct {
+	globalOptions
+	Output      string        `longflag:"output" shortflag:"o"`
+	Paths       []string      `longflag:"path"`
+	CAFiles     []string      `longflag:"ca-file"`
+	Recent      time.Duration `longflag:"recent"`
+	FlaggedOnly bool          `longflag:"flagged-only"`
+}
+
+func (opts *pkiInventoryOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func pkiInventoryCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &pkiInventoryOpts{}
+	cmd := &cobra.Command{
+		Use:   "pki-inventory [node-name...]",
+		Short: "Inventory the certificates of the nodes and flag the ones not chaining to the cluster CAs",
+		Long: `Inventory the certificates of the nodes and flag the ones not chaining to the cluster CAs.
+
+PEM certificates and the certificates embedded in kubeconfigs are read below
+/etc/kubernetes, /var/lib/kubelet/pki and the --path directories. Private
+keys, client keys and tokens are removed on the node and never leave it.
+Every certificate is reported with its subject, groups, SANs, issuer, key
+usages, validity and SHA-256 fingerprint, and with its chain built from the
+CAs found on all the audited nodes.
+
+The cluster CAs are the ones the API server publishes in the kube-root-ca.crt
+and extension-apiserver-authentication ConfigMaps of kube-system and the
+--ca-file ones. A CA found on a node is never trusted for being there: the
+kubeadm ca.crt and front-proxy-ca.crt of the nodes must be cluster CAs, and
+the etcd CA, which the API server does not publish, is only trusted when every
+node holding one has the same. Certificates are flagged when they are:
+
+  expired, expiring   past their validity, or within 30 days of its end
+  untrusted           not chaining to a cluster CA
+  self-signed         self-signed and not a CA, like the default kubelet serving certificate
+  recent-admin        issued within --recent to system:masters or kubeadm:cluster-admins
+  ca-mismatch         a kubeadm CA file that is not a cluster CA, or an etcd CA differing between nodes
+
+Every node is audited unless nodes are given.`,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPKIInventoryCmd(st, opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringSliceVar(&opts.Paths,
+		longFlagName(opts, "Paths"),
+		nil,
+		"other host directories to search for certificates")
+
+	cmd.Flags().StringSliceVar(&opts.CAFiles,
+		longFlagName(opts, "CAFiles"),
+		nil,
+		"local PEM files of other CAs to trust as cluster CAs")
+
+	cmd.Flags().DurationVar(&opts.Recent,
+		longFlagName(opts, "Recent"),
+		30*24*time.Hour,
+		"how long ago an admin certificate counts as recently issued")
+
+	cmd.Flags().BoolVar(&opts.FlaggedOnly,
+		longFlagName(opts, "FlaggedOnly"),
+		false,
+		"only report the flagged certificates")
+
+	return cmd
+}
+
+// runPKIInventoryCmd collects the certificates of the nodes one after the
+// other, then analyzes them together so the CAs of a node complete the
+// chains of the others.
+func runPKIInventoryCmd(st *state.State, opts *pkiInventoryOpts, nodeNames []string) error {
+	clusterCAs, err := clusterCAs(st, opts.CAFiles)
+	if err != nil {
+		return err
+	}
+
+	if len(nodeNames) == 0 {
+		var nodes corev1.NodeList
+		if err := st.K8sClient.List(st.Context, &nodes); err != nil {
+			return fmt.Errorf("failed to list nodes: %w", err)
+		}
+		for _, n := range nodes.Items {
+			nodeNames = append(nodeNames, n.Name)
+		}
+		sort.Strings(nodeNames)
+	}
+
+	var (
+		certs  []pki.Certificate
+		failed int
+	)
+	script := pki.CollectScript(append(append([]string{}, pki.DefaultPaths...), opts.Paths...))
+	for _, nodeName := range nodeNames {
+		st.Logger.Info(fmt.Sprintf("Collecting the certificates of %s", nodeName))
+
+		err := runOnNode(st, nodeName,
+			tasks.ExecuteCollect(st, nodeName, "read the certificates", script, func(output []byte) error {
+				files, warnings := baseline.ParseFiles(output)
+				nodeCerts, parseWarnings := pki.Parse(files)
+				for _, w := range append(warnings, parseWarnings...) {
+					st.Logger.Warn(fmt.Sprintf("%s: %s", nodeName, w))
+				}
+				for _, c := range nodeCerts {
+					c.Node = nodeName
+					certs = append(certs, c)
+				}
+				return nil
+			}),
+		)
+		if err != nil {
+			st.Logger.Errorf("Collection of %s failed: %v", nodeName, err)
+			failed++
+		}
+	}
+	if failed == len(nodeNames) {
+		return fmt.Errorf("no node could be audited")
+	}
+
+	pki.Analyze(certs, pki.Options{
+		ClusterCAs: clusterCAs,
+		Now:        time.Now(),
+		Recent:     opts.Recent,
+		Expiring:   expiringWithin,
+	})
+	report := []pki.Certificate{}
+	for _, c := range certs {
+		if opts.FlaggedOnly && len(c.Flags) == 0 {
+			continue
+		}
+		report = append(report, c)
+	}
+	st.Logger.Info(fmt.Sprintf("Found %d certificates, %d flagged", len(certs), countFlagged(certs)))
+
+	return printReport(opts.Output, report, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tPATH\tSUBJECT\tGROUPS\tCHAIN\tNOT AFTER\tFLAGS")
+		for _, c := range report {
+			location := c.Path
+			if c.Source != "" {
+				location += " (" + c.Source + ")"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Node, location, c.Name(),
+				strings.Join(c.Groups, ","), strings.Join(c.Chain, " > "),
+				c.NotAfter.Format("2006-01-02"), strings.Join(c.Flags, ","))
+		}
+	})
+}
+
+// clusterCAs returns the CAs the API server publishes and the ones of files.
+// ConfigMaps that can not be read only log a warning as long as some CA is
+// left to trust.
+func clusterCAs(st *state.State, files []string) ([]*x509.Certificate, error) {
+	var cas []*x509.Certificate
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := pki.ParsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		cas = append(cas, certs...)
+	}
+
+	for name, keys := range map[string][]string{
+		"kube-root-ca.crt":                   {"ca.crt"},
+		"extension-apiserver-authentication": {"client-ca-file", "requestheader-client-ca-file"},
+	} {
+		var cm corev1.ConfigMap
+		if err := st.K8sClient.Get(st.Context, client.ObjectKey{Namespace: "kube-system", Name: name}, &cm); err != nil {
+			st.Logger.Warnf("Failed to read the CAs of the %s ConfigMap: %v", name, err)
+			continue
+		}
+		for _, key := range keys {
+			certs, err := pki.ParsePEM([]byte(cm.Data[key]))
+			if err != nil {
+				st.Logger.Warnf("Failed to parse %s of the %s ConfigMap: %v", key, name, err)
+			}
+			cas = append(cas, certs...)
+		}
+	}
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("the API server publishes no CA, give the cluster CAs with --ca-file")
+	}
+	return cas, nil
+}
+
+func countFlagged(certs []pki.Certificate) int {
+	n := 0
+	for _, c := range certs {
+		if len(c.Flags) > 0 {
+			n++
+		}
+	}
+	return n
+}
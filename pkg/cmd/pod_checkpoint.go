@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/checkpoint"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type podCheckpointOpts struct {
+	globalOptions
+	Output  string        `longflag:"output" shortflag:"o"`
+	DumpDir string        `longflag:"dump-dir"`
+	Timeout time.Duration `longflag:"timeout"`
+	Remove  bool          `longflag:"remove"`
+}
+
+// checkpointArchive is a checkpoint archive acquired from a node.
+type checkpointArchive struct {
+	Container string          `json:"container"`
+	Node      string          `json:"node"`
+	Source    string          `json:"source"`
+	Path      string          `json:"path"`
+	SHA256    string          `json:"sha256"`
+	Size      int64           `json:"size"`
+	Verified  bool            `json:"verified"`
+	Content   checkpoint.Info `json:"content"`
+}
+
+func (opts *podCheckpointOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func podCheckpointCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &podCheckpointOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod-checkpoint [namespace/pod[/container]]",
+		Short: "Checkpoint a running container with CRIU and acquire the archive as evidence",
+		Long: `Checkpoint a running container with CRIU and acquire the archive as evidence.
+
+The checkpoint is requested from the kubelet through the node proxy of the API
+server, which requires the ContainerCheckpoint feature gate and a container
+runtime with CRIU support. The container keeps running. The archive, holding
+the memory and process state as well as the filesystem changes, is then copied
+out of /var/lib/kubelet/checkpoints through the forensic pod, verified against
+its hash on the node and recorded in the evidence manifest.
+
+The first container of the pod is used when none is given.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPodCheckpointCmd(st, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"evidence",
+		"evidence directory the archive is written to")
+
+	cmd.Flags().DurationVar(&opts.Timeout,
+		longFlagName(opts, "Timeout"),
+		0,
+		"time the kubelet waits for the checkpoint, 0 keeps the kubelet default")
+
+	cmd.Flags().BoolVar(&opts.Remove,
+		longFlagName(opts, "Remove"),
+		false,
+		"remove the archive from the node once it was acquired and verified")
+
+	return cmd
+}
+
+// runPodCheckpointCmd checkpoints a container and acquires the archives the
+// kubelet wrote on its node.
+func runPodCheckpointCmd(st *state.State, opts *podCheckpointOpts, name string) error {
+	ref, nodeName, _, err := locateContainer(st, name)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := evidence.Open(opts.DumpDir)
+	if err != nil {
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Checkpointing %s on %s", ref, nodeName))
+	sources, err := checkpoint.Request(st.Context, st.ClientSet.CoreV1().RESTClient(), ref, nodeName, opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	var archives []checkpointArchive
+	var steps []tasks.Task
+	for _, source := range sources {
+		item := evidence.Item{
+			Name:        path.Join(nodeName, "checkpoints", path.Base(source)),
+			Source:      source,
+			Description: "CRIU checkpoint of container " + ref.String(),
+			Metadata: map[string]string{
+				"container": ref.String(),
+			},
+		}
+		steps = append(steps,
+			tasks.AcquireEvidence(st, nodeName, manifest, item,
+				checkpoint.CopyScript(source), checkpoint.HashScript(source)),
+			tasks.Task{
+				Description: "inspect " + source,
+				Fn: func(s *state.State) error {
+					archive, err := inspectCheckpoint(manifest, item.Name)
+					if err != nil {
+						return err
+					}
+					archive.Container = ref.String()
+					archives = append(archives, archive)
+					s.Logger.Info(fmt.Sprintf("Checkpoint archive holds %d CRIU images and %d MiB of memory pages", archive.Content.Images, archive.Content.PagesSize/1024/1024))
+					return nil
+				},
+				Retries: 1,
+			},
+			tasks.Task{
+				Description: "remove " + source + " from the node",
+				Predicate: func(_ *state.State) bool {
+					return opts.Remove
+				},
+				Fn: func(s *state.State) error {
+					return tasks.ExecuteCollect(s, nodeName, "remove "+source, checkpoint.RemoveScript(source), func([]byte) error {
+						return nil
+					}).Fn(s)
+				},
+				Retries: 1,
+			},
+		)
+	}
+
+	if err := runOnNode(st, nodeName, steps...); err != nil {
+		return err
+	}
+
+	return printReport(opts.Output, archives, func(w io.Writer) {
+		fmt.Fprintln(w, "CONTAINER\tNODE\tSOURCE\tPATH\tSIZE\tIMAGES\tPAGES\tVERIFIED\tSHA256")
+		for _, a := range archives {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%t\t%s\n",
+				a.Container, a.Node, a.Source, a.Path, a.Size, a.Content.Images, a.Content.PagesSize, a.Verified, a.SHA256)
+		}
+	})
+}
+
+// inspectCheckpoint checks that an acquired checkpoint archive matches its
+// hash on the node and is a complete CRIU checkpoint.
+func inspectCheckpoint(manifest *evidence.Manifest, name string) (checkpointArchive, error) {
+	var item evidence.Item
+	for _, i := range manifest.Items {
+		if i.Name == name {
+			item = i
+		}
+	}
+	archive := checkpointArchive{
+		Node:     item.Node,
+		Source:   item.Source,
+		Path:     item.Path,
+		SHA256:   item.SHA256,
+		Size:     item.Size,
+		Verified: item.Verified,
+	}
+	if !item.Verified {
+		return archive, fmt.Errorf("checkpoint archive %s does not match its hash on the node", item.Path)
+	}
+
+	f, err := os.Open(item.Path)
+	if err != nil {
+		return archive, fmt.Errorf("failed to open checkpoint archive: %w", err)
+	}
+	defer f.Close()
+
+	archive.Content, err = checkpoint.Inspect(f)
+	if err != nil {
+		return archive, fmt.Errorf("%s: %w", item.Path, err)
+	}
+	return archive, nil
+}
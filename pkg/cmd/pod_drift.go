@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/overlay"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type podDriftOpts struct {
+	globalOptions
+	Output  string `longflag:"output" shortflag:"o"`
+	DumpDir string `longflag:"dump-dir"`
+	MaxSize int64  `longflag:"max-size"`
+}
+
+func (opts *podDriftOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func podDriftCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &podDriftOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod-drift [namespace/pod[/container]]",
+		Short: "List the files a container added, modified or deleted compared to its image",
+		Long: `List the files a container added, modified or deleted compared to its image.
+
+The writable upper directory of the overlayfs root mount of the container is
+walked on its node. Entries missing from the image layers are reported as
+added, entries shadowing an image file as modified, whiteouts as deleted and
+opaque directories, which hide the whole image directory, as opaque. Modified
+files whose content equals the image version only had their metadata changed.
+
+The first container of the pod is used when none is given.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPodDriftCmd(st, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.DumpDir,
+		longFlagName(opts, "DumpDir"),
+		"",
+		"copy the added and modified files into this evidence directory")
+
+	cmd.Flags().Int64Var(&opts.MaxSize,
+		longFlagName(opts, "MaxSize"),
+		64,
+		"do not hash files larger than this many MiB")
+
+	return cmd
+}
+
+// runPodDriftCmd reports the content of the writable layer of a container and
+// optionally copies the changed files out of the node.
+func runPodDriftCmd(st *state.State, opts *podDriftOpts, name string) error {
+	ref, nodeName, containerID, err := locateContainer(st, name)
+	if err != nil {
+		return err
+	}
+
+	var manifest *evidence.Manifest
+	if opts.DumpDir != "" {
+		manifest, err = evidence.Open(opts.DumpDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	st.Logger.Info(fmt.Sprintf("Reading the writable layer of %s on %s", ref, nodeName))
+
+	var drift overlay.Drift
+	err = runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "walk the container upper directory", overlay.DriftScript(containerID, opts.MaxSize*1024*1024), func(output []byte) error {
+			drift = overlay.ParseDrift(output)
+			for _, w := range drift.Warnings {
+				st.Logger.Warn(w)
+			}
+			return nil
+		}),
+		tasks.Task{
+			Description: "copy changed files",
+			Predicate: func(_ *state.State) bool {
+				return manifest != nil && drift.UpperDir != ""
+			},
+			Fn: func(s *state.State) error {
+				dir := path.Join(nodeName, "drift", strings.ReplaceAll(ref.String(), "/", "_"))
+				for _, c := range drift.Changes {
+					if !c.IsRegular() || c.MetadataOnly {
+						continue
+					}
+					item := evidence.Item{
+						Name:        path.Join(dir, c.Path),
+						Source:      path.Join(drift.UpperDir, c.Path),
+						Description: fmt.Sprintf("%s file %s of container %s", c.Change, c.Path, ref),
+						Metadata: map[string]string{
+							"container": ref.String(),
+							"path":      c.Path,
+							"change":    c.Change,
+							"mode":      c.Mode,
+							"modTime":   c.ModTime.Format(time.RFC3339),
+						},
+					}
+					acquire := tasks.AcquireEvidence(s, nodeName, manifest, item,
+						overlay.CopyScript(drift.UpperDir, c.Path), overlay.HashScript(drift.UpperDir, c.Path))
+					if err := acquire.Fn(s); err != nil {
+						// The container may have removed the file since the walk,
+						// keep going with the remaining ones.
+						s.Logger.Warnf("Failed to copy %s: %s", c.Path, err)
+					}
+				}
+				return nil
+			},
+			Retries: 1,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if drift.UpperDir != "" {
+		st.Logger.Info(fmt.Sprintf("Found %d changes in %s", len(drift.Changes), drift.UpperDir))
+	}
+
+	return printReport(opts.Output, drift, func(w io.Writer) {
+		fmt.Fprintln(w, "CHANGE\tTYPE\tMODE\tUID\tGID\tSIZE\tMTIME\tSHA256\tPATH")
+		for _, c := range drift.Changes {
+			change, sum, p := c.Change, c.SHA256, c.Path
+			if c.MetadataOnly {
+				change += " (metadata)"
+			}
+			if sum == "" {
+				sum = "-"
+			}
+			if c.Target != "" {
+				p += " -> " + c.Target
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+				change, c.Type, c.Mode, c.UID, c.GID, c.Size, c.ModTime.Format("2006-01-02 15:04:05"), sum, p)
+		}
+	})
+}
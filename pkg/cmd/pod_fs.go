@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type podFilesystemOpts struct {
+	globalOptions
+}
+
+func (opts *podFilesystemOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func podFilesystemCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &podFilesystemOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod-fs [namespace/pod[/container]]",
+		Short: "Browse the root filesystem of a container",
+		Long: `Browse the root filesystem of a container.
+
+An interactive shell of the forensic pod is opened on the node of the pod, in
+the root directory of the container as seen from its mount namespace. The
+tools of the forensic pod are used, so images without a shell, such as
+distroless images, can be browsed as well. Paths must be given relative to the
+container root, absolute paths refer to the forensic pod.
+
+The first container of the pod is used when none is given.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPodFilesystemCmd(st, opts, args[0])
+		},
+	}
+
+	return cmd
+}
+
+// runPodFilesystemCmd opens a shell in the root filesystem of a container.
+func runPodFilesystemCmd(st *state.State, _ *podFilesystemOpts, name string) error {
+	ref, nodeName, containerID, err := locateContainer(st, name)
+	if err != nil {
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Opening the root filesystem of %s on %s", ref, nodeName))
+
+	return runOnNode(st, nodeName,
+		tasks.ExecuteInteractiveScript(st, nodeName, "Browse the container root filesystem", procfs.RootShellScript(containerID, ref.String())),
+	)
+}
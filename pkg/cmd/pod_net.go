@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type podNetworkOpts struct {
+	globalOptions
+	Output string `longflag:"output" shortflag:"o"`
+}
+
+func (opts *podNetworkOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func podNetworkCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &podNetworkOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod-net [namespace/pod[/container]]",
+		Short: "List the interfaces, routes and sockets of a pod",
+		Long: `List the interfaces, routes and sockets of a pod.
+
+The network namespace of the container is entered with nsenter from the
+forensic pod on its node, so images without any networking tool are covered.
+The TCP and UDP sockets are listed with the processes holding them.
+
+The first container of the pod is used when none is given.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPodNetworkCmd(st, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	return cmd
+}
+
+// runPodNetworkCmd lists the network namespace of a container.
+func runPodNetworkCmd(st *state.State, opts *podNetworkOpts, name string) error {
+	ref, nodeName, containerID, err := locateContainer(st, name)
+	if err != nil {
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Listing the network of %s on %s", ref, nodeName))
+
+	var network procfs.Network
+	err = runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "list container network", procfs.NetworkScript(containerID), func(output []byte) error {
+			network = procfs.ParseNetwork(output)
+			for _, w := range network.Warnings {
+				st.Logger.Warn(w)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	return printReport(opts.Output, network, func(w io.Writer) {
+		fmt.Fprintln(w, "INTERFACE\tFAMILY\tADDRESS")
+		for _, a := range network.Addresses {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", a.Interface, a.Family, a.Address)
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "ROUTE")
+		for _, r := range network.Routes {
+			fmt.Fprintln(w, r)
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "PROTO\tLOCAL\tREMOTE\tSTATE\tPID\tPROCESS")
+		for _, s := range network.Sockets {
+			remote, state := "-", s.State
+			if s.Connected() {
+				remote = s.Remote.String()
+			}
+			if state == "" {
+				state = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", s.Proto, s.Local, remote, state, s.PID, s.Process)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type podProcessOpts struct {
+	globalOptions
+	Output string `longflag:"output" shortflag:"o"`
+}
+
+func (opts *podProcessOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func podProcessCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &podProcessOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod-process [namespace/pod[/container]]",
+		Short: "List the processes running in a container",
+		Long: `List the processes running in a container.
+
+The processes sharing the PID namespace of the container are listed from its
+node, with their host PID and their PID inside the container. Pods sharing
+their process namespace list the processes of all their containers.
+
+The first container of the pod is used when none is given.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPodProcessCmd(st, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	return cmd
+}
+
+// runPodProcessCmd lists the processes of the PID namespace of a container.
+func runPodProcessCmd(st *state.State, opts *podProcessOpts, name string) error {
+	ref, nodeName, containerID, err := locateContainer(st, name)
+	if err != nil {
+		return err
+	}
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	index := kube.NewPodIndex(pods)
+
+	st.Logger.Info(fmt.Sprintf("Listing the processes of %s on %s", ref, nodeName))
+
+	var procs []procfs.NamespaceProcess
+	err = runOnNode(st, nodeName,
+		tasks.ExecuteCollect(st, nodeName, "list container processes", procfs.NamespaceProcessesScript(containerID), func(output []byte) error {
+			var warnings []string
+			procs, warnings = procfs.ParseNamespaceProcesses(output)
+			for _, w := range warnings {
+				st.Logger.Warn(w)
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	for i, p := range procs {
+		if c, ok := index.LookupCgroup(p.Cgroup); ok {
+			procs[i].Container = c.String()
+		}
+	}
+
+	return printReport(opts.Output, procs, func(w io.Writer) {
+		fmt.Fprintln(w, "PID\tHOST PID\tPPID\tUID\tCONTAINER\tNAME\tEXE\tCMDLINE")
+		for _, p := range procs {
+			container := p.Container
+			if container == "" {
+				container = "-"
+			}
+			fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", p.NSPID, p.PID, p.PPID, p.UID, container, p.Name, p.Exe, p.Cmdline)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/workload"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type privilegedWorkloadsOpts struct {
+	globalOptions
+	Output      string `longflag:"output" shortflag:"o"`
+	Namespace   string `longflag:"namespace" shortflag:"n"`
+	MinSeverity string `longflag:"min-severity"`
+}
+
+func (opts *privilegedWorkloadsOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func privilegedWorkloadsCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &privilegedWorkloadsOpts{}
+	cmd := &cobra.Command{
+		Use:   "privileged-workloads",
+		Short: "Inventory the pods running with privileges, grouped by namespace and workload",
+		Long: `Inventory the pods running with privileges, grouped by namespace and workload.
+
+Every running pod is checked for privileged containers, the host PID, network
+and IPC namespaces, hostPath mounts, added capabilities, privilege escalation
+and the root user. Mounts of the host root, /var/run, the container runtime
+sockets and similar paths and capabilities allowing to escape the container
+are reported as high.
+
+Pods are grouped by the workload owning them, such as the Deployment of their
+ReplicaSet or the CronJob of their Job. Privilege escalation not disabled and
+containers running with the user of their image are low and only reported
+with --min-severity low.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runPrivilegedWorkloadsCmd(st, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVarP(&opts.Namespace,
+		longFlagName(opts, "Namespace"),
+		shortFlagName(opts, "Namespace"),
+		"",
+		"only inventory the pods of this namespace")
+
+	cmd.Flags().StringVar(&opts.MinSeverity,
+		longFlagName(opts, "MinSeverity"),
+		severity.Medium,
+		"lowest severity reported, one of high, medium or low")
+
+	return cmd
+}
+
+func runPrivilegedWorkloadsCmd(st *state.State, opts *privilegedWorkloadsOpts) error {
+	if err := severity.Valid(opts.MinSeverity); err != nil {
+		return err
+	}
+
+	var (
+		pods        corev1.PodList
+		replicaSets appsv1.ReplicaSetList
+		jobs        batchv1.JobList
+	)
+	for _, list := range []client.ObjectList{&pods, &replicaSets, &jobs} {
+		if err := st.K8sClient.List(st.Context, list, client.InNamespace(opts.Namespace)); err != nil {
+			return fmt.Errorf("failed to list %T: %w", list, err)
+		}
+	}
+	st.Logger.Info(fmt.Sprintf("Inspecting %d pods", len(pods.Items)))
+
+	workloads := workload.Group(pods.Items, workload.NewOwnerIndex(replicaSets.Items, jobs.Items), opts.MinSeverity)
+
+	return printReport(opts.Output, workloads, func(w io.Writer) {
+		fmt.Fprintln(w, "NAMESPACE\tWORKLOAD\tPODS\tSEVERITY\tCHECK\tCONTAINER\tDETAIL")
+		for _, wl := range workloads {
+			for _, f := range wl.Findings {
+				container := f.Container
+				if container == "" {
+					container = "<pod>"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+					wl.Namespace, wl.Owner, len(wl.Pods), f.Severity, f.Check, container, f.Detail)
+			}
+		}
+	})
+}
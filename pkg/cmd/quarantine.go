@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/quarantine"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type quarantineNodeOpts struct {
+	globalOptions
+	Output      string `longflag:"output" shortflag:"o"`
+	Reason      string `longflag:"reason"`
+	Evict       bool   `longflag:"evict"`
+	IsolatePods bool   `longflag:"isolate-pods"`
+	UndoDir     string `longflag:"undo-dir"`
+}
+
+func (opts *quarantineNodeOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func quarantineCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "quarantine",
+		Short: "Isolate a node or a pod, recording every change so it can be released",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(quarantineNodeCmd(rootFlags))
+	cmd.AddCommand(quarantinePodCmd(rootFlags))
+
+	return cmd
+}
+
+func quarantineNodeCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &quarantineNodeOpts{}
+	cmd := &cobra.Command{
+		Use:   "node [node-name]",
+		Short: "Cordon, taint and label a node and optionally isolate its pods",
+		Long: `Cordon, taint and label a node and optionally isolate its pods.
+
+The node is cordoned, tainted with ` + quarantine.TaintKey + `:NoSchedule and
+labeled with ` + quarantine.LabelKey + `. The forensic pod tolerates the taint.
+With --evict the NoExecute effect is added as well, which evicts the running
+pods and with them their volatile state, so acquire what is needed first.
+With --isolate-pods every pod of the node is labeled with
+` + quarantine.PodLabelKey("<record ID>") + ` and a NetworkPolicy
+without rules selecting the labeled pods is created in each of their
+namespaces. NetworkPolicies add up: the traffic other policies selecting the
+pods allow, such as the ones selecting every pod of their namespace, is still
+allowed. These policies are reported and kept in the undo record, narrow them
+to fully isolate the pods. Pods using the host network are not affected by
+NetworkPolicies and are only reported.
+
+Every change is recorded, before it is made, in a ConfigMap of the default
+namespace and in --undo-dir. "release node" reverts the changes.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runQuarantineNodeCmd(st, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format of the undo record, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.Reason,
+		longFlagName(opts, "Reason"),
+		"",
+		"reason of the quarantine, stored in the undo record")
+
+	cmd.Flags().BoolVar(&opts.Evict,
+		longFlagName(opts, "Evict"),
+		false,
+		"also taint with NoExecute, evicting the pods that do not tolerate it")
+
+	cmd.Flags().BoolVar(&opts.IsolatePods,
+		longFlagName(opts, "IsolatePods"),
+		false,
+		"isolate the pods of the node with NetworkPolicies, reporting the other policies still allowing their traffic")
+
+	cmd.Flags().StringVar(&opts.UndoDir,
+		longFlagName(opts, "UndoDir"),
+		"quarantine",
+		"directory the local copy of the undo record is written to")
+
+	return cmd
+}
+
+// runQuarantineNodeCmd quarantines a node. It stops at the first change that
+// fails, the changes made so far stay recorded and can be released.
+func runQuarantineNodeCmd(st *state.State, opts *quarantineNodeOpts, nodeName string) error {
+	store := quarantine.Store{Client: st.K8sClient, Dir: opts.UndoDir}
+	existing, err := store.Load(st.Context, "Node", "", nodeName)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ReleasedAt == nil {
+		return fmt.Errorf("node %s is already quarantined since %s, release it first", nodeName, existing.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	node := &corev1.Node{}
+	if err := st.K8sClient.Get(st.Context, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+
+	q := &quarantine.Quarantine{
+		Client: st.K8sClient,
+		Store:  store,
+		Record: quarantine.NewRecord("Node", "", nodeName, opts.Reason),
+	}
+	if err := quarantineNode(st, q, opts, nodeName); err != nil {
+		st.Logger.Errorf("Quarantine of %s stopped, the changes made so far are recorded and can be released", nodeName)
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Node %s is quarantined, %d changes recorded in ConfigMap %s/%s and %s",
+		nodeName, len(q.Record.Changes), quarantine.Namespace, quarantine.ConfigMapName("Node", "", nodeName), opts.UndoDir))
+
+	return printUndoRecord(opts.Output, q.Record)
+}
+
+func quarantineNode(st *state.State, q *quarantine.Quarantine, opts *quarantineNodeOpts, nodeName string) error {
+	if err := q.Store.Save(st.Context, q.Record); err != nil {
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Cordoning %s", nodeName))
+	if err := q.Cordon(st.Context, nodeName); err != nil {
+		return err
+	}
+
+	effects := []corev1.TaintEffect{corev1.TaintEffectNoSchedule}
+	if opts.Evict {
+		st.Logger.Warn(fmt.Sprintf("Tainting %s with NoExecute, its pods will be evicted", nodeName))
+		effects = append(effects, corev1.TaintEffectNoExecute)
+	}
+	for _, effect := range effects {
+		if err := q.Taint(st.Context, nodeName, effect); err != nil {
+			return err
+		}
+	}
+
+	if err := q.Label(st.Context, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName}}); err != nil {
+		return err
+	}
+
+	if !opts.IsolatePods {
+		return nil
+	}
+
+	pods, err := kube.ListNodePods(st.Context, st.K8sClient, nodeName)
+	if err != nil {
+		return err
+	}
+	isolated, err := isolatePods(st, q, pods)
+	if err != nil {
+		return err
+	}
+	return checkIsolation(st, q, isolated)
+}
+
+// isolatePods labels pods with the record ID and creates the NetworkPolicy
+// selecting them in each of their namespaces. It returns the labeled pods.
+func isolatePods(st *state.State, q *quarantine.Quarantine, pods []corev1.Pod) ([]corev1.Pod, error) {
+	var isolated []corev1.Pod
+	namespaces := map[string]bool{}
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if pod.Spec.HostNetwork {
+			st.Logger.Warn(fmt.Sprintf("Pod %s/%s uses the host network and can not be isolated with a NetworkPolicy", pod.Namespace, pod.Name))
+			continue
+		}
+		if err := q.Label(st.Context, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}); err != nil {
+			return isolated, err
+		}
+		isolated = append(isolated, pod)
+		namespaces[pod.Namespace] = true
+	}
+
+	var sorted []string
+	for ns := range namespaces {
+		sorted = append(sorted, ns)
+	}
+	sort.Strings(sorted)
+	for _, ns := range sorted {
+		st.Logger.Info(fmt.Sprintf("Isolating the quarantined pods of namespace %s", ns))
+		if err := q.Isolate(st.Context, ns); err != nil {
+			return isolated, err
+		}
+	}
+	return isolated, nil
+}
+
+// checkIsolation warns about the NetworkPolicies still allowing traffic of
+// the isolated pods, since policies add up, and keeps them in the record.
+func checkIsolation(st *state.State, q *quarantine.Quarantine, pods []corev1.Pod) error {
+	bypasses, err := quarantine.Bypasses(st.Context, q.Client, pods)
+	if err != nil {
+		return err
+	}
+	for _, b := range bypasses {
+		st.Logger.Warn(b.String())
+	}
+	q.Record.Bypasses = bypasses
+	return q.Store.Save(st.Context, q.Record)
+}
+
+type quarantinePodOpts struct {
+	globalOptions
+	Output  string `longflag:"output" shortflag:"o"`
+	Reason  string `longflag:"reason"`
+	UndoDir string `longflag:"undo-dir"`
+}
+
+func (opts *quarantinePodOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func quarantinePodCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &quarantinePodOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod [namespace/pod]",
+		Short: "Isolate a pod and detach it from its controller and Services, keeping it running",
+		Long: `Isolate a pod and detach it from its controller and Services, keeping it running.
+
+The pod is labeled with ` + quarantine.PodLabelKey("<record ID>") + ` and a
+NetworkPolicy without rules selecting it is created in its namespace. Each
+quarantine labels its own key, so quarantining a pod of a quarantined node
+and releasing either one leaves the other isolated. Then
+the labels its controller and the matching Services select it by are removed:
+the controller releases the pod and starts a replacement, and the Services
+stop sending it traffic, while the pod itself keeps running for the
+investigation. NetworkPolicies add up: other policies still selecting the pod
+once detached keep allowing their traffic, they are reported and kept in the
+undo record. Pods using the host network are not affected by NetworkPolicies.
+
+Every change is recorded, before it is made, in a ConfigMap of the default
+namespace and in --undo-dir. "release pod" restores the labels, after which
+the controller adopts the pod again and scales away the surplus pod, and
+deletes the NetworkPolicy.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runQuarantinePodCmd(st, opts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format of the undo record, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.Reason,
+		longFlagName(opts, "Reason"),
+		"",
+		"reason of the quarantine, stored in the undo record")
+
+	cmd.Flags().StringVar(&opts.UndoDir,
+		longFlagName(opts, "UndoDir"),
+		"quarantine",
+		"directory the local copy of the undo record is written to")
+
+	return cmd
+}
+
+// runQuarantinePodCmd quarantines a pod. As for nodes, it stops at the first
+// change that fails and the changes made so far can be released.
+func runQuarantinePodCmd(st *state.State, opts *quarantinePodOpts, name string) error {
+	namespace, podName, err := parsePodName(name)
+	if err != nil {
+		return err
+	}
+
+	store := quarantine.Store{Client: st.K8sClient, Dir: opts.UndoDir}
+	existing, err := store.Load(st.Context, "Pod", namespace, podName)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ReleasedAt == nil {
+		return fmt.Errorf("pod %s is already quarantined since %s, release it first", name, existing.CreatedAt.Format("2006-01-02 15:04:05"))
+	}
+
+	pod := &corev1.Pod{}
+	if err := st.K8sClient.Get(st.Context, client.ObjectKey{Namespace: namespace, Name: podName}, pod); err != nil {
+		return fmt.Errorf("failed to get pod %s: %w", name, err)
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "StatefulSet" {
+		st.Logger.Warn(fmt.Sprintf("StatefulSet %s can not start a replacement while the pod %s exists", owner.Name, name))
+	}
+
+	q := &quarantine.Quarantine{
+		Client: st.K8sClient,
+		Store:  store,
+		Record: quarantine.NewRecord("Pod", namespace, podName, opts.Reason),
+	}
+	if err := quarantinePod(st, q, pod); err != nil {
+		st.Logger.Errorf("Quarantine of %s stopped, the changes made so far are recorded and can be released", name)
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Pod %s is quarantined, %d changes recorded in ConfigMap %s/%s and %s",
+		name, len(q.Record.Changes), quarantine.Namespace, quarantine.ConfigMapName("Pod", namespace, podName), opts.UndoDir))
+
+	return printUndoRecord(opts.Output, q.Record)
+}
+
+// quarantinePod isolates the pod before detaching it, so it has no network
+// access by the time its controller lets go of it.
+func quarantinePod(st *state.State, q *quarantine.Quarantine, pod *corev1.Pod) error {
+	if err := q.Store.Save(st.Context, q.Record); err != nil {
+		return err
+	}
+
+	isolated, err := isolatePods(st, q, []corev1.Pod{*pod})
+	if err != nil {
+		return err
+	}
+
+	st.Logger.Info(fmt.Sprintf("Detaching %s/%s from its controller and Services", pod.Namespace, pod.Name))
+	selectors, err := q.Detach(st.Context, pod)
+	if err != nil {
+		return err
+	}
+	for _, s := range selectors {
+		if s.Matches {
+			st.Logger.Warn(fmt.Sprintf("%s %s still selects the pod", s.Kind, s.Name))
+			continue
+		}
+		st.Logger.Info(fmt.Sprintf("Detached from %s %s", s.Kind, s.Name))
+	}
+	return checkIsolation(st, q, isolated)
+}
+
+func printUndoRecord(format string, r *quarantine.Record) error {
+	return printReport(format, r, func(w io.Writer) {
+		fmt.Fprintln(w, "#\tCHANGE")
+		for i, c := range r.Changes {
+			fmt.Fprintf(w, "%d\t%s\n", i+1, c)
+		}
+		for _, b := range r.Bypasses {
+			fmt.Fprintf(w, "!\t%s\n", b)
+		}
+	})
+}
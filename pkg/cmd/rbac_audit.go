@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/rbac"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// podSecurityEnforceLabel is the Pod Security Admission label of namespaces.
+const podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+
+type rbacAuditOpts struct {
+	globalOptions
+	Output               string   `longflag:"output" shortflag:"o"`
+	PrivilegedNamespaces []string `longflag:"privileged-namespace"`
+	IncludeDefaults      bool     `longflag:"include-defaults"`
+}
+
+// rbacAuditReport is the result of the RBAC audit.
+type rbacAuditReport struct {
+	Findings []rbac.Finding `json:"findings"`
+	Warnings []string       `json:"warnings,omitempty"`
+}
+
+func (opts *rbacAuditOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func rbacAuditCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &rbacAuditOpts{}
+	cmd := &cobra.Command{
+		Use:   "rbac-audit",
+		Short: "Report subjects with dangerous RBAC rights and the bindings granting them",
+		Long: `Report subjects with dangerous RBAC rights and the bindings granting them.
+
+Every Role, ClusterRole and binding of the cluster is walked and each
+subject is reported with the binding, role and rule granting it one of:
+
+  pods-exec       exec or attach into pods
+  create-pods     create pods or pod controllers in a privileged namespace
+  read-secrets    get, list or watch secrets
+  escalate, bind  grant rights the subject does not hold
+  impersonate     act as other users, groups or service accounts
+  nodes-proxy     reach the kubelet API of nodes
+  wildcard-verbs  any verb on the resources of a rule
+
+Rights of system:anonymous and system:unauthenticated are always reported as
+high and listed first. Privileged namespaces are kube-system, the namespaces
+given with --privileged-namespace and the ones enforcing the privileged Pod
+Security level. The subjects the API server puts in the bindings it
+bootstraps, such as system:masters in cluster-admin, are skipped unless
+--include-defaults is set. Other subjects of these bindings, system: groups
+included, are always reported, the bootstrapping label can be set by anyone
+allowed to create a binding.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runRBACAuditCmd(st, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringSliceVar(&opts.PrivilegedNamespaces,
+		longFlagName(opts, "PrivilegedNamespaces"),
+		nil,
+		"additional namespaces where creating pods is reported")
+
+	cmd.Flags().BoolVar(&opts.IncludeDefaults,
+		longFlagName(opts, "IncludeDefaults"),
+		false,
+		"also audit the control plane subjects of the default bindings")
+
+	return cmd
+}
+
+func runRBACAuditCmd(st *state.State, opts *rbacAuditOpts) error {
+	privileged, err := privilegedNamespaces(st, opts.PrivilegedNamespaces)
+	if err != nil {
+		return err
+	}
+
+	st.Logger.Info("Collecting roles and bindings")
+	inv, err := rbac.Collect(st.Context, st.K8sClient)
+	if err != nil {
+		return err
+	}
+	st.Logger.Info(fmt.Sprintf("Auditing %d bindings", len(inv.RoleBindings)+len(inv.ClusterRoleBindings)))
+
+	report := rbacAuditReport{}
+	report.Findings, report.Warnings = rbac.Analyze(inv, rbac.Options{
+		PrivilegedNamespaces: privileged,
+		IncludeDefaults:      opts.IncludeDefaults,
+	})
+	for _, w := range report.Warnings {
+		st.Logger.Warn(w)
+	}
+
+	return printReport(opts.Output, report, func(w io.Writer) {
+		fmt.Fprintln(w, "SEVERITY\tRISK\tSUBJECT\tSCOPE\tCHAIN")
+		for _, f := range report.Findings {
+			subject := f.Subject.String()
+			if f.Anonymous {
+				subject += " (anonymous)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Severity, f.Risk, subject, f.Scope, f.Chain())
+		}
+	})
+}
+
+// privilegedNamespaces returns kube-system, the namespaces enforcing the
+// privileged Pod Security level and extra.
+func privilegedNamespaces(st *state.State, extra []string) (map[string]bool, error) {
+	privileged := map[string]bool{"kube-system": true}
+	for _, ns := range extra {
+		privileged[ns] = true
+	}
+	var namespaces corev1.NamespaceList
+	if err := st.K8sClient.List(st.Context, &namespaces); err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+	for _, ns := range namespaces.Items {
+		if ns.Labels[podSecurityEnforceLabel] == "privileged" {
+			privileged[ns.Name] = true
+		}
+	}
+	return privileged, nil
+}
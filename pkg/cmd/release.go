@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/quarantine"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type releaseOpts struct {
+	globalOptions
+	Output  string `longflag:"output" shortflag:"o"`
+	UndoDir string `longflag:"undo-dir"`
+}
+
+func (opts *releaseOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func releaseCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "release",
+		Short: "Revert the quarantine of a node or a pod from its undo record",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(releaseNodeCmd(rootFlags))
+	cmd.AddCommand(releasePodCmd(rootFlags))
+
+	return cmd
+}
+
+func releaseNodeCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &releaseOpts{}
+	cmd := &cobra.Command{
+		Use:   "node [node-name]",
+		Short: "Revert the quarantine of a node",
+		Long: `Revert the quarantine of a node.
+
+The undo record is read from its ConfigMap, or from --undo-dir when the
+ConfigMap is gone, and its changes are reverted last first: the
+NetworkPolicies are deleted and the labels, taints and the schedulable state
+are restored to their values before the quarantine.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runReleaseCmd(st, opts, "Node", "", args[0])
+		},
+	}
+
+	addReleaseFlags(cmd, opts)
+
+	return cmd
+}
+
+func releasePodCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &releaseOpts{}
+	cmd := &cobra.Command{
+		Use:   "pod [namespace/pod]",
+		Short: "Revert the quarantine of a pod",
+		Long: `Revert the quarantine of a pod.
+
+The labels removed from the pod are restored, so its controller adopts it
+again and its Services send it traffic, and the NetworkPolicy isolating it is
+deleted. The controller then scales away the pod it is left with in surplus.`,
+		Args:          cobra.ExactArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			namespace, podName, err := parsePodName(args[0])
+			if err != nil {
+				return err
+			}
+
+			return runReleaseCmd(st, opts, "Pod", namespace, podName)
+		},
+	}
+
+	addReleaseFlags(cmd, opts)
+
+	return cmd
+}
+
+func addReleaseFlags(cmd *cobra.Command, opts *releaseOpts) {
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format of the undo record, one of text, json or yaml")
+
+	cmd.Flags().StringVar(&opts.UndoDir,
+		longFlagName(opts, "UndoDir"),
+		"quarantine",
+		"directory holding the local copy of the undo record")
+}
+
+// runReleaseCmd reverts the changes recorded for an object. The record is
+// kept when a change can not be reverted, so the release can be retried.
+func runReleaseCmd(st *state.State, opts *releaseOpts, kind, namespace, name string) error {
+	store := quarantine.Store{Client: st.K8sClient, Dir: opts.UndoDir}
+	r, err := store.Load(st.Context, kind, namespace, name)
+	if err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("no quarantine record found for %s", quarantine.NewRecord(kind, namespace, name, "").Target())
+	}
+
+	st.Logger.Info(fmt.Sprintf("Reverting %d changes of the quarantine of %s", len(r.Changes), r.Target()))
+	if errs := quarantine.Release(st.Context, st.K8sClient, r); len(errs) > 0 {
+		for _, err := range errs {
+			st.Logger.Error(err)
+		}
+		return fmt.Errorf("%d of %d changes could not be reverted, the undo record is kept", len(errs), len(r.Changes))
+	}
+
+	if err := store.Released(st.Context, r); err != nil {
+		return err
+	}
+	st.Logger.Info(fmt.Sprintf("Released %s", r.Target()))
+
+	return printUndoRecord(opts.Output, r)
+}
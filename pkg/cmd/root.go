@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
 	"github.com/spf13/cobra"
 )
 
@@ -40,8 +41,40 @@ func newRoot() *cobra.Command {
 		"text",
 		"format for logging")
 
+	fs.StringVar(&opts.Image,
+		longFlagName(opts, "Image"),
+		tasks.ForensicImage,
+		"image of the forensic pod, build/forensic-pod adds getfattr, GNU stat and etcdctl to the default one")
+
 	rootCmd.AddCommand(nodeProcessCmd(fs))
 	rootCmd.AddCommand(nodeNetworkCmd(fs))
+	rootCmd.AddCommand(nodeHiddenCmd(fs))
+	rootCmd.AddCommand(nodeFilelessCmd(fs))
+	rootCmd.AddCommand(nodeEnvCmd(fs))
+	rootCmd.AddCommand(nodeMinerCmd(fs))
+	rootCmd.AddCommand(nodeShellsCmd(fs))
+	rootCmd.AddCommand(nodePermsCmd(fs))
+	rootCmd.AddCommand(nodeTimelineCmd(fs))
+	rootCmd.AddCommand(timelineCmd(fs))
+	rootCmd.AddCommand(nodeYaraCmd(fs))
+	rootCmd.AddCommand(iocSweepCmd(fs))
+	rootCmd.AddCommand(nodeMemdumpCmd(fs))
+	rootCmd.AddCommand(podDriftCmd(fs))
+	rootCmd.AddCommand(podCheckpointCmd(fs))
+	rootCmd.AddCommand(podProcessCmd(fs))
+	rootCmd.AddCommand(podNetworkCmd(fs))
+	rootCmd.AddCommand(podFilesystemCmd(fs))
+	rootCmd.AddCommand(quarantineCmd(fs))
+	rootCmd.AddCommand(releaseCmd(fs))
+	rootCmd.AddCommand(rbacAuditCmd(fs))
+	rootCmd.AddCommand(privilegedWorkloadsCmd(fs))
+	rootCmd.AddCommand(auditLogCmd(fs))
+	rootCmd.AddCommand(saTokensCmd(fs))
+	rootCmd.AddCommand(imageInventoryCmd(fs))
+	rootCmd.AddCommand(controlPlaneAuditCmd(fs))
+	rootCmd.AddCommand(kubeletAuditCmd(fs))
+	rootCmd.AddCommand(pkiInventoryCmd(fs))
+	rootCmd.AddCommand(etcdCmd(fs))
 
 	return rootCmd
 }
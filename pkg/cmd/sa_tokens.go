@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/rbac"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/satoken"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type saTokensOpts struct {
+	globalOptions
+	Output    string `longflag:"output" shortflag:"o"`
+	Namespace string `longflag:"namespace" shortflag:"n"`
+	All       bool   `longflag:"all"`
+}
+
+func (opts *saTokensOpts) BuildState() (*state.State, error) {
+	s, err := opts.globalOptions.BuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func saTokensCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &saTokensOpts{}
+	cmd := &cobra.Command{
+		Use:   "sa-tokens",
+		Short: "Map service account tokens to the pods holding them and the rights they carry",
+		Long: `Map service account tokens to the pods holding them and the rights they carry.
+
+Every service account is listed with the pods whose containers can read one
+of its tokens, mounted as a projected volume, mounted from a legacy token
+Secret or read from one into environment variables, through env or envFrom,
+and with its legacy long-lived token Secrets. Init and ephemeral containers
+count too. The rights of a token are the dangerous ones rbac-audit reports
+for the service account and for the groups every service account is a
+member of, default bindings included.
+
+Service accounts are sorted by the severity of their rights, then by the
+number of tokens out there, so the tokens most worth stealing come first.
+Only service accounts with a token are listed unless --all is set.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+
+			opts.globalOptions = *gopts
+			st, err := opts.BuildState()
+			if err != nil {
+				return err
+			}
+
+			return runSATokensCmd(st, opts)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, json or yaml")
+
+	cmd.Flags().StringVarP(&opts.Namespace,
+		longFlagName(opts, "Namespace"),
+		shortFlagName(opts, "Namespace"),
+		"",
+		"only list the service accounts of this namespace")
+
+	cmd.Flags().BoolVar(&opts.All,
+		longFlagName(opts, "All"),
+		false,
+		"also list the service accounts without a token")
+
+	return cmd
+}
+
+func runSATokensCmd(st *state.State, opts *saTokensOpts) error {
+	var (
+		serviceAccounts corev1.ServiceAccountList
+		pods            corev1.PodList
+		secrets         corev1.SecretList
+	)
+	inNamespace := client.InNamespace(opts.Namespace)
+	if err := st.K8sClient.List(st.Context, &serviceAccounts, inNamespace); err != nil {
+		return fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	if err := st.K8sClient.List(st.Context, &pods, inNamespace); err != nil {
+		return fmt.Errorf("failed to list pods: %w", err)
+	}
+	tokenType := client.MatchingFields{"type": string(corev1.SecretTypeServiceAccountToken)}
+	if err := st.K8sClient.List(st.Context, &secrets, inNamespace, tokenType); err != nil {
+		return fmt.Errorf("failed to list token secrets: %w", err)
+	}
+
+	privileged, err := privilegedNamespaces(st, nil)
+	if err != nil {
+		return err
+	}
+	inv, err := rbac.Collect(st.Context, st.K8sClient)
+	if err != nil {
+		return err
+	}
+	findings, _ := rbac.Analyze(inv, rbac.Options{PrivilegedNamespaces: privileged, IncludeDefaults: true})
+
+	var exposures []satoken.Exposure
+	for _, e := range satoken.Analyze(serviceAccounts.Items, pods.Items, secrets.Items, findings) {
+		if opts.All || e.Exposed() {
+			exposures = append(exposures, e)
+		}
+	}
+	st.Logger.Info(fmt.Sprintf("%d of %d service accounts have a token in a pod or a legacy Secret",
+		countExposed(exposures), len(serviceAccounts.Items)))
+
+	return printReport(opts.Output, exposures, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVICEACCOUNT\tSEVERITY\tRISKS\tPODS\tLEGACY SECRETS")
+		for _, e := range exposures {
+			var pods, secrets []string
+			for _, p := range e.Pods {
+				name := p.Pod + "(" + p.Mount + ")"
+				if !slices.Contains(pods, name) {
+					pods = append(pods, name)
+				}
+			}
+			for _, s := range e.LegacySecrets {
+				secrets = append(secrets, s.Name)
+			}
+			severity := e.Severity
+			if severity == "" {
+				severity = "-"
+			}
+			fmt.Fprintf(w, "%s/%s\t%s\t%s\t%s\t%s\n", e.Namespace, e.Name, severity,
+				strings.Join(e.Risks, ","), strings.Join(pods, ","), strings.Join(secrets, ","))
+		}
+	})
+}
+
+func countExposed(exposures []satoken.Exposure) int {
+	n := 0
+	for _, e := range exposures {
+		if e.Exposed() {
+			n++
+		}
+	}
+	return n
+}
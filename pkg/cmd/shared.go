@@ -2,14 +2,21 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"reflect"
 	"strings"
 
 	"github.com/bombsimon/logrusr/v4"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/kube"
 	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/stream"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"k8c.io/kubeone/pkg/fail"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlruntimelog "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -17,6 +24,7 @@ type globalOptions struct {
 	Verbose   bool   `longflag:"verbose" shortflag:"v"`
 	Debug     bool   `longflag:"debug" shortflag:"d"`
 	LogFormat string `longflag:"log-format" shortflag:"l"`
+	Image     string `longflag:"image"`
 }
 
 func (opts *globalOptions) BuildState() (*state.State, error) {
@@ -29,6 +37,7 @@ func (opts *globalOptions) BuildState() (*state.State, error) {
 	s.Logger = newLogger(opts.Verbose, opts.LogFormat)
 
 	s.Verbose = opts.Verbose
+	s.ForensicImage = opts.Image
 
 	return s, nil
 }
@@ -48,9 +57,126 @@ func persistentGlobalOptions(fs *pflag.FlagSet) (*globalOptions, error) {
 	}
 	gf.LogFormat = logFormat
 
+	image, err := fs.GetString(longFlagName(gf, "Image"))
+	if err != nil {
+		return nil, fail.Runtime(err, "getting global flags")
+	}
+	gf.Image = image
+
 	return gf, nil
 }
 
+// runOnNode deploys the forensic pod on nodeName, runs steps inside it and
+// always removes the pod again, even when one of the steps failed.
+func runOnNode(st *state.State, nodeName string, steps ...tasks.Task) error {
+	taskList := tasks.Tasks{
+		tasks.DeloyForenPod(st, nodeName),
+		tasks.WaitForenPodRunning(st, nodeName),
+	}
+	taskList = append(taskList, steps...)
+	taskList = append(taskList, tasks.DeleteForenPod(st, nodeName))
+
+	err := taskList.Run(st)
+	if err != nil {
+		tasks.DeleteForenPod(st, nodeName).Fn(st)
+		return err
+	}
+	return nil
+}
+
+// resolveContainer finds the container referenced as namespace/pod[/container]
+// on nodeName and returns its runtime ID. The first container of the pod is
+// used when none is given.
+func resolveContainer(pods []corev1.Pod, index *kube.PodIndex, name, nodeName string) (kube.ContainerRef, string, error) {
+	ref, err := kube.ParseContainerRef(name)
+	if err != nil {
+		return ref, "", err
+	}
+
+	found := false
+	for _, pod := range pods {
+		if pod.Namespace == ref.Namespace && pod.Name == ref.Pod {
+			found = true
+			if ref.Container == "" && len(pod.Spec.Containers) > 0 {
+				ref.Container = pod.Spec.Containers[0].Name
+			}
+		}
+	}
+	if !found {
+		return ref, "", fmt.Errorf("pod %s/%s is not running on node %s", ref.Namespace, ref.Pod, nodeName)
+	}
+
+	id, ok := index.ContainerID(ref)
+	if !ok {
+		return ref, "", fmt.Errorf("container %s has no running container ID", ref)
+	}
+	return ref, id, nil
+}
+
+// locateContainer looks up the container referenced as
+// namespace/pod[/container] and returns it with the node it runs on and its
+// runtime ID.
+func locateContainer(st *state.State, name string) (kube.ContainerRef, string, string, error) {
+	ref, err := kube.ParseContainerRef(name)
+	if err != nil {
+		return ref, "", "", err
+	}
+
+	var pod corev1.Pod
+	if err := st.K8sClient.Get(st.Context, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Pod}, &pod); err != nil {
+		return ref, "", "", fmt.Errorf("failed to get pod %s/%s: %w", ref.Namespace, ref.Pod, err)
+	}
+	if pod.Spec.NodeName == "" {
+		return ref, "", "", fmt.Errorf("pod %s/%s is not scheduled on a node", ref.Namespace, ref.Pod)
+	}
+
+	pods := []corev1.Pod{pod}
+	ref, id, err := resolveContainer(pods, kube.NewPodIndex(pods), name, pod.Spec.NodeName)
+	return ref, pod.Spec.NodeName, id, err
+}
+
+// parsePodName splits a pod given as namespace/pod.
+func parsePodName(name string) (string, string, error) {
+	ref, err := kube.ParseContainerRef(name)
+	if err != nil || ref.Container != "" {
+		return "", "", fmt.Errorf("invalid pod %q, expected namespace/pod", name)
+	}
+	return ref.Namespace, ref.Pod, nil
+}
+
+// streamTargets creates a task that runs one of the stream scripts in the
+// forensic pod and hands the targets to scan while they arrive. Warnings are
+// logged and passed to warn if it is set.
+func streamTargets(st *state.State, nodeName, description, script string, scan func(stream.Target, io.Reader) error, warn func(string)) tasks.Task {
+	return tasks.Task{
+		Description: description,
+		Fn: func(s *state.State) error {
+			pr, pw := io.Pipe()
+			done := make(chan error, 1)
+			go func() {
+				err := stream.ReadTargets(pr, scan, func(w string) {
+					st.Logger.Warn(w)
+					if warn != nil {
+						warn(w)
+					}
+				})
+				if err != nil {
+					pr.CloseWithError(err)
+				}
+				done <- err
+			}()
+
+			err := tasks.ExecuteStream(s, nodeName, description, script, pw).Fn(s)
+			pw.CloseWithError(err)
+			if readErr := <-done; readErr != nil {
+				return readErr
+			}
+			return err
+		},
+		Retries: 1,
+	}
+}
+
 func newLogger(verbose bool, format string) *logrus.Logger {
 	logger := logrus.New()
 
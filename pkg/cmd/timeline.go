@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/timeline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+type timelineOpts struct {
+	globalOptions
+	Output string `longflag:"output" shortflag:"o"`
+	Since  string `longflag:"since"`
+	Until  string `longflag:"until"`
+}
+
+func timelineCmd(rootFlags *pflag.FlagSet) *cobra.Command {
+	opts := &timelineOpts{}
+	cmd := &cobra.Command{
+		Use:           "timeline [bodyfile...]",
+		Short:         "Render bodyfiles into a sorted MAC time timeline",
+		Args:          cobra.MinimumNArgs(1),
+		SilenceErrors: true,
+		RunE: func(_ *cobra.Command, args []string) error {
+			gopts, err := persistentGlobalOptions(rootFlags)
+			if err != nil {
+				return err
+			}
+			opts.globalOptions = *gopts
+
+			return runTimelineCmd(opts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.Output,
+		longFlagName(opts, "Output"),
+		shortFlagName(opts, "Output"),
+		"text",
+		"output format, one of text, csv, json or yaml")
+
+	cmd.Flags().StringVar(&opts.Since,
+		longFlagName(opts, "Since"),
+		"",
+		"only show events at or after this time (RFC3339 or YYYY-MM-DD)")
+
+	cmd.Flags().StringVar(&opts.Until,
+		longFlagName(opts, "Until"),
+		"",
+		"only show events at or before this time (RFC3339 or YYYY-MM-DD)")
+
+	return cmd
+}
+
+// runTimelineCmd renders bodyfiles locally, it does not talk to the cluster.
+func runTimelineCmd(opts *timelineOpts, bodyfiles []string) error {
+	since, err := parseTime(opts.Since)
+	if err != nil {
+		return err
+	}
+	until, err := parseTime(opts.Until)
+	if err != nil {
+		return err
+	}
+
+	var records []timeline.Record
+	for _, name := range bodyfiles {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open bodyfile: %w", err)
+		}
+		recs, err := timeline.ReadBodyfile(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read bodyfile %s: %w", name, err)
+		}
+		records = append(records, recs...)
+	}
+
+	events := timeline.Render(records, since, until)
+
+	switch opts.Output {
+	case "csv":
+		return timeline.WriteCSV(os.Stdout, events)
+	case "", "text":
+		return timeline.WriteText(os.Stdout, events)
+	default:
+		return printReport(opts.Output, events, nil)
+	}
+}
+
+// parseTime parses a time given on the command line, an empty value is the
+// zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or YYYY-MM-DD", value)
+}
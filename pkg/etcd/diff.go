@@ -0,0 +1,113 @@
+package etcd
+
+import (
+	"slices"
+	"sort"
+)
+
+// Types of a change between two snapshots.
+const (
+	ChangeAdded    = "added"
+	ChangeDeleted  = "deleted"
+	ChangeModified = "modified"
+)
+
+// Change is a key that differs between two snapshots.
+type Change struct {
+	Type      string `json:"type"`
+	Key       string `json:"key"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind,omitempty"`
+	// OldRevision and NewRevision are the revisions the key was last
+	// modified at in each snapshot.
+	OldRevision int64 `json:"oldRevision,omitempty"`
+	NewRevision int64 `json:"newRevision,omitempty"`
+	// DeleteRevision is the revision a deleted key was deleted at, when the
+	// newer snapshot still holds its tombstone.
+	DeleteRevision int64 `json:"deleteRevision,omitempty"`
+
+	Old *Object `json:"-"`
+	New *Object `json:"-"`
+}
+
+// Filter selects objects by resource and namespace, empty fields select
+// everything.
+type Filter struct {
+	Resources []string
+	Namespace string
+	// Deleted selects the keys deleted before the snapshot too.
+	Deleted bool
+}
+
+// Match reports whether the filter selects an object.
+func (f Filter) Match(o *Object) bool {
+	if len(f.Resources) > 0 && !slices.Contains(f.Resources, o.Resource) {
+		return false
+	}
+	if f.Namespace != "" && o.Namespace != f.Namespace {
+		return false
+	}
+	return f.Deleted || !o.Deleted()
+}
+
+// Select returns the objects of the snapshot the filter selects.
+func (s *Snapshot) Select(f Filter) []*Object {
+	var objects []*Object
+	for i := range s.Objects {
+		if f.Match(&s.Objects[i]) {
+			objects = append(objects, &s.Objects[i])
+		}
+	}
+	return objects
+}
+
+// Diff compares the live keys of an older snapshot with the ones of a newer
+// one. Objects deleted between them are what an attacker cleaning up after
+// themselves leaves behind in the older one.
+func Diff(older, newer *Snapshot, f Filter) []Change {
+	f.Deleted = false
+	var changes []Change
+	for _, o := range older.Select(f) {
+		n := newer.Find(o.Key)
+		switch {
+		case n == nil || n.Deleted():
+			c := newChange(ChangeDeleted, o)
+			if n != nil {
+				c.DeleteRevision = n.DeleteRevision
+			}
+			changes = append(changes, c)
+		case n.ModRevision != o.ModRevision:
+			c := newChange(ChangeModified, n)
+			c.Old, c.OldRevision = o, o.ModRevision
+			changes = append(changes, c)
+		}
+	}
+	for _, n := range newer.Select(f) {
+		if o := older.Find(n.Key); o == nil || o.Deleted() {
+			changes = append(changes, newChange(ChangeAdded, n))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+func newChange(typ string, o *Object) Change {
+	c := Change{
+		Type:      typ,
+		Key:       o.Key,
+		Resource:  o.Resource,
+		Namespace: o.Namespace,
+		Name:      o.Name,
+		Kind:      o.Kind,
+	}
+	if typ == ChangeDeleted {
+		c.Old, c.OldRevision = o, o.ModRevision
+	} else {
+		c.New, c.NewRevision = o, o.ModRevision
+	}
+	return c
+}
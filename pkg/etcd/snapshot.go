@@ -0,0 +1,189 @@
+// Package etcd takes snapshots of the etcd members of the control plane and
+// reads the cluster state they hold.
+package etcd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// PKIDir is where kubeadm writes the etcd certificates.
+const PKIDir = "/etc/kubernetes/pki/etcd"
+
+// Credentials are the host paths of the TLS files used to reach etcd.
+type Credentials struct {
+	CACert string
+	Cert   string
+	Key    string
+}
+
+// DefaultCredentials uses the client certificate kubeadm issues for the etcd
+// health checks.
+var DefaultCredentials = Credentials{
+	CACert: path.Join(PKIDir, "ca.crt"),
+	Cert:   path.Join(PKIDir, "healthcheck-client.crt"),
+	Key:    path.Join(PKIDir, "healthcheck-client.key"),
+}
+
+// snapshotScript runs the etcdctl of the etcd container, or the one shipped
+// in the image of build/forensic-pod, to print the status of the member and
+// save a snapshot to $out in the forensic pod, never on the host. The endpoint
+// defaults to the first client URL etcd listens on.
+const snapshotScript = `
+root=` + tasks.HostRoot + `
+etcdctl=
+etcdutl=
+for d in /proc/[0-9]*; do
+  [ "$(cat "$d/comm" 2>/dev/null)" = etcd ] || continue
+  for b in usr/local/bin bin usr/bin; do
+    [ -z "$etcdctl" ] && [ -x "$d/root/$b/etcdctl" ] && etcdctl=$d/root/$b/etcdctl
+    [ -z "$etcdutl" ] && [ -x "$d/root/$b/etcdutl" ] && etcdutl=$d/root/$b/etcdutl
+  done
+  if [ -z "$endpoint" ]; then
+    urls=$(tr '\0' '\n' < "$d/cmdline" 2>/dev/null | awk 'p { print; exit } /^--listen-client-urls=/ { sub(/^--listen-client-urls=/, ""); print; exit } $0 == "--listen-client-urls" { p = 1 }')
+    endpoint=$(printf '%s' "${urls%%,*}" | sed 's|//0\.0\.0\.0:|//127.0.0.1:|')
+  fi
+  break
+done
+[ -n "$etcdctl" ] || etcdctl=$(command -v etcdctl)
+if [ -z "$etcdctl" ]; then
+  echo "no etcdctl found in the etcd container nor in the forensic pod image, give an --image built from build/forensic-pod" >&2
+  exit 1
+fi
+[ -n "$endpoint" ] || endpoint=https://127.0.0.1:2379
+for f in "$cacert" "$cert" "$key"; do
+  if [ ! -f "$root$f" ]; then
+    echo "$f does not exist, give the etcd client credentials" >&2
+    exit 1
+  fi
+done
+ctl() {
+  ETCDCTL_API=3 "$etcdctl" --endpoints="$endpoint" --cacert="$root$cacert" --cert="$root$cert" --key="$root$key" "$@"
+}
+status=$(ctl endpoint status -w json) || exit 1
+printf 'status\t%s\n' "$(printf '%s' "$status" | tr -d '\n')"
+rm -f "$out"
+ctl snapshot save "$out" >/dev/null || exit 1
+if [ -n "$etcdutl" ]; then
+  printf 'snapshot\t%s\n' "$("$etcdutl" snapshot status -w json "$out" 2>/dev/null | tr -d '\n')"
+else
+  printf 'snapshot\t%s\n' "$(ETCDCTL_API=3 "$etcdctl" snapshot status -w json "$out" 2>/dev/null | tr -d '\n')"
+fi
+`
+
+// SnapshotScript saves a snapshot of the etcd member of the node to out, a
+// path in the forensic pod. An empty endpoint is taken from the etcd flags.
+func SnapshotScript(creds Credentials, endpoint, out string) string {
+	return "cacert=" + shell.Quote(creds.CACert) + "\n" +
+		"cert=" + shell.Quote(creds.Cert) + "\n" +
+		"key=" + shell.Quote(creds.Key) + "\n" +
+		"endpoint=" + shell.Quote(endpoint) + "\n" +
+		"out=" + shell.Quote(out) + "\n" +
+		snapshotScript
+}
+
+// CopyScript writes the snapshot at out to standard output.
+func CopyScript(out string) string {
+	return "cat " + shell.Quote(out)
+}
+
+// HashScript prints the SHA-256 of the snapshot at out.
+func HashScript(out string) string {
+	return "sha256sum < " + shell.Quote(out) + " | cut -d ' ' -f 1"
+}
+
+// RemoveScript removes the snapshot at out from the forensic pod.
+func RemoveScript(out string) string {
+	return "rm -f " + shell.Quote(out)
+}
+
+// MemberStatus is the status of the member a snapshot is taken from.
+type MemberStatus struct {
+	Endpoint  string `json:"endpoint"`
+	ClusterID uint64 `json:"clusterID"`
+	MemberID  uint64 `json:"memberID"`
+	Leader    uint64 `json:"leader"`
+	Version   string `json:"version"`
+	// Revision is the revision of the key space when the status was read,
+	// right before the snapshot.
+	Revision  int64  `json:"revision"`
+	RaftTerm  uint64 `json:"raftTerm"`
+	RaftIndex uint64 `json:"raftIndex"`
+	DBSize    int64  `json:"dbSize"`
+}
+
+// SnapshotStatus describes the content of a snapshot.
+type SnapshotStatus struct {
+	Hash      uint32 `json:"hash"`
+	Revision  int64  `json:"revision"`
+	TotalKey  int    `json:"totalKey"`
+	TotalSize int64  `json:"totalSize"`
+}
+
+// endpointStatus is an entry of etcdctl endpoint status -w json.
+type endpointStatus struct {
+	Endpoint string `json:"Endpoint"`
+	Status   struct {
+		Header struct {
+			ClusterID uint64 `json:"cluster_id"`
+			MemberID  uint64 `json:"member_id"`
+			Revision  int64  `json:"revision"`
+			RaftTerm  uint64 `json:"raft_term"`
+		} `json:"header"`
+		Version   string `json:"version"`
+		DBSize    int64  `json:"dbSize"`
+		Leader    uint64 `json:"leader"`
+		RaftIndex uint64 `json:"raftIndex"`
+	} `json:"Status"`
+}
+
+// ParseSnapshot parses the output of SnapshotScript.
+func ParseSnapshot(output []byte) (MemberStatus, SnapshotStatus, error) {
+	var (
+		member   MemberStatus
+		snapshot SnapshotStatus
+	)
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		kind, data, _ := strings.Cut(sc.Text(), "\t")
+		switch kind {
+		case "status":
+			var statuses []endpointStatus
+			if err := json.Unmarshal([]byte(data), &statuses); err != nil {
+				return member, snapshot, fmt.Errorf("failed to parse the endpoint status: %w", err)
+			}
+			if len(statuses) == 0 {
+				return member, snapshot, fmt.Errorf("etcd returned no endpoint status")
+			}
+			s := statuses[0]
+			member = MemberStatus{
+				Endpoint:  s.Endpoint,
+				ClusterID: s.Status.Header.ClusterID,
+				MemberID:  s.Status.Header.MemberID,
+				Leader:    s.Status.Leader,
+				Version:   s.Status.Version,
+				Revision:  s.Status.Header.Revision,
+				RaftTerm:  s.Status.Header.RaftTerm,
+				RaftIndex: s.Status.RaftIndex,
+				DBSize:    s.Status.DBSize,
+			}
+		case "snapshot":
+			// The status of the snapshot is informative, etcdctl may not
+			// support it anymore.
+			if data == "" || json.Unmarshal([]byte(data), &snapshot) != nil {
+				snapshot = SnapshotStatus{}
+			}
+		}
+	}
+	if member.Endpoint == "" {
+		return member, snapshot, fmt.Errorf("no endpoint status in the snapshot output")
+	}
+	return member, snapshot, nil
+}
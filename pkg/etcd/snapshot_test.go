@@ -0,0 +1,35 @@
+package etcd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnapshot(t *testing.T) {
+	member, snapshot, err := ParseSnapshot([]byte(`status	[{"Endpoint":"https://127.0.0.1:2379","Status":{"header":{"cluster_id":17237436991929493444,"member_id":9372538179322589801,"revision":4821,"raft_term":3},"version":"3.5.15","dbSize":5218304,"leader":9372538179322589801,"raftIndex":5301}}]
+snapshot	{"hash":3112384210,"revision":4821,"totalKey":912,"totalSize":5218304}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, MemberStatus{
+		Endpoint:  "https://127.0.0.1:2379",
+		ClusterID: 17237436991929493444,
+		MemberID:  9372538179322589801,
+		Leader:    9372538179322589801,
+		Version:   "3.5.15",
+		Revision:  4821,
+		RaftTerm:  3,
+		RaftIndex: 5301,
+		DBSize:    5218304,
+	}, member)
+	assert.Equal(t, SnapshotStatus{Hash: 3112384210, Revision: 4821, TotalKey: 912, TotalSize: 5218304}, snapshot)
+
+	// etcdctl releases without snapshot status still give a snapshot.
+	_, snapshot, err = ParseSnapshot([]byte("status\t[{\"Endpoint\":\"https://127.0.0.1:2379\",\"Status\":{}}]\nsnapshot\tDeprecated: use etcdutl\n"))
+	require.NoError(t, err)
+	assert.Zero(t, snapshot)
+
+	_, _, err = ParseSnapshot([]byte("snapshot\t{}\n"))
+	assert.Error(t, err)
+}
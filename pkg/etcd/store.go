@@ -0,0 +1,367 @@
+package etcd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protowire"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// Prefix is the key prefix the API server stores its objects under.
+const Prefix = "/registry/"
+
+// Encodings of the stored values.
+const (
+	EncodingProtobuf  = "protobuf"
+	EncodingJSON      = "json"
+	EncodingEncrypted = "encrypted"
+	EncodingRaw       = "raw"
+)
+
+// Buckets of the etcd backend.
+var (
+	keyBucket  = []byte("key")
+	metaBucket = []byte("meta")
+)
+
+// revisionLength is the length of the revision keys of the key bucket, a
+// main and a sub revision separated by _. Tombstones are suffixed with t.
+const revisionLength = 17
+
+var (
+	protobufMagic = []byte("k8s\x00")
+	encryptedMark = []byte("k8s:enc:")
+)
+
+// resourceAliases maps the key names the API server keeps for historical
+// reasons to their resource.
+var resourceAliases = map[string]string{
+	"minions":            "nodes",
+	"services/specs":     "services",
+	"services/endpoints": "endpoints",
+	"controllers":        "replicationcontrollers",
+}
+
+var codecs = serializer.NewCodecFactory(newScheme())
+
+func newScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	_ = scheme.AddToScheme(s)
+	_ = apiextensionsv1.AddToScheme(s)
+	return s
+}
+
+// Object is the last value of a key of a snapshot.
+type Object struct {
+	Key            string `json:"key"`
+	Resource       string `json:"resource"`
+	Namespace      string `json:"namespace,omitempty"`
+	Name           string `json:"name"`
+	APIVersion     string `json:"apiVersion,omitempty"`
+	Kind           string `json:"kind,omitempty"`
+	Encoding       string `json:"encoding"`
+	CreateRevision int64  `json:"createRevision"`
+	ModRevision    int64  `json:"modRevision"`
+	Version        int64  `json:"version"`
+	Lease          int64  `json:"lease,omitempty"`
+	// DeleteRevision is set on keys deleted before the snapshot was taken
+	// whose history was not compacted yet, the object is then the value the
+	// key had when it was deleted.
+	DeleteRevision int64 `json:"deleteRevision,omitempty"`
+
+	value  []byte
+	object runtime.Object
+}
+
+// Deleted reports whether the key was deleted before the snapshot.
+func (o *Object) Deleted() bool {
+	return o.DeleteRevision != 0
+}
+
+// YAML returns the object as YAML.
+func (o *Object) YAML() ([]byte, error) {
+	if o.object == nil {
+		return nil, fmt.Errorf("%s is %s and can not be decoded", o.Key, o.Encoding)
+	}
+	return yaml.Marshal(o.object)
+}
+
+// WriteYAML writes the objects as YAML files below dir, in a directory per
+// resource and namespace, _cluster for cluster scoped ones. Objects that can
+// not be decoded or whose key is not a valid path are skipped and returned.
+func WriteYAML(dir string, objects []*Object) ([]*Object, error) {
+	var skipped []*Object
+	for _, o := range objects {
+		data, err := o.YAML()
+		if err != nil {
+			skipped = append(skipped, o)
+			continue
+		}
+		namespace := o.Namespace
+		if namespace == "" {
+			namespace = "_cluster"
+		}
+		rel := filepath.Join(filepath.FromSlash(o.Resource), namespace, o.Name+".yaml")
+		if !filepath.IsLocal(rel) {
+			// Keys are not validated by etcd, a crafted one must not escape
+			// dir.
+			skipped = append(skipped, o)
+			continue
+		}
+		name := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+			return skipped, err
+		}
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+// Snapshot is an etcd snapshot read offline.
+type Snapshot struct {
+	Path string `json:"path"`
+	// Revision is the last revision of the snapshot.
+	Revision int64 `json:"revision"`
+	// CompactRevision is the revision the history was compacted at, the
+	// keys deleted before it are gone.
+	CompactRevision int64    `json:"compactRevision"`
+	Objects         []Object `json:"objects"`
+}
+
+// Open reads an etcd snapshot, or the db file of an etcd data directory,
+// without modifying it.
+func Open(name string) (*Snapshot, error) {
+	db, err := bolt.Open(name, 0o400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open etcd snapshot %s: %w", name, err)
+	}
+	defer db.Close()
+
+	s := &Snapshot{Path: name}
+	objects := map[string]*Object{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(metaBucket); meta != nil {
+			if rev := meta.Get([]byte("finishedCompactRev")); len(rev) >= 8 {
+				s.CompactRevision = int64(binary.BigEndian.Uint64(rev))
+			}
+		}
+		keys := tx.Bucket(keyBucket)
+		if keys == nil {
+			return fmt.Errorf("%s is not an etcd snapshot, it has no key bucket", name)
+		}
+		// Revisions are stored in order, the last record of a key is its
+		// current value or its tombstone.
+		return keys.ForEach(func(rev, value []byte) error {
+			if len(rev) < revisionLength {
+				return nil
+			}
+			main := int64(binary.BigEndian.Uint64(rev))
+			if main > s.Revision {
+				s.Revision = main
+			}
+			kv, err := parseKeyValue(value)
+			if err != nil {
+				return fmt.Errorf("failed to parse revision %d: %w", main, err)
+			}
+			if len(rev) > revisionLength && rev[revisionLength] == 't' {
+				if o, ok := objects[kv.Key]; ok {
+					o.DeleteRevision = main
+				}
+				return nil
+			}
+			objects[kv.Key] = &kv
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range objects {
+		o.decode()
+		s.Objects = append(s.Objects, *o)
+	}
+	sort.Slice(s.Objects, func(i, j int) bool {
+		return s.Objects[i].Key < s.Objects[j].Key
+	})
+	return s, nil
+}
+
+// Find returns the object of a key.
+func (s *Snapshot) Find(key string) *Object {
+	i := sort.Search(len(s.Objects), func(i int) bool {
+		return s.Objects[i].Key >= key
+	})
+	if i < len(s.Objects) && s.Objects[i].Key == key {
+		return &s.Objects[i]
+	}
+	return nil
+}
+
+// parseKeyValue decodes an mvccpb.KeyValue.
+func parseKeyValue(b []byte) (Object, error) {
+	var o Object
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return o, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return o, protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch num {
+			case 1:
+				o.Key = string(v)
+			case 5:
+				o.value = append([]byte{}, v...)
+			}
+		case typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return o, protowire.ParseError(n)
+			}
+			b = b[n:]
+			switch num {
+			case 2:
+				o.CreateRevision = int64(v)
+			case 3:
+				o.ModRevision = int64(v)
+			case 4:
+				o.Version = int64(v)
+			case 6:
+				o.Lease = int64(v)
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return o, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return o, nil
+}
+
+// decode decodes the value of the object and sets its resource, namespace,
+// name and kind, guessed from the key when the value can not be decoded.
+func (o *Object) decode() {
+	var meta struct{ namespace, name string }
+	switch {
+	case bytes.HasPrefix(o.value, encryptedMark):
+		o.Encoding = EncodingEncrypted
+	case bytes.HasPrefix(o.value, protobufMagic):
+		o.Encoding = EncodingProtobuf
+		if obj, gvk, err := codecs.UniversalDeserializer().Decode(o.value, nil, nil); err == nil {
+			obj.GetObjectKind().SetGroupVersionKind(*gvk)
+			o.object = obj
+			break
+		}
+		// Types missing from the scheme still tell their kind, and their
+		// metadata is the first field of every Kubernetes type.
+		var unknown runtime.Unknown
+		if err := unknown.Unmarshal(o.value[len(protobufMagic):]); err == nil {
+			o.APIVersion, o.Kind = unknown.APIVersion, unknown.Kind
+			meta.namespace, meta.name = protobufMeta(unknown.Raw)
+		}
+	case len(o.value) > 0 && o.value[0] == '{':
+		o.Encoding = EncodingJSON
+		if obj, gvk, err := codecs.UniversalDeserializer().Decode(o.value, nil, nil); err == nil {
+			obj.GetObjectKind().SetGroupVersionKind(*gvk)
+			o.object = obj
+			break
+		}
+		var u unstructured.Unstructured
+		if err := json.Unmarshal(o.value, &u.Object); err == nil {
+			o.object = &u
+		}
+	default:
+		o.Encoding = EncodingRaw
+	}
+
+	if o.object != nil {
+		gvk := o.object.GetObjectKind().GroupVersionKind()
+		o.APIVersion, o.Kind = gvk.GroupVersion().String(), gvk.Kind
+		if m, ok := o.object.(interface {
+			GetNamespace() string
+			GetName() string
+		}); ok {
+			meta.namespace, meta.name = m.GetNamespace(), m.GetName()
+		}
+	}
+	o.Resource, o.Namespace, o.Name = parseKey(o.Key, meta.namespace, meta.name)
+}
+
+// protobufMeta reads the namespace and name of the ObjectMeta of a protobuf
+// encoded object, its first field, whose name and namespace are the first
+// and third ones.
+func protobufMeta(raw []byte) (namespace, name string) {
+	field := func(b []byte, want protowire.Number) []byte {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				return nil
+			}
+			b = b[n:]
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil
+			}
+			if num == want && typ == protowire.BytesType {
+				v, _ := protowire.ConsumeBytes(b)
+				return v
+			}
+			b = b[n:]
+		}
+		return nil
+	}
+	meta := field(raw, 1)
+	return string(field(meta, 3)), string(field(meta, 1))
+}
+
+// parseKey splits a key into its resource, namespace and name. Keys are
+// <prefix><resource>/[<namespace>/]<name>, resources of API groups other
+// than the core one may be prefixed with their group.
+func parseKey(key, namespace, name string) (string, string, string) {
+	rest, ok := strings.CutPrefix(key, Prefix)
+	if !ok {
+		return "", namespace, key
+	}
+	parts := strings.Split(rest, "/")
+	if name == "" {
+		// Guess from the key, <resource>/<namespace>/<name> being the most
+		// common form.
+		name = parts[len(parts)-1]
+		if len(parts) >= 3 {
+			namespace = parts[len(parts)-2]
+		}
+	}
+	resource := strings.TrimSuffix(rest, "/"+name)
+	if namespace != "" {
+		resource = strings.TrimSuffix(resource, "/"+namespace)
+	}
+	if alias, ok := resourceAliases[resource]; ok {
+		resource = alias
+	}
+	return resource, namespace, name
+}
@@ -0,0 +1,238 @@
+package etcd
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"google.golang.org/protobuf/encoding/protowire"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// record is a revision of the key bucket.
+type record struct {
+	rev       int64
+	key       string
+	value     []byte
+	create    int64
+	version   int64
+	tombstone bool
+}
+
+func writeSnapshot(t *testing.T, compacted int64, records ...record) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "snapshot.db")
+	db, err := bolt.Open(name, 0o600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		keys, err := tx.CreateBucket(keyBucket)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			rev := binary.BigEndian.AppendUint64(nil, uint64(r.rev))
+			rev = append(rev, '_')
+			rev = binary.BigEndian.AppendUint64(rev, 0)
+			var kv []byte
+			kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+			kv = protowire.AppendString(kv, r.key)
+			if r.tombstone {
+				rev = append(rev, 't')
+			} else {
+				kv = protowire.AppendTag(kv, 2, protowire.VarintType)
+				kv = protowire.AppendVarint(kv, uint64(r.create))
+				kv = protowire.AppendTag(kv, 3, protowire.VarintType)
+				kv = protowire.AppendVarint(kv, uint64(r.rev))
+				kv = protowire.AppendTag(kv, 4, protowire.VarintType)
+				kv = protowire.AppendVarint(kv, uint64(r.version))
+				kv = protowire.AppendTag(kv, 5, protowire.BytesType)
+				kv = protowire.AppendBytes(kv, r.value)
+			}
+			if err := keys.Put(rev, kv); err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucket(metaBucket)
+		if err != nil {
+			return err
+		}
+		return meta.Put([]byte("finishedCompactRev"), binary.BigEndian.AppendUint64(nil, uint64(compacted)))
+	}))
+	return name
+}
+
+func encodeProtobuf(t *testing.T, obj runtime.Object) []byte {
+	t.Helper()
+	info, ok := runtime.SerializerInfoForMediaType(codecs.SupportedMediaTypes(), runtime.ContentTypeProtobuf)
+	require.True(t, ok)
+	data, err := runtime.Encode(codecs.EncoderForVersion(info.Serializer, corev1.SchemeGroupVersion), obj)
+	require.NoError(t, err)
+	return data
+}
+
+// encodeUnknown encodes an object of a type missing from the scheme, only
+// made of its metadata.
+func encodeUnknown(t *testing.T, apiVersion, kind string, meta metav1.ObjectMeta) []byte {
+	t.Helper()
+	raw, err := meta.Marshal()
+	require.NoError(t, err)
+	u := runtime.Unknown{
+		TypeMeta: runtime.TypeMeta{APIVersion: apiVersion, Kind: kind},
+		Raw:      protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), raw),
+	}
+	data, err := u.Marshal()
+	require.NoError(t, err)
+	return append(append([]byte{}, protobufMagic...), data...)
+}
+
+func secret(name, value string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+		Data:       map[string][]byte{"token": []byte(value)},
+	}
+}
+
+func TestOpen(t *testing.T) {
+	name := writeSnapshot(t, 3,
+		record{rev: 2, key: "/registry/secrets/kube-system/backdoor", value: encodeProtobuf(t, secret("backdoor", "old")), create: 2, version: 1},
+		record{rev: 4, key: "/registry/namespaces/default", value: encodeProtobuf(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}), create: 4, version: 1},
+		record{rev: 5, key: "/registry/secrets/kube-system/backdoor", value: encodeProtobuf(t, secret("backdoor", "new")), create: 2, version: 2},
+		record{rev: 6, key: "/registry/example.com/widgets/prod/w1", value: []byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w1","namespace":"prod"},"spec":{"size":3}}`), create: 6, version: 1},
+		record{rev: 7, key: "/registry/example.com/gadgets/g1", value: encodeUnknown(t, "example.com/v1", "Gadget", metav1.ObjectMeta{Name: "g1"}), create: 7, version: 1},
+		record{rev: 8, key: "/registry/minions/node-1", value: []byte("k8s:enc:aescbc:v1:key1:\x00\x01"), create: 8, version: 1},
+		record{rev: 9, key: "/registry/secrets/kube-system/backdoor", tombstone: true},
+	)
+
+	s, err := Open(name)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), s.Revision)
+	assert.Equal(t, int64(3), s.CompactRevision)
+
+	var keys []string
+	for _, o := range s.Objects {
+		keys = append(keys, o.Key)
+	}
+	assert.Equal(t, []string{
+		"/registry/example.com/gadgets/g1",
+		"/registry/example.com/widgets/prod/w1",
+		"/registry/minions/node-1",
+		"/registry/namespaces/default",
+		"/registry/secrets/kube-system/backdoor",
+	}, keys)
+
+	backdoor := s.Find("/registry/secrets/kube-system/backdoor")
+	require.NotNil(t, backdoor)
+	assert.Equal(t, "secrets", backdoor.Resource)
+	assert.Equal(t, "kube-system", backdoor.Namespace)
+	assert.Equal(t, "backdoor", backdoor.Name)
+	assert.Equal(t, "v1", backdoor.APIVersion)
+	assert.Equal(t, "Secret", backdoor.Kind)
+	assert.Equal(t, EncodingProtobuf, backdoor.Encoding)
+	assert.Equal(t, int64(2), backdoor.CreateRevision)
+	assert.Equal(t, int64(5), backdoor.ModRevision)
+	assert.Equal(t, int64(2), backdoor.Version)
+	assert.Equal(t, int64(9), backdoor.DeleteRevision)
+	assert.True(t, backdoor.Deleted())
+	data, err := backdoor.YAML()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "kind: Secret\n")
+	assert.Contains(t, string(data), "token: bmV3\n")
+
+	namespace := s.Find("/registry/namespaces/default")
+	assert.Equal(t, "namespaces", namespace.Resource)
+	assert.Empty(t, namespace.Namespace)
+	assert.Equal(t, "default", namespace.Name)
+
+	widget := s.Find("/registry/example.com/widgets/prod/w1")
+	assert.Equal(t, "example.com/widgets", widget.Resource)
+	assert.Equal(t, "prod", widget.Namespace)
+	assert.Equal(t, EncodingJSON, widget.Encoding)
+	assert.Equal(t, "Widget", widget.Kind)
+	data, err = widget.YAML()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "size: 3\n")
+
+	gadget := s.Find("/registry/example.com/gadgets/g1")
+	assert.Equal(t, "example.com/gadgets", gadget.Resource)
+	assert.Equal(t, "g1", gadget.Name)
+	assert.Equal(t, "example.com/v1", gadget.APIVersion)
+	assert.Equal(t, "Gadget", gadget.Kind)
+	_, err = gadget.YAML()
+	assert.Error(t, err)
+
+	node := s.Find("/registry/minions/node-1")
+	assert.Equal(t, "nodes", node.Resource)
+	assert.Equal(t, "node-1", node.Name)
+	assert.Equal(t, EncodingEncrypted, node.Encoding)
+
+	assert.Len(t, s.Select(Filter{}), 4)
+	assert.Len(t, s.Select(Filter{Deleted: true}), 5)
+	assert.Len(t, s.Select(Filter{Resources: []string{"secrets"}, Deleted: true}), 1)
+	assert.Len(t, s.Select(Filter{Namespace: "prod"}), 1)
+
+	dir := t.TempDir()
+	skipped, err := WriteYAML(dir, s.Select(Filter{Deleted: true}))
+	require.NoError(t, err)
+	assert.Len(t, skipped, 2)
+	assert.FileExists(t, filepath.Join(dir, "secrets", "kube-system", "backdoor.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "namespaces", "_cluster", "default.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "example.com", "widgets", "prod", "w1.yaml"))
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.db"))
+	assert.Error(t, err)
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = Open(empty)
+	assert.Error(t, err)
+}
+
+func TestDiff(t *testing.T) {
+	pod := func(name string) []byte {
+		return encodeProtobuf(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+	}
+	older, err := Open(writeSnapshot(t, 0,
+		record{rev: 2, key: "/registry/pods/default/miner", value: pod("miner"), create: 2, version: 1},
+		record{rev: 3, key: "/registry/pods/default/web", value: pod("web"), create: 3, version: 1},
+		record{rev: 4, key: "/registry/secrets/kube-system/backdoor", value: encodeProtobuf(t, secret("backdoor", "x")), create: 4, version: 1},
+	))
+	require.NoError(t, err)
+	newer, err := Open(writeSnapshot(t, 0,
+		record{rev: 3, key: "/registry/pods/default/web", value: pod("web"), create: 3, version: 1},
+		record{rev: 4, key: "/registry/secrets/kube-system/backdoor", value: encodeProtobuf(t, secret("backdoor", "x")), create: 4, version: 1},
+		record{rev: 5, key: "/registry/pods/default/api", value: pod("api"), create: 5, version: 1},
+		record{rev: 6, key: "/registry/pods/default/web", value: pod("web"), create: 3, version: 2},
+		record{rev: 7, key: "/registry/secrets/kube-system/backdoor", tombstone: true},
+	))
+	require.NoError(t, err)
+
+	changes := Diff(older, newer, Filter{})
+	var summary []string
+	for _, c := range changes {
+		summary = append(summary, c.Type+" "+c.Key)
+	}
+	assert.Equal(t, []string{
+		"added /registry/pods/default/api",
+		"deleted /registry/pods/default/miner",
+		"modified /registry/pods/default/web",
+		"deleted /registry/secrets/kube-system/backdoor",
+	}, summary)
+
+	assert.Equal(t, int64(2), changes[1].OldRevision)
+	assert.NotNil(t, changes[1].Old)
+	assert.Nil(t, changes[1].New)
+	assert.Equal(t, int64(3), changes[2].OldRevision)
+	assert.Equal(t, int64(6), changes[2].NewRevision)
+	assert.Equal(t, int64(7), changes[3].DeleteRevision)
+	assert.Equal(t, "Secret", changes[3].Kind)
+
+	assert.Len(t, Diff(older, newer, Filter{Resources: []string{"secrets"}}), 1)
+	assert.Len(t, Diff(older, newer, Filter{Namespace: "kube-system"}), 1)
+}
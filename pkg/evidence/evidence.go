@@ -0,0 +1,141 @@
+// Package evidence stores artifacts acquired from the cluster on the local disk
+// and keeps a manifest with their origin and hashes, so that every copy can be
+// verified later on.
+package evidence
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ManifestFile is the name of the manifest inside an evidence directory.
+const ManifestFile = "manifest.json"
+
+// Item describes a single acquired artifact.
+type Item struct {
+	Name        string            `json:"name"`
+	Path        string            `json:"path"`
+	Node        string            `json:"node,omitempty"`
+	Source      string            `json:"source"`
+	Description string            `json:"description,omitempty"`
+	Size        int64             `json:"size"`
+	SHA256      string            `json:"sha256"`
+	MD5         string            `json:"md5"`
+	Verified    bool              `json:"verified"`
+	CollectedAt time.Time         `json:"collectedAt"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// Manifest is the list of artifacts stored in an evidence directory.
+type Manifest struct {
+	Dir   string `json:"-"`
+	Items []Item `json:"items"`
+
+	mu sync.Mutex
+}
+
+// Open loads the manifest of dir, creating the directory if needed.
+func Open(dir string) (*Manifest, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create evidence directory %s: %w", dir, err)
+	}
+
+	m := &Manifest{Dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read evidence manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse evidence manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+// Record appends item to the manifest and writes the manifest to disk.
+func (m *Manifest) Record(item Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Items = append(m.Items, item)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal evidence manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(m.Dir, ManifestFile), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write evidence manifest: %w", err)
+	}
+
+	return nil
+}
+
+// Writer writes an artifact into the evidence directory and hashes it on the fly.
+type Writer struct {
+	item   Item
+	file   *os.File
+	sha256 hash.Hash
+	md5    hash.Hash
+	w      io.Writer
+}
+
+// Create creates the artifact name inside the evidence directory.
+func (m *Manifest) Create(name, node, source string) (*Writer, error) {
+	path := filepath.Join(m.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create evidence file: %w", err)
+	}
+
+	w := &Writer{
+		item: Item{
+			Name:        name,
+			Path:        path,
+			Node:        node,
+			Source:      source,
+			CollectedAt: time.Now().UTC(),
+		},
+		file:   file,
+		sha256: sha256.New(),
+		md5:    md5.New(),
+	}
+	w.w = io.MultiWriter(file, w.sha256, w.md5)
+
+	return w, nil
+}
+
+// Write writes p to the artifact and the hashes.
+func (w *Writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.item.Size += int64(n)
+	return n, err
+}
+
+// Close closes the artifact file and returns the finished manifest item.
+func (w *Writer) Close() (Item, error) {
+	w.item.SHA256 = hex.EncodeToString(w.sha256.Sum(nil))
+	w.item.MD5 = hex.EncodeToString(w.md5.Sum(nil))
+
+	if err := w.file.Sync(); err != nil {
+		w.file.Close()
+		return w.item, fmt.Errorf("failed to sync evidence file: %w", err)
+	}
+
+	return w.item, w.file.Close()
+}
@@ -0,0 +1,41 @@
+package evidence
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAndRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := Open(dir)
+	assert.NoError(t, err)
+
+	w, err := m.Create("node-1/exe-42.bin", "node-1", "/proc/42/exe")
+	assert.NoError(t, err)
+
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(t, err)
+
+	item, err := w.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), item.Size)
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", item.SHA256)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", item.MD5)
+
+	assert.NoError(t, m.Record(item))
+
+	data, err := os.ReadFile(item.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	reopened, err := Open(dir)
+	assert.NoError(t, err)
+	assert.Len(t, reopened.Items, 1)
+	assert.Equal(t, item.SHA256, reopened.Items[0].SHA256)
+
+	_, err = reopened.Create("node-1/exe-42.bin", "node-1", "/proc/42/exe")
+	assert.Error(t, err)
+}
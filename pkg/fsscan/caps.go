@@ -0,0 +1,93 @@
+package fsscan
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// capabilityNames are the Linux capabilities indexed by their bit number.
+var capabilityNames = []string{
+	"cap_chown", "cap_dac_override", "cap_dac_read_search", "cap_fowner",
+	"cap_fsetid", "cap_kill", "cap_setgid", "cap_setuid", "cap_setpcap",
+	"cap_linux_immutable", "cap_net_bind_service", "cap_net_broadcast",
+	"cap_net_admin", "cap_net_raw", "cap_ipc_lock", "cap_ipc_owner",
+	"cap_sys_module", "cap_sys_rawio", "cap_sys_chroot", "cap_sys_ptrace",
+	"cap_sys_pacct", "cap_sys_admin", "cap_sys_boot", "cap_sys_nice",
+	"cap_sys_resource", "cap_sys_time", "cap_sys_tty_config", "cap_mknod",
+	"cap_lease", "cap_audit_write", "cap_audit_control", "cap_setfcap",
+	"cap_mac_override", "cap_mac_admin", "cap_syslog", "cap_wake_alarm",
+	"cap_block_suspend", "cap_audit_read", "cap_perfmon", "cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+const (
+	vfsCapRevisionMask   = 0xff000000
+	vfsCapFlagsEffective = 0x000001
+	vfsCapRevision1      = 0x01000000
+	vfsCapRevision2      = 0x02000000
+	vfsCapRevision3      = 0x03000000
+)
+
+// DecodeCapabilities decodes the hex encoded value of a security.capability
+// extended attribute, as printed by getfattr -e hex, into the notation used by
+// getcap, e.g. "cap_net_admin,cap_net_raw=ep".
+func DecodeCapabilities(value string) (string, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+	if err != nil {
+		return "", fmt.Errorf("invalid capability value %q: %w", value, err)
+	}
+	if len(raw) < 4 {
+		return "", fmt.Errorf("capability value %q is too short", value)
+	}
+
+	magic := binary.LittleEndian.Uint32(raw)
+	words := 2
+	switch magic & vfsCapRevisionMask {
+	case vfsCapRevision1:
+		words = 1
+	case vfsCapRevision2, vfsCapRevision3:
+	default:
+		return "", fmt.Errorf("unknown capability revision %#x", magic&vfsCapRevisionMask)
+	}
+	if len(raw) < 4+8*words {
+		return "", fmt.Errorf("capability value %q is too short", value)
+	}
+
+	var permitted, inheritable uint64
+	for i := 0; i < words; i++ {
+		permitted |= uint64(binary.LittleEndian.Uint32(raw[4+8*i:])) << (32 * i)
+		inheritable |= uint64(binary.LittleEndian.Uint32(raw[8+8*i:])) << (32 * i)
+	}
+
+	var caps []string
+	for bit := 0; bit < 64; bit++ {
+		if (permitted|inheritable)&(1<<bit) == 0 {
+			continue
+		}
+		if bit < len(capabilityNames) {
+			caps = append(caps, capabilityNames[bit])
+		} else {
+			caps = append(caps, fmt.Sprintf("cap_%d", bit))
+		}
+	}
+
+	flags := ""
+	if magic&vfsCapFlagsEffective != 0 {
+		flags += "e"
+	}
+	if inheritable != 0 {
+		flags += "i"
+	}
+	if permitted != 0 {
+		flags += "p"
+	}
+
+	decoded := strings.Join(caps, ",") + "=" + flags
+	if magic&vfsCapRevisionMask == vfsCapRevision3 && len(raw) >= 24 {
+		decoded += fmt.Sprintf(" [rootid=%d]", binary.LittleEndian.Uint32(raw[20:]))
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,359 @@
+// Package fsscan walks the host filesystem of a node through the forensic pod
+// looking for privilege escalation paths: SUID and SGID binaries, files with
+// capabilities, world writable locations and files without a known owner.
+package fsscan
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// DefaultExcludes are skipped by default: pseudo filesystems and the storage
+// of container runtimes and pod volumes, which hold files of other images.
+var DefaultExcludes = []string{
+	"/proc", "/sys", "/dev", "/run",
+	"/var/lib/containerd", "/var/lib/docker", "/var/lib/containers",
+	"/var/lib/kubelet/pods", "/var/log/pods",
+}
+
+// tmpDirs are expected to be world writable.
+var tmpDirs = []string{"/tmp", "/var/tmp", "/dev/shm"}
+
+// Finding kinds of the filesystem scan.
+const (
+	KindSUID          = "suid"
+	KindSGID          = "sgid"
+	KindCapabilities  = "capabilities"
+	KindWorldWritable = "world-writable"
+	KindNoUser        = "unowned-user"
+	KindNoGroup       = "unowned-group"
+)
+
+// Package ownership states of a finding.
+const (
+	PackageOwned    = "owned"
+	PackageModified = "modified"
+	PackageUnowned  = "unowned"
+	PackageUnknown  = "unknown"
+)
+
+// Entry is a file found by the scan.
+type Entry struct {
+	Path          string   `json:"path"`
+	Kinds         []string `json:"kinds"`
+	Mode          string   `json:"mode"`
+	UID           int      `json:"uid"`
+	GID           int      `json:"gid"`
+	Size          int64    `json:"size"`
+	Capabilities  string   `json:"capabilities,omitempty"`
+	SHA256        string   `json:"sha256,omitempty"`
+	Package       string   `json:"package,omitempty"`
+	PackageStatus string   `json:"packageStatus,omitempty"`
+	Suspicious    bool     `json:"suspicious"`
+
+	mode os.FileMode
+}
+
+// FieldCapabilities is the entry field left unavailable when the forensic pod
+// can not read file capabilities.
+const FieldCapabilities = "capabilities"
+
+// Result is the outcome of a filesystem scan.
+type Result struct {
+	PackageManager string   `json:"packageManager"`
+	Warnings       []string `json:"warnings,omitempty"`
+	// Unavailable lists the entry fields the scan could not collect.
+	Unavailable []string `json:"unavailable,omitempty"`
+	Entries     []Entry  `json:"entries"`
+}
+
+// pruneExpr returns the find expression matching the excluded paths.
+func pruneExpr(excludes []string) string {
+	if len(excludes) == 0 {
+		// A name never contains a slash, so this never matches.
+		return "-name /"
+	}
+	var parts []string
+	for _, e := range excludes {
+		parts = append(parts, "-path "+shell.Quote(tasks.HostRoot+path.Clean("/"+e)))
+	}
+	return strings.Join(parts, " -o ")
+}
+
+func hostPaths(roots []string) string {
+	var paths []string
+	for _, r := range roots {
+		paths = append(paths, tasks.HostRoot+path.Clean("/"+r))
+	}
+	return shell.Join(paths)
+}
+
+// ScanScript walks roots, skipping excludes, and prints the metadata of every
+// SUID, SGID, world writable or unowned file. Files carrying capabilities are
+// listed with getfattr, shipped in the image of build/forensic-pod. Without
+// it the capabilities are reported unavailable rather than empty.
+func ScanScript(roots, excludes []string) string {
+	return `
+H=` + tasks.HostRoot + `
+awk -F: '{ printf "uid\t%s\n", $3 }' "$H/etc/passwd" 2>/dev/null
+awk -F: '{ printf "gid\t%s\n", $3 }' "$H/etc/group" 2>/dev/null
+uids=$(awk -F: '{ printf " ! -user %s", $3 }' "$H/etc/passwd" 2>/dev/null)
+gids=$(awk -F: '{ printf " ! -group %s", $3 }' "$H/etc/group" 2>/dev/null)
+[ -n "$uids" ] || uids="-name /"
+[ -n "$gids" ] || gids="-name /"
+find ` + hostPaths(roots) + ` \( ` + pruneExpr(excludes) + ` \) -prune -o \
+  \( -perm -4000 -o -perm -2000 -o \( -perm -0002 ! -type l \) -o \( $uids \) -o \( $gids \) \) \
+  -exec stat -c 'file %u %g %f %s %n' {} + 2>/dev/null
+if command -v getfattr >/dev/null 2>&1; then
+  find ` + hostPaths(roots) + ` \( ` + pruneExpr(excludes) + ` \) -prune -o -type f -print0 2>/dev/null |
+    xargs -0 -r getfattr -n security.capability -e hex --absolute-names 2>/dev/null |
+    awk '/^# file: / { f = substr($0, 9) } /^security.capability=/ { printf "%s\t%s\n", f, substr($0, 21) }' |
+    while IFS="$(printf '\t')" read -r f v; do
+      printf 'cap\t%s\t%s\n' "$f" "$v"
+      stat -c 'file %u %g %f %s %n' "$f" 2>/dev/null
+    done
+else
+  printf 'unavailable\t` + FieldCapabilities + `\tgetfattr is not available in the forensic pod image, file capabilities were not scanned\n'
+fi
+`
+}
+
+// ParseScan parses the output of ScanScript.
+func ParseScan(output []byte) Result {
+	entries := map[string]*Entry{}
+	users := map[int]bool{}
+	groups := map[int]bool{}
+	var result Result
+
+	get := func(p string) *Entry {
+		if entries[p] == nil {
+			entries[p] = &Entry{Path: p}
+		}
+		return entries[p]
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "file "):
+			fields := strings.SplitN(line, " ", 6)
+			if len(fields) < 6 {
+				continue
+			}
+			e := get(strings.TrimPrefix(fields[5], tasks.HostRoot))
+			e.UID, _ = strconv.Atoi(fields[1])
+			e.GID, _ = strconv.Atoi(fields[2])
+			raw, _ := strconv.ParseUint(fields[3], 16, 32)
+			e.mode = UnixMode(uint32(raw))
+			e.Mode = e.mode.String()
+			e.Size, _ = strconv.ParseInt(fields[4], 10, 64)
+		case strings.HasPrefix(line, "cap\t"):
+			fields := strings.SplitN(line, "\t", 3)
+			if len(fields) < 3 {
+				continue
+			}
+			e := get(strings.TrimPrefix(fields[1], tasks.HostRoot))
+			caps, err := DecodeCapabilities(fields[2])
+			if err != nil {
+				caps = fields[2]
+			}
+			e.Capabilities = caps
+		case strings.HasPrefix(line, "uid\t"):
+			uid, err := strconv.Atoi(strings.TrimPrefix(line, "uid\t"))
+			if err == nil {
+				users[uid] = true
+			}
+		case strings.HasPrefix(line, "gid\t"):
+			gid, err := strconv.Atoi(strings.TrimPrefix(line, "gid\t"))
+			if err == nil {
+				groups[gid] = true
+			}
+		case strings.HasPrefix(line, "warn\t"):
+			result.Warnings = append(result.Warnings, strings.TrimPrefix(line, "warn\t"))
+		case strings.HasPrefix(line, "unavailable\t"):
+			field, reason, _ := strings.Cut(strings.TrimPrefix(line, "unavailable\t"), "\t")
+			result.Unavailable = append(result.Unavailable, field)
+			result.Warnings = append(result.Warnings, reason)
+		}
+	}
+
+	for _, e := range entries {
+		classify(e, users, groups)
+		if len(e.Kinds) > 0 {
+			result.Entries = append(result.Entries, *e)
+		}
+	}
+
+	sort.Slice(result.Entries, func(i, j int) bool {
+		return result.Entries[i].Path < result.Entries[j].Path
+	})
+
+	return result
+}
+
+// classify sets the kinds of e from its mode and owner. World writable entries
+// below the temporary directories, and sticky directories, are expected and
+// not reported. Ownership is only judged when the host user database was read.
+func classify(e *Entry, users, groups map[int]bool) {
+	e.Kinds = nil
+	if e.mode&os.ModeSetuid != 0 {
+		e.Kinds = append(e.Kinds, KindSUID)
+	}
+	if e.mode&os.ModeSetgid != 0 && !e.mode.IsDir() {
+		e.Kinds = append(e.Kinds, KindSGID)
+	}
+	if e.Capabilities != "" {
+		e.Kinds = append(e.Kinds, KindCapabilities)
+	}
+	if e.mode&0o002 != 0 && e.mode&os.ModeSymlink == 0 && !inTmp(e.Path) &&
+		!(e.mode.IsDir() && e.mode&os.ModeSticky != 0) && e.mode&(os.ModeSocket|os.ModeNamedPipe|os.ModeCharDevice|os.ModeDevice) == 0 {
+		e.Kinds = append(e.Kinds, KindWorldWritable)
+	}
+	if len(users) > 0 && e.Mode != "" && !users[e.UID] {
+		e.Kinds = append(e.Kinds, KindNoUser)
+	}
+	if len(groups) > 0 && e.Mode != "" && !groups[e.GID] {
+		e.Kinds = append(e.Kinds, KindNoGroup)
+	}
+}
+
+func inTmp(p string) bool {
+	for _, dir := range tmpDirs {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// UnixMode converts a raw st_mode, as printed by stat %f, to an os.FileMode.
+func UnixMode(raw uint32) os.FileMode {
+	mode := os.FileMode(raw & 0o777)
+	switch raw & 0o170000 {
+	case 0o040000:
+		mode |= os.ModeDir
+	case 0o120000:
+		mode |= os.ModeSymlink
+	case 0o020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0o060000:
+		mode |= os.ModeDevice
+	case 0o010000:
+		mode |= os.ModeNamedPipe
+	case 0o140000:
+		mode |= os.ModeSocket
+	}
+	if raw&0o4000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if raw&0o2000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if raw&0o1000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// PackageScript prints the SHA-256 and the package ownership of every path.
+// The package database of the host is queried with dpkg lists, rpm run in a
+// chroot of the host, or the apk database, whichever the host uses.
+func PackageScript(paths []string) string {
+	var b strings.Builder
+	b.WriteString(`
+H=` + tasks.HostRoot + `
+pm=none
+[ -d "$H/var/lib/dpkg/info" ] && pm=dpkg
+[ -x "$H/usr/bin/rpm" ] && pm=rpm
+[ -f "$H/lib/apk/db/installed" ] && pm=apk
+printf 'pm\t%s\n' "$pm"
+check() {
+  f=$1
+  h=
+  [ -f "$H$f" ] && h=$(sha256sum "$H$f" 2>/dev/null | cut -d ' ' -f 1)
+  pkg=
+  status=unknown
+  case $pm in
+    dpkg)
+      l=$(grep -lFx -e "$f" -e "${f#/usr}" -e "/usr$f" "$H"/var/lib/dpkg/info/*.list 2>/dev/null | head -n 1)
+      pkg=${l##*/}
+      pkg=${pkg%.list}
+      status=unowned
+      if [ -n "$pkg" ]; then
+        status=owned
+        sums="$H/var/lib/dpkg/info/$pkg.md5sums"
+        if [ -f "$sums" ] && [ -f "$H$f" ]; then
+          m=$(md5sum "$H$f" | cut -d ' ' -f 1)
+          grep -q "^$m " "$sums" || status=modified
+        fi
+      fi
+      ;;
+    rpm)
+      if pkg=$(chroot "$H" rpm -qf --queryformat '%{NAME}' "$f" 2>/dev/null); then
+        status=owned
+        chroot "$H" rpm -Vf "$f" 2>/dev/null | grep -q " $f\$" && status=modified
+      else
+        pkg=
+        status=unowned
+      fi
+      ;;
+    apk)
+      pkg=$(awk -v f="${f#/}" '/^P:/ { p = substr($0, 3) } /^F:/ { d = substr($0, 3) } /^R:/ { if (d "/" substr($0, 3) == f) { print p; exit } }' "$H/lib/apk/db/installed")
+      status=unowned
+      [ -n "$pkg" ] && status=owned
+      ;;
+  esac
+  printf 'pkg\t%s\t%s\t%s\t%s\n' "$f" "$h" "$status" "$pkg"
+}
+`)
+	for _, p := range paths {
+		fmt.Fprintf(&b, "check %s\n", shell.Quote(p))
+	}
+	return b.String()
+}
+
+// ApplyPackages merges the output of PackageScript into the result and marks
+// the entries that grant privileges without coming from a pristine package.
+func (r *Result) ApplyPackages(output []byte) {
+	type pkgInfo struct {
+		hash, status, pkg string
+	}
+	infos := map[string]pkgInfo{}
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		switch {
+		case len(fields) >= 2 && fields[0] == "pm":
+			r.PackageManager = fields[1]
+		case len(fields) >= 5 && fields[0] == "pkg":
+			infos[fields[1]] = pkgInfo{hash: fields[2], status: fields[3], pkg: fields[4]}
+		}
+	}
+
+	for i := range r.Entries {
+		e := &r.Entries[i]
+		if info, ok := infos[e.Path]; ok {
+			e.SHA256 = info.hash
+			e.PackageStatus = info.status
+			e.Package = info.pkg
+		}
+		privileged := slices.Contains(e.Kinds, KindSUID) || slices.Contains(e.Kinds, KindSGID) ||
+			slices.Contains(e.Kinds, KindCapabilities)
+		switch e.PackageStatus {
+		case PackageModified:
+			e.Suspicious = true
+		case PackageUnowned:
+			e.Suspicious = privileged
+		}
+	}
+
+	sort.SliceStable(r.Entries, func(i, j int) bool {
+		return r.Entries[i].Suspicious && !r.Entries[j].Suspicious
+	})
+}
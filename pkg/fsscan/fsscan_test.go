@@ -0,0 +1,60 @@
+package fsscan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCapabilities(t *testing.T) {
+	// getcap: /usr/bin/ping cap_net_raw=ep
+	caps, err := DecodeCapabilities("0x0100000200200000000000000000000000000000")
+	assert.NoError(t, err)
+	assert.Equal(t, "cap_net_raw=ep", caps)
+
+	_, err = DecodeCapabilities("0x00")
+	assert.Error(t, err)
+}
+
+func TestParseScan(t *testing.T) {
+	output := []byte(`uid	0
+uid	1000
+gid	0
+file 0 0 89ed 68248 /proc/1/root/usr/bin/passwd
+file 0 0 89ed 16000 /proc/1/root/usr/local/bin/.helper
+file 0 0 41ff 4096 /proc/1/root/etc/cron.d
+file 0 0 43ff 4096 /proc/1/root/var/spool/drop
+file 0 0 81b6 10 /proc/1/root/tmp/scratch
+file 4242 0 81a4 10 /proc/1/root/opt/leftover
+cap	/proc/1/root/usr/bin/ping	0x0100000200200000000000000000000000000000
+file 0 0 81ed 72776 /proc/1/root/usr/bin/ping
+`)
+
+	result := ParseScan(output)
+	paths := map[string][]string{}
+	for _, e := range result.Entries {
+		paths[e.Path] = e.Kinds
+	}
+
+	assert.Equal(t, map[string][]string{
+		"/usr/bin/passwd":        {KindSUID},
+		"/usr/local/bin/.helper": {KindSUID},
+		"/etc/cron.d":            {KindWorldWritable},
+		"/opt/leftover":          {KindNoUser},
+		"/usr/bin/ping":          {KindCapabilities},
+	}, paths)
+
+	result.ApplyPackages([]byte(`pm	dpkg
+pkg	/usr/bin/passwd	aa	owned	passwd
+pkg	/usr/local/bin/.helper	bb	unowned	
+pkg	/usr/bin/ping	cc	modified	iputils-ping
+`))
+	assert.Equal(t, "dpkg", result.PackageManager)
+	assert.True(t, result.Entries[0].Suspicious)
+	assert.True(t, result.Entries[1].Suspicious)
+	assert.False(t, result.Entries[2].Suspicious)
+
+	result = ParseScan([]byte("unavailable\tcapabilities\tgetfattr is not available\n"))
+	assert.Equal(t, []string{FieldCapabilities}, result.Unavailable)
+	assert.Equal(t, []string{"getfattr is not available"}, result.Warnings)
+}
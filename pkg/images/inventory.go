@@ -0,0 +1,274 @@
+// Package images inventories the images of the running containers and
+// detects tags resolving to different digests across the cluster.
+package images
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Flags of a container.
+const (
+	// FlagUnpinned is set on images referenced by tag only.
+	FlagUnpinned = "unpinned"
+	// FlagLatest is set on images using the latest tag, explicitly or not.
+	FlagLatest = "latest"
+	// FlagNoRepoDigest is set when the runtime reports the local image ID
+	// instead of a registry digest, e.g. for images loaded on the node.
+	FlagNoRepoDigest = "no-repo-digest"
+	// FlagDrift is set when the same image and tag run with different
+	// digests in the cluster.
+	FlagDrift = "drift"
+	// FlagDigestMismatch is set when a container pinned to a digest runs
+	// another one.
+	FlagDigestMismatch = "digest-mismatch"
+)
+
+// Reference is a parsed image reference.
+type Reference struct {
+	// Repository is the normalized repository, e.g. docker.io/library/nginx.
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// Name returns the repository with its tag, the key tags drift on.
+func (r Reference) Name() string {
+	tag := r.Tag
+	if tag == "" {
+		tag = "latest"
+	}
+	return r.Repository + ":" + tag
+}
+
+// ParseReference parses and normalizes an image reference the way container
+// runtimes do: images without a registry come from docker.io, official
+// images from docker.io/library.
+func ParseReference(image string) Reference {
+	var r Reference
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		r.Digest = name[i+1:]
+		name = name[:i]
+	}
+	// A colon after the last slash separates the tag, one before it belongs
+	// to the registry port.
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		r.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	first, rest, hasSlash := strings.Cut(name, "/")
+	switch {
+	case !hasSlash:
+		name = "docker.io/library/" + name
+	case !strings.ContainsAny(first, ".:") && first != "localhost":
+		name = "docker.io/" + name
+	case first == "index.docker.io":
+		name = "docker.io/" + rest
+		if !strings.Contains(rest, "/") {
+			name = "docker.io/library/" + rest
+		}
+	}
+	r.Repository = name
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r
+}
+
+// Container is a container with the image it runs.
+type Container struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Node      string `json:"node,omitempty"`
+	// Image is the image of the spec, ImageID the one the runtime resolved.
+	Image     string    `json:"image"`
+	ImageID   string    `json:"imageID"`
+	Reference Reference `json:"reference"`
+	// Digest is the digest the container runs, taken from ImageID.
+	Digest string   `json:"digest"`
+	Flags  []string `json:"flags,omitempty"`
+}
+
+// DigestUse is a digest a tag resolves to and where.
+type DigestUse struct {
+	Digest     string   `json:"digest"`
+	Nodes      []string `json:"nodes"`
+	Containers int      `json:"containers"`
+}
+
+// Drift is a tag resolving to several digests.
+type Drift struct {
+	Image   string      `json:"image"`
+	Digests []DigestUse `json:"digests"`
+}
+
+// Report is the image inventory of the cluster.
+type Report struct {
+	Containers []Container `json:"containers"`
+	Drifts     []Drift     `json:"drifts,omitempty"`
+}
+
+// Inventory lists the images of the containers of the running pods and
+// flags drifting tags.
+func Inventory(pods []corev1.Pod) Report {
+	var containers []Container
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		images := map[string]string{}
+		for _, c := range pod.Spec.InitContainers {
+			images[c.Name] = c.Image
+		}
+		for _, c := range pod.Spec.Containers {
+			images[c.Name] = c.Image
+		}
+		for _, c := range pod.Spec.EphemeralContainers {
+			images[c.Name] = c.Image
+		}
+
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		statuses = append(statuses, pod.Status.EphemeralContainerStatuses...)
+		for _, s := range statuses {
+			if s.ImageID == "" {
+				continue
+			}
+			image := images[s.Name]
+			if image == "" {
+				image = s.Image
+			}
+			containers = append(containers, newContainer(pod, s.Name, image, s.ImageID))
+		}
+	}
+
+	drifts := detectDrift(containers)
+	sort.Slice(containers, func(i, j int) bool {
+		a, b := containers[i], containers[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Pod != b.Pod {
+			return a.Pod < b.Pod
+		}
+		return a.Container < b.Container
+	})
+	return Report{Containers: containers, Drifts: drifts}
+}
+
+func newContainer(pod corev1.Pod, name, image, imageID string) Container {
+	c := Container{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: name,
+		Node:      pod.Spec.NodeName,
+		Image:     image,
+		ImageID:   imageID,
+		Reference: ParseReference(image),
+	}
+
+	// Image IDs come as docker-pullable://repo@sha256:..., repo@sha256:...
+	// or a bare sha256:... image ID.
+	id := imageID
+	if i := strings.Index(id, "://"); i >= 0 {
+		id = id[i+3:]
+	}
+	if i := strings.LastIndex(id, "@"); i >= 0 {
+		c.Digest = id[i+1:]
+	} else {
+		c.Digest = id
+		c.Flags = append(c.Flags, FlagNoRepoDigest)
+	}
+
+	switch {
+	case c.Reference.Digest == "":
+		c.Flags = append(c.Flags, FlagUnpinned)
+		if c.Reference.Tag == "latest" {
+			c.Flags = append(c.Flags, FlagLatest)
+		}
+	case c.Reference.Digest != c.Digest && !slices.Contains(c.Flags, FlagNoRepoDigest):
+		c.Flags = append(c.Flags, FlagDigestMismatch)
+	}
+	return c
+}
+
+// detectDrift flags the unpinned containers whose tag resolves to several
+// digests. Pinned containers can not drift, they are checked against their
+// own digest.
+func detectDrift(containers []Container) []Drift {
+	uses := map[string]map[string]*DigestUse{}
+	for _, c := range containers {
+		if c.Reference.Digest != "" {
+			continue
+		}
+		name := c.Reference.Name()
+		if uses[name] == nil {
+			uses[name] = map[string]*DigestUse{}
+		}
+		u, ok := uses[name][c.Digest]
+		if !ok {
+			u = &DigestUse{Digest: c.Digest}
+			uses[name][c.Digest] = u
+		}
+		u.Containers++
+		if c.Node != "" && !slices.Contains(u.Nodes, c.Node) {
+			u.Nodes = append(u.Nodes, c.Node)
+		}
+	}
+
+	var drifts []Drift
+	for name, digests := range uses {
+		if len(digests) < 2 {
+			continue
+		}
+		d := Drift{Image: name}
+		for _, u := range digests {
+			sort.Strings(u.Nodes)
+			d.Digests = append(d.Digests, *u)
+		}
+		sort.Slice(d.Digests, func(i, j int) bool {
+			return d.Digests[i].Digest < d.Digests[j].Digest
+		})
+		drifts = append(drifts, d)
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Image < drifts[j].Image
+	})
+
+	drifting := map[string]bool{}
+	for _, d := range drifts {
+		drifting[d.Image] = true
+	}
+	for i := range containers {
+		if containers[i].Reference.Digest == "" && drifting[containers[i].Reference.Name()] {
+			containers[i].Flags = append(containers[i].Flags, FlagDrift)
+		}
+	}
+	return drifts
+}
+
+// String describes where each digest of the drifting tag runs.
+func (d Drift) String() string {
+	var parts []string
+	for _, u := range d.Digests {
+		parts = append(parts, fmt.Sprintf("%s on %s", ShortDigest(u.Digest), strings.Join(u.Nodes, ",")))
+	}
+	return d.Image + " resolves to " + strings.Join(parts, "; ")
+}
+
+// ShortDigest shortens a digest for display.
+func ShortDigest(digest string) string {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || len(hex) <= 12 {
+		return digest
+	}
+	return algorithm + ":" + hex[:12]
+}
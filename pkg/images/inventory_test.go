@@ -0,0 +1,77 @@
+package images
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseReference(t *testing.T) {
+	for image, want := range map[string]Reference{
+		"nginx":                           {Repository: "docker.io/library/nginx", Tag: "latest"},
+		"nginx:1.25":                      {Repository: "docker.io/library/nginx", Tag: "1.25"},
+		"bitnami/redis:7":                 {Repository: "docker.io/bitnami/redis", Tag: "7"},
+		"index.docker.io/nginx:1.25":      {Repository: "docker.io/library/nginx", Tag: "1.25"},
+		"registry.local:5000/team/app":    {Repository: "registry.local:5000/team/app", Tag: "latest"},
+		"registry.local:5000/team/app:v2": {Repository: "registry.local:5000/team/app", Tag: "v2"},
+		"localhost/app:dev":               {Repository: "localhost/app", Tag: "dev"},
+		"ghcr.io/org/app@sha256:abc":      {Repository: "ghcr.io/org/app", Digest: "sha256:abc"},
+		"ghcr.io/org/app:v1@sha256:abc":   {Repository: "ghcr.io/org/app", Tag: "v1", Digest: "sha256:abc"},
+	} {
+		assert.Equal(t, want, ParseReference(image), image)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	const (
+		good  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		other = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+	newPod := func(name, node, image, imageID string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name},
+			Spec: corev1.PodSpec{
+				NodeName:   node,
+				Containers: []corev1.Container{{Name: "app", Image: image}},
+			},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app", Image: image, ImageID: imageID}},
+			},
+		}
+	}
+	pods := []corev1.Pod{
+		newPod("web-a", "worker-1", "nginx:1.25", "docker.io/library/nginx@"+good),
+		newPod("web-b", "worker-2", "docker.io/library/nginx:1.25", "docker-pullable://nginx@"+other),
+		newPod("web-c", "worker-3", "nginx:1.25", "docker.io/library/nginx@"+good),
+		newPod("api", "worker-1", "ghcr.io/org/api@"+good, "ghcr.io/org/api@"+other),
+		newPod("tool", "worker-2", "busybox", good),
+	}
+	pending := newPod("pending", "worker-1", "nginx:1.25", "")
+	pending.Status.Phase = corev1.PodPending
+	pods = append(pods, pending)
+
+	report := Inventory(pods)
+	require.Len(t, report.Containers, 5)
+
+	flags := map[string][]string{}
+	for _, c := range report.Containers {
+		flags[c.Pod] = c.Flags
+	}
+	assert.Equal(t, []string{FlagUnpinned, FlagDrift}, flags["web-a"])
+	assert.Equal(t, []string{FlagUnpinned, FlagDrift}, flags["web-b"])
+	assert.Equal(t, []string{FlagDigestMismatch}, flags["api"])
+	assert.Equal(t, []string{FlagNoRepoDigest, FlagUnpinned, FlagLatest}, flags["tool"])
+
+	require.Len(t, report.Drifts, 1)
+	drift := report.Drifts[0]
+	assert.Equal(t, "docker.io/library/nginx:1.25", drift.Image)
+	assert.Equal(t, []DigestUse{
+		{Digest: good, Nodes: []string{"worker-1", "worker-3"}, Containers: 2},
+		{Digest: other, Nodes: []string{"worker-2"}, Containers: 1},
+	}, drift.Digests)
+	assert.Equal(t, "docker.io/library/nginx:1.25 resolves to sha256:111111111111 on worker-1,worker-3; sha256:222222222222 on worker-2", drift.String())
+}
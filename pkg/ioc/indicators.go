@@ -0,0 +1,290 @@
+// Package ioc loads indicators of compromise and sweeps nodes for them:
+// running processes and their executables, network connections, DNS
+// configuration, hosts files and file trees.
+package ioc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Types of indicators.
+const (
+	TypeSHA256  = "sha256"
+	TypeIP      = "ip"
+	TypeCIDR    = "cidr"
+	TypeDomain  = "domain"
+	TypePath    = "path"
+	TypeProcess = "process"
+)
+
+var types = []string{TypeSHA256, TypeIP, TypeCIDR, TypeDomain, TypePath, TypeProcess}
+
+var (
+	sha256Pattern  = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	weakHash       = regexp.MustCompile(`^([0-9a-fA-F]{32}|[0-9a-fA-F]{40})$`)
+	domainPattern  = regexp.MustCompile(`^(\*\.)?([a-z0-9_]([a-z0-9_-]*[a-z0-9_])?\.)+[a-z][a-z0-9-]*$`)
+	textSeparators = regexp.MustCompile(`[^A-Za-z0-9._:/\[\]-]+`)
+)
+
+// Indicator is a single indicator of compromise.
+type Indicator struct {
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Description string `json:"description,omitempty"`
+}
+
+// String returns the indicator as type:value.
+func (i Indicator) String() string {
+	return i.Type + ":" + i.Value
+}
+
+// Set is a parsed indicator file indexed for lookups.
+type Set struct {
+	Indicators []Indicator
+	byValue    map[string][]Indicator
+	prefixes   []netip.Prefix
+	cidrs      []Indicator
+	domains    []Indicator
+}
+
+// Load reads an indicator file.
+func Load(name string) (*Set, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open indicator file: %w", err)
+	}
+	defer f.Close()
+
+	set, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return set, nil
+}
+
+// Parse reads indicators, one per line. A line is either type:value, with
+// type one of sha256, ip, cidr, domain, path or process, or a bare value whose
+// type is guessed: 64 hex digits are a SHA-256, addresses and prefixes are IPs
+// and CIDRs, absolute paths are paths, host names with a dot are domains and
+// anything else is a process name. Text after " #" is kept as description,
+// lines starting with # are comments.
+func Parse(r io.Reader) (*Set, error) {
+	set := &Set{byValue: map[string][]Indicator{}}
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		ind := Indicator{}
+		if value, desc, ok := strings.Cut(line, " #"); ok {
+			line, ind.Description = strings.TrimSpace(value), strings.TrimSpace(desc)
+		}
+		if t, value, ok := strings.Cut(line, ":"); ok && slices.Contains(types, strings.ToLower(t)) {
+			ind.Type, ind.Value = strings.ToLower(t), strings.TrimSpace(value)
+		} else {
+			ind.Type, ind.Value = guessType(line), line
+		}
+
+		if err := set.add(ind); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read indicators: %w", err)
+	}
+	if len(set.Indicators) == 0 {
+		return nil, fmt.Errorf("no indicators found")
+	}
+
+	return set, nil
+}
+
+func guessType(value string) string {
+	if sha256Pattern.MatchString(value) {
+		return TypeSHA256
+	}
+	if weakHash.MatchString(value) {
+		return "hash"
+	}
+	if _, err := netip.ParseAddr(value); err == nil {
+		return TypeIP
+	}
+	if _, err := netip.ParsePrefix(value); err == nil {
+		return TypeCIDR
+	}
+	if strings.HasPrefix(value, "/") {
+		return TypePath
+	}
+	if domainPattern.MatchString(strings.ToLower(value)) {
+		return TypeDomain
+	}
+	return TypeProcess
+}
+
+func (s *Set) add(ind Indicator) error {
+	if ind.Value == "" {
+		return fmt.Errorf("empty %s indicator", ind.Type)
+	}
+
+	switch ind.Type {
+	case "hash":
+		return fmt.Errorf("%s looks like an MD5 or SHA-1 hash, only SHA-256 is supported", ind.Value)
+	case TypeSHA256:
+		if !sha256Pattern.MatchString(ind.Value) {
+			return fmt.Errorf("invalid SHA-256 %q", ind.Value)
+		}
+		ind.Value = strings.ToLower(ind.Value)
+	case TypeIP:
+		addr, err := netip.ParseAddr(ind.Value)
+		if err != nil {
+			return fmt.Errorf("invalid IP %q", ind.Value)
+		}
+		ind.Value = addr.Unmap().String()
+	case TypeCIDR:
+		prefix, err := netip.ParsePrefix(ind.Value)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q", ind.Value)
+		}
+		ind.Value = prefix.Masked().String()
+		s.prefixes = append(s.prefixes, prefix.Masked())
+		s.cidrs = append(s.cidrs, ind)
+	case TypeDomain:
+		ind.Value = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(ind.Value), "*."), ".")
+		if !domainPattern.MatchString(ind.Value) {
+			return fmt.Errorf("invalid domain %q", ind.Value)
+		}
+		s.domains = append(s.domains, ind)
+	case TypePath:
+		if !strings.HasPrefix(ind.Value, "/") {
+			return fmt.Errorf("path %q is not absolute", ind.Value)
+		}
+		ind.Value = path.Clean(ind.Value)
+	case TypeProcess:
+		ind.Value = strings.ToLower(ind.Value)
+	}
+
+	s.Indicators = append(s.Indicators, ind)
+	if ind.Type != TypeCIDR && ind.Type != TypeDomain {
+		key := ind.String()
+		s.byValue[key] = append(s.byValue[key], ind)
+	}
+	return nil
+}
+
+// Count returns the number of indicators by type.
+func (s *Set) Count() map[string]int {
+	counts := map[string]int{}
+	for _, ind := range s.Indicators {
+		counts[ind.Type]++
+	}
+	return counts
+}
+
+// Paths returns the values of the path indicators.
+func (s *Set) Paths() []string {
+	var paths []string
+	for _, ind := range s.Indicators {
+		if ind.Type == TypePath {
+			paths = append(paths, ind.Value)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// MatchHash returns the SHA-256 indicators equal to sum.
+func (s *Set) MatchHash(sum string) []Indicator {
+	return s.byValue[TypeSHA256+":"+strings.ToLower(sum)]
+}
+
+// MatchIP returns the IP indicators equal to addr and the CIDR indicators
+// containing it.
+func (s *Set) MatchIP(addr netip.Addr) []Indicator {
+	addr = addr.Unmap()
+	matches := append([]Indicator(nil), s.byValue[TypeIP+":"+addr.String()]...)
+	for i, prefix := range s.prefixes {
+		if prefix.Contains(addr) {
+			matches = append(matches, s.cidrs[i])
+		}
+	}
+	return matches
+}
+
+// MatchDomain returns the domain indicators equal to name or one of its
+// parent domains.
+func (s *Set) MatchDomain(name string) []Indicator {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	var matches []Indicator
+	for _, ind := range s.domains {
+		if name == ind.Value || strings.HasSuffix(name, "."+ind.Value) {
+			matches = append(matches, ind)
+		}
+	}
+	return matches
+}
+
+// MatchPath returns the path indicators equal to p.
+func (s *Set) MatchPath(p string) []Indicator {
+	return s.byValue[TypePath+":"+p]
+}
+
+// MatchProcess returns the process indicators equal to name, ignoring case.
+func (s *Set) MatchProcess(name string) []Indicator {
+	return s.byValue[TypeProcess+":"+strings.ToLower(name)]
+}
+
+// MatchText returns the IP, CIDR, domain and path indicators found in free
+// text such as a command line or a configuration line. URLs and host:port
+// pairs are split into their parts.
+func (s *Set) MatchText(text string) []Indicator {
+	var matches []Indicator
+	seen := map[string]bool{}
+	add := func(inds []Indicator) {
+		for _, ind := range inds {
+			if !seen[ind.String()] {
+				seen[ind.String()] = true
+				matches = append(matches, ind)
+			}
+		}
+	}
+
+	for _, token := range textSeparators.Split(text, -1) {
+		if token == "" {
+			continue
+		}
+		if strings.HasPrefix(token, "/") {
+			add(s.MatchPath(path.Clean(token)))
+		}
+		candidates := []string{strings.Trim(token, "[]")}
+		if ap, err := netip.ParseAddrPort(token); err == nil {
+			candidates = append(candidates, ap.Addr().String())
+		}
+		for _, part := range strings.FieldsFunc(token, func(r rune) bool { return r == '/' || r == ':' || r == '[' || r == ']' }) {
+			candidates = append(candidates, part)
+		}
+		for _, c := range candidates {
+			if addr, err := netip.ParseAddr(c); err == nil {
+				add(s.MatchIP(addr))
+				continue
+			}
+			if strings.Contains(c, ".") {
+				add(s.MatchDomain(strings.Trim(c, ".-")))
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,101 @@
+package ioc
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIndicators = `
+# campaign indicators
+E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855 # empty file
+ip:203.0.113.7
+198.51.100.0/24 # mining pool range
+*.pool.evil.example
+/tmp/.x/kdevtmpfsi
+kdevtmpfsi
+process:xmrig
+`
+
+func TestParse(t *testing.T) {
+	set, err := Parse(strings.NewReader(testIndicators))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{TypeSHA256: 1, TypeIP: 1, TypeCIDR: 1, TypeDomain: 1, TypePath: 1, TypeProcess: 2}, set.Count())
+	assert.Equal(t, Indicator{Type: TypeSHA256, Value: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", Description: "empty file"}, set.Indicators[0])
+	assert.Equal(t, []string{"/tmp/.x/kdevtmpfsi"}, set.Paths())
+
+	assert.Len(t, set.MatchIP(netip.MustParseAddr("198.51.100.20")), 1)
+	assert.Len(t, set.MatchIP(netip.MustParseAddr("::ffff:203.0.113.7")), 1)
+	assert.Empty(t, set.MatchIP(netip.MustParseAddr("192.0.2.1")))
+	assert.Len(t, set.MatchDomain("eu.POOL.evil.example."), 1)
+	assert.Empty(t, set.MatchDomain("notpool.evil.example"))
+	assert.Len(t, set.MatchProcess("XMRig"), 1)
+
+	found := set.MatchText("./x -o stratum+tcp://eu.pool.evil.example:3333 --proxy=[203.0.113.7]:80 -c /tmp/.x/kdevtmpfsi")
+	var values []string
+	for _, ind := range found {
+		values = append(values, ind.Value)
+	}
+	assert.ElementsMatch(t, []string{"pool.evil.example", "203.0.113.7", "/tmp/.x/kdevtmpfsi"}, values)
+
+	for _, invalid := range []string{"d41d8cd98f00b204e9800998ecf8427e", "ip:300.1.1.1", "cidr:10.0.0.0/33", "path:tmp/x", "# only comments"} {
+		_, err := Parse(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+const testSweep = "proc\t100\tkdevtmpfsi\t/tmp/.x/kdevtmpfsi (deleted)\t2049:77\t0::/kubepods/pod1/abc\t/tmp/.x/kdevtmpfsi -o 198.51.100.9:443\n" +
+	"exehash\t2049:77\te3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n" +
+	"sockfd\t100\t5\t9001\n" +
+	"net\ttcp\t0100007F:9C40\t077100CB:0050\t01\t9001\n" +
+	"proc\t1\tsystemd\t/usr/lib/systemd/systemd\t2049:10\t0::/init.scope\t/sbin/init\n" +
+	"exehash\t2049:10\t0000000000000000000000000000000000000000000000000000000000000000\n" +
+	"conf\t1\t/etc/hosts\t3\t198.51.100.10 eu.pool.evil.example\n" +
+	"conf\t1\t/etc/resolv.conf\t1\t# nameserver 203.0.113.7\n" +
+	"path\t100\t/tmp/.x/kdevtmpfsi\n" +
+	"file\te3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\t/var/tmp/empty\n"
+
+func TestMatch(t *testing.T) {
+	set, err := Parse(strings.NewReader(testIndicators))
+	require.NoError(t, err)
+
+	hits := set.Match([]byte(testSweep), func(cgroup string) string {
+		if strings.Contains(cgroup, "kubepods") {
+			return "default/miner"
+		}
+		return ""
+	})
+
+	var got []string
+	for _, h := range hits {
+		got = append(got, h.Source+" "+h.Indicator.String())
+		if h.PID == 100 {
+			assert.Equal(t, "default/miner", h.Pod)
+			assert.Equal(t, "kdevtmpfsi", h.Process)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		"process process:kdevtmpfsi",
+		"executable path:/tmp/.x/kdevtmpfsi",
+		"executable sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"cmdline path:/tmp/.x/kdevtmpfsi",
+		"cmdline cidr:198.51.100.0/24",
+		"connection ip:203.0.113.7",
+		"hosts cidr:198.51.100.0/24",
+		"hosts domain:pool.evil.example",
+		"path path:/tmp/.x/kdevtmpfsi",
+		"file sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}, got)
+
+	summary := Summarize([]NodeResult{
+		{Node: "a", Hits: hits},
+		{Node: "b", Hits: hits[:1]},
+	})
+	require.NotEmpty(t, summary)
+	assert.Equal(t, []string{"a", "b"}, summary[0].Nodes)
+	assert.Equal(t, 2, summary[0].Hits)
+}
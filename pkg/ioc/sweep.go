@@ -0,0 +1,275 @@
+package ioc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/procfs"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// Sources of hits.
+const (
+	SourceProcess    = "process"
+	SourceExecutable = "executable"
+	SourceCmdline    = "cmdline"
+	SourceConnection = "connection"
+	SourceDNS        = "dns"
+	SourceHosts      = "hosts"
+	SourcePath       = "path"
+	SourceFile       = "file"
+)
+
+// configFiles are read from the root of every mount namespace.
+var configFiles = []string{"/etc/hosts", "/etc/resolv.conf", "/run/systemd/resolve/resolv.conf"}
+
+// SweepScript collects everything indicators are matched against: processes
+// with the SHA-256 of their executables, their sockets, the hosts and resolver
+// files and the existence of the path indicators in every mount namespace,
+// and the SHA-256 of the regular files below trees up to maxSize bytes.
+func SweepScript(paths, trees []string, maxSize int64) string {
+	script := `
+seen=" "
+hashed=" "
+mnts=" "
+for d in /proc/[0-9]*; do
+  p=${d#/proc/}
+  exe=$(readlink "$d/exe" 2>/dev/null)
+  [ -n "$exe" ] || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cg=$(tr '\n\t' ';;' < "$d/cgroup" 2>/dev/null)
+  cmd=$(tr '\0\t\n' '   ' < "$d/cmdline" 2>/dev/null)
+  id=$(stat -L -c '%d:%i' "$d/exe" 2>/dev/null)
+  [ -n "$id" ] || id="pid:$p"
+  printf 'proc\t%s\t%s\t%s\t%s\t%s\t%s\n' "$p" "$comm" "$exe" "$id" "$cg" "$cmd"
+  case "$hashed" in
+    *" $id "*) ;;
+    *)
+      hashed="$hashed$id "
+      printf 'exehash\t%s\t%s\n' "$id" "$(sha256sum < "$d/exe" 2>/dev/null | cut -d' ' -f1)"
+      ;;
+  esac
+` + procfs.SocketsScript + `
+  mnt=$(readlink "$d/ns/mnt" 2>/dev/null)
+  case "$mnts" in
+    *" $mnt "*) ;;
+    *)
+      mnts="$mnts$mnt "
+      for f in ` + shell.Join(configFiles) + `; do
+        awk -v p="$p" -v f="$f" '{ gsub(/\t/, " "); printf "conf\t%s\t%s\t%d\t%s\n", p, f, NR, $0 }' "$d/root$f" 2>/dev/null
+      done
+`
+	if len(paths) > 0 {
+		script += `      for f in ` + shell.Join(paths) + `; do
+        if [ -e "$d/root$f" ] || [ -L "$d/root$f" ]; then printf 'path\t%s\t%s\n' "$p" "$f"; fi
+      done
+`
+	}
+	script += `      ;;
+  esac
+done
+`
+
+	if len(trees) > 0 {
+		var roots []string
+		for _, t := range trees {
+			roots = append(roots, tasks.HostRoot+path.Clean("/"+t))
+		}
+		script += fmt.Sprintf(`find %s -xdev -type f -size -%dc -exec sha256sum {} + 2>/dev/null | while read -r sum f; do
+  printf 'file\t%%s\t%%s\n' "$sum" "${f#%s}"
+done
+`, shell.Join(roots), maxSize+1, tasks.HostRoot)
+	}
+
+	return script
+}
+
+// Process is a process seen during a sweep.
+type Process struct {
+	PID     int
+	Name    string
+	Exe     string
+	Cgroup  string
+	Cmdline string
+	SHA256  string
+}
+
+// Hit is an indicator found on a node.
+type Hit struct {
+	Indicator Indicator `json:"indicator"`
+	Source    string    `json:"source"`
+	PID       int       `json:"pid,omitempty"`
+	Process   string    `json:"process,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Detail    string    `json:"detail"`
+}
+
+// Match parses the output of SweepScript and returns the indicators of the set
+// found in it. resolve maps the cgroup of a process to its pod and may be nil.
+func (s *Set) Match(output []byte, resolve func(cgroup string) string) []Hit {
+	procs := map[int]*Process{}
+	hashes := map[string]string{}
+	exeIDs := map[int]string{}
+
+	var hits []Hit
+	seen := map[string]bool{}
+	add := func(inds []Indicator, source string, pid int, detail string) {
+		for _, ind := range inds {
+			h := Hit{Indicator: ind, Source: source, PID: pid, Detail: detail}
+			if p := procs[pid]; p != nil {
+				h.Process = p.Name
+				if resolve != nil {
+					h.Pod = resolve(p.Cgroup)
+				}
+			}
+			key := fmt.Sprintf("%s|%s|%d|%s", ind, source, pid, detail)
+			if !seen[key] {
+				seen[key] = true
+				hits = append(hits, h)
+			}
+		}
+	}
+
+	type lineRecord struct {
+		kind   string
+		fields []string
+	}
+	var rest []lineRecord
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		switch fields[0] {
+		case "proc":
+			if len(fields) < 7 {
+				continue
+			}
+			pid, err := strconv.Atoi(fields[1])
+			if err != nil {
+				continue
+			}
+			procs[pid] = &Process{PID: pid, Name: fields[2], Exe: fields[3], Cgroup: fields[5], Cmdline: strings.TrimSpace(fields[6])}
+			exeIDs[pid] = fields[4]
+		case "exehash":
+			if len(fields) == 3 {
+				hashes[fields[1]] = fields[2]
+			}
+		case "conf", "path", "file":
+			rest = append(rest, lineRecord{kind: fields[0], fields: fields[1:]})
+		}
+	}
+
+	pids := make([]int, 0, len(procs))
+	for pid := range procs {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+
+	sockets := procfs.ParseSockets(output)
+	for _, pid := range pids {
+		p := procs[pid]
+		p.SHA256 = hashes[exeIDs[pid]]
+		exe := strings.TrimSuffix(p.Exe, " (deleted)")
+
+		add(s.MatchProcess(p.Name), SourceProcess, pid, "name "+p.Name)
+		if base := path.Base(exe); !strings.EqualFold(base, p.Name) {
+			add(s.MatchProcess(base), SourceProcess, pid, "executable "+exe)
+		}
+		add(s.MatchPath(exe), SourceExecutable, pid, exe)
+		if p.SHA256 != "" {
+			add(s.MatchHash(p.SHA256), SourceExecutable, pid, exe+" sha256:"+p.SHA256)
+		}
+		add(s.MatchText(p.Cmdline), SourceCmdline, pid, p.Cmdline)
+
+		for _, sock := range sockets[pid] {
+			if sock.Connected() {
+				add(s.MatchIP(sock.Remote.Addr()), SourceConnection, pid, sock.String())
+			}
+		}
+	}
+
+	for _, r := range rest {
+		switch r.kind {
+		case "conf":
+			if len(r.fields) < 4 {
+				continue
+			}
+			pid, _ := strconv.Atoi(r.fields[0])
+			text := strings.TrimSpace(r.fields[3])
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			source := SourceDNS
+			if r.fields[1] == "/etc/hosts" {
+				source = SourceHosts
+			}
+			add(s.MatchText(text), source, pid, fmt.Sprintf("%s:%s: %s", r.fields[1], r.fields[2], text))
+		case "path":
+			if len(r.fields) < 2 {
+				continue
+			}
+			pid, _ := strconv.Atoi(r.fields[0])
+			add(s.MatchPath(r.fields[1]), SourcePath, pid, r.fields[1]+" exists")
+		case "file":
+			if len(r.fields) < 2 {
+				continue
+			}
+			add(s.MatchHash(r.fields[0]), SourceFile, 0, r.fields[1]+" sha256:"+r.fields[0])
+			add(s.MatchPath(r.fields[1]), SourceFile, 0, r.fields[1])
+		}
+	}
+
+	return hits
+}
+
+// NodeResult is the outcome of a sweep of a single node.
+type NodeResult struct {
+	Node  string `json:"node"`
+	Error string `json:"error,omitempty"`
+	Hits  []Hit  `json:"hits"`
+}
+
+// Summary lists the nodes an indicator was found on.
+type Summary struct {
+	Indicator Indicator `json:"indicator"`
+	Nodes     []string  `json:"nodes"`
+	Hits      int       `json:"hits"`
+}
+
+// Summarize consolidates the results of several nodes per indicator. Only
+// indicators that were found are included, most widespread first.
+func Summarize(results []NodeResult) []Summary {
+	byIndicator := map[string]*Summary{}
+	var order []string
+	for _, r := range results {
+		for _, h := range r.Hits {
+			key := h.Indicator.String()
+			sum, ok := byIndicator[key]
+			if !ok {
+				sum = &Summary{Indicator: h.Indicator}
+				byIndicator[key] = sum
+				order = append(order, key)
+			}
+			sum.Hits++
+			if len(sum.Nodes) == 0 || sum.Nodes[len(sum.Nodes)-1] != r.Node {
+				sum.Nodes = append(sum.Nodes, r.Node)
+			}
+		}
+	}
+
+	summaries := make([]Summary, 0, len(order))
+	for _, key := range order {
+		summaries = append(summaries, *byIndicator[key])
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return len(summaries[i].Nodes) > len(summaries[j].Nodes)
+	})
+	return summaries
+}
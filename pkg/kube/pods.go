@@ -0,0 +1,169 @@
+// Package kube holds helpers to relate what is found on a node back to the
+// Kubernetes objects running there.
+package kube
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ContainerRef identifies a container of a pod.
+type ContainerRef struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Container string `json:"container,omitempty"`
+	NodeName  string `json:"node,omitempty"`
+}
+
+// String returns the reference as namespace/pod/container.
+func (r ContainerRef) String() string {
+	if r.Container == "" {
+		return r.Namespace + "/" + r.Pod
+	}
+	return r.Namespace + "/" + r.Pod + "/" + r.Container
+}
+
+// ParseContainerRef parses a reference given as namespace/pod or
+// namespace/pod/container.
+func ParseContainerRef(s string) (ContainerRef, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" || len(parts) == 3 && parts[2] == "" {
+		return ContainerRef{}, fmt.Errorf("invalid container reference %q, expected namespace/pod[/container]", s)
+	}
+	ref := ContainerRef{Namespace: parts[0], Pod: parts[1]}
+	if len(parts) == 3 {
+		ref.Container = parts[2]
+	}
+	return ref, nil
+}
+
+// ListNodePods returns the pods scheduled on nodeName.
+func ListNodePods(ctx context.Context, c client.Client, nodeName string) ([]corev1.Pod, error) {
+	var list corev1.PodList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.Spec.NodeName == nodeName {
+			pods = append(pods, pod)
+		}
+	}
+
+	return pods, nil
+}
+
+// PodIndex resolves pod UIDs and container IDs found in cgroup paths to pods.
+type PodIndex struct {
+	byUID         map[string]ContainerRef
+	byContainerID map[string]ContainerRef
+	containerIDs  map[string]string
+	containers    map[string]corev1.Container
+}
+
+// NewPodIndex indexes pods by UID and by the IDs of all their containers.
+func NewPodIndex(pods []corev1.Pod) *PodIndex {
+	idx := &PodIndex{
+		byUID:         map[string]ContainerRef{},
+		byContainerID: map[string]ContainerRef{},
+		containerIDs:  map[string]string{},
+		containers:    map[string]corev1.Container{},
+	}
+
+	for _, pod := range pods {
+		ref := ContainerRef{Namespace: pod.Namespace, Pod: pod.Name, NodeName: pod.Spec.NodeName}
+		idx.byUID[string(pod.UID)] = ref
+
+		var containers []corev1.Container
+		containers = append(containers, pod.Spec.InitContainers...)
+		containers = append(containers, pod.Spec.Containers...)
+		for _, c := range pod.Spec.EphemeralContainers {
+			containers = append(containers, corev1.Container(c.EphemeralContainerCommon))
+		}
+		for _, c := range containers {
+			cref := ref
+			cref.Container = c.Name
+			idx.containers[cref.String()] = c
+		}
+
+		var statuses []corev1.ContainerStatus
+		statuses = append(statuses, pod.Status.InitContainerStatuses...)
+		statuses = append(statuses, pod.Status.ContainerStatuses...)
+		statuses = append(statuses, pod.Status.EphemeralContainerStatuses...)
+		for _, cs := range statuses {
+			id := TrimContainerID(cs.ContainerID)
+			if id == "" {
+				continue
+			}
+			cref := ref
+			cref.Container = cs.Name
+			idx.byContainerID[id] = cref
+			idx.containerIDs[cref.String()] = id
+		}
+	}
+
+	return idx
+}
+
+// Lookup returns the pod, and the container if known, for the pod UID and
+// container ID parsed from a cgroup path.
+func (idx *PodIndex) Lookup(podUID, containerID string) (ContainerRef, bool) {
+	if ref, ok := idx.byContainerID[containerID]; ok && containerID != "" {
+		return ref, true
+	}
+	if ref, ok := idx.byUID[podUID]; ok && podUID != "" {
+		return ref, true
+	}
+	return ContainerRef{}, false
+}
+
+// LookupCgroup resolves the content of a /proc/PID/cgroup file.
+func (idx *PodIndex) LookupCgroup(cgroup string) (ContainerRef, bool) {
+	podUID, containerID := ParseCgroup(cgroup)
+	return idx.Lookup(podUID, containerID)
+}
+
+// ContainerID returns the runtime ID of the container referenced by ref.
+func (idx *PodIndex) ContainerID(ref ContainerRef) (string, bool) {
+	id, ok := idx.containerIDs[ref.String()]
+	return id, ok
+}
+
+// ContainerSpec returns the spec of the container referenced by ref.
+func (idx *PodIndex) ContainerSpec(ref ContainerRef) (corev1.Container, bool) {
+	c, ok := idx.containers[ref.String()]
+	return c, ok
+}
+
+// TrimContainerID strips the runtime scheme, e.g. containerd://, from a
+// container ID reported in the pod status.
+func TrimContainerID(id string) string {
+	if i := strings.Index(id, "://"); i >= 0 {
+		return id[i+3:]
+	}
+	return id
+}
+
+var (
+	podUIDPattern      = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+	containerIDPattern = regexp.MustCompile(`([0-9a-f]{64})`)
+)
+
+// ParseCgroup extracts the pod UID and container ID from the content of a
+// /proc/PID/cgroup file. Both the cgroupfs and the systemd cgroup driver
+// layouts of the kubelet are understood.
+func ParseCgroup(cgroup string) (podUID, containerID string) {
+	if m := podUIDPattern.FindAllStringSubmatch(cgroup, -1); len(m) > 0 {
+		podUID = strings.ReplaceAll(m[len(m)-1][1], "_", "-")
+	}
+	if m := containerIDPattern.FindAllStringSubmatch(cgroup, -1); len(m) > 0 {
+		containerID = m[len(m)-1][1]
+	}
+	return podUID, containerID
+}
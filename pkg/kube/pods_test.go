@@ -0,0 +1,104 @@
+package kube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testContainerID = "4f3c2b1a00112233445566778899aabbccddeeff00112233445566778899aabb"
+
+func TestParseCgroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		cgroup      string
+		podUID      string
+		containerID string
+	}{
+		{
+			name:        "systemd driver",
+			cgroup:      "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0a1b2c3d_1111_2222_3333_444455556666.slice/cri-containerd-" + testContainerID + ".scope",
+			podUID:      "0a1b2c3d-1111-2222-3333-444455556666",
+			containerID: testContainerID,
+		},
+		{
+			name:        "cgroupfs driver",
+			cgroup:      "12:pids:/kubepods/besteffort/pod0a1b2c3d-1111-2222-3333-444455556666/" + testContainerID,
+			podUID:      "0a1b2c3d-1111-2222-3333-444455556666",
+			containerID: testContainerID,
+		},
+		{
+			name:   "host process",
+			cgroup: "0::/system.slice/sshd.service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			podUID, containerID := ParseCgroup(tt.cgroup)
+			assert.Equal(t, tt.podUID, podUID)
+			assert.Equal(t, tt.containerID, containerID)
+		})
+	}
+}
+
+func TestPodIndex(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop", UID: "0a1b2c3d-1111-2222-3333-444455556666"},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "nginx", ContainerID: "containerd://" + testContainerID},
+			},
+		},
+	}
+	idx := NewPodIndex([]corev1.Pod{pod})
+
+	ref, ok := idx.Lookup("", testContainerID)
+	assert.True(t, ok)
+	assert.Equal(t, "shop/web/nginx", ref.String())
+
+	ref, ok = idx.Lookup("0a1b2c3d-1111-2222-3333-444455556666", "")
+	assert.True(t, ok)
+	assert.Equal(t, "shop/web", ref.String())
+
+	id, ok := idx.ContainerID(ContainerRef{Namespace: "shop", Pod: "web", Container: "nginx"})
+	assert.True(t, ok)
+	assert.Equal(t, testContainerID, id)
+
+	_, ok = idx.Lookup("", "")
+	assert.False(t, ok)
+}
+
+func TestPodIndexEphemeralContainers(t *testing.T) {
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "shop"},
+		Spec: corev1.PodSpec{
+			EphemeralContainers: []corev1.EphemeralContainer{{
+				EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", Stdin: true, TTY: true},
+			}},
+		},
+	}
+	idx := NewPodIndex([]corev1.Pod{pod})
+
+	c, ok := idx.ContainerSpec(ContainerRef{Namespace: "shop", Pod: "web", Container: "debugger"})
+	assert.True(t, ok)
+	assert.True(t, c.TTY)
+}
+
+func TestParseContainerRef(t *testing.T) {
+	ref, err := ParseContainerRef("kube-system/coredns-abc/coredns")
+	assert.NoError(t, err)
+	assert.Equal(t, ContainerRef{Namespace: "kube-system", Pod: "coredns-abc", Container: "coredns"}, ref)
+
+	ref, err = ParseContainerRef("default/web")
+	assert.NoError(t, err)
+	assert.Equal(t, ContainerRef{Namespace: "default", Pod: "web"}, ref)
+
+	for _, invalid := range []string{"web", "default/", "/web", "a/b/", "a/b/c/d"} {
+		_, err := ParseContainerRef(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,154 @@
+// Package memdump writes process memory regions streamed out of a node into a
+// tar archive, together with an index describing every region.
+package memdump
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/stream"
+)
+
+// IndexFile is the name of the region index inside an archive.
+const IndexFile = "index.json"
+
+// Region is a dumped memory region.
+type Region struct {
+	PID     int    `json:"pid"`
+	Process string `json:"process"`
+	Pod     string `json:"pod,omitempty"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Perms   string `json:"perms"`
+	Offset  string `json:"offset"`
+	Inode   string `json:"inode"`
+	Path    string `json:"path,omitempty"`
+	Size    int64  `json:"size"`
+	// Requested is the size of the region, or of the piece of it, when it
+	// could only be read up to Size. The rest of it was not dumped.
+	Requested int64  `json:"requested,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	SHA256    string `json:"sha256"`
+	MD5       string `json:"md5"`
+	File      string `json:"file"`
+}
+
+// Index describes the content of an archive.
+type Index struct {
+	Node      string    `json:"node"`
+	Target    string    `json:"target"`
+	CreatedAt time.Time `json:"createdAt"`
+	Regions   []Region  `json:"regions"`
+	Skipped   []string  `json:"skipped,omitempty"`
+}
+
+// Archive writes regions as PID/START-END.bin entries of a tar archive and
+// the index as last entry. Regions larger than stream.ChunkSize are written as
+// one entry per piece.
+type Archive struct {
+	Index Index
+	tw    *tar.Writer
+}
+
+// NewArchive starts an archive on w for a dump of target on node.
+func NewArchive(w io.Writer, node, target string) *Archive {
+	return &Archive{
+		Index: Index{Node: node, Target: target, CreatedAt: time.Now().UTC(), Regions: []Region{}},
+		tw:    tar.NewWriter(w),
+	}
+}
+
+// Add copies a memory region of t.Size bytes from data to the archive.
+func (a *Archive) Add(t stream.Target, pod string, data io.Reader) error {
+	if t.Kind != stream.TargetMemory {
+		return fmt.Errorf("unexpected %s target %s in memory dump", t.Kind, t)
+	}
+
+	end := t.Address + uint64(t.Size)
+	r := Region{
+		PID:     t.PID,
+		Process: t.Process,
+		Pod:     pod,
+		Start:   fmt.Sprintf("%#x", t.Address),
+		End:     fmt.Sprintf("%#x", end),
+		Perms:   t.Perms,
+		Offset:  fmt.Sprintf("%#x", t.Offset),
+		Inode:   t.Inode,
+		Path:    t.Path,
+		Size:    t.Size,
+		File:    fmt.Sprintf("%d/%016x-%016x.bin", t.PID, t.Address, end),
+	}
+	if t.Truncated {
+		r.Requested, r.Truncated = t.Requested, true
+	}
+	sha, sum := sha256.New(), md5.New()
+	if err := a.copy(r.File, t.Size, io.TeeReader(data, io.MultiWriter(sha, sum))); err != nil {
+		return err
+	}
+	r.SHA256, r.MD5 = hex.EncodeToString(sha.Sum(nil)), hex.EncodeToString(sum.Sum(nil))
+	a.Index.Regions = append(a.Index.Regions, r)
+	return nil
+}
+
+// Skip records a region that was not dumped.
+func (a *Archive) Skip(reason string) {
+	a.Index.Skipped = append(a.Index.Skipped, reason)
+}
+
+// Size returns the number of region bytes written so far.
+func (a *Archive) Size() int64 {
+	var size int64
+	for _, r := range a.Index.Regions {
+		size += r.Size
+	}
+	return size
+}
+
+// Truncated returns the number of regions that were read partially.
+func (a *Archive) Truncated() int {
+	n := 0
+	for _, r := range a.Index.Regions {
+		if r.Truncated {
+			n++
+		}
+	}
+	return n
+}
+
+// Close writes the index and finishes the archive. It does not close the
+// underlying writer.
+func (a *Archive) Close() error {
+	data, err := json.MarshalIndent(a.Index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal region index: %w", err)
+	}
+	if err := a.copy(IndexFile, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return err
+	}
+	return a.tw.Close()
+}
+
+// copy writes an entry of size bytes read from data.
+func (a *Archive) copy(name string, size int64, data io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    size,
+		ModTime: time.Now(),
+		Format:  tar.FormatPAX,
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s to archive: %w", name, err)
+	}
+	if _, err := io.CopyN(a.tw, data, size); err != nil {
+		return fmt.Errorf("failed to write %s to archive: %w", name, err)
+	}
+	return nil
+}
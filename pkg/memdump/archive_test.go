@@ -0,0 +1,65 @@
+package memdump
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewArchive(&buf, "worker-1", "pid 42")
+
+	heap := stream.Target{Kind: stream.TargetMemory, Path: "[heap]", PID: 42, Process: "nginx", Address: 0x5000, Perms: "rw-p", Inode: "00:00:0", Size: 4}
+	require.NoError(t, a.Add(heap, "default/web", strings.NewReader("abcd")))
+	stack := stream.Target{Kind: stream.TargetMemory, Path: "[stack]", PID: 42, Process: "nginx", Address: 0x9000, Perms: "rw-p", Size: 2, Requested: 8, Truncated: true}
+	require.NoError(t, a.Add(stack, "default/web", strings.NewReader("ef")))
+	assert.Error(t, a.Add(stream.Target{Kind: stream.TargetFile, Path: "/etc/passwd", Size: 1}, "", strings.NewReader("x")))
+	a.Skip("skipped 1 bytes region 7000 of pid 42, larger than the maximum region size")
+	assert.Equal(t, int64(6), a.Size())
+	assert.Equal(t, 1, a.Truncated())
+	require.NoError(t, a.Close())
+
+	tr := tar.NewReader(&buf)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = data
+	}
+
+	assert.Equal(t, []byte("abcd"), files["42/0000000000005000-0000000000005004.bin"])
+
+	var index Index
+	require.NoError(t, json.Unmarshal(files[IndexFile], &index))
+	assert.Equal(t, "worker-1", index.Node)
+	assert.Len(t, index.Skipped, 1)
+	require.Len(t, index.Regions, 2)
+	r := index.Regions[0]
+	assert.Equal(t, "0x5000", r.Start)
+	assert.Equal(t, "0x5004", r.End)
+	assert.Equal(t, "default/web", r.Pod)
+	assert.Equal(t, "88d4266fd4e6338d13b845fcf289579d209c897823b9217da3e161936f031589", r.SHA256)
+	assert.Equal(t, "e2fc714c4727ee9395f324cd2e7f331f", r.MD5)
+	assert.False(t, r.Truncated)
+
+	// Only the bytes read are archived, the index tells the region was cut.
+	r = index.Regions[1]
+	assert.Equal(t, []byte("ef"), files["42/0000000000009000-0000000000009002.bin"])
+	assert.Equal(t, "0x9002", r.End)
+	assert.Equal(t, int64(2), r.Size)
+	assert.Equal(t, int64(8), r.Requested)
+	assert.True(t, r.Truncated)
+}
@@ -0,0 +1,253 @@
+// Package overlay reports the drift of a container from its image by walking
+// the writable upper directory of its overlayfs root mount. Every entry of the
+// upper directory was created or copied up by the container, whiteouts mark
+// files it deleted and opaque directories hide the image content below them.
+package overlay
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/fsscan"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// Kinds of changes.
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+	ChangeOpaque   = "opaque"
+)
+
+// overlayOptionAwk prints the values of the overlayfs mount option opt, set
+// with -v, of the root mount found in a mountinfo file, one per line. Layer
+// lists such as lowerdir are split on colons.
+const overlayOptionAwk = `awk -v opt="$opt" '$5=="/" { for (i = 7; i <= NF; i++) if ($i == "-") { if ($(i+1) == "overlay") { n = split($(i+3), o, ","); for (j = 1; j <= n; j++) if (index(o[j], opt "=") == 1) { m = split(substr(o[j], length(opt) + 2), v, ":"); for (k = 1; k <= m; k++) if (v[k] != "") print v[k] } } break } }'`
+
+// Change is an entry of the upper directory of a container.
+type Change struct {
+	Path    string    `json:"path"`
+	Change  string    `json:"change"`
+	Type    string    `json:"type"`
+	Mode    string    `json:"mode"`
+	UID     int       `json:"uid"`
+	GID     int       `json:"gid"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Target  string    `json:"target,omitempty"`
+
+	// LowerSHA256 is the hash of the image version of a modified file.
+	// MetadataOnly is set when it equals SHA256, the file was then copied up
+	// by a change of its owner, mode or timestamps only.
+	LowerSHA256  string `json:"lowerSha256,omitempty"`
+	MetadataOnly bool   `json:"metadataOnly,omitempty"`
+
+	mode os.FileMode
+}
+
+// IsRegular reports whether the change is a regular file that can be copied
+// out of the upper directory.
+func (c Change) IsRegular() bool {
+	return c.mode.IsRegular()
+}
+
+// Drift is the content of the writable layer of a container.
+type Drift struct {
+	PID       int      `json:"pid"`
+	UpperDir  string   `json:"upperDir"`
+	LowerDirs []string `json:"lowerDirs"`
+	Warnings  []string `json:"warnings,omitempty"`
+	// Unavailable lists the kinds of changes the script could not detect.
+	Unavailable []string `json:"unavailable,omitempty"`
+	Changes     []Change `json:"changes"`
+}
+
+// DriftScript locates the overlayfs root mount of the container through one
+// of its processes and lists every entry of its upper directory, together with
+// the lower directory the path exists in, if any. Regular files up to maxHash
+// bytes are hashed, in both layers for modified files. Opaque directories are
+// read with getfattr, shipped in the image of build/forensic-pod. Without it
+// opaque changes are reported unavailable.
+func DriftScript(containerID string, maxHash int64) string {
+	id := shell.Quote(containerID)
+	limit := strconv.FormatInt(maxHash, 10)
+	return `
+H=` + tasks.HostRoot + `
+pid=""
+for d in /proc/[0-9]*; do
+  if grep -q ` + id + ` "$d/cgroup" 2>/dev/null && [ -r "$d/mountinfo" ]; then pid=${d#/proc/}; break; fi
+done
+if [ -z "$pid" ]; then
+  printf 'warn\tno running process found for container %s\n' ` + id + `
+  exit 0
+fi
+upper=$(opt=upperdir; ` + overlayOptionAwk + ` "/proc/$pid/mountinfo" | head -n 1)
+lowers=$(opt=lowerdir; ` + overlayOptionAwk + ` "/proc/$pid/mountinfo")
+if [ -z "$upper" ] || [ ! -d "$H$upper" ]; then
+  printf 'warn\tthe root filesystem of container %s is not an overlay mount with an upper directory\n' ` + id + `
+  exit 0
+fi
+printf 'mount\t%s\t%s\n' "$pid" "$upper"
+for l in $lowers; do printf 'lower\t%s\n' "$l"; done
+command -v getfattr >/dev/null 2>&1 ||
+  printf 'unavailable\t` + ChangeOpaque + `\tgetfattr is not available in the forensic pod image, opaque directories were not detected\n'
+U=$H$upper
+cd "$U" && find . -mindepth 1 2>/dev/null | while IFS= read -r f; do
+  f=${f#.}
+  s=$(stat -c '%f %u %g %s %Y %t %T' "$U$f" 2>/dev/null) || continue
+  l=""
+  for d in $lowers; do
+    if [ -e "$H$d$f" ] || [ -L "$H$d$f" ]; then l=$d; break; fi
+  done
+  printf 'entry\t%s\t%s\t%s\n' "$f" "$s" "$l"
+  set -- $s
+  if [ -L "$U$f" ]; then
+    printf 'link\t%s\t%s\n' "$f" "$(readlink "$U$f")"
+  elif [ -f "$U$f" ]; then
+    h=""
+    lh=""
+    [ "$4" -le ` + limit + ` ] && h=$(sha256sum < "$U$f" 2>/dev/null | cut -d ' ' -f 1)
+    if [ -n "$l" ] && [ -f "$H$l$f" ] && [ ! -L "$H$l$f" ] && [ "$(stat -c %s "$H$l$f" 2>/dev/null)" -le ` + limit + ` ] 2>/dev/null; then
+      lh=$(sha256sum < "$H$l$f" 2>/dev/null | cut -d ' ' -f 1)
+    fi
+    printf 'hash\t%s\t%s\t%s\n' "$f" "$h" "$lh"
+  elif [ -d "$U$f" ] && [ -n "$l" ]; then
+    o=$(getfattr --absolute-names --only-values -n trusted.overlay.opaque "$U$f" 2>/dev/null)
+    [ -n "$o" ] || o=$(getfattr --absolute-names --only-values -n user.overlay.opaque "$U$f" 2>/dev/null)
+    [ "$o" = y ] && printf 'opaque\t%s\n' "$f"
+  fi
+done
+`
+}
+
+// ParseDrift parses the output of DriftScript. Directories that exist in the
+// image are only reported when they are opaque, they are otherwise copied up
+// merely to hold a changed entry.
+func ParseDrift(output []byte) Drift {
+	drift := Drift{LowerDirs: []string{}, Changes: []Change{}}
+	changes := map[string]*Change{}
+	var order []string
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		switch {
+		case fields[0] == "warn" && len(fields) > 1:
+			drift.Warnings = append(drift.Warnings, strings.Join(fields[1:], " "))
+		case fields[0] == "unavailable" && len(fields) >= 3:
+			drift.Unavailable = append(drift.Unavailable, fields[1])
+			drift.Warnings = append(drift.Warnings, strings.Join(fields[2:], " "))
+		case fields[0] == "mount" && len(fields) >= 3:
+			drift.PID, _ = strconv.Atoi(fields[1])
+			drift.UpperDir = fields[2]
+		case fields[0] == "lower" && len(fields) >= 2:
+			drift.LowerDirs = append(drift.LowerDirs, fields[1])
+		case fields[0] == "entry" && len(fields) >= 3:
+			c, ok := parseEntry(fields[1], fields[2])
+			if !ok {
+				continue
+			}
+			switch {
+			case c.Change == ChangeDeleted:
+			case len(fields) > 3 && fields[3] != "":
+				c.Change = ChangeModified
+			default:
+				c.Change = ChangeAdded
+			}
+			changes[c.Path] = c
+			order = append(order, c.Path)
+		case fields[0] == "link" && len(fields) >= 3:
+			if c, ok := changes[fields[1]]; ok {
+				c.Target = fields[2]
+			}
+		case fields[0] == "hash" && len(fields) >= 3:
+			if c, ok := changes[fields[1]]; ok {
+				c.SHA256 = fields[2]
+				if len(fields) > 3 {
+					c.LowerSHA256 = fields[3]
+				}
+				c.MetadataOnly = c.SHA256 != "" && c.SHA256 == c.LowerSHA256
+			}
+		case fields[0] == "opaque" && len(fields) >= 2:
+			if c, ok := changes[fields[1]]; ok {
+				c.Change = ChangeOpaque
+			}
+		}
+	}
+
+	for _, p := range order {
+		c := changes[p]
+		if c.mode.IsDir() && c.Change == ChangeModified {
+			continue
+		}
+		drift.Changes = append(drift.Changes, *c)
+	}
+	sort.Slice(drift.Changes, func(i, j int) bool {
+		return drift.Changes[i].Path < drift.Changes[j].Path
+	})
+
+	return drift
+}
+
+// parseEntry parses the stat fields of an entry: the raw mode, owner, group,
+// size, modification time and device numbers. A character device 0:0 is a
+// whiteout.
+func parseEntry(p, stat string) (*Change, bool) {
+	f := strings.Fields(stat)
+	if len(f) < 7 {
+		return nil, false
+	}
+	raw, err := strconv.ParseUint(f[0], 16, 32)
+	if err != nil {
+		return nil, false
+	}
+	c := &Change{Path: p, mode: fsscan.UnixMode(uint32(raw))}
+	c.Mode = c.mode.String()
+	c.UID, _ = strconv.Atoi(f[1])
+	c.GID, _ = strconv.Atoi(f[2])
+	c.Size, _ = strconv.ParseInt(f[3], 10, 64)
+	if mtime, err := strconv.ParseInt(f[4], 10, 64); err == nil {
+		c.ModTime = time.Unix(mtime, 0).UTC()
+	}
+	c.Type = fileType(c.mode)
+	if c.mode&os.ModeCharDevice != 0 && f[5] == "0" && f[6] == "0" {
+		c.Change = ChangeDeleted
+		c.Type, c.Mode, c.Size = "whiteout", "", 0
+	}
+	return c, true
+}
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeCharDevice != 0:
+		return "char"
+	case mode&os.ModeDevice != 0:
+		return "block"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	}
+	return "unknown"
+}
+
+// CopyScript writes the file p of the upper directory to standard output.
+func CopyScript(upperDir, p string) string {
+	return "cat " + shell.Quote(tasks.HostRoot+upperDir+p)
+}
+
+// HashScript prints the SHA-256 of the file p of the upper directory.
+func HashScript(upperDir, p string) string {
+	return "sha256sum < " + shell.Quote(tasks.HostRoot+upperDir+p) + " | cut -d ' ' -f 1"
+}
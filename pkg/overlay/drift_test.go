@@ -0,0 +1,75 @@
+package overlay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDrift(t *testing.T) {
+	output := []byte(`mount	4242	/var/lib/containerd/snapshots/42/fs
+lower	/var/lib/containerd/snapshots/41/fs
+lower	/var/lib/containerd/snapshots/40/fs
+entry	/etc	41ed 0 0 4096 1792342268 0 0	/var/lib/containerd/snapshots/41/fs
+entry	/etc/hosts	81a4 0 0 5 1792342268 0 0	/var/lib/containerd/snapshots/41/fs
+hash	/etc/hosts	a6328afc	a6328afc
+entry	/etc/passwd	81a4 0 0 6 1792342268 0 0	/var/lib/containerd/snapshots/41/fs
+hash	/etc/passwd	d829226e	53175bcc
+entry	/usr/bin/y	a1ff 0 0 6 1792342268 0 0
+link	/usr/bin/y	/tmp/x
+entry	/usr/bin/ls	21a4 0 0 0 1792342268 0 0	/var/lib/containerd/snapshots/41/fs
+entry	/tmp	41ed 0 0 4096 1792342268 0 0
+entry	/tmp/x	89ed 1000 1000 5 1792342268 0 0
+hash	/tmp/x	886b6748
+entry	/opt/app	41ed 0 0 4096 1792342268 0 0	/var/lib/containerd/snapshots/40/fs
+opaque	/opt/app
+`)
+
+	drift := ParseDrift(output)
+	assert.Equal(t, 4242, drift.PID)
+	assert.Equal(t, "/var/lib/containerd/snapshots/42/fs", drift.UpperDir)
+	assert.Len(t, drift.LowerDirs, 2)
+
+	changes := map[string]Change{}
+	for _, c := range drift.Changes {
+		changes[c.Path] = c
+	}
+	require.Len(t, changes, 7)
+	assert.NotContains(t, changes, "/etc")
+
+	assert.Equal(t, ChangeModified, changes["/etc/hosts"].Change)
+	assert.True(t, changes["/etc/hosts"].MetadataOnly)
+	assert.Equal(t, ChangeModified, changes["/etc/passwd"].Change)
+	assert.False(t, changes["/etc/passwd"].MetadataOnly)
+	assert.Equal(t, "53175bcc", changes["/etc/passwd"].LowerSHA256)
+
+	assert.Equal(t, ChangeAdded, changes["/usr/bin/y"].Change)
+	assert.Equal(t, "symlink", changes["/usr/bin/y"].Type)
+	assert.Equal(t, "/tmp/x", changes["/usr/bin/y"].Target)
+
+	assert.Equal(t, ChangeDeleted, changes["/usr/bin/ls"].Change)
+	assert.Equal(t, "whiteout", changes["/usr/bin/ls"].Type)
+	assert.False(t, changes["/usr/bin/ls"].IsRegular())
+
+	x := changes["/tmp/x"]
+	assert.Equal(t, ChangeAdded, x.Change)
+	assert.Equal(t, "urwxr-xr-x", x.Mode)
+	assert.Equal(t, 1000, x.UID)
+	assert.Equal(t, int64(5), x.Size)
+	assert.Equal(t, int64(1792342268), x.ModTime.Unix())
+	assert.True(t, x.IsRegular())
+
+	assert.Equal(t, ChangeAdded, changes["/tmp"].Change)
+	assert.Equal(t, ChangeOpaque, changes["/opt/app"].Change)
+}
+
+func TestParseDriftWarning(t *testing.T) {
+	drift := ParseDrift([]byte("warn\tno running process found for container abc\n"))
+	assert.Equal(t, []string{"no running process found for container abc"}, drift.Warnings)
+	assert.Empty(t, drift.Changes)
+
+	drift = ParseDrift([]byte("unavailable\topaque\tgetfattr is not available\n"))
+	assert.Equal(t, []string{ChangeOpaque}, drift.Unavailable)
+	assert.Equal(t, []string{"getfattr is not available"}, drift.Warnings)
+}
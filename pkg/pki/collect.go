@@ -0,0 +1,43 @@
+package pki
+
+import (
+	"path"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// DefaultPaths are the host directories holding the certificates and
+// kubeconfigs of the Kubernetes components.
+var DefaultPaths = []string{"/etc/kubernetes", "/var/lib/kubelet/pki"}
+
+// maxFileSize skips the large files of the scanned directories, certificate
+// bundles and kubeconfigs are far smaller.
+const maxFileSize = "1024k"
+
+// CollectScript prints the files below paths holding PEM certificates or
+// kubeconfig embedded ones, base64 encoded. Private keys, client keys and
+// tokens are removed on the node and never leave it.
+func CollectScript(paths []string) string {
+	var roots []string
+	for _, p := range paths {
+		roots = append(roots, tasks.HostRoot+path.Clean("/"+p))
+	}
+	return `
+for root in ` + shell.Join(roots) + `; do
+  if [ ! -d "$root" ]; then
+    printf 'warning\t%s does not exist\n' "${root#` + tasks.HostRoot + `}"
+    continue
+  fi
+  find "$root" -type f -size -` + maxFileSize + ` 2>/dev/null | while IFS= read -r f; do
+    grep -q -e 'BEGIN CERTIFICATE' -e 'certificate-authority-data' -e 'client-certificate-data' "$f" 2>/dev/null || continue
+    data=$(awk '
+      /-----BEGIN .*PRIVATE KEY-----/ { skip = 1 }
+      !skip && !/^[ \t]*(client-key-data|token):/ { print }
+      /-----END .*PRIVATE KEY-----/ { skip = 0 }
+    ' "$f" | base64 | tr -d '\n')
+    printf 'file\t%s\t%s\n' "${f#` + tasks.HostRoot + `}" "$data"
+  done
+done
+`
+}
@@ -0,0 +1,330 @@
+// Package pki inventories the certificates of the nodes, builds their CA
+// chains and flags the ones an attacker may have issued or planted.
+package pki
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/baseline"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Flags of a certificate.
+const (
+	FlagExpired  = "expired"
+	FlagExpiring = "expiring"
+	// FlagUntrusted is set on certificates not chaining to a cluster CA.
+	FlagUntrusted = "untrusted"
+	// FlagSelfSigned is set on self-signed certificates that are not a CA,
+	// like the serving certificate a kubelet generates by default.
+	FlagSelfSigned = "self-signed"
+	// FlagRecentAdmin is set on certificates recently issued to an admin
+	// group.
+	FlagRecentAdmin = "recent-admin"
+	// FlagCAMismatch is set on the kubeadm CA files of a node that differ
+	// from the CAs the API server publishes or, for the etcd CA, from the
+	// etcd CA of another node.
+	FlagCAMismatch = "ca-mismatch"
+)
+
+// AdminGroups are the groups bound to cluster-admin by default, certificates
+// carry their groups as organizations.
+var AdminGroups = []string{"system:masters", "kubeadm:cluster-admins"}
+
+// PublishedCAFiles are the CAs kubeadm generates that the API server
+// publishes. Nodes are not trusted with them, their copies are checked
+// against the published ones.
+var PublishedCAFiles = []string{
+	"/etc/kubernetes/pki/ca.crt",
+	"/etc/kubernetes/pki/front-proxy-ca.crt",
+}
+
+// EtcdCAFile is the etcd CA kubeadm generates on the control plane nodes. The
+// API server does not publish it, it is trusted when every node holding it
+// has the same one.
+const EtcdCAFile = "/etc/kubernetes/pki/etcd/ca.crt"
+
+// Certificate is a certificate found on a node.
+type Certificate struct {
+	Node string `json:"node,omitempty"`
+	Path string `json:"path"`
+	// Source tells the kubeconfig entry the certificate is embedded in.
+	Source         string    `json:"source,omitempty"`
+	Subject        string    `json:"subject"`
+	CommonName     string    `json:"commonName,omitempty"`
+	Groups         []string  `json:"groups,omitempty"`
+	SANs           []string  `json:"sans,omitempty"`
+	Issuer         string    `json:"issuer"`
+	IsCA           bool      `json:"isCA"`
+	KeyUsage       []string  `json:"keyUsage,omitempty"`
+	ExtKeyUsage    []string  `json:"extKeyUsage,omitempty"`
+	NotBefore      time.Time `json:"notBefore"`
+	NotAfter       time.Time `json:"notAfter"`
+	SHA256         string    `json:"sha256"`
+	SubjectKeyID   string    `json:"subjectKeyID,omitempty"`
+	AuthorityKeyID string    `json:"authorityKeyID,omitempty"`
+	// Chain lists the issuers of the certificate up to its root.
+	Chain []string `json:"chain,omitempty"`
+	Flags []string `json:"flags,omitempty"`
+
+	cert *x509.Certificate
+}
+
+// Name returns the common name of the certificate, or its subject.
+func (c *Certificate) Name() string {
+	if c.CommonName != "" {
+		return c.CommonName
+	}
+	return c.Subject
+}
+
+// ParsePEM returns the certificates of PEM data.
+func ParsePEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return certs, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// Parse returns the certificates of PEM files and of the certificates
+// embedded in kubeconfigs.
+func Parse(files []baseline.File) ([]Certificate, []string) {
+	var (
+		certs    []Certificate
+		warnings []string
+	)
+	add := func(f *baseline.File, source string, data []byte) {
+		parsed, err := ParsePEM(data)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to parse a certificate of %s: %s", f.Path, err))
+		}
+		for _, c := range parsed {
+			certs = append(certs, newCertificate(f.Path, source, c))
+		}
+	}
+	for i := range files {
+		f := &files[i]
+		if bytes.Contains(f.Data, []byte("-----BEGIN CERTIFICATE-----")) {
+			add(f, "", f.Data)
+			continue
+		}
+		config, err := clientcmd.Load(f.Data)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("failed to parse %s as a kubeconfig: %s", f.Path, err))
+			continue
+		}
+		for _, name := range sortedKeys(config.Clusters) {
+			add(f, "cluster "+name, config.Clusters[name].CertificateAuthorityData)
+		}
+		for _, name := range sortedKeys(config.AuthInfos) {
+			add(f, "user "+name, config.AuthInfos[name].ClientCertificateData)
+		}
+	}
+	return certs, warnings
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newCertificate(path, source string, c *x509.Certificate) Certificate {
+	cert := Certificate{
+		Path:           path,
+		Source:         source,
+		Subject:        c.Subject.String(),
+		CommonName:     c.Subject.CommonName,
+		Groups:         c.Subject.Organization,
+		SANs:           append([]string{}, c.DNSNames...),
+		Issuer:         c.Issuer.String(),
+		IsCA:           c.IsCA,
+		KeyUsage:       keyUsages(c.KeyUsage),
+		NotBefore:      c.NotBefore.UTC(),
+		NotAfter:       c.NotAfter.UTC(),
+		SHA256:         fingerprint(c),
+		SubjectKeyID:   hex.EncodeToString(c.SubjectKeyId),
+		AuthorityKeyID: hex.EncodeToString(c.AuthorityKeyId),
+		cert:           c,
+	}
+	for _, ip := range c.IPAddresses {
+		cert.SANs = append(cert.SANs, ip.String())
+	}
+	for _, u := range c.ExtKeyUsage {
+		cert.ExtKeyUsage = append(cert.ExtKeyUsage, extKeyUsageNames[u])
+	}
+	return cert
+}
+
+var keyUsageNames = []struct {
+	usage x509.KeyUsage
+	name  string
+}{
+	{x509.KeyUsageDigitalSignature, "digitalSignature"},
+	{x509.KeyUsageContentCommitment, "contentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "keyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "dataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "keyAgreement"},
+	{x509.KeyUsageCertSign, "certSign"},
+	{x509.KeyUsageCRLSign, "crlSign"},
+	{x509.KeyUsageEncipherOnly, "encipherOnly"},
+	{x509.KeyUsageDecipherOnly, "decipherOnly"},
+}
+
+func keyUsages(usage x509.KeyUsage) []string {
+	var names []string
+	for _, u := range keyUsageNames {
+		if usage&u.usage != 0 {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "any",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "ocspSigning",
+}
+
+// Options tunes the analysis of the certificates.
+type Options struct {
+	// ClusterCAs are the CAs the API server publishes and the ones given
+	// by the user, the only CAs trusted besides the etcd CA.
+	ClusterCAs []*x509.Certificate
+	Now        time.Time
+	// Recent is how long ago an admin certificate counts as recently
+	// issued.
+	Recent time.Duration
+	// Expiring is how soon a certificate counts as expiring.
+	Expiring time.Duration
+}
+
+// Analyze builds the chains of the certificates, against every CA found and
+// the cluster CAs, and flags them. Only the cluster CAs are trusted, and the
+// etcd CA when the nodes agree on it.
+func Analyze(certs []Certificate, opts Options) {
+	trusted := map[string]bool{}
+	var cas []*x509.Certificate
+	addCA := func(c *x509.Certificate) {
+		if !slices.ContainsFunc(cas, c.Equal) {
+			cas = append(cas, c)
+		}
+	}
+	for _, c := range opts.ClusterCAs {
+		trusted[fingerprint(c)] = true
+		addCA(c)
+	}
+	etcdCAs := map[string]bool{}
+	for _, c := range certs {
+		if c.IsCA {
+			addCA(c.cert)
+			if c.Path == EtcdCAFile && c.Source == "" {
+				etcdCAs[c.SHA256] = true
+			}
+		}
+	}
+	if len(etcdCAs) == 1 {
+		for sum := range etcdCAs {
+			trusted[sum] = true
+		}
+	}
+
+	for i := range certs {
+		c := &certs[i]
+		chain, chained := buildChain(c.cert, cas, trusted)
+		for _, issuer := range chain {
+			name := issuer.Subject.CommonName
+			if name == "" {
+				name = issuer.Subject.String()
+			}
+			c.Chain = append(c.Chain, name)
+		}
+
+		c.Flags = nil
+		if c.IsCA && c.Source == "" && (slices.Contains(PublishedCAFiles, c.Path) || c.Path == EtcdCAFile) && !trusted[c.SHA256] {
+			c.Flags = append(c.Flags, FlagCAMismatch)
+		}
+		switch {
+		case opts.Now.After(c.NotAfter):
+			c.Flags = append(c.Flags, FlagExpired)
+		case opts.Now.Add(opts.Expiring).After(c.NotAfter):
+			c.Flags = append(c.Flags, FlagExpiring)
+		}
+		switch {
+		case chained:
+		case !c.IsCA && selfSigned(c.cert):
+			c.Flags = append(c.Flags, FlagSelfSigned)
+		default:
+			c.Flags = append(c.Flags, FlagUntrusted)
+		}
+		if opts.Now.Sub(c.NotBefore) <= opts.Recent && slices.ContainsFunc(c.Groups, func(g string) bool {
+			return slices.Contains(AdminGroups, g)
+		}) {
+			c.Flags = append(c.Flags, FlagRecentAdmin)
+		}
+	}
+}
+
+// buildChain follows the issuers of a certificate through cas and reports
+// whether one of them, or the certificate itself, is trusted.
+func buildChain(cert *x509.Certificate, cas []*x509.Certificate, trusted map[string]bool) ([]*x509.Certificate, bool) {
+	var chain []*x509.Certificate
+	current := cert
+	for {
+		if trusted[fingerprint(current)] {
+			return chain, true
+		}
+		if selfSigned(current) || len(chain) > len(cas) {
+			return chain, false
+		}
+		var issuer *x509.Certificate
+		for _, ca := range cas {
+			if !ca.Equal(current) && current.CheckSignatureFrom(ca) == nil {
+				issuer = ca
+				break
+			}
+		}
+		if issuer == nil {
+			return chain, false
+		}
+		chain = append(chain, issuer)
+		current = issuer
+	}
+}
+
+func fingerprint(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func selfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil
+}
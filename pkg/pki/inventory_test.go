@@ -0,0 +1,184 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/baseline"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func issue(t *testing.T, template *x509.Certificate, parent *issued) *issued {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if template.NotAfter.IsZero() {
+		template.NotAfter = now.AddDate(1, 0, 0)
+	}
+	if template.IsCA {
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &issued{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func TestAnalyze(t *testing.T) {
+	ca := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "kubernetes"}, NotBefore: now.AddDate(-1, 0, 0), IsCA: true}, nil)
+	intermediate := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "intermediate"}, NotBefore: now.AddDate(-1, 0, 0), IsCA: true}, ca)
+	apiserver := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "kube-apiserver"},
+		DNSNames:    []string{"kubernetes", "kubernetes.default"},
+		NotBefore:   now.AddDate(-1, 0, 0),
+		NotAfter:    now.AddDate(0, 0, 10),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, intermediate)
+	admin := issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "backdoor", Organization: []string{"system:masters"}},
+		NotBefore:   now.AddDate(0, 0, -2),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+	rogueCA := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "rogue"}, NotBefore: now.AddDate(0, 0, -5), IsCA: true}, nil)
+	rogue := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "rogue-client"}, NotBefore: now.AddDate(0, 0, -5), NotAfter: now.AddDate(0, 0, -1)}, rogueCA)
+	kubelet := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "worker-1@1700000000"}, NotBefore: now.AddDate(-1, 0, 0)}, nil)
+
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: kubernetes
+  cluster:
+    server: https://10.0.0.10:6443
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString(ca.pem) + `
+users:
+- name: kubernetes-admin
+  user:
+    client-certificate-data: ` + base64.StdEncoding.EncodeToString(admin.pem) + `
+contexts:
+- name: kubernetes-admin@kubernetes
+  context:
+    cluster: kubernetes
+    user: kubernetes-admin
+`
+	certs, warnings := Parse([]baseline.File{
+		{Path: "/etc/kubernetes/pki/ca.crt", Data: ca.pem},
+		{Path: "/etc/kubernetes/pki/apiserver.crt", Data: append(append([]byte{}, apiserver.pem...), intermediate.pem...)},
+		{Path: "/etc/kubernetes/admin.conf", Data: []byte(kubeconfig)},
+		{Path: "/etc/kubernetes/rogue.pem", Data: append(append([]byte{}, rogue.pem...), rogueCA.pem...)},
+		{Path: "/var/lib/kubelet/pki/kubelet.crt", Data: kubelet.pem},
+		{Path: "/etc/kubernetes/notes.txt", Data: []byte("certificate-authority-data: [")},
+	})
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "failed to parse /etc/kubernetes/notes.txt as a kubeconfig")
+	require.Len(t, certs, 8)
+
+	Analyze(certs, Options{ClusterCAs: []*x509.Certificate{ca.cert}, Now: now, Recent: 7 * 24 * time.Hour, Expiring: 30 * 24 * time.Hour})
+	byName := map[string]Certificate{}
+	for _, c := range certs {
+		byName[c.Path+"|"+c.Source+"|"+c.Name()] = c
+	}
+
+	c := byName["/etc/kubernetes/pki/ca.crt||kubernetes"]
+	assert.True(t, c.IsCA)
+	assert.Empty(t, c.Chain)
+	assert.Empty(t, c.Flags)
+
+	c = byName["/etc/kubernetes/pki/apiserver.crt||kube-apiserver"]
+	assert.Equal(t, []string{"kubernetes", "kubernetes.default"}, c.SANs)
+	assert.Equal(t, "CN=intermediate", c.Issuer)
+	assert.Equal(t, []string{"digitalSignature"}, c.KeyUsage)
+	assert.Equal(t, []string{"serverAuth"}, c.ExtKeyUsage)
+	assert.Equal(t, []string{"intermediate", "kubernetes"}, c.Chain)
+	assert.Equal(t, []string{FlagExpiring}, c.Flags)
+	assert.Len(t, c.SHA256, 64)
+
+	c = byName["/etc/kubernetes/admin.conf|cluster kubernetes|kubernetes"]
+	assert.Empty(t, c.Flags)
+	c = byName["/etc/kubernetes/admin.conf|user kubernetes-admin|backdoor"]
+	assert.Equal(t, []string{"system:masters"}, c.Groups)
+	assert.Equal(t, []string{"kubernetes"}, c.Chain)
+	assert.Equal(t, []string{FlagRecentAdmin}, c.Flags)
+
+	c = byName["/etc/kubernetes/rogue.pem||rogue-client"]
+	assert.Equal(t, []string{"rogue"}, c.Chain)
+	assert.Equal(t, []string{FlagExpired, FlagUntrusted}, c.Flags)
+	assert.Equal(t, []string{FlagUntrusted}, byName["/etc/kubernetes/rogue.pem||rogue"].Flags)
+
+	assert.Equal(t, []string{FlagSelfSigned}, byName["/var/lib/kubelet/pki/kubelet.crt||worker-1@1700000000"].Flags)
+
+	// A CA given by the cluster is trusted wherever it is found.
+	Analyze(certs, Options{Now: now, ClusterCAs: []*x509.Certificate{ca.cert, rogueCA.cert}})
+	assert.NotContains(t, certs[5].Flags, FlagUntrusted)
+}
+
+func TestAnalyzeNodeCAs(t *testing.T) {
+	ca := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "kubernetes"}, NotBefore: now.AddDate(-1, 0, 0), IsCA: true}, nil)
+	plantedCA := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "kubernetes"}, NotBefore: now.AddDate(0, 0, -1), IsCA: true}, nil)
+	planted := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "admin", Organization: []string{"system:masters"}}, NotBefore: now.AddDate(0, 0, -1)}, plantedCA)
+	etcdCA := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "etcd-ca"}, NotBefore: now.AddDate(-1, 0, 0), IsCA: true}, nil)
+	etcdServer := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "cp-1"}, NotBefore: now.AddDate(-1, 0, 0)}, etcdCA)
+	otherEtcdCA := issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "etcd-ca"}, NotBefore: now.AddDate(0, 0, -1), IsCA: true}, nil)
+
+	parse := func(node string, files ...baseline.File) []Certificate {
+		certs, warnings := Parse(files)
+		require.Empty(t, warnings)
+		for i := range certs {
+			certs[i].Node = node
+		}
+		return certs
+	}
+	certs := parse("cp-1",
+		baseline.File{Path: "/etc/kubernetes/pki/ca.crt", Data: ca.pem},
+		baseline.File{Path: EtcdCAFile, Data: etcdCA.pem},
+		baseline.File{Path: "/etc/kubernetes/pki/etcd/server.crt", Data: etcdServer.pem},
+	)
+	certs = append(certs, parse("cp-2",
+		baseline.File{Path: "/etc/kubernetes/pki/ca.crt", Data: plantedCA.pem},
+		baseline.File{Path: EtcdCAFile, Data: etcdCA.pem},
+		baseline.File{Path: "/etc/kubernetes/admin.pem", Data: planted.pem},
+	)...)
+	require.Len(t, certs, 6)
+
+	// A CA planted at a kubeadm path is not trusted, on that node or any
+	// other.
+	Analyze(certs, Options{ClusterCAs: []*x509.Certificate{ca.cert}, Now: now})
+	assert.Empty(t, certs[0].Flags)
+	assert.Equal(t, []string{FlagCAMismatch, FlagUntrusted}, certs[3].Flags)
+	assert.Equal(t, []string{FlagUntrusted}, certs[5].Flags)
+
+	// The etcd CA is trusted while the control plane nodes agree on it.
+	assert.Empty(t, certs[1].Flags)
+	assert.Empty(t, certs[2].Flags)
+	assert.Empty(t, certs[4].Flags)
+
+	certs = append(certs, parse("cp-3", baseline.File{Path: EtcdCAFile, Data: otherEtcdCA.pem})...)
+	Analyze(certs, Options{ClusterCAs: []*x509.Certificate{ca.cert}, Now: now})
+	assert.Equal(t, []string{FlagCAMismatch, FlagUntrusted}, certs[1].Flags)
+	assert.Equal(t, []string{FlagUntrusted}, certs[2].Flags)
+	assert.Equal(t, []string{FlagCAMismatch, FlagUntrusted}, certs[6].Flags)
+}
@@ -0,0 +1,184 @@
+package procfs
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+)
+
+// ContainerInitScript is a script fragment setting $pid to the lowest host
+// PID running in the container, which is its init process unless PIDs
+// wrapped around. It prints a warning and exits when the container has no
+// running process.
+func ContainerInitScript(containerID string) string {
+	id := shell.Quote(containerID)
+	return `
+pid=$(for d in /proc/[0-9]*; do grep -q ` + id + ` "$d/cgroup" 2>/dev/null && echo "${d#/proc/}"; done | sort -n | head -n 1)
+if [ -z "$pid" ]; then
+  printf 'warn\tno running process found for container %s\n' ` + id + `
+  exit 0
+fi
+`
+}
+
+// NamespaceProcessesScript lists the processes sharing the PID namespace of
+// the container. Pods sharing their process namespace list the processes of
+// every container.
+func NamespaceProcessesScript(containerID string) string {
+	return ContainerInitScript(containerID) + `
+ns=$(readlink "/proc/$pid/ns/pid")
+[ "$ns" = "$(readlink /proc/1/ns/pid)" ] && printf 'warn\tthe container shares the PID namespace of the host\n'
+for d in /proc/[0-9]*; do
+  [ "$(readlink "$d/ns/pid" 2>/dev/null)" = "$ns" ] || continue
+  p=${d#/proc/}
+  st=$(awk '/^PPid:/ { pp = $2 } /^Uid:/ { u = $2 } /^NSpid:/ { n = $NF } END { printf "%s\t%s\t%s", n, pp, u }' "$d/status" 2>/dev/null) || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cg=$(tr '\n\t' ';;' < "$d/cgroup" 2>/dev/null)
+  exe=$(readlink "$d/exe" 2>/dev/null)
+  cmd=$(tr '\0\t\n' '   ' < "$d/cmdline" 2>/dev/null)
+  printf 'proc\t%s\t%s\t%s\t%s\t%s\t%s\n' "$p" "$st" "$comm" "$cg" "$exe" "$cmd"
+done
+`
+}
+
+// NamespaceProcess is a process of a container PID namespace.
+type NamespaceProcess struct {
+	PID       int    `json:"pid"`
+	NSPID     int    `json:"nsPid"`
+	PPID      int    `json:"ppid"`
+	UID       int    `json:"uid"`
+	Name      string `json:"name"`
+	Container string `json:"container,omitempty"`
+	Exe       string `json:"exe"`
+	Cmdline   string `json:"cmdline"`
+	Cgroup    string `json:"-"`
+}
+
+// ParseNamespaceProcesses parses the output of NamespaceProcessesScript and
+// returns the processes ordered by their PID inside the namespace.
+func ParseNamespaceProcesses(output []byte) ([]NamespaceProcess, []string) {
+	var procs []NamespaceProcess
+	var warnings []string
+
+	for _, r := range parseRecords(output) {
+		switch r.kind() {
+		case "warn":
+			warnings = append(warnings, strings.Join(r[1:], " "))
+		case "proc":
+			procs = append(procs, NamespaceProcess{
+				PID:     r.intField(0),
+				NSPID:   r.intField(1),
+				PPID:    r.intField(2),
+				UID:     r.intField(3),
+				Name:    r.field(4),
+				Cgroup:  r.field(5),
+				Exe:     r.field(6),
+				Cmdline: strings.TrimSpace(r.field(7)),
+			})
+		}
+	}
+
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].NSPID < procs[j].NSPID
+	})
+	return procs, warnings
+}
+
+// NetworkScript enters the network namespace of the container with nsenter
+// to list its addresses and routes with the tools of the forensic pod, then
+// dumps the sockets of every process of that namespace.
+func NetworkScript(containerID string) string {
+	return ContainerInitScript(containerID) + `
+ns=$(readlink "/proc/$pid/ns/net")
+[ "$ns" = "$(readlink /proc/1/ns/net)" ] && printf 'warn\tthe container uses the network namespace of the host\n'
+printf 'init\t%s\n' "$pid"
+nsenter -t "$pid" -n ip -o addr show 2>/dev/null | awk '{ printf "addr\t%s\t%s\t%s\n", $2, $3, $4 }'
+nsenter -t "$pid" -n ip route show 2>/dev/null | awk '{ printf "route\t%s\n", $0 }'
+seen=" "
+for d in /proc/[0-9]*; do
+  [ "$(readlink "$d/ns/net" 2>/dev/null)" = "$ns" ] || continue
+  p=${d#/proc/}
+  printf 'proc\t%s\t%s\n' "$p" "$(cat "$d/comm" 2>/dev/null)"
+` + SocketsScript + `
+done
+`
+}
+
+// Address is an address of a network interface.
+type Address struct {
+	Interface string `json:"interface"`
+	Family    string `json:"family"`
+	Address   string `json:"address"`
+}
+
+// ProcessSocket is a socket held by a process.
+type ProcessSocket struct {
+	PID     int    `json:"pid"`
+	Process string `json:"process"`
+	Socket
+}
+
+// Network is the network namespace of a container.
+type Network struct {
+	PID       int             `json:"pid"`
+	Addresses []Address       `json:"addresses"`
+	Routes    []string        `json:"routes"`
+	Sockets   []ProcessSocket `json:"sockets"`
+	Warnings  []string        `json:"warnings,omitempty"`
+}
+
+// ParseNetwork parses the output of NetworkScript.
+func ParseNetwork(output []byte) Network {
+	network := Network{Addresses: []Address{}, Routes: []string{}, Sockets: []ProcessSocket{}}
+	names := map[int]string{}
+
+	for _, r := range parseRecords(output) {
+		switch r.kind() {
+		case "warn":
+			network.Warnings = append(network.Warnings, strings.Join(r[1:], " "))
+		case "init":
+			network.PID = r.intField(0)
+		case "addr":
+			network.Addresses = append(network.Addresses, Address{
+				Interface: r.field(0),
+				Family:    r.field(1),
+				Address:   r.field(2),
+			})
+		case "route":
+			network.Routes = append(network.Routes, strings.TrimSpace(r.field(0)))
+		case "proc":
+			names[r.intField(0)] = r.field(1)
+		}
+	}
+
+	for pid, sockets := range ParseSockets(output) {
+		for _, s := range sockets {
+			network.Sockets = append(network.Sockets, ProcessSocket{PID: pid, Process: names[pid], Socket: s})
+		}
+	}
+	sort.Slice(network.Sockets, func(i, j int) bool {
+		a, b := network.Sockets[i], network.Sockets[j]
+		if a.PID != b.PID {
+			return a.PID < b.PID
+		}
+		return a.Local.String() < b.Local.String()
+	})
+
+	return network
+}
+
+// RootShellScript opens an interactive shell of the forensic pod whose
+// working directory is the root of the container, as seen from its mount
+// namespace through /proc/PID/root. The tools of the forensic pod are used,
+// so images without a shell can be browsed too.
+func RootShellScript(containerID, ref string) string {
+	return ContainerInitScript(containerID) + `
+export ROOT=/proc/$pid/root
+cd "$ROOT" || exit 1
+printf 'Browsing the root filesystem of %s (PID %s) at %s.\n' ` + shell.Quote(ref) + ` "$pid" "$ROOT"
+printf 'Use relative paths, absolute paths refer to the forensic pod.\n'
+export PS1=` + shell.Quote(ref+` \w \$ `) + `
+exec sh -i
+`
+}
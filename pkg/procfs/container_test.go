@@ -0,0 +1,59 @@
+package procfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNamespaceProcesses(t *testing.T) {
+	output := []byte(`proc	4310	7	4242	0	sh	0::/kubepods/pod1234/cri-containerd-abc;	/bin/busybox	sh -c curl x | sh
+proc	4242	1	4200	65532	nginx	0::/kubepods/pod1234/cri-containerd-abc;	/usr/sbin/nginx	nginx -g daemon off;
+`)
+
+	procs, warnings := ParseNamespaceProcesses(output)
+	assert.Empty(t, warnings)
+	require.Len(t, procs, 2)
+	assert.Equal(t, NamespaceProcess{
+		PID:     4242,
+		NSPID:   1,
+		PPID:    4200,
+		UID:     65532,
+		Name:    "nginx",
+		Exe:     "/usr/sbin/nginx",
+		Cmdline: "nginx -g daemon off;",
+		Cgroup:  "0::/kubepods/pod1234/cri-containerd-abc;",
+	}, procs[0])
+	assert.Equal(t, 7, procs[1].NSPID)
+
+	_, warnings = ParseNamespaceProcesses([]byte("warn\tno running process found for container abc\n"))
+	assert.Equal(t, []string{"no running process found for container abc"}, warnings)
+}
+
+func TestParseNetwork(t *testing.T) {
+	output := []byte(`init	4242
+addr	lo	inet	127.0.0.1/8
+addr	eth0	inet	10.244.1.7/24
+route	default via 10.244.1.1 dev eth0
+proc	4242	nginx
+sockfd	4242	6	1001
+sockfd	4242	7	1002
+net	tcp	00000000:0050	00000000:0000	0A	1001
+net	tcp	0701F40A:0050	077100CB:D431	01	1002
+proc	4310	sh
+`)
+
+	network := ParseNetwork(output)
+	assert.Equal(t, 4242, network.PID)
+	assert.Equal(t, []Address{
+		{Interface: "lo", Family: "inet", Address: "127.0.0.1/8"},
+		{Interface: "eth0", Family: "inet", Address: "10.244.1.7/24"},
+	}, network.Addresses)
+	assert.Equal(t, []string{"default via 10.244.1.1 dev eth0"}, network.Routes)
+
+	require.Len(t, network.Sockets, 2)
+	assert.Equal(t, "nginx", network.Sockets[0].Process)
+	assert.Equal(t, "tcp 0.0.0.0:80 LISTEN", network.Sockets[0].String())
+	assert.Equal(t, "tcp 10.244.1.7:80 -> 203.0.113.7:54321 ESTABLISHED", network.Sockets[1].String())
+}
@@ -0,0 +1,212 @@
+package procfs
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+)
+
+// EnvironScript dumps the environment, the loaded shared libraries and the
+// ld.so.preload file of every process, together with its cgroup so findings
+// can be attributed to pods.
+const EnvironScript = `
+for d in /proc/[0-9]*; do
+  p=${d#/proc/}
+  [ -r "$d/environ" ] || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cg=$(tr '\n\t' ';;' < "$d/cgroup" 2>/dev/null)
+  printf 'proc\t%s\t%s\t%s\n' "$p" "$comm" "$cg"
+  tr '\0\t\n' '\n  ' < "$d/environ" 2>/dev/null | awk -v p="$p" 'NF { printf "env\t%s\t%s\n", p, $0 }'
+  awk -v p="$p" '$6 ~ /\.so/ && !seen[$6]++ { path = $6; for (i = 7; i <= NF; i++) path = path " " $i; printf "lib\t%s\t%s\n", p, path }' "$d/maps" 2>/dev/null
+  [ -s "$d/root/etc/ld.so.preload" ] && awk -v p="$p" 'NF && $1 !~ /^#/ { printf "preload\t%s\t%s\n", p, $0 }' "$d/root/etc/ld.so.preload" 2>/dev/null
+done
+`
+
+// Finding categories of the environment scanner.
+const (
+	CategoryLDInjection    = "ld-injection"
+	CategoryPreloadFile    = "ld.so.preload"
+	CategoryUnusualLibrary = "unusual-library"
+	CategoryProxy          = "proxy"
+	CategoryCredential     = "credential"
+)
+
+// ldVariables are the dynamic loader variables that inject code into a process.
+var ldVariables = map[string]string{
+	"LD_PRELOAD":      severity.High,
+	"LD_AUDIT":        severity.High,
+	"LD_LIBRARY_PATH": severity.Medium,
+}
+
+var proxyVariables = map[string]bool{
+	"HTTP_PROXY":  true,
+	"HTTPS_PROXY": true,
+	"ALL_PROXY":   true,
+	"FTP_PROXY":   true,
+}
+
+var credentialPattern = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|ACCESS_?KEY|PRIVATE_?KEY|CREDENTIAL|AUTH)`)
+
+// libraryPrefixes are the directories shared libraries are normally loaded from.
+var libraryPrefixes = []string{
+	"/lib/", "/lib32/", "/lib64/", "/libx32/",
+	"/usr/lib/", "/usr/lib32/", "/usr/lib64/", "/usr/libx32/", "/usr/libexec/",
+	"/usr/local/lib/", "/usr/local/lib64/", "/usr/share/",
+	"/opt/", "/snap/", "/nix/store/",
+}
+
+// EnvFinding is a suspicious environment variable or library shared by one or
+// more processes of the same cgroup.
+type EnvFinding struct {
+	Category string   `json:"category"`
+	Severity string   `json:"severity"`
+	Variable string   `json:"variable,omitempty"`
+	Value    string   `json:"value"`
+	PIDs     []int    `json:"pids"`
+	Names    []string `json:"names"`
+	Cgroup   string   `json:"cgroup,omitempty"`
+	Pod      string   `json:"pod,omitempty"`
+}
+
+// ScanEnviron parses the output of EnvironScript. Credential values, and
+// passwords embedded in proxy URLs, are redacted unless showSecrets is set.
+func ScanEnviron(output []byte, showSecrets bool) []EnvFinding {
+	type procInfo struct {
+		name, cgroup string
+	}
+	procs := map[int]procInfo{}
+	findings := map[string]*EnvFinding{}
+	var order []string
+
+	add := func(pid int, category, level, variable, value string) {
+		p := procs[pid]
+		key := strings.Join([]string{p.cgroup, category, variable, value}, "\x00")
+		f, ok := findings[key]
+		if !ok {
+			f = &EnvFinding{
+				Category: category,
+				Severity: level,
+				Variable: variable,
+				Value:    value,
+				Cgroup:   p.cgroup,
+			}
+			findings[key] = f
+			order = append(order, key)
+		}
+		f.PIDs = append(f.PIDs, pid)
+		if !slices.Contains(f.Names, p.name) {
+			f.Names = append(f.Names, p.name)
+		}
+	}
+
+	for _, r := range parseRecords(output) {
+		pid := r.intField(0)
+		switch r.kind() {
+		case "proc":
+			procs[pid] = procInfo{name: r.field(1), cgroup: r.field(2)}
+		case "env":
+			name, value, _ := strings.Cut(r.field(1), "=")
+			upper := strings.ToUpper(name)
+			switch {
+			case ldVariables[upper] != "":
+				add(pid, CategoryLDInjection, ldVariables[upper], name, value)
+			case proxyVariables[upper]:
+				if !showSecrets {
+					value = redactURLPassword(value)
+				}
+				add(pid, CategoryProxy, severity.Low, name, value)
+			case credentialPattern.MatchString(name) && value != "":
+				if !showSecrets {
+					value = Redact(value)
+				}
+				add(pid, CategoryCredential, severity.Low, name, value)
+			}
+		case "lib":
+			path := r.field(1)
+			if reason := classifyPath(path); reason != "" {
+				add(pid, CategoryUnusualLibrary, severity.High, "", path)
+			} else if !hasAnyPrefix(path, libraryPrefixes) {
+				add(pid, CategoryUnusualLibrary, severity.Medium, "", path)
+			}
+		case "preload":
+			add(pid, CategoryPreloadFile, severity.High, "", r.field(1))
+		}
+	}
+
+	result := make([]EnvFinding, 0, len(order))
+	for _, key := range order {
+		result = append(result, *findings[key])
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return severity.Rank(result[i].Severity) > severity.Rank(result[j].Severity)
+	})
+
+	return result
+}
+
+// redactKey keys the fingerprints of redacted secrets. It is drawn for every
+// run, fingerprints can be compared within a report but not reversed with a
+// dictionary of likely secrets.
+var redactKey = newRedactKey()
+
+func newRedactKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("failed to generate the redaction key: " + err.Error())
+	}
+	return key
+}
+
+// Redact replaces a secret with a short keyed fingerprint, so that equal
+// secrets can still be correlated within a run without revealing them.
+func Redact(value string) string {
+	mac := hmac.New(sha256.New, redactKey)
+	mac.Write([]byte(value))
+	return "<redacted hmac:" + hex.EncodeToString(mac.Sum(nil))[:12] + ">"
+}
+
+// redactURLPassword redacts the password of a proxy URL, which is often given
+// without a scheme. Values that do not parse as a URL are redacted whole.
+func redactURLPassword(value string) string {
+	raw := value
+	schemeless := !strings.Contains(value, "://")
+	if schemeless {
+		raw = "http://" + value
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Opaque != "" {
+		return Redact(value)
+	}
+	if u.User == nil {
+		if strings.Contains(value, "@") {
+			return Redact(value)
+		}
+		return value
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "REDACTED")
+	}
+	s := u.String()
+	if schemeless {
+		s = strings.TrimPrefix(s, "http://")
+	}
+	return s
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package procfs
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// upperDirAwk prints the overlayfs upper directory of the root mount found in
+// a mountinfo file, which is the writable layer of a container.
+const upperDirAwk = `awk '$5=="/" { for (i = 7; i <= NF; i++) if ($i == "-") { if ($(i+1) == "overlay") { n = split($(i+3), o, ","); for (j = 1; j <= n; j++) if (o[j] ~ /^upperdir=/) { sub(/^upperdir=/, "", o[j]); print o[j] } } break } }'`
+
+// FilelessScript reads the executable and the executable mappings of every
+// process. For processes inside a container it also checks whether the
+// executable exists in the writable overlay layer of the container.
+const FilelessScript = `
+for d in /proc/[0-9]*; do
+  p=${d#/proc/}
+  exe=$(readlink "$d/exe" 2>/dev/null)
+  [ -n "$exe" ] || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cmd=$(tr '\0\t\n' '   ' < "$d/cmdline" 2>/dev/null)
+  upper=$(` + upperDirAwk + ` "$d/mountinfo" 2>/dev/null | head -n 1)
+  inupper=0
+  case "$exe" in
+    *" (deleted)") ;;
+    *) [ -n "$upper" ] && [ -e "` + tasks.HostRoot + `$upper$exe" ] && inupper=1 ;;
+  esac
+  printf 'exe\t%s\t%s\t%s\t%s\t%s\t%s\n' "$p" "$comm" "$exe" "$upper" "$inupper" "$cmd"
+  awk -v p="$p" '$2 ~ /x/ {
+    if (NF == 5) { anon++; next }
+    path = $6; for (i = 7; i <= NF; i++) path = path " " $i
+    printf "map\t%s\t%s\t%s\t%s\n", p, $1, $2, path
+  } END { if (anon) printf "anon\t%s\t%d\n", p, anon }' "$d/maps" 2>/dev/null
+done
+`
+
+// Reasons reported for fileless executables.
+const (
+	ReasonDeleted      = "deleted"
+	ReasonMemfd        = "memfd"
+	ReasonTmpfs        = "tmpfs"
+	ReasonOverlayUpper = "overlay-upper"
+)
+
+// tmpfsPrefixes are the usual world writable, often memory backed, locations
+// that legitimate software hardly ever executes from.
+var tmpfsPrefixes = []string{"/tmp/", "/dev/shm/", "/var/tmp/", "/run/user/"}
+
+// Mapping is an executable memory mapping of a process.
+type Mapping struct {
+	Range  string `json:"range"`
+	Perms  string `json:"perms"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// FilelessProcess is a process whose executable, or one of its executable
+// mappings, does not come from a regular file of the image or host.
+type FilelessProcess struct {
+	PID             int       `json:"pid"`
+	Name            string    `json:"name"`
+	Exe             string    `json:"exe"`
+	Cmdline         string    `json:"cmdline"`
+	UpperDir        string    `json:"upperDir,omitempty"`
+	Reasons         []string  `json:"reasons"`
+	Mappings        []Mapping `json:"mappings,omitempty"`
+	AnonExecRegions int       `json:"anonExecRegions,omitempty"`
+}
+
+// classifyPath returns why path is suspicious as executable backing, or an
+// empty string if it is not.
+func classifyPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/memfd:"):
+		return ReasonMemfd
+	case strings.HasSuffix(path, " (deleted)"):
+		return ReasonDeleted
+	}
+	if hasAnyPrefix(path, tmpfsPrefixes) {
+		return ReasonTmpfs
+	}
+	return ""
+}
+
+// FindFilelessProcesses parses the output of FilelessScript and returns the
+// processes running from deleted, memfd, tmpfs or container upper layer
+// executables, or mapping executable code from such files.
+func FindFilelessProcesses(output []byte) []FilelessProcess {
+	procs := map[int]*FilelessProcess{}
+	var order []int
+
+	for _, r := range parseRecords(output) {
+		pid := r.intField(0)
+		switch r.kind() {
+		case "exe":
+			p := &FilelessProcess{
+				PID:      pid,
+				Name:     r.field(1),
+				Exe:      r.field(2),
+				UpperDir: r.field(3),
+				Cmdline:  r.field(5),
+			}
+			if reason := classifyPath(p.Exe); reason != "" {
+				p.Reasons = append(p.Reasons, reason)
+			}
+			if r.field(4) == "1" {
+				p.Reasons = append(p.Reasons, ReasonOverlayUpper)
+			}
+			procs[pid] = p
+			order = append(order, pid)
+		case "map":
+			p, ok := procs[pid]
+			if !ok {
+				continue
+			}
+			path := r.field(3)
+			reason := classifyPath(path)
+			if reason == "" || path == p.Exe {
+				continue
+			}
+			p.Mappings = append(p.Mappings, Mapping{
+				Range:  r.field(1),
+				Perms:  r.field(2),
+				Path:   path,
+				Reason: reason,
+			})
+			if !slices.Contains(p.Reasons, "mapped-"+reason) {
+				p.Reasons = append(p.Reasons, "mapped-"+reason)
+			}
+		case "anon":
+			if p, ok := procs[pid]; ok {
+				p.AnonExecRegions = r.intField(1)
+			}
+		}
+	}
+
+	var found []FilelessProcess
+	for _, pid := range order {
+		if p := procs[pid]; len(p.Reasons) > 0 {
+			found = append(found, *p)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].PID < found[j].PID
+	})
+
+	return found
+}
+
+// ExeHashScript prints the SHA-256 of the executable of pid as seen through
+// /proc, which works for deleted and memfd executables too.
+func ExeHashScript(pid int) string {
+	return fmt.Sprintf("sha256sum /proc/%d/exe | cut -d ' ' -f 1", pid)
+}
+
+// ExeCopyScript writes the executable of pid to standard output.
+func ExeCopyScript(pid int) string {
+	return fmt.Sprintf("cat /proc/%d/exe", pid)
+}
@@ -0,0 +1,35 @@
+package procfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindFilelessProcesses(t *testing.T) {
+	output := []byte(`exe	1	systemd	/usr/lib/systemd/systemd		0	/sbin/init
+map	1	55d0-55e0	r-xp	/usr/lib/systemd/systemd
+exe	200	kdevtmpfsi	/tmp/kdevtmpfsi (deleted)		0	kdevtmpfsi
+map	200	1000-2000	r-xp	/tmp/kdevtmpfsi (deleted)
+exe	300	x	/memfd:x (deleted)		0	x
+exe	400	nginx	/usr/sbin/nginx	/var/lib/containerd/snap/42/fs	1	nginx
+exe	500	java	/usr/bin/java		0	java -jar app.jar
+map	500	3000-4000	r-xp	/dev/shm/libinject.so
+anon	500	12
+`)
+
+	found := FindFilelessProcesses(output)
+	assert.Len(t, found, 4)
+
+	assert.Equal(t, 200, found[0].PID)
+	assert.Equal(t, []string{ReasonDeleted}, found[0].Reasons)
+	assert.Empty(t, found[0].Mappings)
+
+	assert.Equal(t, []string{ReasonMemfd}, found[1].Reasons)
+	assert.Equal(t, []string{ReasonOverlayUpper}, found[2].Reasons)
+	assert.Equal(t, "/var/lib/containerd/snap/42/fs", found[2].UpperDir)
+
+	assert.Equal(t, []string{"mapped-" + ReasonTmpfs}, found[3].Reasons)
+	assert.Equal(t, "/dev/shm/libinject.so", found[3].Mappings[0].Path)
+	assert.Equal(t, 12, found[3].AnonExecRegions)
+}
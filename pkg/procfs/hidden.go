@@ -0,0 +1,229 @@
+package procfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// HiddenScript compares four independent views of the running processes:
+// the readdir listing of /proc (taken before and after the scan), direct probing
+// of every PID up to pid_max, the task directories of every listed process and
+// the cgroup.procs files of the host cgroup hierarchy.
+const HiddenScript = `
+max=$(cat /proc/sys/kernel/pid_max)
+for d in /proc/[0-9]*; do printf 'readdir\t%s\n' "${d#/proc/}"; done
+i=1
+while [ "$i" -le "$max" ]; do
+  if [ -e "/proc/$i/status" ]; then
+    name= tgid= ppid= uid=
+    while read -r k v rest; do
+      case "$k" in
+        Name:) name="$v${rest:+ $rest}" ;;
+        Tgid:) tgid=$v ;;
+        PPid:) ppid=$v ;;
+        Uid:) uid=$v ;;
+      esac
+    done < "/proc/$i/status" 2>/dev/null
+    printf 'probe\t%s\t%s\t%s\t%s\t%s\n' "$i" "$tgid" "$ppid" "$uid" "$name"
+    if [ "$tgid" = "$i" ]; then
+      exe=$(readlink "/proc/$i/exe" 2>/dev/null)
+      cmd=$(tr '\0\t\n' '   ' < "/proc/$i/cmdline" 2>/dev/null)
+      printf 'meta\t%s\t%s\t%s\n' "$i" "$exe" "$cmd"
+    fi
+  fi
+  i=$((i+1))
+done
+for d in /proc/[0-9]*; do
+  for t in "$d"/task/[0-9]*; do printf 'task\t%s\t%s\n' "${d#/proc/}" "${t##*/}"; done
+done
+find ` + tasks.HostRoot + `/sys/fs/cgroup -name cgroup.procs 2>/dev/null | while read -r f; do
+  while read -r p; do printf 'cgroup\t%s\t%s\n' "$p" "${f#` + tasks.HostRoot + `/sys/fs/cgroup}"; done < "$f"
+done
+for d in /proc/[0-9]*; do printf 'readdir\t%s\n' "${d#/proc/}"; done
+`
+
+// PID sources compared by the hidden process detection.
+const (
+	SourceReaddir = "readdir"
+	SourceProbe   = "probe"
+	SourceTask    = "task"
+	SourceCgroup  = "cgroup"
+)
+
+// HiddenProcess is a PID that is visible through at least one source but
+// missing from another source that should have reported it.
+type HiddenProcess struct {
+	PID         int      `json:"pid"`
+	TGID        int      `json:"tgid,omitempty"`
+	PPID        int      `json:"ppid,omitempty"`
+	UID         string   `json:"uid,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Exe         string   `json:"exe,omitempty"`
+	Cmdline     string   `json:"cmdline,omitempty"`
+	Cgroup      string   `json:"cgroup,omitempty"`
+	SeenIn      []string `json:"seenIn"`
+	MissingFrom []string `json:"missingFrom"`
+	Reason      string   `json:"reason"`
+	Verified    bool     `json:"verified"`
+}
+
+type probedPID struct {
+	tgid, ppid   int
+	uid, name    string
+	exe, cmdline string
+}
+
+// FindHiddenProcesses parses the output of HiddenScript and returns every
+// inconsistency between the sources, ordered by PID.
+func FindHiddenProcesses(output []byte) []HiddenProcess {
+	readdir := map[int]bool{}
+	probed := map[int]*probedPID{}
+	tasks := map[int]map[int]bool{}
+	cgroups := map[int]string{}
+
+	for _, r := range parseRecords(output) {
+		switch r.kind() {
+		case SourceReaddir:
+			readdir[r.intField(0)] = true
+		case SourceProbe:
+			probed[r.intField(0)] = &probedPID{
+				tgid: r.intField(1),
+				ppid: r.intField(2),
+				uid:  r.field(3),
+				name: r.field(4),
+			}
+		case "meta":
+			if p, ok := probed[r.intField(0)]; ok {
+				p.exe = r.field(1)
+				p.cmdline = r.field(2)
+			}
+		case SourceTask:
+			tgid := r.intField(0)
+			if tasks[tgid] == nil {
+				tasks[tgid] = map[int]bool{}
+			}
+			tasks[tgid][r.intField(1)] = true
+		case SourceCgroup:
+			cgroups[r.intField(0)] = r.field(1)
+		}
+	}
+
+	var hidden []HiddenProcess
+	for pid, p := range probed {
+		cgroup, inCgroup := cgroups[pid]
+		if !inCgroup {
+			cgroup = cgroups[p.tgid]
+		}
+		h := HiddenProcess{
+			PID:     pid,
+			TGID:    p.tgid,
+			PPID:    p.ppid,
+			UID:     p.uid,
+			Name:    p.name,
+			Exe:     p.exe,
+			Cmdline: p.cmdline,
+			Cgroup:  cgroup,
+		}
+
+		if p.tgid == pid {
+			// Thread group leaders must show up in the /proc listing and in
+			// the cgroup.procs file of their cgroup.
+			if !readdir[pid] {
+				h.SeenIn = []string{SourceProbe}
+				if inCgroup {
+					h.SeenIn = append(h.SeenIn, SourceCgroup)
+				}
+				h.MissingFrom = []string{SourceReaddir}
+				h.Reason = "process is reachable in /proc but hidden from its directory listing"
+				hidden = append(hidden, h)
+			} else if !inCgroup && len(cgroups) > 0 {
+				h.SeenIn = []string{SourceProbe, SourceReaddir}
+				h.MissingFrom = []string{SourceCgroup}
+				h.Reason = "process is listed in /proc but missing from every cgroup.procs file"
+				hidden = append(hidden, h)
+			}
+			continue
+		}
+
+		// Threads are never listed in /proc itself, but they must be listed in
+		// the task directory of their thread group leader.
+		if readdir[p.tgid] && tasks[p.tgid] != nil && !tasks[p.tgid][pid] {
+			h.SeenIn = []string{SourceProbe, SourceReaddir}
+			h.MissingFrom = []string{SourceTask}
+			h.Reason = "thread is reachable in /proc but hidden from the task directory of its process"
+			hidden = append(hidden, h)
+		}
+	}
+
+	for pid, cgroup := range cgroups {
+		if _, ok := probed[pid]; ok || readdir[pid] {
+			continue
+		}
+		hidden = append(hidden, HiddenProcess{
+			PID:         pid,
+			Cgroup:      cgroup,
+			SeenIn:      []string{SourceCgroup},
+			MissingFrom: []string{SourceReaddir, SourceProbe},
+			Reason:      "process is a cgroup member but has no /proc entry, it is hidden or exited during the scan",
+		})
+	}
+
+	sort.Slice(hidden, func(i, j int) bool {
+		return hidden[i].PID < hidden[j].PID
+	})
+
+	return hidden
+}
+
+// VerifyHiddenScript returns a script that checks every candidate again after
+// the scan. Processes that started or exited while the sources were read look
+// hidden for a moment, a second look tells them apart from concealed ones.
+// Candidates missing only from the cgroup hierarchy are looked up in the
+// cgroup.procs files again, the others in their /proc directory.
+func VerifyHiddenScript(candidates []HiddenProcess) string {
+	var b strings.Builder
+	for _, c := range candidates {
+		if len(c.MissingFrom) == 1 && c.MissingFrom[0] == SourceCgroup {
+			fmt.Fprintf(&b, `if [ ! -e /proc/%[1]d/status ]; then printf 'verify\t%[1]d\tgone\n'; `+
+				`elif find %[2]s/sys/fs/cgroup -name cgroup.procs -exec cat {} + 2>/dev/null | grep -qx %[1]d; then printf 'verify\t%[1]d\tlisted\n'; `+
+				`else printf 'verify\t%[1]d\thidden\n'; fi`+"\n", c.PID, tasks.HostRoot)
+			continue
+		}
+		dir := "/proc"
+		if c.TGID > 0 && c.TGID != c.PID {
+			dir = fmt.Sprintf("/proc/%d/task", c.TGID)
+		}
+		fmt.Fprintf(&b, `if [ ! -e %[2]s/%[1]d/status ]; then printf 'verify\t%[1]d\tgone\n'; `+
+			`elif ls %[2]s | grep -qx %[1]d; then printf 'verify\t%[1]d\tlisted\n'; `+
+			`else printf 'verify\t%[1]d\thidden\n'; fi`+"\n", c.PID, dir)
+	}
+	return b.String()
+}
+
+// ApplyVerification drops the candidates that turned out to be visible on the
+// second look and marks the ones that are still hidden as verified. Candidates
+// that exited in the meantime are kept unverified.
+func ApplyVerification(candidates []HiddenProcess, output []byte) []HiddenProcess {
+	status := map[int]string{}
+	for _, r := range parseRecords(output) {
+		if r.kind() == "verify" {
+			status[r.intField(0)] = r.field(1)
+		}
+	}
+
+	var verified []HiddenProcess
+	for _, c := range candidates {
+		switch status[c.PID] {
+		case "listed":
+			continue
+		case "hidden":
+			c.Verified = true
+		}
+		verified = append(verified, c)
+	}
+
+	return verified
+}
@@ -0,0 +1,73 @@
+package procfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindHiddenProcesses(t *testing.T) {
+	output := []byte(`readdir	1
+readdir	100
+readdir	200
+probe	1	1	0	0	systemd
+meta	1	/usr/lib/systemd/systemd	/sbin/init
+probe	100	100	1	0	sshd
+meta	100	/usr/sbin/sshd	sshd -D
+probe	101	100	1	0	sshd
+probe	102	100	1	0	sshd
+probe	666	666	1	0	kworker
+meta	666	/tmp/.x/kworker	kworker
+probe	200	200	1	0	bash
+meta	200	/bin/bash	bash
+task	1	1
+task	100	100
+task	100	101
+cgroup	1	/init.scope
+cgroup	100	/system.slice/ssh.service
+cgroup	666	/system.slice/cron.service
+cgroup	777	/system.slice/cron.service
+readdir	1
+readdir	100
+readdir	200
+`)
+
+	hidden := FindHiddenProcesses(output)
+	assert.Len(t, hidden, 4)
+
+	assert.Equal(t, 102, hidden[0].PID)
+	assert.Equal(t, []string{SourceTask}, hidden[0].MissingFrom)
+
+	assert.Equal(t, 200, hidden[1].PID)
+	assert.Equal(t, []string{SourceProbe, SourceReaddir}, hidden[1].SeenIn)
+	assert.Equal(t, []string{SourceCgroup}, hidden[1].MissingFrom)
+
+	assert.Equal(t, 666, hidden[2].PID)
+	assert.Equal(t, "/tmp/.x/kworker", hidden[2].Exe)
+	assert.Equal(t, []string{SourceProbe, SourceCgroup}, hidden[2].SeenIn)
+	assert.Equal(t, []string{SourceReaddir}, hidden[2].MissingFrom)
+
+	assert.Equal(t, 777, hidden[3].PID)
+	assert.Equal(t, []string{SourceCgroup}, hidden[3].SeenIn)
+}
+
+func TestVerifyHiddenScript(t *testing.T) {
+	script := VerifyHiddenScript([]HiddenProcess{
+		{PID: 200, TGID: 200, MissingFrom: []string{SourceCgroup}},
+		{PID: 666, TGID: 666, MissingFrom: []string{SourceReaddir}},
+	})
+	assert.Contains(t, script, "cgroup.procs -exec cat {} + 2>/dev/null | grep -qx 200;")
+	assert.Contains(t, script, "ls /proc | grep -qx 666;")
+}
+
+func TestApplyVerification(t *testing.T) {
+	candidates := []HiddenProcess{{PID: 10}, {PID: 11}, {PID: 12}}
+	output := []byte("verify\t10\tlisted\nverify\t11\thidden\nverify\t12\tgone\n")
+
+	verified := ApplyVerification(candidates, output)
+	assert.Len(t, verified, 2)
+	assert.Equal(t, 11, verified[0].PID)
+	assert.True(t, verified[0].Verified)
+	assert.Equal(t, 12, verified[1].PID)
+	assert.False(t, verified[1].Verified)
+}
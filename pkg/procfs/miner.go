@@ -0,0 +1,275 @@
+package procfs
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc/PID/stat. It is
+// 100 on every architecture Kubernetes nodes run on.
+const clockTicks = 100
+
+// MinerScript samples the CPU time of every process samples times, interval
+// seconds apart, then records the details, sockets, hugepage usage and MSR
+// access of every process along with the hugepage and MSR settings of the host.
+func MinerScript(samples, interval int) string {
+	return fmt.Sprintf(`
+samples=%d
+interval=%d
+s=1
+while [ "$s" -le "$samples" ]; do
+  printf 'sample\t%%s\t%%s\n' "$s" "$(cut -d ' ' -f 1 /proc/uptime)"
+  for d in /proc/[0-9]*; do
+    { read -r line < "$d/stat"; } 2>/dev/null && printf 'stat\t%%s\t%%s\t%%s\n' "$s" "${d#/proc/}" "$line"
+  done
+  [ "$s" -lt "$samples" ] && sleep "$interval"
+  s=$((s+1))
+done
+printf 'host\tnr_hugepages\t%%s\n' "$(cat /proc/sys/vm/nr_hugepages 2>/dev/null)"
+[ -d /sys/module/msr ] && printf 'host\tmsr_module\tloaded\n'
+seen=" "
+for d in /proc/[0-9]*; do
+  p=${d#/proc/}
+  exe=$(readlink "$d/exe" 2>/dev/null)
+  [ -n "$exe" ] || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cg=$(tr '\n\t' ';;' < "$d/cgroup" 2>/dev/null)
+  cmd=$(tr '\0\t\n' '   ' < "$d/cmdline" 2>/dev/null)
+  printf 'proc\t%%s\t%%s\t%%s\t%%s\t%%s\n' "$p" "$comm" "$exe" "$cg" "$cmd"
+  awk -v p="$p" '/^HugetlbPages:/ && $2 > 0 { printf "huge\t%%s\t%%s\n", p, $2 }' "$d/status" 2>/dev/null
+  ls -l "$d/fd" 2>/dev/null | grep -q '/dev/cpu/[0-9]*/msr' && printf 'msr\t%%s\n' "$p"
+%s
+done
+`, samples, interval, SocketsScript)
+}
+
+// minerNames are binary names of well known miners and of the malware
+// families that drop them.
+var minerNames = []string{
+	"xmrig", "xmr-stak", "xmrstak", "minerd", "cpuminer", "cgminer", "bfgminer",
+	"ccminer", "ethminer", "nbminer", "t-rex", "phoenixminer", "lolminer",
+	"nanominer", "teamredminer", "srbminer", "gminer", "kdevtmpfsi", "kinsing",
+	"sysrv", "xmr", "moneroocean",
+}
+
+// minerArgs match command line arguments of miners. Pools are matched by
+// name only, a bare "pool" shows up in the arguments of JVMs and database
+// clients too.
+var minerArgs = []*regexp.Regexp{
+	regexp.MustCompile(`stratum[0-9]?\+(tcp|ssl|tls)://`),
+	regexp.MustCompile(`--donate-level`),
+	regexp.MustCompile(`--(cpu-priority|cpu-max-threads-hint|max-cpu-usage|randomx|nicehash|coin)\b`),
+	regexp.MustCompile(`(-a|--algo)[ =](rx/|cn/|cryptonight|randomx|ethash|kawpow|argon2)`),
+	regexp.MustCompile(`(nanopool|minexmr|supportxmr|hashvault|2miners|f2pool|c3pool|moneroocean|nicehash)`),
+}
+
+// minerPorts are the ports commonly used by mining pools.
+var minerPorts = map[uint16]bool{
+	3333: true, 3334: true, 3335: true, 4444: true, 5555: true, 5556: true,
+	6666: true, 7777: true, 8888: true, 9999: true, 14433: true, 14444: true,
+	20580: true, 45560: true, 45700: true,
+}
+
+// MinerSuspect is a process with cryptominer traits, ranked by score.
+type MinerSuspect struct {
+	PID         int      `json:"pid"`
+	Name        string   `json:"name"`
+	Exe         string   `json:"exe"`
+	Cmdline     string   `json:"cmdline"`
+	Cgroup      string   `json:"cgroup,omitempty"`
+	Pod         string   `json:"pod,omitempty"`
+	Score       int      `json:"score"`
+	AvgCPU      float64  `json:"avgCPU"`
+	MinCPU      float64  `json:"minCPU"`
+	Evidence    []string `json:"evidence"`
+	Connections []string `json:"connections,omitempty"`
+}
+
+// MinerReport is the outcome of the cryptominer heuristics on a node.
+type MinerReport struct {
+	HostEvidence []string       `json:"hostEvidence,omitempty"`
+	Suspects     []MinerSuspect `json:"suspects"`
+}
+
+type cpuSample struct {
+	uptime float64
+	ticks  map[int]cpuTicks
+}
+
+type cpuTicks struct {
+	ticks     uint64
+	starttime string
+}
+
+// parseStat returns the consumed CPU ticks and the start time of a
+// /proc/PID/stat line.
+func parseStat(line string) (cpuTicks, bool) {
+	i := strings.LastIndexByte(line, ')')
+	if i < 0 {
+		return cpuTicks{}, false
+	}
+	fields := strings.Fields(line[i+1:])
+	if len(fields) < 20 {
+		return cpuTicks{}, false
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return cpuTicks{}, false
+	}
+	return cpuTicks{ticks: utime + stime, starttime: fields[19]}, true
+}
+
+// FindMiners parses the output of MinerScript and returns the processes
+// scoring at least minScore. cpuThreshold is the CPU usage, in percent of a
+// core, a process must sustain over every sampling interval to count as busy.
+func FindMiners(output []byte, cpuThreshold float64, minScore int) MinerReport {
+	samples := map[int]*cpuSample{}
+	var sampleOrder []int
+	procs := map[int]*MinerSuspect{}
+	huge := map[int]string{}
+	msr := map[int]bool{}
+	sockets := newSocketTable()
+	var report MinerReport
+
+	for _, r := range parseRecords(output) {
+		if sockets.add(r) {
+			continue
+		}
+		switch r.kind() {
+		case "sample":
+			uptime, _ := strconv.ParseFloat(r.field(1), 64)
+			samples[r.intField(0)] = &cpuSample{uptime: uptime, ticks: map[int]cpuTicks{}}
+			sampleOrder = append(sampleOrder, r.intField(0))
+		case "stat":
+			if s, ok := samples[r.intField(0)]; ok {
+				if t, ok := parseStat(r.field(2)); ok {
+					s.ticks[r.intField(1)] = t
+				}
+			}
+		case "host":
+			switch r.field(0) {
+			case "nr_hugepages":
+				if n, _ := strconv.Atoi(r.field(1)); n > 0 {
+					report.HostEvidence = append(report.HostEvidence, fmt.Sprintf("vm.nr_hugepages is set to %d", n))
+				}
+			case "msr_module":
+				report.HostEvidence = append(report.HostEvidence, "msr kernel module is loaded")
+			}
+		case "proc":
+			procs[r.intField(0)] = &MinerSuspect{
+				PID:     r.intField(0),
+				Name:    r.field(1),
+				Exe:     r.field(2),
+				Cgroup:  r.field(3),
+				Cmdline: r.field(4),
+			}
+		case "huge":
+			huge[r.intField(0)] = r.field(1)
+		case "msr":
+			msr[r.intField(0)] = true
+		}
+	}
+
+	for pid, p := range procs {
+		p.AvgCPU, p.MinCPU = cpuUsage(pid, samples, sampleOrder)
+		if len(sampleOrder) > 1 && p.MinCPU >= cpuThreshold {
+			switch {
+			case p.MinCPU >= 200:
+				p.Score += 40
+			case p.MinCPU >= 90:
+				p.Score += 30
+			default:
+				p.Score += 20
+			}
+			p.Evidence = append(p.Evidence, fmt.Sprintf("sustained CPU usage of at least %.0f%% (average %.0f%%)", p.MinCPU, p.AvgCPU))
+		}
+
+		name := strings.ToLower(p.Name)
+		exe := strings.ToLower(p.Exe)
+		for _, miner := range minerNames {
+			if name == miner || strings.HasSuffix(exe, "/"+miner) || strings.HasPrefix(name, miner) {
+				p.Score += 40
+				p.Evidence = append(p.Evidence, fmt.Sprintf("binary name matches known miner %q", miner))
+				break
+			}
+		}
+
+		argScore := 0
+		for _, pattern := range minerArgs {
+			if m := pattern.FindString(strings.ToLower(p.Cmdline)); m != "" && argScore < 60 {
+				argScore += 30
+				p.Evidence = append(p.Evidence, fmt.Sprintf("miner argument %q in command line", m))
+			}
+		}
+		p.Score += argScore
+
+		for _, s := range sockets.sockets(pid) {
+			if !s.Connected() {
+				continue
+			}
+			p.Connections = append(p.Connections, s.String())
+			if minerPorts[s.Remote.Port()] {
+				p.Score += 25
+				p.Evidence = append(p.Evidence, fmt.Sprintf("connection to common mining pool port %s", s.Remote))
+			}
+		}
+
+		if msr[pid] {
+			p.Score += 30
+			p.Evidence = append(p.Evidence, "holds a /dev/cpu/*/msr file open")
+		}
+		if kb, ok := huge[pid]; ok {
+			p.Score += 15
+			p.Evidence = append(p.Evidence, fmt.Sprintf("uses %s kB of hugetlb pages", kb))
+		}
+
+		// Host wide tweaks only support the suspicion against processes that
+		// already show miner traits themselves.
+		if p.Score > 0 {
+			p.Score += 5 * len(report.HostEvidence)
+		}
+
+		if p.Score >= minScore {
+			report.Suspects = append(report.Suspects, *p)
+		}
+	}
+
+	sort.Slice(report.Suspects, func(i, j int) bool {
+		if report.Suspects[i].Score != report.Suspects[j].Score {
+			return report.Suspects[i].Score > report.Suspects[j].Score
+		}
+		return report.Suspects[i].PID < report.Suspects[j].PID
+	})
+
+	return report
+}
+
+// cpuUsage returns the average and the lowest CPU usage of pid over the
+// sampling intervals, in percent of a single core.
+func cpuUsage(pid int, samples map[int]*cpuSample, order []int) (avg, low float64) {
+	var total float64
+	intervals := 0
+	for i := 1; i < len(order); i++ {
+		prev, cur := samples[order[i-1]], samples[order[i]]
+		a, ok1 := prev.ticks[pid]
+		b, ok2 := cur.ticks[pid]
+		elapsed := cur.uptime - prev.uptime
+		if !ok1 || !ok2 || a.starttime != b.starttime || elapsed <= 0 || b.ticks < a.ticks {
+			return 0, 0
+		}
+		usage := float64(b.ticks-a.ticks) / clockTicks / elapsed * 100
+		if intervals == 0 || usage < low {
+			low = usage
+		}
+		total += usage
+		intervals++
+	}
+	if intervals == 0 {
+		return 0, 0
+	}
+	return total / float64(intervals), low
+}
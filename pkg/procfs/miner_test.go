@@ -0,0 +1,55 @@
+package procfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindMiners(t *testing.T) {
+	output := []byte(`sample	1	1000.00
+stat	1	10	10 (kworker) S 1 1 1 0 -1 0 0 0 0 0 5000 1000 0 0 20 0 1 0 500 0 0
+stat	1	20	20 (python3) S 1 1 1 0 -1 0 0 0 0 0 100 10 0 0 20 0 1 0 600 0 0
+sample	2	1010.00
+stat	2	10	10 (kworker) S 1 1 1 0 -1 0 0 0 0 0 6900 1100 0 0 20 0 1 0 500 0 0
+stat	2	20	20 (python3) S 1 1 1 0 -1 0 0 0 0 0 110 10 0 0 20 0 1 0 600 0 0
+host	nr_hugepages	1280
+host	msr_module	loaded
+proc	10	kworker	/tmp/.cache/kworker	0::/kubepods/pod1/abc	/tmp/.cache/kworker -o stratum+tcp://pool.supportxmr.com:3333 --donate-level 1
+msr	10
+sockfd	10	5	4242
+net	tcp	0100000A:A3B2	0101A8C0:0D05	01	4242
+proc	20	python3	/usr/bin/python3	0::/system.slice/app.service	python3 app.py
+`)
+
+	report := FindMiners(output, 50, 30)
+	assert.Len(t, report.HostEvidence, 2)
+	assert.Len(t, report.Suspects, 1)
+
+	suspect := report.Suspects[0]
+	assert.Equal(t, 10, suspect.PID)
+	assert.InDelta(t, 200, suspect.AvgCPU, 0.01)
+	assert.Equal(t, []string{"tcp 10.0.0.1:41906 -> 192.168.1.1:3333 ESTABLISHED"}, suspect.Connections)
+	assert.Contains(t, suspect.Evidence, "holds a /dev/cpu/*/msr file open")
+	assert.Greater(t, suspect.Score, 100)
+}
+
+func TestFindMinersIgnoresGenericPools(t *testing.T) {
+	output := []byte(`sample	1	1000.00
+proc	30	java	/usr/bin/java	0::/kubepods/pod2/def	java -Djava.util.concurrent.ForkJoinPool.common.parallelism=4 -jar app.jar
+proc	31	api	/app/api	0::/kubepods/pod3/ghi	/app/api --db-pool.size=20 --redis.pool=8
+`)
+
+	report := FindMiners(output, 50, 30)
+	assert.Empty(t, report.Suspects)
+}
+
+func TestParseProcNetAddr(t *testing.T) {
+	addr, err := parseProcNetAddr("0100007F:1F90")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", addr.String())
+
+	addr, err = parseProcNetAddr("00000000000000000000000001000000:0016")
+	assert.NoError(t, err)
+	assert.Equal(t, "[::1]:22", addr.String())
+}
@@ -0,0 +1,184 @@
+package procfs
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// SocketsScript is a script fragment that records the socket inodes held by
+// every process and dumps the TCP and UDP tables of every network namespace
+// once. It expects the process directory in $d, the PID in $p and $seen to be
+// initialized to " " before the process loop.
+const SocketsScript = `
+  ls -l "$d/fd" 2>/dev/null | awk -v p="$p" '/socket:\[/ { match($0, /socket:\[[0-9]+\]/); printf "sockfd\t%s\t%s\t%s\n", p, $(NF-2), substr($0, RSTART+8, RLENGTH-9) }'
+  ns=$(readlink "$d/ns/net" 2>/dev/null)
+  case "$seen" in
+    *" $ns "*) ;;
+    *)
+      seen="$seen$ns "
+      for proto in tcp tcp6 udp udp6; do
+        awk -v proto="$proto" 'NR > 1 { printf "net\t%s\t%s\t%s\t%s\t%s\n", proto, $2, $3, $4, $10 }' "$d/net/$proto" 2>/dev/null
+      done
+      ;;
+  esac
+`
+
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// Socket is an entry of the kernel TCP or UDP socket tables.
+type Socket struct {
+	Proto  string         `json:"proto"`
+	Local  netip.AddrPort `json:"local"`
+	Remote netip.AddrPort `json:"remote"`
+	State  string         `json:"state"`
+	Inode  string         `json:"-"`
+}
+
+// Connected reports whether the socket has a remote peer.
+func (s Socket) Connected() bool {
+	return s.Remote.Port() != 0 && !s.Remote.Addr().IsUnspecified()
+}
+
+// String returns the socket as "proto local -> remote state".
+func (s Socket) String() string {
+	if !s.Connected() {
+		return fmt.Sprintf("%s %s %s", s.Proto, s.Local, s.State)
+	}
+	return fmt.Sprintf("%s %s -> %s %s", s.Proto, s.Local, s.Remote, s.State)
+}
+
+// socketTable holds the sockets of all network namespaces by inode and the
+// socket inodes held open by every process.
+type socketTable struct {
+	byInode map[string]Socket
+	byPID   map[int][]string
+	fds     map[int]map[string]string
+}
+
+func newSocketTable() *socketTable {
+	return &socketTable{
+		byInode: map[string]Socket{},
+		byPID:   map[int][]string{},
+		fds:     map[int]map[string]string{},
+	}
+}
+
+// add consumes the sockfd and net records of SocketsScript and reports
+// whether r was one of them.
+func (t *socketTable) add(r record) bool {
+	switch r.kind() {
+	case "sockfd":
+		pid := r.intField(0)
+		t.byPID[pid] = append(t.byPID[pid], r.field(2))
+		if t.fds[pid] == nil {
+			t.fds[pid] = map[string]string{}
+		}
+		t.fds[pid][r.field(1)] = r.field(2)
+		return true
+	case "net":
+		local, err := parseProcNetAddr(r.field(1))
+		if err != nil {
+			return true
+		}
+		remote, err := parseProcNetAddr(r.field(2))
+		if err != nil {
+			return true
+		}
+		state := tcpStates[strings.ToUpper(r.field(3))]
+		if strings.HasPrefix(r.field(0), "udp") {
+			state = ""
+		}
+		t.byInode[r.field(4)] = Socket{
+			Proto:  r.field(0),
+			Local:  local,
+			Remote: remote,
+			State:  state,
+			Inode:  r.field(4),
+		}
+		return true
+	}
+	return false
+}
+
+// sockets returns the sockets held open by pid.
+func (t *socketTable) sockets(pid int) []Socket {
+	var sockets []Socket
+	for _, inode := range t.byPID[pid] {
+		if s, ok := t.byInode[inode]; ok {
+			sockets = append(sockets, s)
+		}
+	}
+	return sockets
+}
+
+// fdSocket returns the socket behind file descriptor fd of pid. Sockets that
+// are not part of the TCP and UDP tables are returned as unix sockets.
+func (t *socketTable) fdSocket(pid int, fd string) (Socket, bool) {
+	inode, ok := t.fds[pid][fd]
+	if !ok {
+		return Socket{}, false
+	}
+	if s, ok := t.byInode[inode]; ok {
+		return s, true
+	}
+	return Socket{Proto: "unix", Inode: inode}, true
+}
+
+// ParseSockets returns the TCP and UDP sockets held by every process, from
+// the output of a script embedding SocketsScript. Other records are ignored.
+func ParseSockets(output []byte) map[int][]Socket {
+	t := newSocketTable()
+	for _, r := range parseRecords(output) {
+		t.add(r)
+	}
+
+	sockets := map[int][]Socket{}
+	for pid := range t.byPID {
+		if s := t.sockets(pid); len(s) > 0 {
+			sockets[pid] = s
+		}
+	}
+	return sockets
+}
+
+// parseProcNetAddr parses an address of /proc/net/{tcp,udp}[6]. The address
+// is written as the hex dump of the 32 bit words in host byte order, which is
+// little endian on every platform Kubernetes nodes run on.
+func parseProcNetAddr(s string) (netip.AddrPort, error) {
+	host, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("invalid address %q", s)
+	}
+
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid port in %q: %w", s, err)
+	}
+
+	raw, err := hex.DecodeString(host)
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return netip.AddrPort{}, fmt.Errorf("invalid host in %q", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		binary.BigEndian.PutUint32(raw[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+
+	addr, _ := netip.AddrFromSlice(raw)
+	return netip.AddrPortFrom(addr.Unmap(), uint16(p)), nil
+}
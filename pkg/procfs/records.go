@@ -0,0 +1,57 @@
+// Package procfs parses process information collected from the host /proc of
+// a node through the forensic pod and runs the detectors built on top of it.
+//
+// The collection scripts run with busybox inside the forensic pod and print one
+// tab separated record per line. The first field names the record kind, the
+// remaining fields depend on the kind.
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// record is a single line of collector output split into its fields.
+type record []string
+
+// kind returns the record kind.
+func (r record) kind() string {
+	return r[0]
+}
+
+// field returns the nth field after the kind, or an empty string if the record
+// is too short.
+func (r record) field(n int) string {
+	if n+1 >= len(r) {
+		return ""
+	}
+	return r[n+1]
+}
+
+// intField returns the nth field parsed as integer, or -1 if it is not a number.
+func (r record) intField(n int) int {
+	v, err := strconv.Atoi(strings.TrimSpace(r.field(n)))
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// parseRecords splits collector output into records, skipping empty lines.
+func parseRecords(output []byte) []record {
+	var records []record
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		records = append(records, strings.Split(line, "\t"))
+	}
+
+	return records
+}
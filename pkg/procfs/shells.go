@@ -0,0 +1,238 @@
+package procfs
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+)
+
+// ShellsScript records the parent, controlling terminal and file descriptors
+// of every process together with the socket tables of the host.
+const ShellsScript = `
+seen=" "
+for d in /proc/[0-9]*; do
+  p=${d#/proc/}
+  { read -r line < "$d/stat"; } 2>/dev/null || continue
+  printf 'stat\t%s\t%s\n' "$p" "$line"
+  exe=$(readlink "$d/exe" 2>/dev/null)
+  [ -n "$exe" ] || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cg=$(tr '\n\t' ';;' < "$d/cgroup" 2>/dev/null)
+  cmd=$(tr '\0\t\n' '   ' < "$d/cmdline" 2>/dev/null)
+  printf 'proc\t%s\t%s\t%s\t%s\t%s\n' "$p" "$comm" "$exe" "$cg" "$cmd"
+  ls -l "$d/fd" 2>/dev/null | awk -v p="$p" 'NF > 3 { fd = $(NF-2); t = $NF
+    if (t ~ /^pipe:\[/) printf "pipefd\t%s\t%s\t%s\n", p, fd, substr(t, 7, length(t) - 7)
+    else if (fd <= 2) printf "stdfd\t%s\t%s\t%s\n", p, fd, t }'
+` + SocketsScript + `
+done
+`
+
+// shellPattern matches the names of shells and of the tools commonly used to
+// spawn or relay a reverse shell.
+var shellPattern = regexp.MustCompile(`^(sh|ash|bash|dash|zsh|ksh|mksh|csh|tcsh|fish|busybox|python[0-9.]*|perl[0-9.]*|ruby[0-9.]*|php[0-9.]*|lua[0-9.]*|node|nc|ncat|netcat|nc\.traditional|nc\.openbsd|socat|telnet|openssl|awk|gawk)$`)
+
+// Kinds of shell detector hits.
+const (
+	ShellSocketStdio    = "socket-stdio"
+	ShellPipedToSocket  = "pipe-to-socket"
+	ShellUnrequestedTTY = "unrequested-tty"
+)
+
+// ProcessRef is a process in the ancestry of a hit.
+type ProcessRef struct {
+	PID     int    `json:"pid"`
+	Name    string `json:"name"`
+	Cmdline string `json:"cmdline"`
+}
+
+// ShellHit is a process that looks like a reverse or unexpected interactive shell.
+type ShellHit struct {
+	Kind     string       `json:"kind"`
+	Severity string       `json:"severity"`
+	PID      int          `json:"pid"`
+	Name     string       `json:"name"`
+	Exe      string       `json:"exe"`
+	Cmdline  string       `json:"cmdline"`
+	Detail   string       `json:"detail"`
+	Remote   []string     `json:"remote,omitempty"`
+	Pod      string       `json:"pod,omitempty"`
+	Ancestry []ProcessRef `json:"ancestry"`
+}
+
+// ContainerResolver resolves the cgroup of a process to the pod container it
+// belongs to and tells whether the pod spec requested a TTY for it.
+type ContainerResolver func(cgroup string) (container string, ttyRequested bool, ok bool)
+
+type shellProc struct {
+	pid, ppid          int
+	ttyNr              int
+	name, exe, cmdline string
+	cgroup             string
+	stdfds             map[string]string
+}
+
+// FindShells parses the output of ShellsScript. It reports shells whose
+// standard streams are network sockets or pipes into a process holding network
+// connections, and, when resolve is set, container processes holding a
+// terminal the pod spec did not ask for.
+func FindShells(output []byte, resolve ContainerResolver) []ShellHit {
+	procs := map[int]*shellProc{}
+	pipes := map[string][]int{}
+	sockets := newSocketTable()
+
+	get := func(pid int) *shellProc {
+		if procs[pid] == nil {
+			procs[pid] = &shellProc{pid: pid, stdfds: map[string]string{}}
+		}
+		return procs[pid]
+	}
+
+	for _, r := range parseRecords(output) {
+		if sockets.add(r) {
+			continue
+		}
+		pid := r.intField(0)
+		switch r.kind() {
+		case "stat":
+			p := get(pid)
+			line := r.field(1)
+			if i := strings.LastIndexByte(line, ')'); i >= 0 {
+				if j := strings.IndexByte(line, '('); j >= 0 && j < i {
+					p.name = line[j+1 : i]
+				}
+				fields := strings.Fields(line[i+1:])
+				if len(fields) > 4 {
+					p.ppid, _ = strconv.Atoi(fields[1])
+					p.ttyNr, _ = strconv.Atoi(fields[4])
+				}
+			}
+		case "proc":
+			p := get(pid)
+			p.name = r.field(1)
+			p.exe = r.field(2)
+			p.cgroup = r.field(3)
+			p.cmdline = r.field(4)
+		case "pipefd":
+			pipes[r.field(2)] = append(pipes[r.field(2)], pid)
+			if fd := r.field(1); fd == "0" || fd == "1" || fd == "2" {
+				get(pid).stdfds[fd] = "pipe:" + r.field(2)
+			}
+		case "stdfd":
+			get(pid).stdfds[r.field(1)] = r.field(2)
+		}
+	}
+
+	ancestry := func(pid int) []ProcessRef {
+		var refs []ProcessRef
+		visited := map[int]bool{}
+		for p := procs[pid]; p != nil && !visited[p.pid]; p = procs[p.ppid] {
+			visited[p.pid] = true
+			refs = append(refs, ProcessRef{PID: p.pid, Name: p.name, Cmdline: p.cmdline})
+			if p.ppid == 0 {
+				break
+			}
+		}
+		return refs
+	}
+
+	var hits []ShellHit
+	for pid, p := range procs {
+		if p.exe == "" {
+			continue
+		}
+		var container string
+		var ttyRequested, inContainer bool
+		if resolve != nil {
+			container, ttyRequested, inContainer = resolve(p.cgroup)
+		}
+		newHit := func(kind, level, detail string) ShellHit {
+			return ShellHit{
+				Kind:     kind,
+				Severity: level,
+				PID:      pid,
+				Name:     p.name,
+				Exe:      p.exe,
+				Cmdline:  p.cmdline,
+				Detail:   detail,
+				Pod:      container,
+				Ancestry: ancestry(pid),
+			}
+		}
+
+		if shellPattern.MatchString(p.name) || shellPattern.MatchString(path.Base(p.exe)) {
+			var remote, relays []string
+			for _, fd := range []string{"0", "1", "2"} {
+				if s, ok := sockets.fdSocket(pid, fd); ok && s.Connected() {
+					remote = appendUnique(remote, s.Remote.String())
+					continue
+				}
+				inode, ok := strings.CutPrefix(p.stdfds[fd], "pipe:")
+				if !ok {
+					continue
+				}
+				for _, peer := range pipes[inode] {
+					if peer == pid {
+						continue
+					}
+					for _, s := range sockets.sockets(peer) {
+						if s.Connected() {
+							remote = appendUnique(remote, s.Remote.String())
+							relays = appendUnique(relays, fmt.Sprintf("%s[%d]", procs[peer].name, peer))
+						}
+					}
+				}
+			}
+
+			switch {
+			case len(remote) > 0 && len(relays) == 0:
+				hit := newHit(ShellSocketStdio, severity.High, "standard streams are network sockets")
+				hit.Remote = remote
+				hits = append(hits, hit)
+			case len(remote) > 0:
+				level := severity.High
+				if len(relays) == 1 && strings.HasPrefix(relays[0], "sshd[") {
+					level = severity.Medium
+				}
+				hit := newHit(ShellPipedToSocket, level, "standard streams are piped to "+strings.Join(relays, ", "))
+				hit.Remote = remote
+				hits = append(hits, hit)
+			}
+		}
+
+		if !inContainer || ttyRequested {
+			continue
+		}
+		hasTTY := p.ttyNr != 0
+		for _, target := range p.stdfds {
+			if strings.HasPrefix(target, "/dev/pts/") {
+				hasTTY = true
+			}
+		}
+		if hasTTY {
+			hits = append(hits, newHit(ShellUnrequestedTTY, severity.Medium,
+				"container process holds a terminal its pod spec did not request, e.g. a kubectl exec -t session"))
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Severity != hits[j].Severity {
+			return severity.Rank(hits[i].Severity) > severity.Rank(hits[j].Severity)
+		}
+		return hits[i].PID < hits[j].PID
+	})
+
+	return hits
+}
+
+func appendUnique(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
@@ -0,0 +1,55 @@
+package procfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindShells(t *testing.T) {
+	output := []byte(`stat	1	1 (systemd) S 0 1 1 0 -1
+proc	1	systemd	/usr/lib/systemd/systemd	0::/init.scope	/sbin/init
+stat	50	50 (containerd-shim) S 1 50 50 0 -1
+proc	50	containerd-shim	/usr/bin/containerd-shim-runc-v2	0::/system.slice/containerd.service	containerd-shim
+stat	100	100 (bash) S 50 100 100 0 -1
+proc	100	bash	/bin/bash	0::/kubepods/podx/web	bash -i
+stdfd	100	0	socket:[900]
+sockfd	100	0	900
+sockfd	100	1	900
+net	tcp	0100000A:A3B2	0101A8C0:115C	01	900
+stat	200	200 (sh) S 50 200 200 0 -1
+proc	200	sh	/bin/sh	0::/kubepods/podx/web	sh
+pipefd	200	0	777
+stat	201	201 (nc) S 50 201 201 0 -1
+proc	201	nc	/usr/bin/nc	0::/kubepods/podx/web	nc 192.168.1.1 4444
+pipefd	201	1	777
+sockfd	201	3	901
+net	tcp	0100000A:A3B3	0101A8C0:115C	01	901
+stat	300	300 (sh) S 50 300 300 34816 -1
+proc	300	sh	/bin/sh	0::/kubepods/podx/web	sh
+stdfd	300	0	/dev/pts/0
+`)
+
+	resolve := func(cgroup string) (string, bool, bool) {
+		if cgroup == "0::/kubepods/podx/web" {
+			return "shop/web/nginx", false, true
+		}
+		return "", false, false
+	}
+
+	hits := FindShells(output, resolve)
+	assert.Len(t, hits, 3)
+
+	assert.Equal(t, ShellSocketStdio, hits[0].Kind)
+	assert.Equal(t, 100, hits[0].PID)
+	assert.Equal(t, []string{"192.168.1.1:4444"}, hits[0].Remote)
+	assert.Equal(t, []int{100, 50, 1}, []int{hits[0].Ancestry[0].PID, hits[0].Ancestry[1].PID, hits[0].Ancestry[2].PID})
+	assert.Equal(t, "shop/web/nginx", hits[0].Pod)
+
+	assert.Equal(t, ShellPipedToSocket, hits[1].Kind)
+	assert.Equal(t, 200, hits[1].PID)
+	assert.Contains(t, hits[1].Detail, "nc[201]")
+
+	assert.Equal(t, ShellUnrequestedTTY, hits[2].Kind)
+	assert.Equal(t, 300, hits[2].PID)
+}
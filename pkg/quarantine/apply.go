@@ -0,0 +1,317 @@
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PolicyName returns the name of the NetworkPolicy isolating the pods of a
+// record.
+func PolicyName(id string) string {
+	return "kubectl-foren-quarantine-" + id
+}
+
+// Quarantine applies changes to the cluster and appends them to its record.
+// A change is saved before it is made: reverting a change that was not made
+// is harmless, while losing track of a change that was made is not.
+type Quarantine struct {
+	Client client.Client
+	Store  Store
+	Record *Record
+}
+
+func (q *Quarantine) record(ctx context.Context, c Change) error {
+	q.Record.Changes = append(q.Record.Changes, c)
+	return q.Store.Save(ctx, q.Record)
+}
+
+// Cordon marks the node unschedulable.
+func (q *Quarantine) Cordon(ctx context.Context, nodeName string) error {
+	node := &corev1.Node{}
+	if err := q.Client.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+	if node.Spec.Unschedulable {
+		return nil
+	}
+
+	before := strconv.FormatBool(node.Spec.Unschedulable)
+	if err := q.record(ctx, Change{Type: ChangeCordon, Kind: "Node", Name: nodeName, Before: &before}); err != nil {
+		return err
+	}
+	return updateNode(ctx, q.Client, nodeName, func(node *corev1.Node) {
+		node.Spec.Unschedulable = true
+	})
+}
+
+// Taint puts the quarantine taint with effect on the node.
+func (q *Quarantine) Taint(ctx context.Context, nodeName string, effect corev1.TaintEffect) error {
+	node := &corev1.Node{}
+	if err := q.Client.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+
+	c := Change{Type: ChangeTaint, Kind: "Node", Name: nodeName, Key: TaintKey, Effect: effect}
+	if i := findTaint(node.Spec.Taints, TaintKey, effect); i >= 0 {
+		previous := node.Spec.Taints[i]
+		c.Taint = &previous
+	}
+	if err := q.record(ctx, c); err != nil {
+		return err
+	}
+
+	taint := corev1.Taint{Key: TaintKey, Value: q.Record.ID, Effect: effect}
+	return updateNode(ctx, q.Client, nodeName, func(node *corev1.Node) {
+		if i := findTaint(node.Spec.Taints, TaintKey, effect); i >= 0 {
+			node.Spec.Taints[i] = taint
+			return
+		}
+		node.Spec.Taints = append(node.Spec.Taints, taint)
+	})
+}
+
+// Label sets the quarantine label, with the record ID as value, on a node or
+// pod. Pods get the label of the record, see PodLabelKey.
+func (q *Quarantine) Label(ctx context.Context, obj client.Object) error {
+	key := client.ObjectKeyFromObject(obj)
+	kind := objectKind(obj)
+	if err := q.Client.Get(ctx, key, obj); err != nil {
+		return fmt.Errorf("failed to get %s %s: %w", kind, key, err)
+	}
+
+	labelKey := LabelKey
+	if kind == "Pod" {
+		labelKey = PodLabelKey(q.Record.ID)
+	}
+	c := Change{Type: ChangeLabel, Kind: kind, Namespace: key.Namespace, Name: key.Name, Key: labelKey}
+	if v, ok := obj.GetLabels()[labelKey]; ok {
+		c.Before = &v
+	}
+	if err := q.record(ctx, c); err != nil {
+		return err
+	}
+
+	return setLabel(ctx, q.Client, obj, labelKey, &q.Record.ID)
+}
+
+// Isolate creates a NetworkPolicy without rules in namespace, selecting the
+// pods labeled with the record ID. NetworkPolicies add up, so it only denies
+// the traffic no other policy selecting the pods allows, see Bypasses.
+func (q *Quarantine) Isolate(ctx context.Context, namespace string) error {
+	name := PolicyName(q.Record.ID)
+	if err := q.record(ctx, Change{Type: ChangeNetworkPolicy, Kind: "NetworkPolicy", Namespace: namespace, Name: name}); err != nil {
+		return err
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{RecordLabel: q.Record.ID},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{PodLabelKey(q.Record.ID): q.Record.ID},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+		},
+	}
+	if err := q.Client.Create(ctx, policy); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create NetworkPolicy %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// Bypass is a NetworkPolicy, other than the quarantine ones, that selects an
+// isolated pod and allows some of its traffic despite the quarantine.
+type Bypass struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	Policy    string `json:"policy"`
+	Ingress   bool   `json:"ingress"`
+	Egress    bool   `json:"egress"`
+}
+
+// String describes the bypass.
+func (b Bypass) String() string {
+	var traffic []string
+	if b.Ingress {
+		traffic = append(traffic, "ingress")
+	}
+	if b.Egress {
+		traffic = append(traffic, "egress")
+	}
+	return fmt.Sprintf("NetworkPolicy %s/%s still allows %s traffic of pod %s", b.Namespace, b.Policy, strings.Join(traffic, " and "), b.Pod)
+}
+
+// Bypasses returns the NetworkPolicies allowing traffic of the isolated pods,
+// matched against the current labels of the pods.
+func Bypasses(ctx context.Context, c client.Client, pods []corev1.Pod) ([]Bypass, error) {
+	policies := map[string][]networkingv1.NetworkPolicy{}
+	var bypasses []Bypass
+	for i := range pods {
+		pod := &corev1.Pod{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(&pods[i]), pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get pod %s/%s: %w", pods[i].Namespace, pods[i].Name, err)
+		}
+
+		list, ok := policies[pod.Namespace]
+		if !ok {
+			var l networkingv1.NetworkPolicyList
+			if err := c.List(ctx, &l, client.InNamespace(pod.Namespace)); err != nil {
+				return nil, fmt.Errorf("failed to list NetworkPolicies of namespace %s: %w", pod.Namespace, err)
+			}
+			list = l.Items
+			policies[pod.Namespace] = list
+		}
+
+		for _, np := range list {
+			ingress, egress := allowsTraffic(np.Spec)
+			if !ingress && !egress {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pod selector of NetworkPolicy %s/%s: %w", np.Namespace, np.Name, err)
+			}
+			if selector.Matches(labels.Set(pod.Labels)) {
+				bypasses = append(bypasses, Bypass{Namespace: pod.Namespace, Pod: pod.Name, Policy: np.Name, Ingress: ingress, Egress: egress})
+			}
+		}
+	}
+	return bypasses, nil
+}
+
+// allowsTraffic reports whether a NetworkPolicy allows ingress or egress
+// traffic of the pods it selects. A policy without policy types applies to
+// ingress, and to egress when it has egress rules.
+func allowsTraffic(spec networkingv1.NetworkPolicySpec) (ingress, egress bool) {
+	types := spec.PolicyTypes
+	if len(types) == 0 {
+		types = []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+		if len(spec.Egress) > 0 {
+			types = append(types, networkingv1.PolicyTypeEgress)
+		}
+	}
+	ingress = slices.Contains(types, networkingv1.PolicyTypeIngress) && len(spec.Ingress) > 0
+	egress = slices.Contains(types, networkingv1.PolicyTypeEgress) && len(spec.Egress) > 0
+	return ingress, egress
+}
+
+// Release reverts the changes of a record, last change first. It keeps going
+// when a change can not be reverted and returns every error.
+func Release(ctx context.Context, c client.Client, r *Record) []error {
+	var errs []error
+	for i := len(r.Changes) - 1; i >= 0; i-- {
+		if err := revert(ctx, c, r.Changes[i]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to revert %s: %w", r.Changes[i], err))
+		}
+	}
+	return errs
+}
+
+func revert(ctx context.Context, c client.Client, ch Change) error {
+	switch ch.Type {
+	case ChangeCordon:
+		unschedulable := ch.Before != nil && *ch.Before == "true"
+		return ignoreNotFound(updateNode(ctx, c, ch.Name, func(node *corev1.Node) {
+			node.Spec.Unschedulable = unschedulable
+		}))
+	case ChangeTaint:
+		return ignoreNotFound(updateNode(ctx, c, ch.Name, func(node *corev1.Node) {
+			if i := findTaint(node.Spec.Taints, ch.Key, ch.Effect); i >= 0 {
+				node.Spec.Taints = append(node.Spec.Taints[:i], node.Spec.Taints[i+1:]...)
+			}
+			if ch.Taint != nil {
+				node.Spec.Taints = append(node.Spec.Taints, *ch.Taint)
+			}
+		}))
+	case ChangeLabel, ChangeUnlabel:
+		var obj client.Object
+		switch ch.Kind {
+		case "Node":
+			obj = &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: ch.Name}}
+		case "Pod":
+			obj = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: ch.Namespace, Name: ch.Name}}
+		default:
+			return fmt.Errorf("unsupported kind %s", ch.Kind)
+		}
+		return ignoreNotFound(setLabel(ctx, c, obj, ch.Key, ch.Before))
+	case ChangeNetworkPolicy:
+		policy := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: ch.Namespace, Name: ch.Name}}
+		return ignoreNotFound(c.Delete(ctx, policy))
+	}
+	return fmt.Errorf("unknown change type %s", ch.Type)
+}
+
+// updateNode applies mutate to the current node and retries on conflicts.
+func updateNode(ctx context.Context, c client.Client, nodeName string, mutate func(*corev1.Node)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node := &corev1.Node{}
+		if err := c.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+			return err
+		}
+		mutate(node)
+		return c.Update(ctx, node)
+	})
+}
+
+// setLabel sets key to value on obj, or removes it when value is nil.
+func setLabel(ctx context.Context, c client.Client, obj client.Object, key string, value *string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			return err
+		}
+		labels := obj.GetLabels()
+		if value == nil {
+			delete(labels, key)
+		} else {
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[key] = *value
+		}
+		obj.SetLabels(labels)
+		return c.Update(ctx, obj)
+	})
+}
+
+func findTaint(taints []corev1.Taint, key string, effect corev1.TaintEffect) int {
+	for i, t := range taints {
+		if t.Key == key && t.Effect == effect {
+			return i
+		}
+	}
+	return -1
+}
+
+func objectKind(obj client.Object) string {
+	switch obj.(type) {
+	case *corev1.Node:
+		return "Node"
+	case *corev1.Pod:
+		return "Pod"
+	}
+	return fmt.Sprintf("%T", obj)
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
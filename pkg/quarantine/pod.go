@@ -0,0 +1,183 @@
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Selector is the label selector of a controller or Service matching a pod.
+type Selector struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Keys are the labels of the pod the selector depends on.
+	Keys []string `json:"keys"`
+	// Matches is set when the selector still matches the pod after it was
+	// detached.
+	Matches bool `json:"matches"`
+
+	selector labels.Selector
+}
+
+// PodSelectors returns the selectors of the controller owning pod and of the
+// Services of its namespace that match it.
+func PodSelectors(ctx context.Context, c client.Client, pod *corev1.Pod) ([]Selector, error) {
+	var selectors []Selector
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		s, err := controllerSelector(ctx, c, pod.Namespace, owner)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			selectors = append(selectors, *s)
+		}
+	}
+
+	var services corev1.ServiceList
+	if err := c.List(ctx, &services, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list services of namespace %s: %w", pod.Namespace, err)
+	}
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		s := mapSelector("Service", svc.Name, svc.Spec.Selector)
+		if s.selector.Matches(labels.Set(pod.Labels)) {
+			selectors = append(selectors, s)
+		}
+	}
+	return selectors, nil
+}
+
+// controllerSelector returns the selector of the controller owning a pod, nil
+// for kinds of controllers that do not select their pods by label.
+func controllerSelector(ctx context.Context, c client.Client, namespace string, owner *metav1.OwnerReference) (*Selector, error) {
+	var (
+		obj      client.Object
+		selector func() *metav1.LabelSelector
+	)
+	switch owner.Kind {
+	case "ReplicaSet":
+		rs := &appsv1.ReplicaSet{}
+		obj, selector = rs, func() *metav1.LabelSelector { return rs.Spec.Selector }
+	case "StatefulSet":
+		sts := &appsv1.StatefulSet{}
+		obj, selector = sts, func() *metav1.LabelSelector { return sts.Spec.Selector }
+	case "DaemonSet":
+		ds := &appsv1.DaemonSet{}
+		obj, selector = ds, func() *metav1.LabelSelector { return ds.Spec.Selector }
+	case "Job":
+		job := &batchv1.Job{}
+		obj, selector = job, func() *metav1.LabelSelector { return job.Spec.Selector }
+	case "ReplicationController":
+		rc := &corev1.ReplicationController{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: owner.Name}, rc); err != nil {
+			return nil, fmt.Errorf("failed to get ReplicationController %s/%s: %w", namespace, owner.Name, err)
+		}
+		s := mapSelector(owner.Kind, owner.Name, rc.Spec.Selector)
+		return &s, nil
+	default:
+		return nil, nil
+	}
+
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: owner.Name}, obj); err != nil {
+		return nil, fmt.Errorf("failed to get %s %s/%s: %w", owner.Kind, namespace, owner.Name, err)
+	}
+	ls := selector()
+	if ls == nil {
+		return nil, nil
+	}
+	parsed, err := metav1.LabelSelectorAsSelector(ls)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector of %s %s/%s: %w", owner.Kind, namespace, owner.Name, err)
+	}
+
+	s := &Selector{Kind: owner.Kind, Name: owner.Name, selector: parsed}
+	for k := range ls.MatchLabels {
+		s.Keys = append(s.Keys, k)
+	}
+	for _, expr := range ls.MatchExpressions {
+		if expr.Operator == metav1.LabelSelectorOpIn || expr.Operator == metav1.LabelSelectorOpExists {
+			s.Keys = append(s.Keys, expr.Key)
+		}
+	}
+	sort.Strings(s.Keys)
+	return s, nil
+}
+
+func mapSelector(kind, name string, set map[string]string) Selector {
+	s := Selector{Kind: kind, Name: name, selector: labels.SelectorFromSet(set)}
+	for k := range set {
+		s.Keys = append(s.Keys, k)
+	}
+	sort.Strings(s.Keys)
+	return s
+}
+
+// Unlabel removes a label from a node or pod.
+func (q *Quarantine) Unlabel(ctx context.Context, obj client.Object, key string) error {
+	objKey := client.ObjectKeyFromObject(obj)
+	kind := objectKind(obj)
+	if err := q.Client.Get(ctx, objKey, obj); err != nil {
+		return fmt.Errorf("failed to get %s %s: %w", kind, objKey, err)
+	}
+	v, ok := obj.GetLabels()[key]
+	if !ok {
+		return nil
+	}
+
+	c := Change{Type: ChangeUnlabel, Kind: kind, Namespace: objKey.Namespace, Name: objKey.Name, Key: key, Before: &v}
+	if err := q.record(ctx, c); err != nil {
+		return err
+	}
+	return setLabel(ctx, q.Client, obj, key, nil)
+}
+
+// Detach removes the labels of the pod its controller and Services select it
+// by. The controller releases the pod and replaces it, and the Services stop
+// sending it traffic. The quarantine labels are kept. The returned selectors
+// are the ones that matched the pod, Matches tells whether they still do.
+func (q *Quarantine) Detach(ctx context.Context, pod *corev1.Pod) ([]Selector, error) {
+	selectors, err := PodSelectors(ctx, q.Client, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := map[string]bool{}
+	for _, s := range selectors {
+		for _, k := range s.Keys {
+			if !strings.HasPrefix(k, LabelKey) {
+				keys[k] = true
+			}
+		}
+	}
+	var sorted []string
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		obj := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+		if err := q.Unlabel(ctx, obj, k); err != nil {
+			return selectors, err
+		}
+	}
+
+	current := &corev1.Pod{}
+	if err := q.Client.Get(ctx, client.ObjectKeyFromObject(pod), current); err != nil {
+		return selectors, fmt.Errorf("failed to get pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	for i := range selectors {
+		selectors[i].Matches = selectors[i].selector.Matches(labels.Set(current.Labels))
+	}
+	return selectors, nil
+}
@@ -0,0 +1,208 @@
+package quarantine
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestQuarantineNodeAndRelease(t *testing.T) {
+	ctx := context.Background()
+	gpu := corev1.Taint{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Labels: map[string]string{"zone": "a"}},
+		Spec:       corev1.NodeSpec{Taints: []corev1.Taint{gpu}},
+	}
+	record := NewRecord("Node", "", "worker-1", "incident 42")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1", Labels: map[string]string{PodLabelKey(record.ID): "old"}},
+		Spec:       corev1.PodSpec{NodeName: "worker-1"},
+	}
+	c := fake.NewClientBuilder().WithObjects(node, pod).Build()
+
+	store := Store{Client: c, Dir: t.TempDir()}
+	q := &Quarantine{Client: c, Store: store, Record: record}
+	require.NoError(t, q.Cordon(ctx, "worker-1"))
+	require.NoError(t, q.Taint(ctx, "worker-1", corev1.TaintEffectNoSchedule))
+	require.NoError(t, q.Label(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}))
+	require.NoError(t, q.Label(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"}}))
+	require.NoError(t, q.Isolate(ctx, "shop"))
+
+	got := &corev1.Node{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Name: "worker-1"}, got))
+	assert.True(t, got.Spec.Unschedulable)
+	assert.Len(t, got.Spec.Taints, 2)
+	assert.Equal(t, q.Record.ID, got.Labels[LabelKey])
+
+	policy := &networkingv1.NetworkPolicy{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: PolicyName(q.Record.ID)}, policy))
+	assert.Equal(t, q.Record.ID, policy.Spec.PodSelector.MatchLabels[PodLabelKey(q.Record.ID)])
+
+	// The record is read back from the ConfigMap, then from the local copy.
+	loaded, err := store.Load(ctx, "Node", "", "worker-1")
+	require.NoError(t, err)
+	require.Len(t, loaded.Changes, 5)
+	assert.Equal(t, "incident 42", loaded.Reason)
+
+	require.NoError(t, c.Delete(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: Namespace, Name: ConfigMapName("Node", "", "worker-1")}}))
+	loaded, err = store.Load(ctx, "Node", "", "worker-1")
+	require.NoError(t, err)
+	require.Len(t, loaded.Changes, 5)
+
+	assert.Empty(t, Release(ctx, c, loaded))
+	require.NoError(t, store.Released(ctx, loaded))
+
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Name: "worker-1"}, got))
+	assert.False(t, got.Spec.Unschedulable)
+	assert.Equal(t, []corev1.Taint{gpu}, got.Spec.Taints)
+	assert.Equal(t, map[string]string{"zone": "a"}, got.Labels)
+
+	gotPod := &corev1.Pod{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: "web-1"}, gotPod))
+	assert.Equal(t, "old", gotPod.Labels[PodLabelKey(q.Record.ID)])
+
+	err = c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: PolicyName(q.Record.ID)}, policy)
+	assert.True(t, apierrors.IsNotFound(err))
+
+	loaded, err = store.Load(ctx, "Node", "", "worker-1")
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+	released, err := filepath.Glob(filepath.Join(store.Dir, "*-released-*.json"))
+	require.NoError(t, err)
+	assert.Len(t, released, 1)
+}
+
+func TestReleaseMissingObjects(t *testing.T) {
+	c := fake.NewClientBuilder().Build()
+	before := "false"
+	r := &Record{Changes: []Change{
+		{Type: ChangeCordon, Kind: "Node", Name: "gone", Before: &before},
+		{Type: ChangeLabel, Kind: "Pod", Namespace: "shop", Name: "gone", Key: LabelKey},
+		{Type: ChangeNetworkPolicy, Kind: "NetworkPolicy", Namespace: "shop", Name: "gone"},
+		{Type: "unknown", Kind: "Node", Name: "x"},
+	}}
+	errs := Release(context.Background(), c, r)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "unknown change type")
+}
+
+func TestQuarantinePodDetach(t *testing.T) {
+	ctx := context.Background()
+	isController := true
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-5d9f"},
+		Spec: appsv1.ReplicaSetSpec{Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "web", "pod-template-hash": "5d9f"},
+		}},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "web"}},
+	}
+	other := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "db"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "db"}},
+	}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "shop",
+		Name:      "web-5d9f-x2k",
+		Labels:    map[string]string{"app": "web", "pod-template-hash": "5d9f", "tier": "front"},
+		OwnerReferences: []metav1.OwnerReference{
+			{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d9f", Controller: &isController},
+		},
+	}}
+	c := fake.NewClientBuilder().WithObjects(rs, svc, other, pod).Build()
+
+	store := Store{Client: c, Dir: t.TempDir()}
+	q := &Quarantine{Client: c, Store: store, Record: NewRecord("Pod", "shop", pod.Name, "")}
+	require.NoError(t, q.Label(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: pod.Name}}))
+	require.NoError(t, q.Isolate(ctx, "shop"))
+	selectors, err := q.Detach(ctx, pod)
+	require.NoError(t, err)
+
+	require.Len(t, selectors, 2)
+	assert.Equal(t, "ReplicaSet", selectors[0].Kind)
+	assert.Equal(t, []string{"app", "pod-template-hash"}, selectors[0].Keys)
+	assert.Equal(t, "Service", selectors[1].Kind)
+	assert.Equal(t, "web", selectors[1].Name)
+	for _, s := range selectors {
+		assert.False(t, s.Matches)
+	}
+
+	got := &corev1.Pod{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pod), got))
+	assert.Equal(t, map[string]string{"tier": "front", PodLabelKey(q.Record.ID): q.Record.ID}, got.Labels)
+	assert.Equal(t, "remove label app from Pod shop/web-5d9f-x2k", q.Record.Changes[2].String())
+
+	assert.Empty(t, Release(ctx, c, q.Record))
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pod), got))
+	assert.Equal(t, pod.Labels, got.Labels)
+}
+
+func TestQuarantinePodOfQuarantinedNode(t *testing.T) {
+	ctx := context.Background()
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"},
+		Spec:       corev1.PodSpec{NodeName: "worker-1"},
+	}
+	c := fake.NewClientBuilder().WithObjects(node, pod).Build()
+	store := Store{Client: c, Dir: t.TempDir()}
+
+	nodeQ := &Quarantine{Client: c, Store: store, Record: NewRecord("Node", "", "worker-1", "")}
+	require.NoError(t, nodeQ.Label(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"}}))
+	require.NoError(t, nodeQ.Isolate(ctx, "shop"))
+	podQ := &Quarantine{Client: c, Store: store, Record: NewRecord("Pod", "shop", "web-1", "")}
+	require.NoError(t, podQ.Label(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"}}))
+	require.NoError(t, podQ.Isolate(ctx, "shop"))
+
+	// Releasing the node leaves the pod selected by its own NetworkPolicy.
+	assert.Empty(t, Release(ctx, c, nodeQ.Record))
+	got := &corev1.Pod{}
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(pod), got))
+	assert.Equal(t, map[string]string{PodLabelKey(podQ.Record.ID): podQ.Record.ID}, got.Labels)
+	policy := &networkingv1.NetworkPolicy{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: PolicyName(podQ.Record.ID)}, policy))
+	assert.Equal(t, got.Labels, policy.Spec.PodSelector.MatchLabels)
+}
+
+func TestBypasses(t *testing.T) {
+	ctx := context.Background()
+	policy := func(name string, selector map[string]string, spec networkingv1.NetworkPolicySpec) *networkingv1.NetworkPolicy {
+		spec.PodSelector = metav1.LabelSelector{MatchLabels: selector}
+		return &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}, Spec: spec}
+	}
+	ingress := []networkingv1.NetworkPolicyIngressRule{{From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}}}}
+	egress := []networkingv1.NetworkPolicyEgressRule{{Ports: []networkingv1.NetworkPolicyPort{{}}}}
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1", Labels: map[string]string{"app": "web"}}}
+	c := fake.NewClientBuilder().WithObjects(pod,
+		policy("allow-same-namespace", nil, networkingv1.NetworkPolicySpec{Ingress: ingress}),
+		policy("allow-dns", nil, networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}, Egress: egress}),
+		policy("web", map[string]string{"app": "web"}, networkingv1.NetworkPolicySpec{Ingress: ingress, Egress: egress}),
+		policy("default-deny", nil, networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress}}),
+		policy("db", map[string]string{"app": "db"}, networkingv1.NetworkPolicySpec{Ingress: ingress}),
+	).Build()
+
+	q := &Quarantine{Client: c, Store: Store{Client: c, Dir: t.TempDir()}, Record: NewRecord("Pod", "shop", "web-1", "")}
+	require.NoError(t, q.Label(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web-1"}}))
+	require.NoError(t, q.Isolate(ctx, "shop"))
+
+	bypasses, err := Bypasses(ctx, c, []corev1.Pod{*pod})
+	require.NoError(t, err)
+	assert.Equal(t, []Bypass{
+		{Namespace: "shop", Pod: "web-1", Policy: "allow-dns", Egress: true},
+		{Namespace: "shop", Pod: "web-1", Policy: "allow-same-namespace", Ingress: true},
+		{Namespace: "shop", Pod: "web-1", Policy: "web", Ingress: true, Egress: true},
+	}, bypasses)
+	assert.Equal(t, "NetworkPolicy shop/web still allows ingress and egress traffic of pod web-1", bypasses[2].String())
+}
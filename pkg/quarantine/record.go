@@ -0,0 +1,256 @@
+// Package quarantine isolates nodes and pods during an investigation and
+// undoes the isolation again. Every change is appended to an undo record
+// before the next one is made, and the record is stored both in a ConfigMap
+// of the cluster and in a local file, so a quarantine interrupted halfway can
+// still be released.
+package quarantine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TaintKey is the taint put on quarantined nodes. The forensic pod
+	// tolerates it.
+	TaintKey = tasks.QuarantineTaintKey
+	// LabelKey marks quarantined nodes, with the ID of their record as
+	// value. Pods are labeled with PodLabelKey instead.
+	LabelKey = "kubectl-foren.io/quarantine"
+	// RecordLabel marks the ConfigMaps holding undo records.
+	RecordLabel = "kubectl-foren.io/undo-record"
+
+	// Namespace holds the undo record ConfigMaps, next to the forensic pods.
+	Namespace = "default"
+
+	recordKey = "record.json"
+)
+
+// Types of changes.
+const (
+	ChangeCordon        = "cordon"
+	ChangeTaint         = "taint"
+	ChangeLabel         = "label"
+	ChangeUnlabel       = "unlabel"
+	ChangeNetworkPolicy = "networkpolicy"
+)
+
+// Change is a single change made to the cluster, with what is needed to
+// revert it.
+type Change struct {
+	Type      string `json:"type"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Key       string `json:"key,omitempty"`
+
+	// Before is the previous value of a label or of the unschedulable flag,
+	// nil if the label was not set.
+	Before *string `json:"before,omitempty"`
+	// Taint is the taint with the same key and effect replaced by the
+	// quarantine taint, nil if there was none.
+	Taint *corev1.Taint `json:"taint,omitempty"`
+	// Effect is the effect of the added taint.
+	Effect corev1.TaintEffect `json:"effect,omitempty"`
+}
+
+// String describes the change.
+func (c Change) String() string {
+	target := c.Kind + " " + c.Name
+	if c.Namespace != "" {
+		target = c.Kind + " " + c.Namespace + "/" + c.Name
+	}
+	switch c.Type {
+	case ChangeCordon:
+		return "cordon " + target
+	case ChangeTaint:
+		return fmt.Sprintf("taint %s with %s:%s", target, c.Key, c.Effect)
+	case ChangeLabel:
+		return fmt.Sprintf("label %s with %s", target, c.Key)
+	case ChangeUnlabel:
+		return fmt.Sprintf("remove label %s from %s", c.Key, target)
+	case ChangeNetworkPolicy:
+		return "create " + target
+	}
+	return c.Type + " " + target
+}
+
+// Record is the undo record of a quarantine.
+type Record struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Name       string     `json:"name"`
+	Reason     string     `json:"reason,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ReleasedAt *time.Time `json:"releasedAt,omitempty"`
+	Changes    []Change   `json:"changes"`
+	// Bypasses are the NetworkPolicies found allowing traffic of the
+	// isolated pods once they were isolated.
+	Bypasses []Bypass `json:"bypasses,omitempty"`
+}
+
+// NewRecord starts the undo record of the quarantine of an object.
+func NewRecord(kind, namespace, name, reason string) *Record {
+	return &Record{
+		ID:        recordID(kind, namespace, name),
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC(),
+		Changes:   []Change{},
+	}
+}
+
+// recordID derives a short ID, usable as label value, from the quarantined
+// object.
+func recordID(kind, namespace, name string) string {
+	sum := sha256.Sum256([]byte(kind + "/" + namespace + "/" + name))
+	return hex.EncodeToString(sum[:5])
+}
+
+// PodLabelKey returns the label marking the pods isolated by a record, which
+// its NetworkPolicies select. Every record has a key of its own, so the
+// quarantines of a node and of one of its pods do not overwrite, nor on
+// release remove, each other's label.
+func PodLabelKey(id string) string {
+	return LabelKey + "-" + id
+}
+
+// Target describes the quarantined object, e.g. node worker-1.
+func (r *Record) Target() string {
+	if r.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+	}
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
+
+// ConfigMapName returns the name of the ConfigMap holding the record.
+func ConfigMapName(kind, namespace, name string) string {
+	return "kubectl-foren-undo-" + recordID(kind, namespace, name)
+}
+
+// Store keeps undo records in the cluster and in a local directory.
+type Store struct {
+	Client client.Client
+	Dir    string
+}
+
+func (s Store) path(cmName string) string {
+	return filepath.Join(s.Dir, cmName+".json")
+}
+
+// Save writes the record locally and to its ConfigMap. The local copy is
+// written first, so the record survives losing access to the cluster.
+func (s Store) Save(ctx context.Context, r *Record) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo record: %w", err)
+	}
+
+	name := ConfigMapName(r.Kind, r.Namespace, r.Name)
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create undo record directory %s: %w", s.Dir, err)
+	}
+	if err := os.WriteFile(s.path(name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write undo record: %w", err)
+	}
+
+	cm := &corev1.ConfigMap{}
+	err = s.Client.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: name}, cm)
+	if apierrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: Namespace,
+				Labels:    map[string]string{RecordLabel: r.ID},
+			},
+			Data: map[string]string{recordKey: string(data)},
+		}
+		if err := s.Client.Create(ctx, cm); err != nil {
+			return fmt.Errorf("failed to create undo record ConfigMap %s: %w", name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get undo record ConfigMap %s: %w", name, err)
+	}
+	cm.Data = map[string]string{recordKey: string(data)}
+	if err := s.Client.Update(ctx, cm); err != nil {
+		return fmt.Errorf("failed to update undo record ConfigMap %s: %w", name, err)
+	}
+	return nil
+}
+
+// Load reads the record of an object from its ConfigMap, or from the local
+// directory when the ConfigMap is missing. It returns nil without error when
+// neither exists.
+func (s Store) Load(ctx context.Context, kind, namespace, name string) (*Record, error) {
+	cmName := ConfigMapName(kind, namespace, name)
+
+	var data []byte
+	cm := &corev1.ConfigMap{}
+	err := s.Client.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: cmName}, cm)
+	switch {
+	case err == nil:
+		data = []byte(cm.Data[recordKey])
+	case apierrors.IsNotFound(err):
+		data, err = os.ReadFile(s.path(cmName))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read undo record: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to get undo record ConfigMap %s: %w", cmName, err)
+	}
+
+	r := &Record{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to parse undo record %s: %w", cmName, err)
+	}
+	return r, nil
+}
+
+// Released marks the record as released. The ConfigMap is deleted and the
+// local copy is moved aside, with the release time, as a trace of the
+// quarantine.
+func (s Store) Released(ctx context.Context, r *Record) error {
+	now := time.Now().UTC()
+	r.ReleasedAt = &now
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo record: %w", err)
+	}
+	name := ConfigMapName(r.Kind, r.Namespace, r.Name)
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create undo record directory %s: %w", s.Dir, err)
+	}
+	if err := os.WriteFile(s.path(name+"-released-"+now.Format("20060102T150405Z")), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write undo record: %w", err)
+	}
+	if err := os.Remove(s.path(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove undo record: %w", err)
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: Namespace}}
+	if err := s.Client.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete undo record ConfigMap %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,423 @@
+// Package rbac audits the RBAC configuration of a cluster for subjects with
+// rights that allow taking over workloads, nodes or the cluster.
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Risks reported by the audit.
+const (
+	RiskExec          = "pods-exec"
+	RiskCreatePods    = "create-pods"
+	RiskSecrets       = "read-secrets"
+	RiskEscalate      = "escalate"
+	RiskBind          = "bind"
+	RiskImpersonate   = "impersonate"
+	RiskNodeProxy     = "nodes-proxy"
+	RiskWildcardVerbs = "wildcard-verbs"
+)
+
+// ScopeCluster is the scope of rights granted by ClusterRoleBindings.
+const ScopeCluster = "*"
+
+// DefaultsLabel marks the roles and bindings the API server bootstraps. Anyone
+// allowed to create a binding can set it, it only tells which subjects may be
+// control plane defaults.
+const DefaultsLabel = "kubernetes.io/bootstrapping"
+
+// controllerPrefix prefixes the bootstrapped bindings of the controllers,
+// system:controller:<name> binds the <name> service account of kube-system.
+const controllerPrefix = "system:controller:"
+
+// bootstrapSubjects are the subjects the API server puts in the other
+// bindings it bootstraps.
+var bootstrapSubjects = map[string][]string{
+	"ClusterRoleBinding/cluster-admin":                           {"Group/system:masters"},
+	"ClusterRoleBinding/system:monitoring":                       {"Group/system:monitoring"},
+	"ClusterRoleBinding/system:discovery":                        {"Group/system:authenticated"},
+	"ClusterRoleBinding/system:basic-user":                       {"Group/system:authenticated"},
+	"ClusterRoleBinding/system:public-info-viewer":               {"Group/system:authenticated"},
+	"ClusterRoleBinding/system:node-proxier":                     {"User/system:kube-proxy"},
+	"ClusterRoleBinding/system:kube-controller-manager":          {"User/system:kube-controller-manager"},
+	"ClusterRoleBinding/system:kube-dns":                         {"ServiceAccount/kube-system/kube-dns"},
+	"ClusterRoleBinding/system:kube-scheduler":                   {"User/system:kube-scheduler"},
+	"ClusterRoleBinding/system:volume-scheduler":                 {"User/system:kube-scheduler"},
+	"ClusterRoleBinding/system:service-account-issuer-discovery": {"Group/system:serviceaccounts"},
+	"RoleBinding/kube-system/system::extension-apiserver-authentication-reader": {
+		"User/system:kube-controller-manager",
+		"User/system:kube-scheduler",
+	},
+	"RoleBinding/kube-system/system::leader-locking-kube-controller-manager": {
+		"ServiceAccount/kube-system/kube-controller-manager",
+		"User/system:kube-controller-manager",
+	},
+	"RoleBinding/kube-system/system::leader-locking-kube-scheduler": {
+		"ServiceAccount/kube-system/kube-scheduler",
+		"User/system:kube-scheduler",
+	},
+}
+
+// anonymousSubjects are the subjects requests without credentials are
+// authenticated as.
+var anonymousSubjects = map[string]bool{
+	rbacv1.UserKind + "/system:anonymous":        true,
+	rbacv1.GroupKind + "/system:unauthenticated": true,
+}
+
+// podControllers are the resources creating pods from a template, which
+// allows to run any pod just as creating pods does.
+var podControllers = []groupResource{
+	{"", "pods"},
+	{"", "replicationcontrollers"},
+	{"apps", "deployments"},
+	{"apps", "replicasets"},
+	{"apps", "statefulsets"},
+	{"apps", "daemonsets"},
+	{"batch", "jobs"},
+	{"batch", "cronjobs"},
+}
+
+// Inventory holds the RBAC objects of a cluster.
+type Inventory struct {
+	Roles               []rbacv1.Role
+	ClusterRoles        []rbacv1.ClusterRole
+	RoleBindings        []rbacv1.RoleBinding
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding
+}
+
+// Collect lists the RBAC objects of the cluster.
+func Collect(ctx context.Context, c client.Client) (*Inventory, error) {
+	var (
+		roles               rbacv1.RoleList
+		clusterRoles        rbacv1.ClusterRoleList
+		roleBindings        rbacv1.RoleBindingList
+		clusterRoleBindings rbacv1.ClusterRoleBindingList
+	)
+	for _, list := range []client.ObjectList{&roles, &clusterRoles, &roleBindings, &clusterRoleBindings} {
+		if err := c.List(ctx, list); err != nil {
+			return nil, fmt.Errorf("failed to list %T: %w", list, err)
+		}
+	}
+	return &Inventory{
+		Roles:               roles.Items,
+		ClusterRoles:        clusterRoles.Items,
+		RoleBindings:        roleBindings.Items,
+		ClusterRoleBindings: clusterRoleBindings.Items,
+	}, nil
+}
+
+// Options tune the audit.
+type Options struct {
+	// PrivilegedNamespaces are the namespaces where creating pods is
+	// reported, e.g. kube-system or namespaces without pod security.
+	PrivilegedNamespaces map[string]bool
+	// IncludeDefaults also reports the control plane subjects of the
+	// bindings bootstrapped by the API server, which grant the control plane
+	// components their rights.
+	IncludeDefaults bool
+}
+
+// Ref names an RBAC object or subject.
+type Ref struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// String returns the reference as Kind/namespace/name.
+func (r Ref) String() string {
+	if r.Namespace != "" {
+		return r.Kind + "/" + r.Namespace + "/" + r.Name
+	}
+	return r.Kind + "/" + r.Name
+}
+
+// Finding is a dangerous right of a subject with the binding, role and rule
+// granting it.
+type Finding struct {
+	Severity string `json:"severity"`
+	Risk     string `json:"risk"`
+	Subject  Ref    `json:"subject"`
+	// Scope is the namespace the right applies to, ScopeCluster for all.
+	Scope     string `json:"scope"`
+	Anonymous bool   `json:"anonymous,omitempty"`
+	Binding   Ref    `json:"binding"`
+	Role      Ref    `json:"role"`
+	Rule      string `json:"rule"`
+}
+
+// Chain describes how the subject is granted the right.
+func (f Finding) Chain() string {
+	return f.Binding.String() + " -> " + f.Role.String() + " -> " + f.Rule
+}
+
+type groupResource struct {
+	group    string
+	resource string
+}
+
+// binding is a RoleBinding or ClusterRoleBinding.
+type binding struct {
+	ref      Ref
+	scope    string
+	defaults bool
+	roleRef  rbacv1.RoleRef
+	subjects []rbacv1.Subject
+}
+
+// Analyze reports the dangerous rights granted by the bindings of inv. It
+// also returns warnings about bindings referencing roles that do not exist,
+// which grant the rights of whatever role is created with that name later.
+func Analyze(inv *Inventory, opts Options) ([]Finding, []string) {
+	roles := map[string][]rbacv1.PolicyRule{}
+	for _, r := range inv.Roles {
+		roles[Ref{Kind: "Role", Namespace: r.Namespace, Name: r.Name}.String()] = r.Rules
+	}
+	for _, r := range inv.ClusterRoles {
+		roles[Ref{Kind: "ClusterRole", Name: r.Name}.String()] = r.Rules
+	}
+
+	var bindings []binding
+	for _, b := range inv.ClusterRoleBindings {
+		bindings = append(bindings, binding{
+			ref:      Ref{Kind: "ClusterRoleBinding", Name: b.Name},
+			scope:    ScopeCluster,
+			defaults: b.Labels[DefaultsLabel] != "",
+			roleRef:  b.RoleRef,
+			subjects: b.Subjects,
+		})
+	}
+	for _, b := range inv.RoleBindings {
+		bindings = append(bindings, binding{
+			ref:      Ref{Kind: "RoleBinding", Namespace: b.Namespace, Name: b.Name},
+			scope:    b.Namespace,
+			defaults: b.Labels[DefaultsLabel] != "",
+			roleRef:  b.RoleRef,
+			subjects: b.Subjects,
+		})
+	}
+
+	var (
+		findings []Finding
+		warnings []string
+	)
+	for _, b := range bindings {
+		var subjects []rbacv1.Subject
+		for _, s := range b.subjects {
+			if b.defaults && !opts.IncludeDefaults && defaultSubject(b.ref, s) {
+				continue
+			}
+			subjects = append(subjects, s)
+		}
+		if len(subjects) == 0 {
+			continue
+		}
+
+		role := Ref{Kind: b.roleRef.Kind, Name: b.roleRef.Name}
+		if role.Kind == "Role" {
+			role.Namespace = b.ref.Namespace
+		}
+		rules, ok := roles[role.String()]
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s references %s which does not exist", b.ref, role))
+			continue
+		}
+
+		for _, rule := range rules {
+			for _, risk := range ruleRisks(rule, b.scope, opts) {
+				for _, s := range subjects {
+					subject := Ref{Kind: s.Kind, Namespace: s.Namespace, Name: s.Name}
+					anonymous := anonymousSubjects[s.Kind+"/"+s.Name]
+					level := risk.severity
+					if anonymous {
+						level = severity.High
+					}
+					findings = append(findings, Finding{
+						Severity:  level,
+						Risk:      risk.name,
+						Subject:   subject,
+						Scope:     b.scope,
+						Anonymous: anonymous,
+						Binding:   b.ref,
+						Role:      role,
+						Rule:      describeRule(rule),
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Anonymous != b.Anonymous {
+			return a.Anonymous
+		}
+		if severity.Rank(a.Severity) != severity.Rank(b.Severity) {
+			return severity.Rank(a.Severity) > severity.Rank(b.Severity)
+		}
+		if a.Subject.String() != b.Subject.String() {
+			return a.Subject.String() < b.Subject.String()
+		}
+		return a.Risk < b.Risk
+	})
+	sort.Strings(warnings)
+
+	return findings, warnings
+}
+
+// defaultSubject reports whether a subject of a bootstrapped binding is one
+// the API server put there. Any other subject, even a system: group such as
+// system:authenticated added to cluster-admin, was added after the bootstrap
+// and is always audited, as are the anonymous subjects.
+func defaultSubject(b Ref, s rbacv1.Subject) bool {
+	if anonymousSubjects[s.Kind+"/"+s.Name] {
+		return false
+	}
+	subject := Ref{Kind: s.Kind, Namespace: s.Namespace, Name: s.Name}.String()
+	if name, ok := strings.CutPrefix(b.Name, controllerPrefix); ok {
+		return subject == Ref{Kind: rbacv1.ServiceAccountKind, Namespace: "kube-system", Name: name}.String()
+	}
+	return slices.Contains(bootstrapSubjects[b.String()], subject)
+}
+
+type risk struct {
+	name     string
+	severity string
+}
+
+// ruleRisks returns the risks of a rule granted in scope.
+func ruleRisks(rule rbacv1.PolicyRule, scope string, opts Options) []risk {
+	if len(rule.Resources) == 0 {
+		return nil
+	}
+
+	var risks []risk
+	// Rights limited to named objects are reported one severity lower.
+	add := func(name, level string) {
+		if len(rule.ResourceNames) > 0 {
+			level = lower(level)
+		}
+		risks = append(risks, risk{name: name, severity: level})
+	}
+	namespaced := severity.Medium
+	if scope == ScopeCluster {
+		namespaced = severity.High
+	}
+
+	if hasVerb(rule, "*") {
+		add(RiskWildcardVerbs, namespaced)
+	}
+	// Exec sessions opened over WebSockets are authorized with get.
+	if allows(rule, "", "pods/exec", "create", "get") || allows(rule, "", "pods/attach", "create", "get") {
+		add(RiskExec, namespaced)
+	}
+	if scope == ScopeCluster || opts.PrivilegedNamespaces[scope] {
+		for _, gr := range podControllers {
+			if allows(rule, gr.group, gr.resource, "create") {
+				add(RiskCreatePods, severity.High)
+				break
+			}
+		}
+	}
+	if allows(rule, "", "secrets", "get", "list", "watch") {
+		add(RiskSecrets, namespaced)
+	}
+	if allows(rule, "rbac.authorization.k8s.io", "roles", "escalate") || allows(rule, "rbac.authorization.k8s.io", "clusterroles", "escalate") {
+		add(RiskEscalate, severity.High)
+	}
+	if allows(rule, "rbac.authorization.k8s.io", "roles", "bind") || allows(rule, "rbac.authorization.k8s.io", "clusterroles", "bind") {
+		add(RiskBind, severity.High)
+	}
+	for _, gr := range []groupResource{{"", "users"}, {"", "groups"}, {"", "serviceaccounts"}, {"authentication.k8s.io", "userextras/scopes"}, {"authentication.k8s.io", "uids"}} {
+		if allows(rule, gr.group, gr.resource, "impersonate") {
+			add(RiskImpersonate, severity.High)
+			break
+		}
+	}
+	// Nodes are cluster scoped, a RoleBinding does not grant access to them.
+	if scope == ScopeCluster && allows(rule, "", "nodes/proxy", "get", "create") {
+		add(RiskNodeProxy, severity.High)
+	}
+
+	return risks
+}
+
+// allows reports whether rule grants one of verbs on resource, which may
+// name a subresource as resource/subresource.
+func allows(rule rbacv1.PolicyRule, group, resource string, verbs ...string) bool {
+	if !contains(rule.APIGroups, group) || !resourceMatches(rule.Resources, resource) {
+		return false
+	}
+	for _, verb := range verbs {
+		if hasVerb(rule, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasVerb(rule rbacv1.PolicyRule, verb string) bool {
+	return contains(rule.Verbs, verb)
+}
+
+// contains reports whether values holds value or the wildcard.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == rbacv1.VerbAll || v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resourceMatches matches resources the way the RBAC authorizer does,
+// including the pods/* and */scale forms for subresources.
+func resourceMatches(resources []string, resource string) bool {
+	base, sub, hasSub := strings.Cut(resource, "/")
+	for _, r := range resources {
+		switch {
+		case r == rbacv1.ResourceAll || r == resource:
+			return true
+		case hasSub && (r == base+"/*" || r == "*/"+sub):
+			return true
+		}
+	}
+	return false
+}
+
+// describeRule renders a rule as verbs on resources, e.g.
+// get,list secrets or create deployments.apps [web].
+func describeRule(rule rbacv1.PolicyRule) string {
+	var resources []string
+	for _, group := range rule.APIGroups {
+		for _, r := range rule.Resources {
+			if group != "" {
+				r += "." + group
+			}
+			resources = append(resources, r)
+		}
+	}
+	s := strings.Join(rule.Verbs, ",") + " " + strings.Join(resources, ",")
+	if len(rule.ResourceNames) > 0 {
+		s += " [" + strings.Join(rule.ResourceNames, ",") + "]"
+	}
+	return s
+}
+
+func lower(level string) string {
+	switch level {
+	case severity.High:
+		return severity.Medium
+	default:
+		return severity.Low
+	}
+}
@@ -0,0 +1,184 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnalyze(t *testing.T) {
+	inv := &Inventory{
+		ClusterRoles: []rbacv1.ClusterRole{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "debugger"},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{""}, Resources: []string{"pods/*"}, Verbs: []string{"get"}},
+					{APIGroups: []string{""}, Resources: []string{"nodes/proxy"}, Verbs: []string{"get"}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "deployer"},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"create", "update"}},
+					{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"registry"}, Verbs: []string{"get"}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin", Labels: map[string]string{DefaultsLabel: "rbac-defaults"}},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+					{NonResourceURLs: []string{"*"}, Verbs: []string{"*"}},
+				},
+			},
+		},
+		Roles: []rbacv1.Role{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "rbac-manager"},
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{"rbac.authorization.k8s.io"}, Resources: []string{"roles"}, Verbs: []string{"bind", "escalate"}},
+				{APIGroups: []string{""}, Resources: []string{"users"}, Verbs: []string{"impersonate"}},
+			},
+		}},
+		ClusterRoleBindings: []rbacv1.ClusterRoleBinding{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin", Labels: map[string]string{DefaultsLabel: "rbac-defaults"}},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+				Subjects:   []rbacv1.Subject{{Kind: "Group", Name: "system:masters"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "public-debug"},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "debugger"},
+				Subjects:   []rbacv1.Subject{{Kind: "User", Name: "system:anonymous"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "dangling"},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "removed"},
+				Subjects:   []rbacv1.Subject{{Kind: "User", Name: "bob"}},
+			},
+		},
+		RoleBindings: []rbacv1.RoleBinding{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "ci"},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "deployer"},
+				Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Namespace: "ci", Name: "runner"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "ci"},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "deployer"},
+				Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Namespace: "ci", Name: "runner"}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "admins"},
+				RoleRef:    rbacv1.RoleRef{Kind: "Role", Name: "rbac-manager"},
+				Subjects:   []rbacv1.Subject{{Kind: "Group", Name: "shop-admins"}},
+			},
+		},
+	}
+
+	findings, warnings := Analyze(inv, Options{PrivilegedNamespaces: map[string]bool{"kube-system": true}})
+	assert.Equal(t, []string{"ClusterRoleBinding/dangling references ClusterRole/removed which does not exist"}, warnings)
+
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Severity+" "+f.Risk+" "+f.Subject.String()+" "+f.Scope)
+	}
+	assert.Equal(t, []string{
+		"high nodes-proxy User/system:anonymous *",
+		"high pods-exec User/system:anonymous *",
+		"high bind Group/shop-admins shop",
+		"high escalate Group/shop-admins shop",
+		"high impersonate Group/shop-admins shop",
+		"high create-pods ServiceAccount/ci/runner kube-system",
+		"low read-secrets ServiceAccount/ci/runner kube-system",
+		"low read-secrets ServiceAccount/ci/runner shop",
+	}, got)
+
+	require.True(t, findings[0].Anonymous)
+	assert.Equal(t, "ClusterRoleBinding/public-debug -> ClusterRole/debugger -> get nodes/proxy", findings[0].Chain())
+	assert.Equal(t, "RoleBinding/shop/admins -> Role/shop/rbac-manager -> bind,escalate roles.rbac.authorization.k8s.io", findings[2].Chain())
+
+	findings, _ = Analyze(inv, Options{IncludeDefaults: true})
+	var admin []string
+	for _, f := range findings {
+		if f.Subject.Name == "system:masters" {
+			admin = append(admin, f.Risk)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		RiskWildcardVerbs, RiskExec, RiskCreatePods, RiskSecrets,
+		RiskEscalate, RiskBind, RiskImpersonate, RiskNodeProxy,
+	}, admin)
+}
+
+func TestResourceMatches(t *testing.T) {
+	assert.True(t, resourceMatches([]string{"*"}, "pods/exec"))
+	assert.True(t, resourceMatches([]string{"pods/*"}, "pods/exec"))
+	assert.True(t, resourceMatches([]string{"*/exec"}, "pods/exec"))
+	assert.False(t, resourceMatches([]string{"pods"}, "pods/exec"))
+	assert.False(t, resourceMatches([]string{"pods/*"}, "pods"))
+}
+
+func TestAnalyzeBootstrappedBinding(t *testing.T) {
+	// Anyone allowed to create bindings can set the bootstrapping label to
+	// hide planted subjects among the defaults.
+	inv := &Inventory{
+		ClusterRoles: []rbacv1.ClusterRole{{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin", Labels: map[string]string{DefaultsLabel: "rbac-defaults"}},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}}},
+		}},
+		ClusterRoleBindings: []rbacv1.ClusterRoleBinding{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-admin", Labels: map[string]string{DefaultsLabel: "rbac-defaults"}},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+				Subjects: []rbacv1.Subject{
+					{Kind: "Group", Name: "system:masters"},
+					{Kind: "User", Name: "system:anonymous"},
+					{Kind: "User", Name: "mallory"},
+					{Kind: "ServiceAccount", Namespace: "default", Name: "default"},
+					{Kind: "Group", Name: "system:authenticated"},
+					{Kind: "ServiceAccount", Namespace: "kube-system", Name: "generic-garbage-collector"},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "system:controller:generic-garbage-collector", Labels: map[string]string{DefaultsLabel: "rbac-defaults"}},
+				RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "cluster-admin"},
+				Subjects: []rbacv1.Subject{
+					{Kind: "ServiceAccount", Namespace: "kube-system", Name: "generic-garbage-collector"},
+					{Kind: "Group", Name: "system:serviceaccounts"},
+				},
+			},
+		},
+	}
+
+	subjects := func(findings []Finding) map[string]bool {
+		got := map[string]bool{}
+		for _, f := range findings {
+			got[f.Subject.String()] = true
+		}
+		return got
+	}
+
+	findings, _ := Analyze(inv, Options{})
+	// Only system:masters in cluster-admin and the controller service account
+	// in its own binding are bootstrap subjects.
+	assert.Equal(t, map[string]bool{
+		"User/system:anonymous":                                true,
+		"User/mallory":                                         true,
+		"ServiceAccount/default/default":                       true,
+		"Group/system:authenticated":                           true,
+		"ServiceAccount/kube-system/generic-garbage-collector": true,
+		"Group/system:serviceaccounts":                         true,
+	}, subjects(findings))
+	require.NotEmpty(t, findings)
+	assert.True(t, findings[0].Anonymous)
+	for _, f := range findings {
+		if f.Binding.Name == "system:controller:generic-garbage-collector" {
+			assert.Equal(t, "Group/system:serviceaccounts", f.Subject.String())
+		}
+	}
+
+	findings, _ = Analyze(inv, Options{IncludeDefaults: true})
+	assert.Len(t, subjects(findings), 7)
+}
@@ -0,0 +1,259 @@
+// Package satoken maps service account tokens to the pods holding them and
+// to the RBAC rights they carry, to tell which stolen tokens matter most.
+package satoken
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/rbac"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// How a pod holds a token.
+const (
+	MountProjected = "projected"
+	MountSecret    = "secret"
+	MountEnv       = "env"
+)
+
+// Labels the API server sets on legacy token Secrets.
+const (
+	LastUsedLabel     = "kubernetes.io/legacy-token-last-used"
+	InvalidSinceLabel = "kubernetes.io/legacy-token-invalid-since"
+)
+
+// PodToken is a token held by a pod.
+type PodToken struct {
+	Pod   string `json:"pod"`
+	Node  string `json:"node,omitempty"`
+	Mount string `json:"mount"`
+	// Source is the volume or, for environment variables, the Secret the
+	// token comes from.
+	Source            string   `json:"source"`
+	Containers        []string `json:"containers"`
+	Audience          string   `json:"audience,omitempty"`
+	ExpirationSeconds int64    `json:"expirationSeconds,omitempty"`
+}
+
+// LegacySecret is a long-lived token Secret of a service account.
+type LegacySecret struct {
+	Name         string `json:"name"`
+	Created      string `json:"created"`
+	HasToken     bool   `json:"hasToken"`
+	LastUsed     string `json:"lastUsed,omitempty"`
+	InvalidSince string `json:"invalidSince,omitempty"`
+}
+
+// Exposure is a service account with where its tokens are and what they
+// allow.
+type Exposure struct {
+	Namespace     string         `json:"namespace"`
+	Name          string         `json:"name"`
+	Severity      string         `json:"severity,omitempty"`
+	Risks         []string       `json:"risks,omitempty"`
+	Pods          []PodToken     `json:"pods,omitempty"`
+	LegacySecrets []LegacySecret `json:"legacySecrets,omitempty"`
+	Grants        []rbac.Finding `json:"grants,omitempty"`
+}
+
+// Exposed reports whether a token of the service account exists.
+func (e *Exposure) Exposed() bool {
+	return len(e.Pods) > 0 || len(e.LegacySecrets) > 0
+}
+
+// Analyze maps the service accounts to the pods holding their tokens, their
+// legacy token Secrets and the rights granted to them by findings, which must
+// include the default bindings.
+func Analyze(serviceAccounts []corev1.ServiceAccount, pods []corev1.Pod, secrets []corev1.Secret, findings []rbac.Finding) []Exposure {
+	exposures := map[string]*Exposure{}
+	get := func(namespace, name string) *Exposure {
+		key := namespace + "/" + name
+		e, ok := exposures[key]
+		if !ok {
+			e = &Exposure{Namespace: namespace, Name: name}
+			exposures[key] = e
+		}
+		return e
+	}
+	for _, sa := range serviceAccounts {
+		get(sa.Namespace, sa.Name)
+	}
+
+	// tokenSecrets maps namespace/secret to the service account owning it.
+	tokenSecrets := map[string]string{}
+	for _, s := range secrets {
+		if s.Type != corev1.SecretTypeServiceAccountToken {
+			continue
+		}
+		owner := s.Annotations[corev1.ServiceAccountNameKey]
+		tokenSecrets[s.Namespace+"/"+s.Name] = owner
+		e := get(s.Namespace, owner)
+		e.LegacySecrets = append(e.LegacySecrets, LegacySecret{
+			Name:         s.Name,
+			Created:      s.CreationTimestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			HasToken:     len(s.Data[corev1.ServiceAccountTokenKey]) > 0,
+			LastUsed:     s.Labels[LastUsedLabel],
+			InvalidSince: s.Labels[InvalidSinceLabel],
+		})
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for _, t := range podTokens(pod, tokenSecrets) {
+			// Projected tokens are issued for the service account of the
+			// pod, legacy ones belong to the owner of their Secret.
+			owner := pod.Spec.ServiceAccountName
+			if t.Mount != MountProjected {
+				owner = tokenSecrets[pod.Namespace+"/"+t.Source]
+			}
+			if owner == "" {
+				owner = "default"
+			}
+			e := get(pod.Namespace, owner)
+			e.Pods = append(e.Pods, t)
+		}
+	}
+
+	for _, f := range findings {
+		for _, e := range exposures {
+			if !carries(e, f.Subject) {
+				continue
+			}
+			e.Grants = append(e.Grants, f)
+			if !slices.Contains(e.Risks, f.Risk) {
+				e.Risks = append(e.Risks, f.Risk)
+			}
+			if severity.Rank(f.Severity) > severity.Rank(e.Severity) {
+				e.Severity = f.Severity
+			}
+		}
+	}
+
+	result := make([]Exposure, 0, len(exposures))
+	for _, e := range exposures {
+		sort.Strings(e.Risks)
+		result = append(result, *e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if severity.Rank(a.Severity) != severity.Rank(b.Severity) {
+			return severity.Rank(a.Severity) > severity.Rank(b.Severity)
+		}
+		if len(a.Pods)+len(a.LegacySecrets) != len(b.Pods)+len(b.LegacySecrets) {
+			return len(a.Pods)+len(a.LegacySecrets) > len(b.Pods)+len(b.LegacySecrets)
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+// carries reports whether a token of the service account authenticates as
+// subject. Service accounts are also members of the system:serviceaccounts,
+// system:serviceaccounts:<namespace> and system:authenticated groups.
+func carries(e *Exposure, subject rbac.Ref) bool {
+	switch subject.Kind {
+	case "ServiceAccount":
+		return subject.Namespace == e.Namespace && subject.Name == e.Name
+	case "User":
+		return subject.Name == "system:serviceaccount:"+e.Namespace+":"+e.Name
+	case "Group":
+		switch subject.Name {
+		case "system:serviceaccounts", "system:serviceaccounts:" + e.Namespace, "system:authenticated":
+			return true
+		}
+	}
+	return false
+}
+
+// podTokens returns the tokens the containers of a pod can read, from
+// projected service account token volumes, legacy token Secret volumes and
+// environment variables read from legacy token Secrets, one by one or all of
+// them through envFrom.
+func podTokens(pod *corev1.Pod, tokenSecrets map[string]string) []PodToken {
+	mounted := map[string][]string{}
+	var containers []corev1.Container
+	containers = append(containers, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, corev1.Container(c.EphemeralContainerCommon))
+	}
+	for _, c := range containers {
+		for _, m := range c.VolumeMounts {
+			if !slices.Contains(mounted[m.Name], c.Name) {
+				mounted[m.Name] = append(mounted[m.Name], c.Name)
+			}
+		}
+	}
+
+	var tokens []PodToken
+	add := func(t PodToken) {
+		t.Pod = pod.Name
+		t.Node = pod.Spec.NodeName
+		tokens = append(tokens, t)
+	}
+	for _, v := range pod.Spec.Volumes {
+		if len(mounted[v.Name]) == 0 {
+			continue
+		}
+		switch {
+		case v.Secret != nil:
+			if _, ok := tokenSecrets[pod.Namespace+"/"+v.Secret.SecretName]; ok {
+				add(PodToken{Mount: MountSecret, Source: v.Secret.SecretName, Containers: mounted[v.Name]})
+			}
+		case v.Projected != nil:
+			for _, s := range v.Projected.Sources {
+				switch {
+				case s.ServiceAccountToken != nil:
+					t := PodToken{Mount: MountProjected, Source: v.Name, Containers: mounted[v.Name], Audience: s.ServiceAccountToken.Audience}
+					if s.ServiceAccountToken.ExpirationSeconds != nil {
+						t.ExpirationSeconds = *s.ServiceAccountToken.ExpirationSeconds
+					}
+					add(t)
+				case s.Secret != nil:
+					if _, ok := tokenSecrets[pod.Namespace+"/"+s.Secret.Name]; ok {
+						add(PodToken{Mount: MountSecret, Source: s.Secret.Name, Containers: mounted[v.Name]})
+					}
+				}
+			}
+		}
+	}
+
+	env := map[string][]string{}
+	var order []string
+	addEnv := func(name, container string) {
+		if _, ok := tokenSecrets[pod.Namespace+"/"+name]; !ok {
+			return
+		}
+		if _, ok := env[name]; !ok {
+			order = append(order, name)
+		}
+		if !slices.Contains(env[name], container) {
+			env[name] = append(env[name], container)
+		}
+	}
+	for _, c := range containers {
+		for _, e := range c.EnvFrom {
+			if e.SecretRef != nil {
+				addEnv(e.SecretRef.Name, c.Name)
+			}
+		}
+		for _, e := range c.Env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				addEnv(e.ValueFrom.SecretKeyRef.Name, c.Name)
+			}
+		}
+	}
+	for _, name := range order {
+		add(PodToken{Mount: MountEnv, Source: name, Containers: env[name]})
+	}
+
+	return tokens
+}
@@ -0,0 +1,142 @@
+package satoken
+
+import (
+	"testing"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/rbac"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnalyze(t *testing.T) {
+	expiration := int64(3607)
+	serviceAccounts := []corev1.ServiceAccount{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "runner"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "unused"}},
+	}
+	secrets := []corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ci",
+				Name:        "runner-token",
+				Annotations: map[string]string{corev1.ServiceAccountNameKey: "runner"},
+				Labels:      map[string]string{LastUsedLabel: "2026-09-30"},
+			},
+			Type: corev1.SecretTypeServiceAccountToken,
+			Data: map[string][]byte{corev1.ServiceAccountTokenKey: []byte("eyJ")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "registry"},
+			Type:       corev1.SecretTypeDockerConfigJson,
+		},
+	}
+	pods := []corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "build-1"},
+			Spec: corev1.PodSpec{
+				NodeName:           "worker-1",
+				ServiceAccountName: "runner",
+				Volumes: []corev1.Volume{
+					{Name: "kube-api-access-x", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{Path: "token", ExpirationSeconds: &expiration}}},
+					}}},
+					{Name: "legacy", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "runner-token"}}},
+					{Name: "unmounted", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "runner-token"}}},
+				},
+				Containers: []corev1.Container{
+					{
+						Name: "build",
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "kube-api-access-x", MountPath: "/var/run/secrets/kubernetes.io/serviceaccount"},
+							{Name: "legacy", MountPath: "/token"},
+						},
+					},
+					{
+						Name: "sidecar",
+						Env: []corev1.EnvVar{{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "runner-token"}, Key: "token"},
+						}}},
+					},
+				},
+			},
+		},
+		{
+			// The pod does not mount its token.
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "web"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "web"}}},
+		},
+	}
+	findings := []rbac.Finding{
+		{Severity: severity.High, Risk: rbac.RiskSecrets, Subject: rbac.Ref{Kind: "ServiceAccount", Namespace: "ci", Name: "runner"}},
+		{Severity: severity.Medium, Risk: rbac.RiskExec, Subject: rbac.Ref{Kind: "Group", Name: "system:serviceaccounts:shop"}},
+		{Severity: severity.High, Risk: rbac.RiskBind, Subject: rbac.Ref{Kind: "User", Name: "alice"}},
+	}
+
+	exposures := Analyze(serviceAccounts, pods, secrets, findings)
+	require.Len(t, exposures, 3)
+
+	runner := exposures[0]
+	assert.Equal(t, "runner", runner.Name)
+	assert.Equal(t, severity.High, runner.Severity)
+	assert.Equal(t, []string{rbac.RiskSecrets}, runner.Risks)
+	assert.Equal(t, []PodToken{
+		{Pod: "build-1", Node: "worker-1", Mount: MountProjected, Source: "kube-api-access-x", Containers: []string{"build"}, ExpirationSeconds: 3607},
+		{Pod: "build-1", Node: "worker-1", Mount: MountSecret, Source: "runner-token", Containers: []string{"build"}},
+		{Pod: "build-1", Node: "worker-1", Mount: MountEnv, Source: "runner-token", Containers: []string{"sidecar"}},
+	}, runner.Pods)
+	require.Len(t, runner.LegacySecrets, 1)
+	assert.True(t, runner.LegacySecrets[0].HasToken)
+	assert.Equal(t, "2026-09-30", runner.LegacySecrets[0].LastUsed)
+	assert.True(t, runner.Exposed())
+
+	// Both service accounts of shop carry the rights of their namespace group.
+	assert.Equal(t, "default", exposures[1].Name)
+	assert.Equal(t, []string{rbac.RiskExec}, exposures[1].Risks)
+	assert.False(t, exposures[1].Exposed())
+	assert.Equal(t, "unused", exposures[2].Name)
+}
+
+func TestAnalyzeEnvFrom(t *testing.T) {
+	secrets := []corev1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ci",
+				Name:        "runner-token",
+				Annotations: map[string]string{corev1.ServiceAccountNameKey: "runner"},
+			},
+			Type: corev1.SecretTypeServiceAccountToken,
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "config"},
+			Type:       corev1.SecretTypeOpaque,
+		},
+	}
+	envFrom := func(name string) []corev1.EnvFromSource {
+		return []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}}}
+	}
+	pods := []corev1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci", Name: "deploy-1"},
+		Spec: corev1.PodSpec{
+			NodeName:       "worker-2",
+			InitContainers: []corev1.Container{{Name: "fetch", EnvFrom: envFrom("runner-token")}},
+			Containers: []corev1.Container{
+				{Name: "deploy", EnvFrom: envFrom("config")},
+				{Name: "sidecar", EnvFrom: envFrom("runner-token")},
+			},
+			EphemeralContainers: []corev1.EphemeralContainer{
+				{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger", EnvFrom: envFrom("runner-token")}},
+			},
+		},
+	}}
+
+	exposures := Analyze(nil, pods, secrets, nil)
+	require.Len(t, exposures, 1)
+	assert.Equal(t, "runner", exposures[0].Name)
+	assert.Equal(t, []PodToken{
+		{Pod: "deploy-1", Node: "worker-2", Mount: MountEnv, Source: "runner-token", Containers: []string{"fetch", "sidecar", "debugger"}},
+	}, exposures[0].Pods)
+}
@@ -0,0 +1,36 @@
+// Package severity defines the severities of findings shared by every
+// detector, so their ordering and the severities users filter on agree.
+package severity
+
+import (
+	"fmt"
+)
+
+// Severities of the findings.
+const (
+	High   = "high"
+	Medium = "medium"
+	Low    = "low"
+)
+
+// Rank orders severities, higher ranks being more severe. Unknown severities
+// rank 0.
+func Rank(severity string) int {
+	switch severity {
+	case High:
+		return 3
+	case Medium:
+		return 2
+	case Low:
+		return 1
+	}
+	return 0
+}
+
+// Valid checks a severity given by the user.
+func Valid(severity string) error {
+	if Rank(severity) == 0 {
+		return fmt.Errorf("invalid severity %q, expected one of high, medium or low", severity)
+	}
+	return nil
+}
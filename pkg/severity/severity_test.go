@@ -0,0 +1,17 @@
+package severity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRank(t *testing.T) {
+	assert.Greater(t, Rank(High), Rank(Medium))
+	assert.Greater(t, Rank(Medium), Rank(Low))
+	assert.Greater(t, Rank(Low), Rank("critical"))
+
+	assert.NoError(t, Valid(Medium))
+	assert.Error(t, Valid("High"))
+	assert.Error(t, Valid(""))
+}
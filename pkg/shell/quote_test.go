@@ -0,0 +1,16 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, "/usr/bin/sudo", Quote("/usr/bin/sudo"))
+	assert.Equal(t, "''", Quote(""))
+	assert.Equal(t, "'/tmp/a b'", Quote("/tmp/a b"))
+	assert.Equal(t, `'it'\''s'`, Quote("it's"))
+	assert.Equal(t, "'$(reboot)'", Quote("$(reboot)"))
+	assert.Equal(t, "/etc '/var/lib/a;b'", Join([]string{"/etc", "/var/lib/a;b"}))
+}
@@ -60,6 +60,9 @@ type State struct {
 	PodName       string
 	Namespace     string
 	ContainerName string
+	// ForensicImage is the image of the forensic pod, tasks.ForensicImage
+	// when empty.
+	ForensicImage string
 }
 
 // WithLogger sets a custom logger
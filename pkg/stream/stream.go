@@ -0,0 +1,367 @@
+// Package stream streams files and process memory out of a node through the
+// forensic pod. The scripts frame every target as a "data" header line
+// announcing the size of the payload that follows it. Payloads are first
+// copied to a temporary file of the forensic pod, so the size announced is the
+// number of bytes actually read and a file changing or a memory read failing
+// halfway shows as a target smaller than requested, never as filler.
+package stream
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// ChunkSize is the size of the pieces memory regions are streamed in, which
+// bounds the space they take in the forensic pod.
+const ChunkSize = 16 * 1024 * 1024
+
+// Kinds of targets.
+const (
+	TargetFile   = "file"
+	TargetMemory = "memory"
+)
+
+// Target is a file or a process memory region streamed out of a node.
+type Target struct {
+	Kind    string `json:"kind"`
+	Path    string `json:"path,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+	Process string `json:"process,omitempty"`
+	Cgroup  string `json:"-"`
+	Address uint64 `json:"address,omitempty"`
+	Perms   string `json:"perms,omitempty"`
+	Offset  uint64 `json:"offset,omitempty"`
+	Inode   string `json:"inode,omitempty"`
+	// Size is the number of bytes read, Requested the number of bytes the
+	// file had or the piece of memory region spans. Truncated targets were
+	// read partially, the content past Size is unknown.
+	Size      int64 `json:"size"`
+	Requested int64 `json:"requested,omitempty"`
+	Truncated bool  `json:"truncated,omitempty"`
+}
+
+// String describes the target, e.g. /usr/bin/ls or pid 42 (nginx) [heap].
+func (t Target) String() string {
+	if t.Kind == TargetMemory {
+		region := t.Path
+		if region == "" {
+			region = "[anon]"
+		}
+		return fmt.Sprintf("pid %d (%s) %s", t.PID, t.Process, region)
+	}
+	return t.Path
+}
+
+// tempFile creates the temporary file payloads are copied to before being
+// framed.
+const tempFile = `
+tmp=$(mktemp) || exit 1
+trap 'rm -f "$tmp"' EXIT
+`
+
+// filesLoop streams every regular file below the roots up to the maximum
+// size.
+const filesLoop = tempFile + `
+find %s %s -type f -size -%dc 2>/dev/null | while IFS= read -r f; do
+  n=$(wc -c < "$f" 2>/dev/null) || continue
+  [ "$n" -gt 0 ] 2>/dev/null || continue
+  head -c %d "$f" > "$tmp" 2>/dev/null
+  got=$(wc -c < "$tmp")
+  printf 'data\tfile\t%%s\t%%s\t0\t0\t%%s\n' "$got" "$f" "$n"
+  cat "$tmp"
+done
+`
+
+func findOpts(xdev bool) string {
+	if xdev {
+		return "-xdev"
+	}
+	return ""
+}
+
+// FilesScript streams the regular files below host paths.
+func FilesScript(paths []string, xdev bool, maxSize int64) string {
+	var roots []string
+	for _, p := range paths {
+		roots = append(roots, tasks.HostRoot+path.Clean("/"+p))
+	}
+	return fmt.Sprintf(filesLoop, shell.Join(roots), findOpts(xdev), maxSize+1, maxSize)
+}
+
+// ContainerFilesScript streams the regular files below paths of the root
+// filesystem of a container, reached through /proc/PID/root of one of its
+// processes.
+func ContainerFilesScript(containerID string, paths []string, xdev bool, maxSize int64) string {
+	var roots []string
+	for _, p := range paths {
+		roots = append(roots, `"$root"`+shell.Quote(path.Clean("/"+p)))
+	}
+	return `
+pid=""
+for d in /proc/[0-9]*; do
+  if grep -q ` + shell.Quote(containerID) + ` "$d/cgroup" 2>/dev/null && [ -e "$d/root/" ]; then pid=${d#/proc/}; break; fi
+done
+if [ -z "$pid" ]; then
+  printf 'warn\tno running process found for container %s\n' ` + shell.Quote(containerID) + `
+  exit 0
+fi
+root=/proc/$pid/root
+` + fmt.Sprintf(filesLoop, strings.Join(roots, " "), findOpts(xdev), maxSize+1, maxSize)
+}
+
+// MemoryOptions selects the processes and memory regions MemoryScript
+// streams.
+type MemoryOptions struct {
+	// PIDs are host PIDs. When empty, the processes of ContainerID or, if
+	// that is empty as well, every process is streamed.
+	PIDs        []int
+	ContainerID string
+	// AllRegions includes file backed regions that are not writable. They
+	// are skipped by default, their content being on disk, except for deleted
+	// and memfd files.
+	AllRegions bool
+	// MaxRegion skips regions larger than this many bytes and MaxTotal stops
+	// once this many bytes were streamed, 0 meaning no limit.
+	MaxRegion int64
+	MaxTotal  int64
+}
+
+// MemoryScript streams the readable memory regions of processes through
+// /proc/PID/mem, in pieces of at most ChunkSize bytes. A piece read partially
+// ends its region. Skipped regions are reported with a skip record.
+func MemoryScript(opts MemoryOptions) string {
+	list := `/proc/[0-9]*`
+	script := ""
+	switch {
+	case len(opts.PIDs) > 0:
+		var dirs []string
+		for _, pid := range opts.PIDs {
+			dirs = append(dirs, "/proc/"+strconv.Itoa(pid))
+		}
+		list = strings.Join(dirs, " ")
+	case opts.ContainerID != "":
+		script = `
+dirs=$(for d in /proc/[0-9]*; do grep -q ` + shell.Quote(opts.ContainerID) + ` "$d/cgroup" 2>/dev/null && echo "$d"; done)
+[ -n "$dirs" ] || printf 'warn\tno running process found for container %s\n' ` + shell.Quote(opts.ContainerID) + `
+`
+		list = `$dirs`
+	}
+	all := "0"
+	if opts.AllRegions {
+		all = "1"
+	}
+	maxRegion, maxTotal := opts.MaxRegion, opts.MaxTotal
+	if maxRegion <= 0 {
+		maxRegion = 1 << 62
+	}
+	if maxTotal <= 0 {
+		maxTotal = 1 << 62
+	}
+
+	return script + tempFile + fmt.Sprintf(`
+total=0
+for d in %s; do
+  p=${d#/proc/}
+  [ "$p" = "$$" ] && continue
+  [ -r "$d/maps" ] || continue
+  comm=$(cat "$d/comm" 2>/dev/null)
+  cg=$(tr '\n\t' ';;' < "$d/cgroup" 2>/dev/null)
+  printf 'proc\t%%s\t%%s\t%%s\n' "$p" "$comm" "$cg"
+  while read -r range perms off dev inode name; do
+    case "$perms" in r*) ;; *) continue ;; esac
+    case "$name" in "[vvar]"|"[vvar_vclock]"|"[vsyscall]") continue ;; esac
+    if [ %s = 0 ] && [ "$inode" != 0 ]; then
+      case "$name" in *" (deleted)"|/memfd:*) ;; *)
+        case "$perms" in ?w*) ;; *) continue ;; esac ;;
+      esac
+    fi
+    start=${range%%-*}
+    n=$((0x${range#*-} - 0x$start))
+    if [ "$n" -gt %d ]; then
+      printf 'skip\t%%s\t%%s\t%%s\t%%s\tlarger than the maximum region size\n' "$p" "$start" "$n" "$name"
+      continue
+    fi
+    if [ $((total + n)) -gt %d ]; then
+      printf 'skip\t%%s\t%%s\t%%s\t%%s\tmaximum total size reached\n' "$p" "$start" "$n" "$name"
+      continue
+    fi
+    total=$((total + n))
+    addr=$((0x$start))
+    left=$n
+    while [ "$left" -gt 0 ]; do
+      want=$left
+      [ "$want" -gt %d ] && want=%d
+      : > "$tmp"
+      dd if="$d/mem" of="$tmp" bs=4096 skip=$((addr / 4096)) count=$((want / 4096)) 2>/dev/null
+      got=$(wc -c < "$tmp")
+      printf 'data\tmemory\t%%s\t%%s\t%%s\t%%x\t%%s\t%%08x\t%%s:%%s\t%%s\n' "$got" "$name" "$p" "$addr" "$perms" $((0x$off + addr - 0x$start)) "$dev" "$inode" "$want"
+      cat "$tmp"
+      [ "$got" -eq "$want" ] || break
+      addr=$((addr + want))
+      left=$((left - want))
+    done
+  done < "$d/maps"
+done
+`, list, all, maxRegion, maxTotal, ChunkSize, ChunkSize)
+}
+
+var containerRootPattern = regexp.MustCompile(`^/proc/[0-9]+/root`)
+
+// ReadTargets reads the stream of one of the scripts and calls scan with every
+// target and a reader of its content, limited to the size of the target. The
+// content scan leaves unread is skipped. Warnings, including skipped regions,
+// are passed to warn. Host paths are reported relative to the host root and
+// container paths relative to the container root.
+func ReadTargets(r io.Reader, scan func(t Target, data io.Reader) error, warn func(string)) error {
+	br := bufio.NewReaderSize(r, 1024*1024)
+	procs := map[int]Target{}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read scan stream: %w", err)
+		}
+		fields := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+
+		switch fields[0] {
+		case "warn":
+			warn(strings.Join(fields[1:], " "))
+		case "proc":
+			if len(fields) < 4 {
+				continue
+			}
+			pid, _ := strconv.Atoi(fields[1])
+			procs[pid] = Target{PID: pid, Process: fields[2], Cgroup: fields[3]}
+		case "skip":
+			if len(fields) < 5 {
+				continue
+			}
+			reason := "it is larger than the maximum size"
+			if len(fields) > 5 {
+				reason = fields[5]
+			}
+			warn(fmt.Sprintf("skipped %s bytes region %s %s of pid %s, %s", fields[3], fields[2], fields[4], fields[1], reason))
+		case "data":
+			if len(fields) < 6 {
+				return fmt.Errorf("invalid scan stream header %q", line)
+			}
+			size, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil || size < 0 {
+				return fmt.Errorf("invalid scan stream header %q", line)
+			}
+
+			t := Target{Kind: fields[1], Path: fields[3], Size: size, Requested: size}
+			requested := ""
+			if t.Kind == TargetMemory {
+				pid, _ := strconv.Atoi(fields[4])
+				t.PID, t.Process, t.Cgroup = pid, procs[pid].Process, procs[pid].Cgroup
+				t.Address, _ = strconv.ParseUint(fields[5], 16, 64)
+				if len(fields) >= 9 {
+					t.Perms, t.Inode = fields[6], fields[8]
+					t.Offset, _ = strconv.ParseUint(fields[7], 16, 64)
+				}
+				if len(fields) >= 10 {
+					requested = fields[9]
+				}
+			} else {
+				if strings.HasPrefix(t.Path, tasks.HostRoot+"/") {
+					t.Path = strings.TrimPrefix(t.Path, tasks.HostRoot)
+				} else {
+					t.Path = containerRootPattern.ReplaceAllString(t.Path, "")
+				}
+				if len(fields) >= 7 {
+					requested = fields[6]
+				}
+			}
+			if n, err := strconv.ParseInt(requested, 10, 64); err == nil && n > size {
+				t.Requested, t.Truncated = n, true
+			}
+
+			data := &io.LimitedReader{R: br, N: size}
+			if err := scan(t, data); err != nil {
+				return err
+			}
+			// The content left unread is skipped to reach the next header.
+			if _, err := io.Copy(io.Discard, data); err != nil {
+				return fmt.Errorf("failed to read scan stream: %w", err)
+			}
+			if data.N > 0 {
+				return fmt.Errorf("failed to read scan stream: %w", io.ErrUnexpectedEOF)
+			}
+		}
+	}
+}
+
+// Window buffers the content of targets to scan them whole, up to a maximum
+// size. The pieces of a memory region are joined back into one target.
+type Window struct {
+	max    int64
+	scan   func(t Target, data []byte) error
+	target Target
+	data   []byte
+	// last is the size of the last piece added, a piece smaller than
+	// ChunkSize ends its region.
+	last int64
+}
+
+// NewWindow returns a window of max bytes handing the targets to scan.
+func NewWindow(max int64, scan func(t Target, data []byte) error) *Window {
+	return &Window{max: max, scan: scan}
+}
+
+// Add reads the content of a target, up to the maximum size. The target is
+// scanned once the next one does not continue it, or on Flush.
+func (w *Window) Add(t Target, data io.Reader) error {
+	joined := w.continues(t)
+	if !joined {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	buf, err := io.ReadAll(io.LimitReader(data, w.max-int64(len(w.data))))
+	if err != nil {
+		return err
+	}
+	// Content past the window is not scanned.
+	truncated := t.Truncated || int64(len(buf)) < t.Size
+	if joined {
+		w.target.Requested += t.Requested
+	} else {
+		w.target, w.data = t, []byte{}
+	}
+	w.data = append(w.data, buf...)
+	w.target.Size = int64(len(w.data))
+	w.target.Truncated = truncated
+	w.last = t.Size
+	return nil
+}
+
+// continues reports whether t is the next piece of the buffered region.
+func (w *Window) continues(t Target) bool {
+	p := w.target
+	return w.data != nil && t.Kind == TargetMemory && p.Kind == TargetMemory &&
+		t.PID == p.PID && t.Path == p.Path && t.Perms == p.Perms &&
+		t.Address == p.Address+uint64(p.Size) && w.last == ChunkSize && !p.Truncated &&
+		p.Size+t.Size <= w.max
+}
+
+// Flush scans the buffered target.
+func (w *Window) Flush() error {
+	if w.data == nil {
+		return nil
+	}
+	t, data := w.target, w.data
+	w.target, w.data, w.last = Target{}, nil, 0
+	return w.scan(t, data)
+}
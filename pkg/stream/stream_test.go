@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTargets(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("data\tfile\t5\t/proc/1/root/etc/passwd\t0\t0\t5\nroot:")
+	buf.WriteString("data\tfile\t3\t/proc/4242/root/app/run.sh\t0\t0\t9\nsh\n")
+	buf.WriteString("proc\t77\tkworker\t0::/\n")
+	buf.WriteString("skip\t77\t7f00\t999999\t[heap]\n")
+	buf.WriteString("data\tmemory\t4\t[stack]\t77\t7ffd1000\trw-p\t00000000\t00:00:0\t4\n\x00\x01\x02\x03")
+	buf.WriteString("warn\tno running process found for container abc\n")
+
+	var targets []Target
+	var contents []string
+	var warnings []string
+	err := ReadTargets(&buf, func(tg Target, data io.Reader) error {
+		targets = append(targets, tg)
+		// Content left unread is skipped.
+		b := make([]byte, 2)
+		n, _ := io.ReadFull(data, b)
+		contents = append(contents, string(b[:n]))
+		return nil
+	}, func(w string) { warnings = append(warnings, w) })
+	require.NoError(t, err)
+
+	require.Len(t, targets, 3)
+	assert.Equal(t, "/etc/passwd", targets[0].Path)
+	assert.False(t, targets[0].Truncated)
+	assert.Equal(t, "ro", contents[0])
+	assert.Equal(t, "/app/run.sh", targets[1].Path)
+	assert.Equal(t, "sh", contents[1])
+	assert.True(t, targets[1].Truncated)
+	assert.Equal(t, int64(9), targets[1].Requested)
+	assert.Equal(t, Target{Kind: TargetMemory, Path: "[stack]", PID: 77, Process: "kworker", Cgroup: "0::/", Address: 0x7ffd1000, Perms: "rw-p", Inode: "00:00:0", Size: 4, Requested: 4}, targets[2])
+	assert.Equal(t, "pid 77 (kworker) [stack]", targets[2].String())
+	require.Len(t, warnings, 2)
+	assert.True(t, strings.HasPrefix(warnings[0], "skipped 999999 bytes region 7f00 [heap] of pid 77, it is larger"))
+
+	err = ReadTargets(strings.NewReader("data\tfile\t10\t/x\t0\t0\t10\nshort"), func(Target, io.Reader) error { return nil }, func(string) {})
+	assert.Error(t, err)
+}
+
+func TestWindow(t *testing.T) {
+	type scanned struct {
+		target Target
+		data   string
+	}
+	var got []scanned
+	w := NewWindow(ChunkSize+6, func(tg Target, data []byte) error {
+		got = append(got, scanned{tg, string(data)})
+		return nil
+	})
+
+	piece := Target{Kind: TargetMemory, PID: 7, Path: "[heap]", Perms: "rw-p", Address: 0x1000, Size: ChunkSize, Requested: ChunkSize}
+	first := strings.Repeat("a", ChunkSize)
+	require.NoError(t, w.Add(piece, strings.NewReader(first)))
+	piece.Address += ChunkSize
+	piece.Size, piece.Requested, piece.Truncated = 4, 8, true
+	require.NoError(t, w.Add(piece, strings.NewReader("bcde")))
+	// A new region, and a file larger than the window.
+	require.NoError(t, w.Add(Target{Kind: TargetMemory, PID: 7, Address: 0x9000000, Size: 2, Requested: 2}, strings.NewReader("fg")))
+	big := strings.Repeat("x", ChunkSize+10)
+	require.NoError(t, w.Add(Target{Kind: TargetFile, Path: "/big", Size: ChunkSize + 10, Requested: ChunkSize + 10}, strings.NewReader(big)))
+	require.NoError(t, w.Flush())
+	require.NoError(t, w.Flush())
+
+	require.Len(t, got, 3)
+	assert.Equal(t, uint64(0x1000), got[0].target.Address)
+	assert.Equal(t, int64(ChunkSize+4), got[0].target.Size)
+	assert.Equal(t, int64(ChunkSize+8), got[0].target.Requested)
+	assert.True(t, got[0].target.Truncated)
+	assert.Equal(t, first+"bcde", got[0].data)
+	assert.Equal(t, "fg", got[1].data)
+	assert.False(t, got[1].target.Truncated)
+	assert.Equal(t, int64(ChunkSize+6), got[2].target.Size)
+	assert.True(t, got[2].target.Truncated)
+}
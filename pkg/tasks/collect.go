@@ -0,0 +1,166 @@
+package tasks
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/evidence"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/state"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+// ExecuteCollect creates a task that runs a shell script inside the forensic pod
+// and hands the captured standard output to collect for parsing.
+func ExecuteCollect(s *state.State, podName, description, script string, collect func(output []byte) error) Task {
+	return Task{
+		Description: description,
+		Fn: func(s *state.State) error {
+			s.Logger.Debug(fmt.Sprintf("Collecting '%s' inside pod ", description), podName)
+
+			var stdout bytes.Buffer
+			if err := execScript(s, podName, script, &stdout); err != nil {
+				return err
+			}
+
+			if err := collect(stdout.Bytes()); err != nil {
+				return fmt.Errorf("failed to process output of '%s': %w", description, err)
+			}
+
+			s.Logger.Debug(fmt.Sprintf("'%s' collected successfully inside pod ", description), podName)
+			return nil
+		},
+		Retries: 1,
+		Timeout: 0,
+	}
+}
+
+// ExecuteStream creates a task that runs a shell script inside the forensic pod
+// and streams its standard output to w. It is used for binary payloads that
+// should not be buffered in memory.
+func ExecuteStream(s *state.State, podName, description, script string, w io.Writer) Task {
+	return Task{
+		Description: description,
+		Fn: func(s *state.State) error {
+			s.Logger.Debug(fmt.Sprintf("Streaming '%s' from pod ", description), podName)
+
+			if err := execScript(s, podName, script, w); err != nil {
+				return err
+			}
+
+			s.Logger.Debug(fmt.Sprintf("'%s' streamed successfully from pod ", description), podName)
+			return nil
+		},
+		Retries: 1,
+		Timeout: 0,
+	}
+}
+
+// execScript runs script with /bin/sh inside the forensic pod container.
+// Standard error is only logged since the scripts routinely hit unreadable
+// /proc entries of processes that exited while they were running.
+func execScript(s *state.State, podName, script string, stdout io.Writer) error {
+	clientset, err := kubernetes.NewForConfig(s.RESTConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes clientset: %w", err)
+	}
+
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace("default").
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: "disk-access",
+			Command:   []string{"/bin/sh", "-c", script},
+			Stdin:     false,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(s.RESTConfig, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	start := time.Now()
+	err = executor.StreamWithContext(s.Context, remotecommand.StreamOptions{
+		Stdout: stdout,
+		Stderr: &stderr,
+		Tty:    false,
+	})
+	if stderr.Len() > 0 {
+		s.Logger.Debug("Script error output: ", stderr.String())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute script in pod %s: %w", podName, err)
+	}
+
+	s.Logger.Debug(fmt.Sprintf("Script finished in %s inside pod ", time.Since(start).Round(time.Millisecond)), podName)
+	return nil
+}
+
+// AcquireEvidence creates a task that copies an artifact out of the forensic pod
+// into the evidence manifest. copyScript writes the artifact to standard output
+// and hashScript prints its SHA-256 inside the pod, so the local copy can be
+// verified against the original.
+func AcquireEvidence(s *state.State, podName string, manifest *evidence.Manifest, item evidence.Item, copyScript, hashScript string) Task {
+	return Task{
+		Description: fmt.Sprintf("Acquire %s", item.Source),
+		Fn: func(s *state.State) error {
+			s.Logger.Debug(fmt.Sprintf("Acquiring %s from pod ", item.Source), podName)
+
+			var remoteHash string
+			if hashScript != "" {
+				err := ExecuteCollect(s, podName, "hash "+item.Source, hashScript, func(output []byte) error {
+					remoteHash = strings.TrimSpace(string(output))
+					return nil
+				}).Fn(s)
+				if err != nil {
+					return err
+				}
+			}
+
+			node := item.Node
+			if node == "" {
+				node = podName
+			}
+			w, err := manifest.Create(item.Name, node, item.Source)
+			if err != nil {
+				return err
+			}
+			streamErr := execScript(s, podName, copyScript, w)
+			acquired, err := w.Close()
+			if streamErr != nil {
+				return streamErr
+			}
+			if err != nil {
+				return err
+			}
+
+			acquired.Description = item.Description
+			acquired.Metadata = item.Metadata
+			if remoteHash != "" {
+				acquired.Verified = remoteHash == acquired.SHA256
+				if !acquired.Verified {
+					s.Logger.Warnf("Hash mismatch for %s: %s inside the pod, %s locally", item.Source, remoteHash, acquired.SHA256)
+				}
+			}
+
+			if err := manifest.Record(acquired); err != nil {
+				return err
+			}
+
+			s.Logger.Infof("Acquired %s to %s (sha256 %s)", item.Source, acquired.Path, acquired.SHA256)
+			return nil
+		},
+		Retries: 1,
+		Timeout: 0,
+	}
+}
@@ -66,10 +66,20 @@ func (t Tasks) prepend(newtasks ...Task) Tasks {
 
 // This Commands is used to execute a command inside a pod and open tty session
 func ExecuteInteractive(s *state.State, podName, command string) Task {
+	return executeInteractive(fmt.Sprintf("Execute '%s' command inside pod", command), podName, strings.Split(command, " "))
+}
+
+// ExecuteInteractiveScript runs script with /bin/sh inside the forensic pod
+// attached to the terminal.
+func ExecuteInteractiveScript(s *state.State, podName, description, script string) Task {
+	return executeInteractive(description, podName, []string{"/bin/sh", "-c", script})
+}
+
+func executeInteractive(description, podName string, command []string) Task {
 	return Task{
-		Description: fmt.Sprintf("Execute '%s' command inside pod", command),
+		Description: description,
 		Fn: func(s *state.State) error {
-			s.Logger.Debug(fmt.Sprintf("Execute '%s' command inside pod ", command), podName)
+			s.Logger.Debug(description+" in pod ", podName)
 
 			clientset, err := kubernetes.NewForConfig(s.RESTConfig)
 			if err != nil {
@@ -91,7 +101,7 @@ func ExecuteInteractive(s *state.State, podName, command string) Task {
 				SubResource("exec").
 				VersionedParams(&corev1.PodExecOptions{
 					Container: "disk-access",
-					Command:   strings.Split(command, " "),
+					Command:   command,
 					Stdin:     true,
 					Stdout:    true,
 					Stderr:    true,
@@ -155,12 +165,31 @@ func ExecuteInteractive(s *state.State, podName, command string) Task {
 	}
 }
 
+// HostRoot is the host root filesystem as seen from the forensic pod. The pod
+// shares the host PID namespace, so the root of PID 1 is the node itself.
+const HostRoot = "/proc/1/root"
+
+// ForensicImage is the default image of the forensic pod. The collection
+// scripts only rely on its busybox, the few tools it lacks are shipped by the
+// image of build/forensic-pod, given with --image. Without them the affected
+// fields are reported unavailable, nothing is installed on a node.
+const ForensicImage = "alpine:3.21.2"
+
+// QuarantineTaintKey is the taint put on quarantined nodes, the forensic pod
+// tolerates it to keep collecting from them.
+const QuarantineTaintKey = "kubectl-foren.io/quarantine"
+
 func DeloyForenPod(s *state.State, podName string) Task {
 	return Task{
 		Description: "Deploy privileged pod on node",
 		Fn: func(s *state.State) error {
 			s.Logger.Debug("Deploying pod ", podName)
 
+			image := s.ForensicImage
+			if image == "" {
+				image = ForensicImage
+			}
+
 			pod := &corev1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      podName,
@@ -170,10 +199,17 @@ func DeloyForenPod(s *state.State, podName string) Task {
 					HostNetwork: true,
 					HostPID:     true,
 					NodeName:    podName,
+					// The forensic pod keeps running on quarantined nodes.
+					Tolerations: []corev1.Toleration{
+						{
+							Key:      QuarantineTaintKey,
+							Operator: corev1.TolerationOpExists,
+						},
+					},
 					Containers: []corev1.Container{
 						{
 							Name:    "disk-access",
-							Image:   "alpine:3.21.2", // use the appropriate image
+							Image:   image,
 							Command: []string{"/bin/sh", "-c", "sleep 3600"},
 							SecurityContext: &corev1.SecurityContext{
 								Privileged: BoolPtr(true),
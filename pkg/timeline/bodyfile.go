@@ -0,0 +1,178 @@
+// Package timeline collects file system metadata of a node in The Sleuth Kit
+// bodyfile format and renders bodyfiles into a MAC time timeline, the way
+// mactime does.
+package timeline
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/shell"
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/tasks"
+)
+
+// Record is a line of a TSK 3 bodyfile:
+// MD5|name|inode|mode_as_string|UID|GID|size|atime|mtime|ctime|crtime
+type Record struct {
+	MD5    string
+	Name   string
+	Inode  string
+	Mode   string
+	UID    int
+	GID    int
+	Size   int64
+	Atime  int64
+	Mtime  int64
+	Ctime  int64
+	Crtime int64
+}
+
+// String formats r as a bodyfile line without the trailing newline.
+func (r Record) String() string {
+	md5 := r.MD5
+	if md5 == "" {
+		md5 = "0"
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%d|%d|%d|%d|%d|%d|%d",
+		md5, r.Name, r.Inode, r.Mode, r.UID, r.GID, r.Size, r.Atime, r.Mtime, r.Ctime, r.Crtime)
+}
+
+// ParseRecord parses a bodyfile line. File names containing a pipe are
+// handled by counting the fields from both ends of the line.
+func ParseRecord(line string) (Record, error) {
+	fields := strings.Split(line, "|")
+	if len(fields) < 11 {
+		return Record{}, fmt.Errorf("expected 11 fields in bodyfile line, got %d", len(fields))
+	}
+	n := len(fields)
+	name := strings.Join(fields[1:n-9], "|")
+	tail := fields[n-9:]
+
+	r := Record{MD5: fields[0], Name: name, Inode: tail[0], Mode: tail[1]}
+	ints := []*int64{&r.Size, &r.Atime, &r.Mtime, &r.Ctime, &r.Crtime}
+	for i, dst := range ints {
+		v, err := strconv.ParseInt(tail[4+i], 10, 64)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid number %q in bodyfile line: %w", tail[4+i], err)
+		}
+		*dst = v
+	}
+	var err error
+	if r.UID, err = strconv.Atoi(tail[2]); err != nil {
+		return Record{}, fmt.Errorf("invalid uid %q in bodyfile line: %w", tail[2], err)
+	}
+	if r.GID, err = strconv.Atoi(tail[3]); err != nil {
+		return Record{}, fmt.Errorf("invalid gid %q in bodyfile line: %w", tail[3], err)
+	}
+
+	return r, nil
+}
+
+// ReadBodyfile reads all records of a bodyfile, skipping empty lines.
+func ReadBodyfile(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec, err := ParseRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, scanner.Err()
+}
+
+// CollectScript walks paths on the host and prints one stat line per entry.
+// Only GNU stat, shipped in the image of build/forensic-pod, reports the
+// birth time through statx. Without it the script warns that crtime is
+// unavailable and leaves it 0, which bodyfile readers treat as unknown. With md5 set the MD5 of every
+// regular file is printed as well.
+func CollectScript(paths []string, xdev, md5 bool) string {
+	var roots []string
+	for _, p := range paths {
+		roots = append(roots, tasks.HostRoot+path.Clean("/"+p))
+	}
+
+	findOpts := ""
+	if xdev {
+		findOpts = " -xdev"
+	}
+
+	script := `
+if stat --version 2>/dev/null | grep -q coreutils; then
+  fmt='stat|%i|%A|%u|%g|%s|%X|%Y|%Z|%W|%n'
+else
+  printf 'warn\tGNU stat is not available in the forensic pod image, crtime is unavailable and left 0\n'
+  fmt='stat|%i|%A|%u|%g|%s|%X|%Y|%Z|0|%n'
+fi
+find ` + shell.Join(roots) + findOpts + ` -exec stat -c "$fmt" {} + 2>/dev/null
+`
+	if md5 {
+		script += `find ` + shell.Join(roots) + findOpts + ` -type f -exec md5sum {} + 2>/dev/null | sed 's/^/md5|/'
+`
+	}
+
+	return script
+}
+
+// ParseCollect turns the output of CollectScript into bodyfile records with
+// host paths, and returns the warnings printed by the script.
+func ParseCollect(output []byte) ([]Record, []string) {
+	var records []Record
+	var warnings []string
+	md5s := map[string]string{}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "stat|"):
+			fields := strings.SplitN(line, "|", 11)
+			if len(fields) < 11 {
+				continue
+			}
+			r := Record{
+				Name:  strings.TrimPrefix(fields[10], tasks.HostRoot),
+				Inode: fields[1],
+				Mode:  fields[2],
+			}
+			r.UID, _ = strconv.Atoi(fields[3])
+			r.GID, _ = strconv.Atoi(fields[4])
+			r.Size, _ = strconv.ParseInt(fields[5], 10, 64)
+			r.Atime, _ = strconv.ParseInt(fields[6], 10, 64)
+			r.Mtime, _ = strconv.ParseInt(fields[7], 10, 64)
+			r.Ctime, _ = strconv.ParseInt(fields[8], 10, 64)
+			r.Crtime, _ = strconv.ParseInt(fields[9], 10, 64)
+			if r.Name == "" {
+				r.Name = "/"
+			}
+			records = append(records, r)
+		case strings.HasPrefix(line, "md5|"):
+			sum, name, ok := strings.Cut(strings.TrimPrefix(line, "md5|"), "  ")
+			if ok {
+				md5s[strings.TrimPrefix(name, tasks.HostRoot)] = sum
+			}
+		case strings.HasPrefix(line, "warn\t"):
+			warnings = append(warnings, strings.TrimPrefix(line, "warn\t"))
+		}
+	}
+
+	for i := range records {
+		if sum, ok := md5s[records[i].Name]; ok {
+			records[i].MD5 = sum
+		}
+	}
+
+	return records, warnings
+}
@@ -0,0 +1,119 @@
+package timeline
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Event is a point in time at which one or more of the MAC times of a file
+// were set. Activity holds the mactime style "macb" flags.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Size     int64     `json:"size"`
+	Activity string    `json:"activity"`
+	Mode     string    `json:"mode"`
+	UID      int       `json:"uid"`
+	GID      int       `json:"gid"`
+	Inode    string    `json:"inode"`
+	Name     string    `json:"name"`
+}
+
+// Render turns records into events sorted by time, keeping only events within
+// [since, until]. Zero bounds are open. Timestamps of 0 mean unknown and are
+// skipped.
+func Render(records []Record, since, until time.Time) []Event {
+	var events []Event
+
+	for _, r := range records {
+		stamps := map[int64][]byte{}
+		add := func(ts int64, flag byte, pos int) {
+			if ts <= 0 {
+				return
+			}
+			if stamps[ts] == nil {
+				stamps[ts] = []byte("....")
+			}
+			stamps[ts][pos] = flag
+		}
+		add(r.Mtime, 'm', 0)
+		add(r.Atime, 'a', 1)
+		add(r.Ctime, 'c', 2)
+		add(r.Crtime, 'b', 3)
+
+		for ts, activity := range stamps {
+			t := time.Unix(ts, 0).UTC()
+			if !since.IsZero() && t.Before(since) {
+				continue
+			}
+			if !until.IsZero() && t.After(until) {
+				continue
+			}
+			events = append(events, Event{
+				Time:     t,
+				Size:     r.Size,
+				Activity: string(activity),
+				Mode:     r.Mode,
+				UID:      r.UID,
+				GID:      r.GID,
+				Inode:    r.Inode,
+				Name:     r.Name,
+			})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].Time.Equal(events[j].Time) {
+			return events[i].Time.Before(events[j].Time)
+		}
+		return events[i].Name < events[j].Name
+	})
+
+	return events
+}
+
+// WriteCSV writes events in the comma separated layout of mactime -d.
+func WriteCSV(w io.Writer, events []Event) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Date", "Size", "Type", "Mode", "UID", "GID", "Meta", "File Name"}); err != nil {
+		return err
+	}
+	for _, e := range events {
+		err := cw.Write([]string{
+			e.Time.Format(time.RFC3339),
+			strconv.FormatInt(e.Size, 10),
+			e.Activity,
+			e.Mode,
+			strconv.Itoa(e.UID),
+			strconv.Itoa(e.GID),
+			e.Inode,
+			e.Name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteText writes events like mactime does, printing the date only on the
+// first event of each second.
+func WriteText(w io.Writer, events []Event) error {
+	var last time.Time
+	for _, e := range events {
+		date := ""
+		if !e.Time.Equal(last) {
+			date = e.Time.Format("Mon Jan 02 2006 15:04:05")
+			last = e.Time
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			date, e.Size, e.Activity, e.Mode, e.UID, e.GID, e.Inode, e.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
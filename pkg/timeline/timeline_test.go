@@ -0,0 +1,58 @@
+package timeline
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCollect(t *testing.T) {
+	output := []byte(`stat|1234|-rwxr-xr-x|0|0|100|1700000300|1700000100|1700000200|1700000000|/proc/1/root/usr/bin/odd|name
+stat|2|drwxr-xr-x|0|0|4096|1700000000|1700000000|1700000000|0|/proc/1/root
+md5|d41d8cd98f00b204e9800998ecf8427e  /proc/1/root/usr/bin/odd|name
+`)
+
+	records, warnings := ParseCollect(output)
+	assert.Empty(t, warnings)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "/usr/bin/odd|name", records[0].Name)
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", records[0].MD5)
+	assert.Equal(t, "/", records[1].Name)
+
+	line := records[0].String()
+	assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e|/usr/bin/odd|name|1234|-rwxr-xr-x|0|0|100|1700000300|1700000100|1700000200|1700000000", line)
+
+	parsed, err := ParseRecord(line)
+	assert.NoError(t, err)
+	assert.Equal(t, records[0], parsed)
+}
+
+func TestRender(t *testing.T) {
+	body := `0|/etc/passwd|10|-rw-r--r--|0|0|2000|1700000300|1700000100|1700000100|1700000000
+0|/tmp/x|11|-rwxr-xr-x|0|0|10|1700000200|1700000200|1700000200|0
+`
+	records, err := ReadBodyfile(strings.NewReader(body))
+	assert.NoError(t, err)
+
+	events := Render(records, time.Time{}, time.Time{})
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Name+" "+e.Activity)
+	}
+	assert.Equal(t, []string{
+		"/etc/passwd ...b",
+		"/etc/passwd m.c.",
+		"/tmp/x mac.",
+		"/etc/passwd .a..",
+	}, got)
+
+	events = Render(records, time.Unix(1700000150, 0), time.Unix(1700000250, 0))
+	assert.Len(t, events, 1)
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteCSV(&buf, events))
+	assert.Contains(t, buf.String(), "2023-11-14T22:16:40Z,10,mac.,-rwxr-xr-x,0,0,11,/tmp/x")
+}
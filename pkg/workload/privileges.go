@@ -0,0 +1,355 @@
+// Package workload inventories the privileges pods run with, grouped by the
+// workload owning them, to scope the attack surface of a cluster.
+package workload
+
+import (
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Checks of the inventory.
+const (
+	CheckPrivileged          = "privileged"
+	CheckHostPID             = "host-pid"
+	CheckHostNetwork         = "host-network"
+	CheckHostIPC             = "host-ipc"
+	CheckHostPath            = "host-path"
+	CheckCapabilities        = "capabilities"
+	CheckPrivilegeEscalation = "privilege-escalation"
+	CheckRoot                = "root"
+)
+
+// sensitivePaths are host paths whose mount gives control over the node.
+// Mounts of their parents are just as sensitive.
+var sensitivePaths = []string{
+	"/",
+	"/etc",
+	"/root",
+	"/proc",
+	"/sys",
+	"/dev",
+	"/boot",
+	"/var/run",
+	"/run",
+	"/var/lib/kubelet",
+	"/var/lib/etcd",
+	"/var/lib/docker",
+	"/var/lib/containerd",
+	"/var/lib/containers",
+	"/var/run/docker.sock",
+	"/run/containerd/containerd.sock",
+	"/var/run/containerd/containerd.sock",
+	"/var/run/crio/crio.sock",
+	"/run/crio/crio.sock",
+	"/var/run/cri-dockerd.sock",
+}
+
+// sensitiveTrees are sensitive paths whose children are sensitive too, such as
+// /etc/kubernetes/pki or /var/lib/kubelet/pki.
+var sensitiveTrees = []string{
+	"/etc",
+	"/root",
+	"/proc",
+	"/boot",
+	"/var/lib/kubelet",
+	"/var/lib/etcd",
+	"/var/lib/docker",
+	"/var/lib/containerd",
+	"/var/lib/containers",
+}
+
+// harmlessPaths are files below sensitive trees that workloads commonly mount
+// and that give nothing away.
+var harmlessPaths = []string{
+	"/etc/localtime",
+	"/etc/timezone",
+}
+
+// dangerousCapabilities allow escaping the container or taking over the node.
+var dangerousCapabilities = map[string]bool{
+	"ALL":             true,
+	"SYS_ADMIN":       true,
+	"SYS_MODULE":      true,
+	"SYS_PTRACE":      true,
+	"SYS_RAWIO":       true,
+	"SYS_BOOT":        true,
+	"DAC_READ_SEARCH": true,
+	"DAC_OVERRIDE":    true,
+	"NET_ADMIN":       true,
+	"BPF":             true,
+	"PERFMON":         true,
+}
+
+// Finding is a privilege of a pod or of one of its containers.
+type Finding struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	// Container is empty for privileges of the whole pod.
+	Container string `json:"container,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Inspect returns the privileges of a pod, pod level first, then per
+// container in the order of the spec.
+func Inspect(pod *corev1.Pod) []Finding {
+	var findings []Finding
+	if pod.Spec.HostPID {
+		findings = append(findings, Finding{Severity: severity.High, Check: CheckHostPID})
+	}
+	if pod.Spec.HostNetwork {
+		findings = append(findings, Finding{Severity: severity.Medium, Check: CheckHostNetwork})
+	}
+	if pod.Spec.HostIPC {
+		findings = append(findings, Finding{Severity: severity.Medium, Check: CheckHostIPC})
+	}
+
+	hostPaths := map[string]*corev1.HostPathVolumeSource{}
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil {
+			hostPaths[v.Name] = v.HostPath
+		}
+	}
+
+	for _, c := range containers(pod) {
+		findings = append(findings, inspectContainer(c.name, c.mounts, c.securityContext, pod.Spec.SecurityContext, hostPaths)...)
+	}
+	return findings
+}
+
+type container struct {
+	name            string
+	mounts          []corev1.VolumeMount
+	securityContext *corev1.SecurityContext
+}
+
+func containers(pod *corev1.Pod) []container {
+	var result []container
+	for _, c := range pod.Spec.InitContainers {
+		result = append(result, container{c.Name, c.VolumeMounts, c.SecurityContext})
+	}
+	for _, c := range pod.Spec.Containers {
+		result = append(result, container{c.Name, c.VolumeMounts, c.SecurityContext})
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		result = append(result, container{c.Name, c.VolumeMounts, c.SecurityContext})
+	}
+	return result
+}
+
+func inspectContainer(name string, mounts []corev1.VolumeMount, sc *corev1.SecurityContext, podContext *corev1.PodSecurityContext, hostPaths map[string]*corev1.HostPathVolumeSource) []Finding {
+	var findings []Finding
+	add := func(level, check, detail string) {
+		findings = append(findings, Finding{Severity: level, Check: check, Container: name, Detail: detail})
+	}
+
+	privileged := sc != nil && sc.Privileged != nil && *sc.Privileged
+	if privileged {
+		add(severity.High, CheckPrivileged, "")
+	}
+
+	for _, m := range mounts {
+		hp, ok := hostPaths[m.Name]
+		if !ok {
+			continue
+		}
+		level := severity.Medium
+		if isSensitivePath(hp.Path) {
+			level = severity.High
+		}
+		detail := hp.Path + " on " + m.MountPath
+		if m.ReadOnly {
+			detail += " (read-only)"
+		}
+		add(level, CheckHostPath, detail)
+	}
+
+	if sc != nil && sc.Capabilities != nil && len(sc.Capabilities.Add) > 0 {
+		level := severity.Medium
+		var caps []string
+		for _, c := range sc.Capabilities.Add {
+			name := strings.TrimPrefix(strings.ToUpper(string(c)), "CAP_")
+			if dangerousCapabilities[name] {
+				level = severity.High
+			}
+			caps = append(caps, name)
+		}
+		add(level, CheckCapabilities, strings.Join(caps, ","))
+	}
+
+	// Privileged containers can escalate anyway, they are reported once.
+	if !privileged {
+		switch {
+		case sc == nil || sc.AllowPrivilegeEscalation == nil:
+			add(severity.Low, CheckPrivilegeEscalation, "not disabled")
+		case *sc.AllowPrivilegeEscalation:
+			add(severity.Medium, CheckPrivilegeEscalation, "allowed")
+		}
+	}
+
+	var (
+		runAsUser    *int64
+		runAsNonRoot *bool
+	)
+	if podContext != nil {
+		runAsUser, runAsNonRoot = podContext.RunAsUser, podContext.RunAsNonRoot
+	}
+	if sc != nil && sc.RunAsUser != nil {
+		runAsUser = sc.RunAsUser
+	}
+	if sc != nil && sc.RunAsNonRoot != nil {
+		runAsNonRoot = sc.RunAsNonRoot
+	}
+	switch {
+	case runAsUser != nil && *runAsUser == 0:
+		add(severity.Medium, CheckRoot, "runAsUser 0")
+	case runAsUser == nil && (runAsNonRoot == nil || !*runAsNonRoot):
+		add(severity.Low, CheckRoot, "user of the image, runAsNonRoot not set")
+	}
+
+	return findings
+}
+
+// isSensitivePath reports whether p is, or is a parent of, a sensitive path or
+// lies below a sensitive tree.
+func isSensitivePath(p string) bool {
+	p = path.Clean(p)
+	for _, s := range sensitivePaths {
+		if p == s || p == "/" || strings.HasPrefix(s, p+"/") {
+			return true
+		}
+	}
+	if slices.Contains(harmlessPaths, p) {
+		return false
+	}
+	for _, s := range sensitiveTrees {
+		if strings.HasPrefix(p, s+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Owner identifies the workload a pod belongs to.
+type Owner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// String returns the owner as Kind/name.
+func (o Owner) String() string {
+	return o.Kind + "/" + o.Name
+}
+
+// OwnerIndex resolves pods to the top level workload owning them, e.g. the
+// Deployment of their ReplicaSet or the CronJob of their Job.
+type OwnerIndex struct {
+	owners map[string]Owner
+}
+
+// NewOwnerIndex indexes the controllers of ReplicaSets and Jobs.
+func NewOwnerIndex(replicaSets []appsv1.ReplicaSet, jobs []batchv1.Job) *OwnerIndex {
+	idx := &OwnerIndex{owners: map[string]Owner{}}
+	for i := range replicaSets {
+		if owner := metav1.GetControllerOf(&replicaSets[i]); owner != nil {
+			idx.owners[ownerKey("ReplicaSet", replicaSets[i].Namespace, replicaSets[i].Name)] = Owner{Kind: owner.Kind, Name: owner.Name}
+		}
+	}
+	for i := range jobs {
+		if owner := metav1.GetControllerOf(&jobs[i]); owner != nil {
+			idx.owners[ownerKey("Job", jobs[i].Namespace, jobs[i].Name)] = Owner{Kind: owner.Kind, Name: owner.Name}
+		}
+	}
+	return idx
+}
+
+func ownerKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// Owner returns the workload owning pod, the pod itself when it has no
+// controller.
+func (idx *OwnerIndex) Owner(pod *corev1.Pod) Owner {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return Owner{Kind: "Pod", Name: pod.Name}
+	}
+	if owner, ok := idx.owners[ownerKey(ref.Kind, pod.Namespace, ref.Name)]; ok {
+		return owner
+	}
+	return Owner{Kind: ref.Kind, Name: ref.Name}
+}
+
+// Workload is the privileges of the pods of a workload. Pods of the same
+// workload share their spec, so findings are merged across them.
+type Workload struct {
+	Namespace string    `json:"namespace"`
+	Owner     Owner     `json:"owner"`
+	Severity  string    `json:"severity"`
+	Pods      []string  `json:"pods"`
+	Nodes     []string  `json:"nodes"`
+	Findings  []Finding `json:"findings"`
+}
+
+// Group inspects pods and groups those with findings of at least
+// minSeverity by namespace and owner.
+func Group(pods []corev1.Pod, idx *OwnerIndex, minSeverity string) []Workload {
+	workloads := map[string]*Workload{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		var findings []Finding
+		for _, f := range Inspect(pod) {
+			if severity.Rank(f.Severity) >= severity.Rank(minSeverity) {
+				findings = append(findings, f)
+			}
+		}
+		if len(findings) == 0 {
+			continue
+		}
+
+		owner := idx.Owner(pod)
+		key := pod.Namespace + "/" + owner.String()
+		w, ok := workloads[key]
+		if !ok {
+			w = &Workload{Namespace: pod.Namespace, Owner: owner}
+			workloads[key] = w
+		}
+		w.Pods = append(w.Pods, pod.Name)
+		if pod.Spec.NodeName != "" && !slices.Contains(w.Nodes, pod.Spec.NodeName) {
+			w.Nodes = append(w.Nodes, pod.Spec.NodeName)
+		}
+		for _, f := range findings {
+			if !slices.Contains(w.Findings, f) {
+				w.Findings = append(w.Findings, f)
+			}
+			if severity.Rank(f.Severity) > severity.Rank(w.Severity) {
+				w.Severity = f.Severity
+			}
+		}
+	}
+
+	result := make([]Workload, 0, len(workloads))
+	for _, w := range workloads {
+		sort.Strings(w.Pods)
+		sort.Strings(w.Nodes)
+		result = append(result, *w)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Owner.String() < result[j].Owner.String()
+	})
+	return result
+}
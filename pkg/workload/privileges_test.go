@@ -0,0 +1,113 @@
+package workload
+
+import (
+	"testing"
+
+	"github.com/mohamed-rafraf/kubectl-foren/pkg/severity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInspect(t *testing.T) {
+	yes, no := true, false
+	root := int64(0)
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		HostPID: true,
+		Volumes: []corev1.Volume{
+			{Name: "sock", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/run/containerd/containerd.sock"}}},
+			{Name: "logs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/log/app"}}},
+			{Name: "varlib", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/lib/"}}},
+		},
+		SecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: &yes},
+		Containers: []corev1.Container{
+			{
+				Name: "agent",
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: "sock", MountPath: "/run/containerd.sock"},
+					{Name: "logs", MountPath: "/logs", ReadOnly: true},
+					{Name: "varlib", MountPath: "/host"},
+				},
+				SecurityContext: &corev1.SecurityContext{
+					Capabilities:             &corev1.Capabilities{Add: []corev1.Capability{"NET_BIND_SERVICE", "CAP_SYS_ADMIN"}},
+					AllowPrivilegeEscalation: &no,
+				},
+			},
+			{
+				Name:            "debug",
+				SecurityContext: &corev1.SecurityContext{Privileged: &yes, RunAsUser: &root},
+			},
+		},
+	}}
+
+	assert.Equal(t, []Finding{
+		{Severity: severity.High, Check: CheckHostPID},
+		{Severity: severity.High, Check: CheckHostPath, Container: "agent", Detail: "/run/containerd/containerd.sock on /run/containerd.sock"},
+		{Severity: severity.Medium, Check: CheckHostPath, Container: "agent", Detail: "/var/log/app on /logs (read-only)"},
+		{Severity: severity.High, Check: CheckHostPath, Container: "agent", Detail: "/var/lib/ on /host"},
+		{Severity: severity.High, Check: CheckCapabilities, Container: "agent", Detail: "NET_BIND_SERVICE,SYS_ADMIN"},
+		{Severity: severity.High, Check: CheckPrivileged, Container: "debug"},
+		{Severity: severity.Medium, Check: CheckRoot, Container: "debug", Detail: "runAsUser 0"},
+	}, Inspect(pod))
+}
+
+func TestGroup(t *testing.T) {
+	isController := true
+	rs := appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "monitoring",
+		Name:      "exporter-7c9",
+		OwnerReferences: []metav1.OwnerReference{
+			{Kind: "Deployment", Name: "exporter", Controller: &isController},
+		},
+	}}
+	newPod := func(namespace, name, node, owner string, spec corev1.PodSpec) corev1.Pod {
+		pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+		pod.Spec.NodeName = node
+		if owner != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner, Controller: &isController}}
+		}
+		return pod
+	}
+	pods := []corev1.Pod{
+		newPod("monitoring", "exporter-7c9-b", "worker-2", "exporter-7c9", corev1.PodSpec{HostNetwork: true, Containers: []corev1.Container{{Name: "exporter"}}}),
+		newPod("monitoring", "exporter-7c9-a", "worker-1", "exporter-7c9", corev1.PodSpec{HostNetwork: true, Containers: []corev1.Container{{Name: "exporter"}}}),
+		newPod("default", "shell", "worker-1", "", corev1.PodSpec{HostIPC: true}),
+		newPod("default", "web", "worker-1", "", corev1.PodSpec{Containers: []corev1.Container{{Name: "web"}}}),
+	}
+
+	workloads := Group(pods, NewOwnerIndex([]appsv1.ReplicaSet{rs}, nil), severity.Medium)
+	require.Len(t, workloads, 2)
+
+	assert.Equal(t, "default", workloads[0].Namespace)
+	assert.Equal(t, Owner{Kind: "Pod", Name: "shell"}, workloads[0].Owner)
+
+	exporter := workloads[1]
+	assert.Equal(t, Owner{Kind: "Deployment", Name: "exporter"}, exporter.Owner)
+	assert.Equal(t, severity.Medium, exporter.Severity)
+	assert.Equal(t, []string{"exporter-7c9-a", "exporter-7c9-b"}, exporter.Pods)
+	assert.Equal(t, []string{"worker-1", "worker-2"}, exporter.Nodes)
+	assert.Equal(t, []Finding{{Severity: severity.Medium, Check: CheckHostNetwork}}, exporter.Findings)
+
+	// With low findings the pods running with defaults are reported as well.
+	// Without the ReplicaSet its pods are grouped under it.
+	workloads = Group(pods, NewOwnerIndex(nil, nil), severity.Low)
+	require.Len(t, workloads, 3)
+	assert.Equal(t, Owner{Kind: "Pod", Name: "web"}, workloads[1].Owner)
+	assert.Equal(t, Owner{Kind: "ReplicaSet", Name: "exporter-7c9"}, workloads[2].Owner)
+}
+
+func TestIsSensitivePath(t *testing.T) {
+	assert.True(t, isSensitivePath("/"))
+	assert.True(t, isSensitivePath("/var/run/"))
+	assert.True(t, isSensitivePath("/var"))
+	assert.False(t, isSensitivePath("/var/log"))
+	assert.False(t, isSensitivePath("/data"))
+
+	for _, p := range []string{"/etc/kubernetes", "/etc/kubernetes/pki", "/var/lib/kubelet/pki", "/var/lib/etcd", "/var/lib/etcd/member", "/proc/sys"} {
+		assert.True(t, isSensitivePath(p), p)
+	}
+	assert.False(t, isSensitivePath("/etc/localtime"))
+	assert.False(t, isSensitivePath("/var/lib/etcdbackup"))
+}
@@ -0,0 +1,243 @@
+package yara
+
+import (
+	"encoding/binary"
+)
+
+// expr is a node of a rule condition. eval returns the value of the node and
+// whether it is defined; YARA treats undefined values, like the offset of a
+// string that did not match, as false in boolean context.
+type expr interface {
+	eval(ctx *scanContext) (int64, bool)
+}
+
+func truth(ctx *scanContext, e expr) bool {
+	v, ok := e.eval(ctx)
+	return ok && v != 0
+}
+
+func boolValue(b bool) (int64, bool) {
+	if b {
+		return 1, true
+	}
+	return 0, true
+}
+
+type intLit int64
+
+func (e intLit) eval(*scanContext) (int64, bool) { return int64(e), true }
+
+type filesizeExpr struct{}
+
+func (filesizeExpr) eval(ctx *scanContext) (int64, bool) { return int64(len(ctx.data)), true }
+
+type ruleRef string
+
+func (e ruleRef) eval(ctx *scanContext) (int64, bool) { return boolValue(ctx.results[string(e)]) }
+
+type stringMatch struct{ s *stringDef }
+
+func (e stringMatch) eval(ctx *scanContext) (int64, bool) { return boolValue(len(ctx.hits(e.s)) > 0) }
+
+type stringCount struct{ s *stringDef }
+
+func (e stringCount) eval(ctx *scanContext) (int64, bool) { return int64(len(ctx.hits(e.s))), true }
+
+// stringOffset is @a[i] and stringLength is !a[i], i counting from 1.
+type stringOffset struct {
+	s      *stringDef
+	index  expr
+	length bool
+}
+
+func (e stringOffset) eval(ctx *scanContext) (int64, bool) {
+	i, ok := e.index.eval(ctx)
+	hits := ctx.hits(e.s)
+	if !ok || i < 1 || i > int64(len(hits)) {
+		return 0, false
+	}
+	if e.length {
+		return int64(hits[i-1].length), true
+	}
+	return int64(hits[i-1].offset), true
+}
+
+// stringAt is "$a at offset", or "$a in (lo..hi)" when hi is set.
+type stringAt struct {
+	s      *stringDef
+	lo, hi expr
+}
+
+func (e stringAt) eval(ctx *scanContext) (int64, bool) {
+	lo, ok := e.lo.eval(ctx)
+	if !ok {
+		return 0, false
+	}
+	hi := lo
+	if e.hi != nil {
+		if hi, ok = e.hi.eval(ctx); !ok {
+			return 0, false
+		}
+	}
+	for _, h := range ctx.hits(e.s) {
+		if int64(h.offset) >= lo && int64(h.offset) <= hi {
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// ofExpr is "N of (...)"; a nil count means any, all is set for all and none
+// for none.
+type ofExpr struct {
+	count     expr
+	all, none bool
+	set       []*stringDef
+}
+
+func (e ofExpr) eval(ctx *scanContext) (int64, bool) {
+	matched := 0
+	for _, s := range e.set {
+		if len(ctx.hits(s)) > 0 {
+			matched++
+		}
+	}
+	switch {
+	case e.all:
+		return boolValue(matched == len(e.set))
+	case e.none:
+		return boolValue(matched == 0)
+	case e.count == nil:
+		return boolValue(matched > 0)
+	}
+	n, ok := e.count.eval(ctx)
+	if !ok {
+		return 0, false
+	}
+	return boolValue(int64(matched) >= n)
+}
+
+// intRead is one of the uint8, uint16, uint32, int8, ... functions reading an
+// integer from the scanned data.
+type intRead struct {
+	offset    expr
+	size      int
+	signed    bool
+	bigEndian bool
+}
+
+func (e intRead) eval(ctx *scanContext) (int64, bool) {
+	off, ok := e.offset.eval(ctx)
+	if !ok || off < 0 || off+int64(e.size) > int64(len(ctx.data)) {
+		return 0, false
+	}
+	b := ctx.data[off : off+int64(e.size)]
+	var order binary.ByteOrder = binary.LittleEndian
+	if e.bigEndian {
+		order = binary.BigEndian
+	}
+	switch e.size {
+	case 1:
+		if e.signed {
+			return int64(int8(b[0])), true
+		}
+		return int64(b[0]), true
+	case 2:
+		if e.signed {
+			return int64(int16(order.Uint16(b))), true
+		}
+		return int64(order.Uint16(b)), true
+	default:
+		if e.signed {
+			return int64(int32(order.Uint32(b))), true
+		}
+		return int64(order.Uint32(b)), true
+	}
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+func (e unaryExpr) eval(ctx *scanContext) (int64, bool) {
+	if e.op == "not" {
+		return boolValue(!truth(ctx, e.x))
+	}
+	v, ok := e.x.eval(ctx)
+	if !ok {
+		return 0, false
+	}
+	if e.op == "-" {
+		return -v, true
+	}
+	return ^v, true
+}
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+func (e binaryExpr) eval(ctx *scanContext) (int64, bool) {
+	switch e.op {
+	case "and":
+		return boolValue(truth(ctx, e.l) && truth(ctx, e.r))
+	case "or":
+		return boolValue(truth(ctx, e.l) || truth(ctx, e.r))
+	}
+
+	l, ok := e.l.eval(ctx)
+	if !ok {
+		return 0, false
+	}
+	r, ok := e.r.eval(ctx)
+	if !ok {
+		return 0, false
+	}
+	switch e.op {
+	case "==":
+		return boolValue(l == r)
+	case "!=":
+		return boolValue(l != r)
+	case "<":
+		return boolValue(l < r)
+	case "<=":
+		return boolValue(l <= r)
+	case ">":
+		return boolValue(l > r)
+	case ">=":
+		return boolValue(l >= r)
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "\\", "%":
+		if r == 0 {
+			return 0, false
+		}
+		if e.op == "%" {
+			return l % r, true
+		}
+		return l / r, true
+	case "&":
+		return l & r, true
+	case "|":
+		return l | r, true
+	case "^":
+		return l ^ r, true
+	case "<<":
+		if r < 0 || r > 63 {
+			return 0, true
+		}
+		return l << uint(r), true
+	case ">>":
+		if r < 0 || r > 63 {
+			return 0, true
+		}
+		return l >> uint(r), true
+	}
+	return 0, false
+}
@@ -0,0 +1,260 @@
+package yara
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type hexKind int
+
+// maxJump bounds how far a jump reaches, as YARA does: unbounded jumps such as
+// [-] or [4-] span at most maxJump bytes past their minimum and wider ranges
+// are rejected, so matching a hex string costs at most a few hundred steps per
+// candidate offset of the scanned window.
+const maxJump = 200
+
+const (
+	hexByte hexKind = iota
+	hexJump
+	hexAlt
+)
+
+// hexNode is an element of a hex string: a byte with a nibble mask, a jump
+// over a range of bytes or a group of alternatives.
+type hexNode struct {
+	kind        hexKind
+	value, mask byte
+	not         bool
+	min, max    int
+	alts        [][]hexNode
+}
+
+func (n hexNode) matches(b byte) bool {
+	return (b&n.mask == n.value) != n.not
+}
+
+// hexPattern is a compiled hex string.
+type hexPattern struct {
+	seq    []hexNode
+	prefix []byte
+}
+
+// parseHex compiles the body of a hex string such as
+// "4D 5A ?? [2-4] ( 90 | CC ) ~00".
+func parseHex(body string) (*hexPattern, error) {
+	h := &hexParser{src: body}
+	seq, err := h.seq(0)
+	if err != nil {
+		return nil, err
+	}
+	h.skipSpace()
+	if h.pos < len(h.src) {
+		return nil, fmt.Errorf("unexpected %q in hex string", h.src[h.pos])
+	}
+	if len(seq) == 0 {
+		return nil, fmt.Errorf("empty hex string")
+	}
+	if seq[0].kind == hexJump || seq[len(seq)-1].kind == hexJump {
+		return nil, fmt.Errorf("hex string can not start or end with a jump")
+	}
+
+	p := &hexPattern{seq: seq}
+	for _, n := range seq {
+		if n.kind != hexByte || n.mask != 0xff || n.not {
+			break
+		}
+		p.prefix = append(p.prefix, n.value)
+	}
+	return p, nil
+}
+
+type hexParser struct {
+	src string
+	pos int
+}
+
+func (h *hexParser) skipSpace() {
+	for h.pos < len(h.src) && strings.ContainsRune(" \t\r\n", rune(h.src[h.pos])) {
+		h.pos++
+	}
+}
+
+func (h *hexParser) seq(depth int) ([]hexNode, error) {
+	var seq []hexNode
+	for {
+		h.skipSpace()
+		if h.pos >= len(h.src) {
+			return seq, nil
+		}
+		switch c := h.src[h.pos]; {
+		case c == '|' || c == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("unexpected %q in hex string", c)
+			}
+			return seq, nil
+		case c == '(':
+			h.pos++
+			node := hexNode{kind: hexAlt}
+			for {
+				alt, err := h.seq(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				if len(alt) == 0 {
+					return nil, fmt.Errorf("empty alternative in hex string")
+				}
+				node.alts = append(node.alts, alt)
+				if h.pos >= len(h.src) {
+					return nil, fmt.Errorf("unterminated alternative in hex string")
+				}
+				h.pos++
+				if h.src[h.pos-1] == ')' {
+					break
+				}
+			}
+			seq = append(seq, node)
+		case c == '[':
+			node, err := h.jump()
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, node)
+		default:
+			node, err := h.byte()
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, node)
+		}
+	}
+}
+
+func (h *hexParser) jump() (hexNode, error) {
+	end := strings.IndexByte(h.src[h.pos:], ']')
+	if end < 0 {
+		return hexNode{}, fmt.Errorf("unterminated jump in hex string")
+	}
+	spec := strings.TrimSpace(h.src[h.pos+1 : h.pos+end])
+	h.pos += end + 1
+
+	node := hexNode{kind: hexJump}
+	lo, hi, isRange := strings.Cut(spec, "-")
+	lo, hi = strings.TrimSpace(lo), strings.TrimSpace(hi)
+	var err error
+	if lo != "" {
+		if node.min, err = strconv.Atoi(lo); err != nil || node.min < 0 {
+			return hexNode{}, fmt.Errorf("invalid jump [%s] in hex string", spec)
+		}
+	}
+	switch {
+	case !isRange:
+		if lo == "" {
+			return hexNode{}, fmt.Errorf("invalid jump [%s] in hex string", spec)
+		}
+		node.max = node.min
+	case hi != "":
+		if node.max, err = strconv.Atoi(hi); err != nil || node.max < node.min {
+			return hexNode{}, fmt.Errorf("invalid jump [%s] in hex string", spec)
+		}
+		if node.max-node.min > maxJump {
+			return hexNode{}, fmt.Errorf("jump [%s] in hex string spans more than %d bytes", spec, maxJump)
+		}
+	default:
+		node.max = node.min + maxJump
+	}
+	return node, nil
+}
+
+func (h *hexParser) byte() (hexNode, error) {
+	node := hexNode{kind: hexByte}
+	if h.src[h.pos] == '~' {
+		node.not = true
+		h.pos++
+	}
+	if h.pos+2 > len(h.src) {
+		return hexNode{}, fmt.Errorf("incomplete byte in hex string")
+	}
+	for i, c := range []byte(h.src[h.pos : h.pos+2]) {
+		shift := 4 * (1 - i)
+		if c == '?' {
+			continue
+		}
+		v, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			return hexNode{}, fmt.Errorf("invalid byte %q in hex string", h.src[h.pos:h.pos+2])
+		}
+		node.value |= byte(v) << shift
+		node.mask |= 0xf << shift
+	}
+	if node.not && node.mask == 0 {
+		return hexNode{}, fmt.Errorf("~?? in hex string matches nothing")
+	}
+	h.pos += 2
+	return node, nil
+}
+
+// find returns the matches of the pattern in data, at most limit of them.
+func (p *hexPattern) find(data []byte, limit int) []hit {
+	var hits []hit
+	for start := 0; start < len(data) && len(hits) < limit; start++ {
+		if len(p.prefix) > 0 {
+			i := bytes.Index(data[start:], p.prefix)
+			if i < 0 {
+				break
+			}
+			start += i
+		}
+		matchHexSeq(p.seq, data, start, func(end int) bool {
+			hits = append(hits, hit{offset: start, length: end - start})
+			return true
+		})
+	}
+	return hits
+}
+
+// matchHexSeq matches seq at pos and calls k with the end of every way to
+// match it, until k returns true. Jumps are tried shortest first.
+func matchHexSeq(seq []hexNode, data []byte, pos int, k func(end int) bool) bool {
+	for len(seq) > 0 && seq[0].kind == hexByte {
+		if pos >= len(data) || !seq[0].matches(data[pos]) {
+			return false
+		}
+		seq = seq[1:]
+		pos++
+	}
+	if len(seq) == 0 {
+		return k(pos)
+	}
+
+	n, rest := seq[0], seq[1:]
+	switch n.kind {
+	case hexJump:
+		max := n.max
+		if pos+max > len(data) {
+			max = len(data) - pos
+		}
+		for j := n.min; j <= max; j++ {
+			if r := rest[0]; r.kind == hexByte && r.mask == 0xff && !r.not && pos+j < len(data) {
+				// Skip straight to the next occurrence of the byte
+				// following the jump.
+				i := bytes.IndexByte(data[pos+j:min(pos+max+1, len(data))], r.value)
+				if i < 0 {
+					break
+				}
+				j += i
+			}
+			if matchHexSeq(rest, data, pos+j, k) {
+				return true
+			}
+		}
+	case hexAlt:
+		for _, alt := range n.alts {
+			if matchHexSeq(alt, data, pos, func(end int) bool { return matchHexSeq(rest, data, end, k) }) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package yara
+
+import "github.com/mohamed-rafraf/kubectl-foren/pkg/stream"
+
+// Hit is a rule match on a scan target.
+type Hit struct {
+	stream.Target
+	Pod string `json:"pod,omitempty"`
+	Match
+}
+
+// NewHits turns the matches of a target into hits. Offsets of memory targets
+// are turned into virtual addresses.
+func NewHits(t stream.Target, pod string, matches []Match) []Hit {
+	var hits []Hit
+	for _, m := range matches {
+		if t.Kind == stream.TargetMemory {
+			strs := make([]StringMatch, len(m.Strings))
+			for i, s := range m.Strings {
+				s.Offset += int64(t.Address)
+				strs[i] = s
+			}
+			m.Strings = strs
+		}
+		hits = append(hits, Hit{Target: t, Pod: pod, Match: m})
+	}
+	return hits
+}
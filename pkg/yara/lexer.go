@@ -0,0 +1,282 @@
+package yara
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokText
+	tokRegex
+	tokInt
+	tokStringID
+	tokStringCount
+	tokStringOffset
+	tokStringLength
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	n    int64
+	line int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokText:
+		return strconv.Quote(t.text)
+	case tokRegex:
+		return "/" + t.text + "/"
+	case tokInt:
+		return strconv.FormatInt(t.n, 10)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexer splits rule source into tokens. It works on demand, so the parser can
+// read the body of a hex string raw right after its opening brace.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", l.line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips white space and comments.
+func (l *lexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf("unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) ident() string {
+	start := l.pos
+	for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+		l.pos++
+	}
+	return l.src[start:l.pos]
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+
+	c := l.src[l.pos]
+	tok := token{line: l.line}
+	switch {
+	case c == '"':
+		text, err := l.text()
+		if err != nil {
+			return token{}, err
+		}
+		tok.kind, tok.text = tokText, text
+	case c == '/':
+		re, err := l.regex()
+		if err != nil {
+			return token{}, err
+		}
+		tok.kind, tok.text = tokRegex, re
+	case isDigit(c):
+		n, err := l.number()
+		if err != nil {
+			return token{}, err
+		}
+		tok.kind, tok.n = tokInt, n
+	case c == '$' || c == '#' || c == '@' || (c == '!' && l.pos+1 < len(l.src) && isIdentChar(l.src[l.pos+1])):
+		l.pos++
+		tok.kind = map[byte]tokenKind{'$': tokStringID, '#': tokStringCount, '@': tokStringOffset, '!': tokStringLength}[c]
+		tok.text = "$" + l.ident()
+		if c == '$' && l.pos < len(l.src) && l.src[l.pos] == '*' {
+			tok.text += "*"
+			l.pos++
+		}
+	case isIdentChar(c):
+		tok.kind, tok.text = tokIdent, l.ident()
+	default:
+		tok.kind = tokPunct
+		for _, p := range []string{"..", "<=", ">=", "==", "!=", "<<", ">>"} {
+			if strings.HasPrefix(l.src[l.pos:], p) {
+				tok.text = p
+				l.pos += len(p)
+				return tok, nil
+			}
+		}
+		if !strings.ContainsRune("{}()[]:=,<>+-*\\%&|^~", rune(c)) {
+			return token{}, l.errorf("unexpected character %q", c)
+		}
+		tok.text = string(c)
+		l.pos++
+	}
+
+	return tok, nil
+}
+
+// text reads a double quoted string, decoding the escapes YARA supports.
+func (l *lexer) text() (string, error) {
+	var b strings.Builder
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return b.String(), nil
+		case '\n':
+			return "", l.errorf("unterminated string")
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return "", l.errorf("unterminated string")
+			}
+			l.pos++
+			switch e := l.src[l.pos]; e {
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'x':
+				if l.pos+2 >= len(l.src) {
+					return "", l.errorf("invalid \\x escape")
+				}
+				v, err := strconv.ParseUint(l.src[l.pos+1:l.pos+3], 16, 8)
+				if err != nil {
+					return "", l.errorf("invalid \\x escape %q", l.src[l.pos-1:l.pos+3])
+				}
+				b.WriteByte(byte(v))
+				l.pos += 2
+			default:
+				return "", l.errorf("unknown escape \\%c", e)
+			}
+			l.pos++
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return "", l.errorf("unterminated string")
+}
+
+// regex reads /pattern/flags and returns it in Go syntax, the i and s flags
+// turned into a flag group.
+func (l *lexer) regex() (string, error) {
+	start := l.pos + 1
+	l.pos++
+	for l.pos < len(l.src) && l.src[l.pos] != '/' {
+		switch l.src[l.pos] {
+		case '\\':
+			l.pos++
+		case '\n':
+			return "", l.errorf("unterminated regular expression")
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.src) {
+		return "", l.errorf("unterminated regular expression")
+	}
+	pattern := strings.ReplaceAll(l.src[start:l.pos], `\/`, `/`)
+	l.pos++
+
+	flags := ""
+	for l.pos < len(l.src) && (l.src[l.pos] == 'i' || l.src[l.pos] == 's') {
+		if !strings.ContainsRune(flags, rune(l.src[l.pos])) {
+			flags += string(l.src[l.pos])
+		}
+		l.pos++
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	return pattern, nil
+}
+
+// number reads a decimal or 0x prefixed hex integer with an optional KB or MB
+// multiplier.
+func (l *lexer) number() (int64, error) {
+	start := l.pos
+	base := 10
+	if strings.HasPrefix(l.src[l.pos:], "0x") {
+		base = 16
+		l.pos += 2
+	}
+	digits := l.pos
+	for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+		l.pos++
+	}
+	word := l.src[digits:l.pos]
+
+	mult := int64(1)
+	if base == 10 {
+		switch {
+		case strings.HasSuffix(word, "KB"):
+			mult, word = 1024, strings.TrimSuffix(word, "KB")
+		case strings.HasSuffix(word, "MB"):
+			mult, word = 1024*1024, strings.TrimSuffix(word, "MB")
+		}
+	}
+	n, err := strconv.ParseInt(word, base, 64)
+	if err != nil {
+		return 0, l.errorf("invalid number %q", l.src[start:l.pos])
+	}
+	return n * mult, nil
+}
+
+// hexBody returns the raw content of a hex string up to its closing brace. The
+// opening brace has already been consumed.
+func (l *lexer) hexBody() (string, error) {
+	end := strings.IndexByte(l.src[l.pos:], '}')
+	if end < 0 {
+		return "", l.errorf("unterminated hex string")
+	}
+	body := l.src[l.pos : l.pos+end]
+	l.line += strings.Count(body, "\n")
+	l.pos += end + 1
+	return body, nil
+}
@@ -0,0 +1,531 @@
+package yara
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var keywords = []string{
+	"all", "and", "any", "ascii", "at", "condition", "false", "filesize", "for", "fullword",
+	"global", "import", "in", "include", "meta", "nocase", "none", "not", "of", "or",
+	"private", "rule", "strings", "them", "true", "wide",
+}
+
+var intFunctions = map[string]intRead{
+	"uint8": {size: 1}, "uint16": {size: 2}, "uint32": {size: 4},
+	"int8": {size: 1, signed: true}, "int16": {size: 2, signed: true}, "int32": {size: 4, signed: true},
+	"uint16be": {size: 2, bigEndian: true}, "uint32be": {size: 4, bigEndian: true},
+	"int16be": {size: 2, signed: true, bigEndian: true}, "int32be": {size: 4, signed: true, bigEndian: true},
+}
+
+type parser struct {
+	lex     *lexer
+	tok     token
+	rules   *Rules
+	rule    *Rule
+	strings map[string]*stringDef
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.tok.line, fmt.Sprintf(format, args...))
+}
+
+// is tells whether the current token is the keyword or punctuation text.
+func (p *parser) is(texts ...string) bool {
+	if p.tok.kind != tokIdent && p.tok.kind != tokPunct {
+		return false
+	}
+	return slices.Contains(texts, p.tok.text)
+}
+
+func (p *parser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("expected %q, got %s", text, p.tok)
+	}
+	return p.advance()
+}
+
+func (p *parser) ident() (string, error) {
+	if p.tok.kind != tokIdent || slices.Contains(keywords, p.tok.text) {
+		return "", p.errorf("expected identifier, got %s", p.tok)
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+func (p *parser) parseFile() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	for p.tok.kind != tokEOF {
+		if p.is("import", "include") {
+			return p.errorf("%s is not supported", p.tok.text)
+		}
+		if err := p.parseRule(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseRule() error {
+	r := &Rule{Meta: map[string]string{}}
+	p.rule = r
+	p.strings = map[string]*stringDef{}
+
+	for p.is("private", "global") {
+		if p.tok.text == "private" {
+			r.private = true
+		} else {
+			r.global = true
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("rule"); err != nil {
+		return err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if p.rules.names[name] {
+		return p.errorf("duplicate rule %s", name)
+	}
+	r.Name = name
+
+	if p.is(":") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		for p.tok.kind == tokIdent {
+			tag, err := p.ident()
+			if err != nil {
+				return err
+			}
+			r.Tags = append(r.Tags, tag)
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+
+	if p.is("meta") {
+		if err := p.parseMeta(); err != nil {
+			return err
+		}
+	}
+	if p.is("strings") {
+		if err := p.parseStrings(); err != nil {
+			return err
+		}
+	}
+	if err := p.expect("condition"); err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	if r.condition, err = p.parseOr(); err != nil {
+		return err
+	}
+	if err := p.expect("}"); err != nil {
+		return err
+	}
+
+	p.rules.rules = append(p.rules.rules, r)
+	p.rules.names[name] = true
+	return nil
+}
+
+func (p *parser) parseMeta() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	for p.tok.kind == tokIdent && !p.is("strings", "condition") {
+		key := p.tok.text
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+
+		negative := p.is("-")
+		if negative {
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case p.tok.kind == tokText && !negative:
+			p.rule.Meta[key] = p.tok.text
+		case p.tok.kind == tokInt:
+			n := p.tok.n
+			if negative {
+				n = -n
+			}
+			p.rule.Meta[key] = strconv.FormatInt(n, 10)
+		case p.is("true", "false") && !negative:
+			p.rule.Meta[key] = p.tok.text
+		default:
+			return p.errorf("invalid value %s for meta %s", p.tok, key)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseStrings() error {
+	if err := p.advance(); err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	for p.tok.kind == tokStringID {
+		s := &stringDef{id: p.tok.text}
+		if strings.HasSuffix(s.id, "*") {
+			return p.errorf("invalid string identifier %s", s.id)
+		}
+		if _, dup := p.strings[s.id]; dup && s.id != "$" {
+			return p.errorf("duplicate string identifier %s", s.id)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.expect("="); err != nil {
+			return err
+		}
+
+		var pattern string
+		switch {
+		case p.tok.kind == tokText:
+			s.kind, s.text = textString, []byte(p.tok.text)
+			if len(s.text) == 0 {
+				return p.errorf("empty string %s", s.id)
+			}
+		case p.tok.kind == tokRegex:
+			s.kind, pattern = regexString, p.tok.text
+		case p.is("{"):
+			body, err := p.lex.hexBody()
+			if err != nil {
+				return err
+			}
+			s.kind = hexString
+			if s.hex, err = parseHex(body); err != nil {
+				return p.errorf("%s: %v", s.id, err)
+			}
+		default:
+			return p.errorf("expected string, regular expression or hex string for %s, got %s", s.id, p.tok)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+
+		if err := p.parseModifiers(s); err != nil {
+			return err
+		}
+		if s.kind == regexString {
+			if s.nocase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return p.errorf("invalid regular expression %s: %v", s.id, err)
+			}
+			s.re = re
+		}
+
+		p.rule.strings = append(p.rule.strings, s)
+		p.strings[s.id] = s
+	}
+	return nil
+}
+
+func (p *parser) parseModifiers(s *stringDef) error {
+	for p.tok.kind == tokIdent {
+		switch p.tok.text {
+		case "nocase":
+			s.nocase = true
+		case "wide":
+			s.wide = true
+		case "ascii":
+			s.ascii = true
+		case "fullword":
+			s.fullword = true
+		case "private":
+			s.private = true
+		case "xor", "base64", "base64wide":
+			return p.errorf("modifier %s is not supported", p.tok.text)
+		default:
+			return nil
+		}
+		if s.kind == hexString && p.tok.text != "private" {
+			return p.errorf("modifier %s can not be used with hex string %s", p.tok.text, s.id)
+		}
+		if s.kind == regexString && p.tok.text == "wide" {
+			return p.errorf("modifier wide is not supported for regular expression %s", s.id)
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// binary parses a left associative level of binary operators.
+func (p *parser) binary(next func() (expr, error), ops ...string) (expr, error) {
+	l, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.is(ops...) {
+		op := p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		r, err := next()
+		if err != nil {
+			return nil, err
+		}
+		l = binaryExpr{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseOr() (expr, error)  { return p.binary(p.parseAnd, "or") }
+func (p *parser) parseAnd() (expr, error) { return p.binary(p.parseNot, "and") }
+
+func (p *parser) parseNot() (expr, error) {
+	if !p.is("not") {
+		return p.binary(p.parseBitOr, "==", "!=", "<", "<=", ">", ">=")
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return unaryExpr{op: "not", x: x}, nil
+}
+
+func (p *parser) parseBitOr() (expr, error)  { return p.binary(p.parseBitXor, "|") }
+func (p *parser) parseBitXor() (expr, error) { return p.binary(p.parseBitAnd, "^") }
+func (p *parser) parseBitAnd() (expr, error) { return p.binary(p.parseShift, "&") }
+func (p *parser) parseShift() (expr, error)  { return p.binary(p.parseAdd, "<<", ">>") }
+func (p *parser) parseAdd() (expr, error)    { return p.binary(p.parseMul, "+", "-") }
+func (p *parser) parseMul() (expr, error)    { return p.binary(p.parseUnary, "*", "\\", "%") }
+
+func (p *parser) parseUnary() (expr, error) {
+	if !p.is("-", "~") {
+		return p.parsePrimary()
+	}
+	op := p.tok.text
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return unaryExpr{op: op, x: x}, nil
+}
+
+func (p *parser) parsePrimary() (expr, error) {
+	tok := p.tok
+	switch {
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+
+	case p.is("true", "false"):
+		return intLit(map[bool]int64{true: 1}[tok.text == "true"]), p.advance()
+
+	case p.is("filesize"):
+		return filesizeExpr{}, p.advance()
+
+	case p.is("any", "all", "none"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return p.parseOf(ofExpr{all: tok.text == "all", none: tok.text == "none"})
+
+	case tok.kind == tokInt:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is("of") {
+			return p.parseOf(ofExpr{count: intLit(tok.n)})
+		}
+		return intLit(tok.n), nil
+
+	case tok.kind == tokStringID:
+		s, err := p.stringRef()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case p.is("at"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			at, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return stringAt{s: s, lo: at}, nil
+		case p.is("in"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			lo, err := p.parseAdd()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(".."); err != nil {
+				return nil, err
+			}
+			hi, err := p.parseAdd()
+			if err != nil {
+				return nil, err
+			}
+			return stringAt{s: s, lo: lo, hi: hi}, p.expect(")")
+		}
+		return stringMatch{s: s}, nil
+
+	case tok.kind == tokStringCount:
+		s, err := p.stringRef()
+		if err != nil {
+			return nil, err
+		}
+		return stringCount{s: s}, nil
+
+	case tok.kind == tokStringOffset || tok.kind == tokStringLength:
+		s, err := p.stringRef()
+		if err != nil {
+			return nil, err
+		}
+		e := stringOffset{s: s, index: intLit(1), length: tok.kind == tokStringLength}
+		if p.is("[") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if e.index, err = p.parseOr(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		}
+		return e, nil
+
+	case tok.kind == tokIdent:
+		if read, ok := intFunctions[tok.text]; ok {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			offset, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			read.offset = offset
+			return read, p.expect(")")
+		}
+		if p.rules.names[tok.text] {
+			return ruleRef(tok.text), p.advance()
+		}
+		if tok.text == "for" {
+			return nil, p.errorf("for expressions are not supported")
+		}
+		return nil, p.errorf("undefined identifier %s", tok.text)
+	}
+
+	return nil, p.errorf("unexpected %s in condition", tok)
+}
+
+// stringRef resolves the string named by the current $a, #a, @a or !a token.
+func (p *parser) stringRef() (*stringDef, error) {
+	id := p.tok.text
+	s, ok := p.strings[id]
+	if !ok || id == "$" || strings.HasSuffix(id, "*") {
+		return nil, p.errorf("undefined string identifier %s", id)
+	}
+	return s, p.advance()
+}
+
+// parseOf parses the "of them" or "of ($a, $b*)" part of an of expression.
+func (p *parser) parseOf(e ofExpr) (expr, error) {
+	if err := p.expect("of"); err != nil {
+		return nil, err
+	}
+
+	if p.is("them") {
+		e.set = p.rule.strings
+		if len(e.set) == 0 {
+			return nil, p.errorf("rule %s has no strings", p.rule.Name)
+		}
+		return e, p.advance()
+	}
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		if p.tok.kind != tokStringID {
+			return nil, p.errorf("expected string identifier, got %s", p.tok)
+		}
+		id := p.tok.text
+		n := len(e.set)
+		for _, s := range p.rule.strings {
+			prefix, wildcard := strings.CutSuffix(id, "*")
+			if s.id == id || wildcard && strings.HasPrefix(s.id, prefix) && !slices.Contains(e.set, s) {
+				e.set = append(e.set, s)
+			}
+		}
+		if len(e.set) == n {
+			return nil, p.errorf("undefined string identifier %s", id)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if !p.is(",") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return e, p.expect(")")
+}
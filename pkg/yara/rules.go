@@ -0,0 +1,263 @@
+// Package yara is a small pattern matching engine understanding a useful
+// subset of the YARA rule language, so rules can be evaluated locally against
+// data streamed out of a node without a YARA binary in the forensic image.
+//
+// Supported are text strings with the nocase, wide, ascii, fullword and
+// private modifiers, hex strings with wildcards, nibble masks, negation, jumps
+// and alternatives, and regular expressions in RE2 syntax. Regular expressions
+// match bytes above 0x7f only through wildcards; use hex strings for binary
+// patterns. Conditions support boolean and arithmetic operators, string
+// counts, offsets and lengths, "at" and "in", "any/all/none/N of", filesize,
+// the uintN and intN functions and references to earlier rules. Modules,
+// includes and for loops are not supported.
+package yara
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// maxHits is the number of matches recorded per string and scanned data, and
+// maxReported the number of them included in a Match.
+const (
+	maxHits     = 10000
+	maxReported = 8
+)
+
+type stringKind int
+
+const (
+	textString stringKind = iota
+	hexString
+	regexString
+)
+
+type stringDef struct {
+	id                                     string
+	kind                                   stringKind
+	text                                   []byte
+	hex                                    *hexPattern
+	re                                     *regexp.Regexp
+	nocase, wide, ascii, fullword, private bool
+}
+
+type hit struct {
+	offset, length int
+}
+
+// Rule is a compiled rule.
+type Rule struct {
+	Name      string
+	Tags      []string
+	Meta      map[string]string
+	private   bool
+	global    bool
+	strings   []*stringDef
+	condition expr
+}
+
+// Rules is a set of compiled rules.
+type Rules struct {
+	rules []*Rule
+	names map[string]bool
+}
+
+// Match is a rule that matched scanned data.
+type Match struct {
+	Rule    string            `json:"rule"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Strings []StringMatch     `json:"strings,omitempty"`
+}
+
+// StringMatch is an occurrence of a string of a matching rule.
+type StringMatch struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Data   string `json:"data"`
+}
+
+// Compile parses rule source.
+func Compile(src string) (*Rules, error) {
+	rs := &Rules{names: map[string]bool{}}
+	if err := rs.add(src); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Load compiles rule files. Rules may refer to rules of earlier files.
+func Load(paths ...string) (*Rules, error) {
+	rs := &Rules{names: map[string]bool{}}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules: %w", err)
+		}
+		if err := rs.add(string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return rs, nil
+}
+
+func (rs *Rules) add(src string) error {
+	p := &parser{lex: &lexer{src: src, line: 1}, rules: rs}
+	return p.parseFile()
+}
+
+// Len returns the number of rules.
+func (rs *Rules) Len() int {
+	return len(rs.rules)
+}
+
+// Scan evaluates all rules against data and returns the matching ones, except
+// private rules. When a global rule does not match, nothing matches.
+func (rs *Rules) Scan(data []byte) []Match {
+	ctx := &scanContext{data: data, cache: map[*stringDef][]hit{}, results: map[string]bool{}}
+
+	var matches []Match
+	for _, r := range rs.rules {
+		matched := truth(ctx, r.condition)
+		ctx.results[r.Name] = matched
+		if r.global && !matched {
+			return nil
+		}
+		if !matched || r.private {
+			continue
+		}
+
+		m := Match{Rule: r.Name, Tags: r.Tags}
+		if len(r.Meta) > 0 {
+			m.Meta = r.Meta
+		}
+		for _, s := range r.strings {
+			if s.private {
+				continue
+			}
+			for i, h := range ctx.hits(s) {
+				if i == maxReported {
+					break
+				}
+				m.Strings = append(m.Strings, StringMatch{ID: s.id, Offset: int64(h.offset), Data: excerpt(data[h.offset : h.offset+h.length])})
+			}
+		}
+		matches = append(matches, m)
+	}
+
+	return matches
+}
+
+func excerpt(b []byte) string {
+	const max = 32
+	if len(b) > max {
+		return strconv.Quote(string(b[:max])) + "..."
+	}
+	return strconv.Quote(string(b))
+}
+
+type scanContext struct {
+	data    []byte
+	lower   []byte
+	cache   map[*stringDef][]hit
+	results map[string]bool
+}
+
+// hits returns the matches of s, searching for them on first use.
+func (ctx *scanContext) hits(s *stringDef) []hit {
+	if h, ok := ctx.cache[s]; ok {
+		return h
+	}
+
+	var hits []hit
+	switch s.kind {
+	case hexString:
+		hits = s.hex.find(ctx.data, maxHits)
+	case regexString:
+		for _, loc := range s.re.FindAllIndex(ctx.data, maxHits) {
+			if loc[1] > loc[0] && (!s.fullword || isWord(ctx.data, loc[0], loc[1], 1)) {
+				hits = append(hits, hit{offset: loc[0], length: loc[1] - loc[0]})
+			}
+		}
+	case textString:
+		hits = ctx.findText(s)
+	}
+
+	ctx.cache[s] = hits
+	return hits
+}
+
+func (ctx *scanContext) findText(s *stringDef) []hit {
+	haystack, needle := ctx.data, s.text
+	if s.nocase {
+		if ctx.lower == nil {
+			ctx.lower = asciiLower(ctx.data)
+		}
+		haystack, needle = ctx.lower, asciiLower(needle)
+	}
+
+	type variant struct {
+		pattern []byte
+		width   int
+	}
+	var variants []variant
+	if s.ascii || !s.wide {
+		variants = append(variants, variant{needle, 1})
+	}
+	if s.wide {
+		wide := make([]byte, 0, 2*len(needle))
+		for _, b := range needle {
+			wide = append(wide, b, 0)
+		}
+		variants = append(variants, variant{wide, 2})
+	}
+
+	var hits []hit
+	for _, v := range variants {
+		for start := 0; len(hits) < maxHits; start++ {
+			i := bytes.Index(haystack[start:], v.pattern)
+			if i < 0 {
+				break
+			}
+			start += i
+			end := start + len(v.pattern)
+			if !s.fullword || isWord(ctx.data, start, end, v.width) {
+				hits = append(hits, hit{offset: start, length: len(v.pattern)})
+			}
+		}
+	}
+	if len(variants) > 1 {
+		sort.Slice(hits, func(i, j int) bool { return hits[i].offset < hits[j].offset })
+	}
+	return hits
+}
+
+// isWord tells whether data[start:end] is delimited by non alphanumeric
+// characters, width being 2 for wide strings.
+func isWord(data []byte, start, end, width int) bool {
+	alnum := func(b byte) bool {
+		return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+	}
+	if start >= width && alnum(data[start-width]) {
+		return false
+	}
+	if end < len(data) && alnum(data[end]) {
+		return false
+	}
+	return true
+}
+
+func asciiLower(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return out
+}
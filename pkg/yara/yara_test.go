@@ -0,0 +1,192 @@
+package yara
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func matchedRules(t *testing.T, src string, data []byte) []string {
+	t.Helper()
+	rs, err := Compile(src)
+	require.NoError(t, err)
+	var names []string
+	for _, m := range rs.Scan(data) {
+		names = append(names, m.Rule)
+	}
+	return names
+}
+
+func TestTextStrings(t *testing.T) {
+	src := `
+rule plain_text { strings: $a = "xmrig" condition: $a }
+rule nocase_text { strings: $a = "STRATUM+TCP" nocase condition: $a }
+rule wide_text { strings: $a = "cmd" wide condition: $a }
+rule asciiwide_text { strings: $a = "cmd" wide ascii condition: #a == 2 }
+rule fullword_text { strings: $a = "sh" fullword condition: $a }
+rule escaped_text { strings: $a = "a\tb\x00c\"" condition: $a }
+`
+	data := []byte("run xmrig -o stratum+tcp://pool c\x00m\x00d\x00 cmd bash a\tb\x00c\"")
+	assert.Equal(t, []string{"plain_text", "nocase_text", "wide_text", "asciiwide_text", "escaped_text"}, matchedRules(t, src, data))
+	assert.Equal(t, []string{"fullword_text"}, matchedRules(t, `rule fullword_text { strings: $a = "sh" fullword condition: $a }`, []byte("/bin/sh -c")))
+}
+
+func TestHexStrings(t *testing.T) {
+	tests := []struct {
+		hex   string
+		data  []byte
+		match bool
+	}{
+		{"4D 5A", []byte("xxMZ"), true},
+		{"4D ?? 90", []byte{0x4d, 0x11, 0x90}, true},
+		{"4? 5A", []byte{0x41, 0x5a}, true},
+		{"4? 5A", []byte{0x51, 0x5a}, false},
+		{"7F 45 [2] 46", []byte{0x7f, 0x45, 0, 0, 0x46}, true},
+		{"7F 45 [2] 46", []byte{0x7f, 0x45, 0, 0x46}, false},
+		{"7F [1-3] 46", []byte{0x7f, 0, 0, 0, 0x46}, true},
+		{"7F [1-3] 46", []byte{0x7f, 0, 0, 0, 0, 0x46}, false},
+		{"7F [-] 46", []byte{0x7f, 0, 0, 0, 0, 0, 0x46}, true},
+		{"7F [-] 46", append(append([]byte{0x7f}, make([]byte, 200)...), 0x46), true},
+		{"7F [-] 46", append(append([]byte{0x7f}, make([]byte, 201)...), 0x46), false},
+		{"7F [2-] 46", append(append([]byte{0x7f}, make([]byte, 202)...), 0x46), true},
+		{"01 ( 02 | 03 04 ) 05", []byte{1, 3, 4, 5}, true},
+		{"01 ( 02 | 03 04 ) 05", []byte{1, 3, 5}, false},
+		{"01 ( 02 ( 0A | 0B ) | 03 ) 05", []byte{1, 2, 0xb, 5}, true},
+		{"01 ~02 03", []byte{1, 9, 3}, true},
+		{"01 ~02 03", []byte{1, 2, 3}, false},
+		{"?? 02", []byte{9, 2}, true},
+	}
+	for _, tc := range tests {
+		names := matchedRules(t, "rule h { strings: $h = { "+tc.hex+" } condition: $h }", tc.data)
+		assert.Equal(t, tc.match, len(names) == 1, "%s on % x", tc.hex, tc.data)
+	}
+}
+
+func TestHexJumpsOnLargeBuffer(t *testing.T) {
+	// MZ every 64 KiB and no zero byte but the last one: without a bound on
+	// the jump every MZ would try every end offset up to the end of the buffer.
+	data := bytes.Repeat([]byte{0xff}, 16<<20)
+	for i := 0; i < len(data); i += 64 << 10 {
+		copy(data[i:], "MZ")
+	}
+	data[len(data)-1] = 0
+	copy(data[len(data)-100:], "MZ")
+
+	rules, err := Compile(`rule mz { strings: $h = { 4D 5A [-] 00 } condition: $h }`)
+	require.NoError(t, err)
+	matches := rules.Scan(data)
+	require.Len(t, matches, 1)
+	require.Len(t, matches[0].Strings, 1)
+	assert.Equal(t, int64(len(data)-100), matches[0].Strings[0].Offset)
+}
+
+func TestRegexStrings(t *testing.T) {
+	src := `
+rule re { strings: $r = /stratum\+tcp:\/\/[a-z.]+:\d+/ condition: $r }
+rule re_nocase { strings: $r = /POOL/i condition: $r }
+rule re_modifier { strings: $r = /POOL/ nocase condition: $r }
+`
+	data := []byte("connect stratum+tcp://pool.example:3333 now")
+	assert.Equal(t, []string{"re", "re_nocase", "re_modifier"}, matchedRules(t, src, data))
+}
+
+func TestConditions(t *testing.T) {
+	data := []byte("MZ..ab..ab..ab..c")
+	tests := []struct {
+		condition string
+		match     bool
+	}{
+		{"$a and $b", true},
+		{"$a and not $b", false},
+		{"#a == 3", true},
+		{"#a > 3 or $x1", true},
+		{"@a[2] == 8", true},
+		{"@a[4] == 8", false},
+		{"!a == 2", true},
+		{"$a at 4", true},
+		{"$a at 5", false},
+		{"$b in (10..20)", true},
+		{"$b in (0..10)", false},
+		{"any of them", true},
+		{"all of them", false},
+		{"none of them", false},
+		{"2 of ($a, $x*)", true},
+		{"3 of ($a, $x*)", false},
+		{"all of ($x*)", false},
+		{"filesize < 1KB and filesize == 17", true},
+		{"uint16(0) == 0x5A4D", true},
+		{"uint16be(0) == 0x4D5A", true},
+		{"uint32(100) == 0 or true", true},
+		{"not (uint32(100) == 0)", true},
+		{"(#a + 1) * 2 == 8 and #a \\ 2 == 1 and #a % 2 == 1", true},
+		{"(#a & 1) == 1 and (1 << 4) == 16 and -#a == -3 and ~0 == -1", true},
+		{"base", true},
+	}
+	for _, tc := range tests {
+		src := `
+private rule base { condition: filesize > 0 }
+rule r {
+  strings:
+    $a = "ab"
+    $b = "c"
+    $x1 = "MZ"
+    $x2 = "zz"
+  condition:
+    ` + tc.condition + `
+}`
+		names := matchedRules(t, src, data)
+		assert.Equal(t, tc.match, len(names) == 1, tc.condition)
+	}
+}
+
+func TestGlobalAndMeta(t *testing.T) {
+	src := `
+global rule small { condition: filesize < 10 }
+rule tagged : miner linux {
+  meta:
+    author = "ir team"
+    score = 80
+    enabled = true
+  strings:
+    $a = "xmr" private
+    $b = "pool"
+  condition:
+    $a and $b
+}`
+	rs, err := Compile(src)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rs.Len())
+	assert.Empty(t, rs.Scan([]byte("xmr pool, but too large")))
+
+	matches := rs.Scan([]byte("xmr pool"))
+	require.Len(t, matches, 2)
+	assert.Equal(t, "tagged", matches[1].Rule)
+	assert.Equal(t, []string{"miner", "linux"}, matches[1].Tags)
+	assert.Equal(t, map[string]string{"author": "ir team", "score": "80", "enabled": "true"}, matches[1].Meta)
+	assert.Equal(t, []StringMatch{{ID: "$b", Offset: 4, Data: `"pool"`}}, matches[1].Strings)
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]string{
+		`import "pe"`: "import is not supported",
+		`rule a { condition: true } rule a { condition: true }`:         "duplicate rule a",
+		`rule a { strings: $a = "x" condition: $b }`:                    "undefined string identifier $b",
+		`rule a { strings: $a = "x" $a = "y" condition: $a }`:           "duplicate string identifier $a",
+		`rule a { strings: $a = { 4D 5 } condition: $a }`:               "hex string",
+		`rule a { strings: $a = { [2] 4D } condition: $a }`:             "can not start or end with a jump",
+		`rule a { strings: $a = { 4D [0-201] 5A } condition: $a }`:      "spans more than 200 bytes",
+		`rule a { strings: $a = "x" xor condition: $a }`:                "modifier xor is not supported",
+		`rule a { strings: $a = /(/ condition: $a }`:                    "invalid regular expression",
+		`rule a { condition: b }`:                                       "undefined identifier b",
+		"rule a {\n condition:\n  true and\n}":                          "line 4",
+		`rule a { strings: $a = "x" condition: for any of them : ($) }`: "for expressions are not supported",
+	}
+	for src, want := range tests {
+		_, err := Compile(src)
+		if assert.Error(t, err, src) {
+			assert.Contains(t, err.Error(), want, src)
+		}
+	}
+}